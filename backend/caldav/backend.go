@@ -0,0 +1,363 @@
+package caldav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"meerkat/logger"
+	"meerkat/models"
+	"meerkat/services"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/caldav"
+	"gorm.io/gorm"
+)
+
+// contextKey is a custom type for context keys to avoid collisions
+type contextKey string
+
+const (
+	userIDKey   contextKey = "userID"
+	usernameKey contextKey = "username"
+	dbKey       contextKey = "db"
+)
+
+// The two calendars every user has
+const (
+	birthdaysCalendar = "birthdays"
+	remindersCalendar = "reminders"
+)
+
+// Object name prefixes within the calendars
+const (
+	birthdayContactPrefix      = "birthday-contact-"
+	birthdayRelationshipPrefix = "birthday-relationship-"
+	anniversaryContactPrefix   = "anniversary-contact-"
+	reminderPrefix             = "reminder-"
+)
+
+// Backend implements the caldav.Backend interface. Birthdays and anniversaries are served as
+// read-only yearly events, reminders as tasks that can be completed, edited or deleted.
+type Backend struct {
+	db *gorm.DB
+}
+
+// NewBackend creates a new CalDAV backend
+func NewBackend(db *gorm.DB) *Backend {
+	return &Backend{db: db}
+}
+
+// ContextWithUser adds user info to context for the backend
+func ContextWithUser(ctx context.Context, userID uint, username string, db *gorm.DB) context.Context {
+	ctx = context.WithValue(ctx, userIDKey, userID)
+	ctx = context.WithValue(ctx, usernameKey, username)
+	ctx = context.WithValue(ctx, dbKey, db)
+	return ctx
+}
+
+func (b *Backend) getUserID(ctx context.Context) (uint, error) {
+	userID, ok := ctx.Value(userIDKey).(uint)
+	if !ok {
+		return 0, fmt.Errorf("user not authenticated")
+	}
+	return userID, nil
+}
+
+func (b *Backend) getUsername(ctx context.Context) string {
+	username, _ := ctx.Value(usernameKey).(string)
+	return username
+}
+
+func (b *Backend) getDB(ctx context.Context) *gorm.DB {
+	if db, ok := ctx.Value(dbKey).(*gorm.DB); ok {
+		return db
+	}
+	return b.db
+}
+
+// CurrentUserPrincipal returns the current user's principal URL
+func (b *Backend) CurrentUserPrincipal(ctx context.Context) (string, error) {
+	username := b.getUsername(ctx)
+	if username == "" {
+		return "", fmt.Errorf("user not authenticated")
+	}
+	return "/caldav/principals/" + username + "/", nil
+}
+
+// CalendarHomeSetPath returns the path to the calendar home set
+func (b *Backend) CalendarHomeSetPath(ctx context.Context) (string, error) {
+	username := b.getUsername(ctx)
+	if username == "" {
+		return "", fmt.Errorf("user not authenticated")
+	}
+	return "/caldav/calendars/" + username + "/", nil
+}
+
+// calendarPath returns the path of one of the user's calendars
+func (b *Backend) calendarPath(ctx context.Context, name string) string {
+	return "/caldav/calendars/" + b.getUsername(ctx) + "/" + name + "/"
+}
+
+func (b *Backend) calendar(ctx context.Context, name string) *caldav.Calendar {
+	if name == birthdaysCalendar {
+		return &caldav.Calendar{
+			Path:                  b.calendarPath(ctx, birthdaysCalendar),
+			Name:                  "Birthdays",
+			Description:           "Birthdays and anniversaries of your contacts",
+			SupportedComponentSet: []string{ical.CompEvent},
+		}
+	}
+	return &caldav.Calendar{
+		Path:                  b.calendarPath(ctx, remindersCalendar),
+		Name:                  "Reminders",
+		Description:           "Reminders from Meerkat CRM",
+		SupportedComponentSet: []string{ical.CompToDo},
+	}
+}
+
+// calendarFromPath returns the name of the calendar a calendar or object path belongs to
+func (b *Backend) calendarFromPath(ctx context.Context, urlPath string) (string, error) {
+	for _, name := range []string{birthdaysCalendar, remindersCalendar} {
+		if strings.HasPrefix(urlPath, b.calendarPath(ctx, name)) || urlPath+"/" == b.calendarPath(ctx, name) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("calendar not found")
+}
+
+// CreateCalendar is not supported: the calendars are derived from Meerkat's data
+func (b *Backend) CreateCalendar(ctx context.Context, calendar *caldav.Calendar) error {
+	return webdav.NewHTTPError(http.StatusForbidden, fmt.Errorf("creating calendars is not supported"))
+}
+
+// ListCalendars returns the birthdays and reminders calendars
+func (b *Backend) ListCalendars(ctx context.Context) ([]caldav.Calendar, error) {
+	if b.getUsername(ctx) == "" {
+		return nil, fmt.Errorf("user not authenticated")
+	}
+	return []caldav.Calendar{*b.calendar(ctx, birthdaysCalendar), *b.calendar(ctx, remindersCalendar)}, nil
+}
+
+// GetCalendar returns a specific calendar
+func (b *Backend) GetCalendar(ctx context.Context, urlPath string) (*caldav.Calendar, error) {
+	name, err := b.calendarFromPath(ctx, urlPath)
+	if err != nil || strings.TrimSuffix(urlPath, "/")+"/" != b.calendarPath(ctx, name) {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("calendar not found"))
+	}
+	return b.calendar(ctx, name), nil
+}
+
+// GetCalendarObject returns a single event or task
+func (b *Backend) GetCalendarObject(ctx context.Context, urlPath string, req *caldav.CalendarCompRequest) (*caldav.CalendarObject, error) {
+	objects, err := b.listObjects(ctx, urlPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		if objects[i].Path == urlPath {
+			return &objects[i], nil
+		}
+	}
+	return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("calendar object not found"))
+}
+
+// ListCalendarObjects returns all events or tasks of a calendar
+func (b *Backend) ListCalendarObjects(ctx context.Context, urlPath string, req *caldav.CalendarCompRequest) ([]caldav.CalendarObject, error) {
+	return b.listObjects(ctx, urlPath)
+}
+
+// QueryCalendarObjects returns the objects of a calendar that match a calendar-query
+func (b *Backend) QueryCalendarObjects(ctx context.Context, urlPath string, query *caldav.CalendarQuery) ([]caldav.CalendarObject, error) {
+	objects, err := b.listObjects(ctx, urlPath)
+	if err != nil {
+		return nil, err
+	}
+	return caldav.Filter(query, objects)
+}
+
+// listObjects renders every object of the calendar urlPath belongs to
+func (b *Backend) listObjects(ctx context.Context, urlPath string) ([]caldav.CalendarObject, error) {
+	name, err := b.calendarFromPath(ctx, urlPath)
+	if err != nil {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, err)
+	}
+	if name == birthdaysCalendar {
+		return b.listBirthdays(ctx)
+	}
+	return b.listReminders(ctx)
+}
+
+func (b *Backend) listBirthdays(ctx context.Context) ([]caldav.CalendarObject, error) {
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db := b.getDB(ctx)
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	birthdays, err := services.ListBirthdays(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	var contacts []models.Contact
+	if err := db.Where("user_id = ? AND archived = ?", userID, false).
+		Where("anniversary IS NOT NULL AND anniversary != ''").
+		Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+
+	dir := b.calendarPath(ctx, birthdaysCalendar)
+	objects := make([]caldav.CalendarObject, 0, len(birthdays)+len(contacts))
+	for _, birthday := range birthdays {
+		name := fmt.Sprintf("%s%d.ics", birthdayContactPrefix, birthday.ContactID)
+		if birthday.Type == "relationship" {
+			name = fmt.Sprintf("%s%d.ics", birthdayRelationshipPrefix, birthday.RelationshipID)
+		}
+		if cal, ok := birthdayEvent(birthday, user); ok {
+			objects = appendObject(objects, dir+name, cal)
+		}
+	}
+	for _, contact := range contacts {
+		if cal, ok := anniversaryEvent(contact, user); ok {
+			objects = appendObject(objects, fmt.Sprintf("%s%s%d.ics", dir, anniversaryContactPrefix, contact.ID), cal)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Path < objects[j].Path })
+	return objects, nil
+}
+
+func (b *Backend) listReminders(ctx context.Context) ([]caldav.CalendarObject, error) {
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reminders []models.Reminder
+	if err := b.getDB(ctx).Preload("Contact").Where("user_id = ?", userID).Order("id").Find(&reminders).Error; err != nil {
+		return nil, err
+	}
+
+	objects := make([]caldav.CalendarObject, 0, len(reminders))
+	for _, reminder := range reminders {
+		objects = appendObject(objects, b.reminderPath(ctx, reminder.ID), reminderTodo(reminder))
+	}
+	return objects, nil
+}
+
+func (b *Backend) reminderPath(ctx context.Context, id uint) string {
+	return fmt.Sprintf("%s%s%d.ics", b.calendarPath(ctx, remindersCalendar), reminderPrefix, id)
+}
+
+// appendObject adds a rendered calendar to objects. Objects that fail to encode are logged and left out.
+func appendObject(objects []caldav.CalendarObject, objectPath string, cal *ical.Calendar) []caldav.CalendarObject {
+	etag, size, err := calendarETag(cal)
+	if err != nil {
+		logger.Warn().Err(err).Str("path", objectPath).Msg("CalDAV: failed to encode calendar object")
+		return objects
+	}
+	return append(objects, caldav.CalendarObject{Path: objectPath, ETag: etag, ContentLength: size, Data: cal})
+}
+
+// findReminder loads the reminder an object path refers to
+func (b *Backend) findReminder(ctx context.Context, urlPath string) (*models.Reminder, error) {
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if name, err := b.calendarFromPath(ctx, urlPath); err != nil || name != remindersCalendar {
+		return nil, webdav.NewHTTPError(http.StatusForbidden, fmt.Errorf("birthdays are read-only, edit the contact in Meerkat instead"))
+	}
+
+	base := strings.TrimSuffix(path.Base(urlPath), ".ics")
+	id, err := strconv.ParseUint(strings.TrimPrefix(base, reminderPrefix), 10, 64)
+	if !strings.HasPrefix(base, reminderPrefix) || err != nil {
+		return nil, webdav.NewHTTPError(http.StatusForbidden, fmt.Errorf("reminders can only be created in Meerkat"))
+	}
+
+	var reminder models.Reminder
+	err = b.getDB(ctx).Preload("Contact").Where("user_id = ?", userID).First(&reminder, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("reminder not found"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reminder, nil
+}
+
+// PutCalendarObject applies changes made to a reminder's task: completing it runs the same logic
+// as completing the reminder in Meerkat, and the summary and due date update the reminder.
+func (b *Backend) PutCalendarObject(ctx context.Context, urlPath string, cal *ical.Calendar, opts *caldav.PutCalendarObjectOptions) (*caldav.CalendarObject, error) {
+	reminder, err := b.findReminder(ctx, urlPath)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := b.GetCalendarObject(ctx, urlPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil {
+		if opts.IfNoneMatch.IsSet() {
+			return nil, webdav.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("resource already exists"))
+		}
+		if opts.IfMatch.IsSet() && !opts.IfMatch.IsWildcard() {
+			if etag, err := opts.IfMatch.ETag(); err != nil || etag != current.ETag {
+				return nil, webdav.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("ETag mismatch: resource has been modified"))
+			}
+		}
+	}
+
+	todo := findTodo(cal)
+	if todo == nil {
+		return nil, webdav.NewHTTPError(http.StatusBadRequest, fmt.Errorf("expected a VTODO"))
+	}
+
+	db := b.getDB(ctx)
+	if summary, err := todo.Props.Text(ical.PropSummary); err == nil && strings.TrimSpace(summary) != "" {
+		reminder.Message = strings.TrimSpace(summary)
+		if len(reminder.Message) > 500 {
+			return nil, webdav.NewHTTPError(http.StatusBadRequest, fmt.Errorf("summary is too long"))
+		}
+	}
+	if due, ok := todoDue(todo); ok && !sameDay(due, reminder.RemindAt.UTC()) {
+		reminder.RemindAt = due
+		reminder.EmailSent = false
+	}
+
+	if todoCompleted(todo) && !reminder.Completed {
+		if _, err := services.CompleteReminder(db, reminder, false); err != nil {
+			return nil, err
+		}
+	} else if err := db.Save(reminder).Error; err != nil {
+		return nil, err
+	}
+
+	// The stored task differs from the uploaded one (e.g. a recurring reminder was rescheduled),
+	// so no ETag is returned and the client fetches it again (RFC 4791 section 5.3.4)
+	return &caldav.CalendarObject{Path: urlPath}, nil
+}
+
+// DeleteCalendarObject deletes the reminder behind a task
+func (b *Backend) DeleteCalendarObject(ctx context.Context, urlPath string) error {
+	reminder, err := b.findReminder(ctx, urlPath)
+	if err != nil {
+		return err
+	}
+	return b.getDB(ctx).Delete(reminder).Error
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
@@ -0,0 +1,228 @@
+package caldav
+
+import (
+	"meerkat/i18n"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const (
+	testBirthdaysPath = "/caldav/calendars/tester/birthdays/"
+	testRemindersPath = "/caldav/calendars/tester/reminders/"
+)
+
+func setupCalDAV(t *testing.T) (*gorm.DB, *gin.Engine, uint) {
+	gin.SetMode(gin.ReleaseMode)
+	require.NoError(t, i18n.Init())
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Contact{}, &models.CardDAVSync{}, &models.Relationship{},
+		&models.Reminder{}, &models.ReminderCompletion{}))
+
+	user := models.User{Username: "tester", Password: "password123", Email: "tester@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+
+	handler := NewHandler(db)
+	router := gin.New()
+	group := router.Group("/caldav")
+	group.Use(func(c *gin.Context) {
+		c.Set("userID", user.ID)
+		c.Set("username", user.Username)
+		c.Next()
+	})
+	group.Any("/*path", handler.GinHandler())
+	group.Handle("PROPFIND", "/*path", handler.GinHandler())
+	group.Handle("REPORT", "/*path", handler.GinHandler())
+
+	return db, router, user.ID
+}
+
+func doDAV(router *gin.Engine, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func getObject(t *testing.T, router *gin.Engine, path string) (*ical.Calendar, string) {
+	t.Helper()
+	w := doDAV(router, http.MethodGet, path, "", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	cal, err := ical.NewDecoder(w.Body).Decode()
+	require.NoError(t, err)
+	return cal, w.Header().Get("ETag")
+}
+
+func putTodo(router *gin.Engine, path, todo string, header map[string]string) *httptest.ResponseRecorder {
+	body := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Test//EN\r\nBEGIN:VTODO\r\n" + todo + "END:VTODO\r\nEND:VCALENDAR\r\n"
+	req, _ := http.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/calendar")
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCalDAV_ListsCalendars(t *testing.T) {
+	_, router, _ := setupCalDAV(t)
+
+	w := doDAV(router, "PROPFIND", "/caldav/calendars/tester/", `<d:propfind xmlns:d="DAV:"><d:prop><d:displayname/></d:prop></d:propfind>`, map[string]string{"Depth": "1"})
+	require.Equal(t, http.StatusMultiStatus, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), testBirthdaysPath)
+	assert.Contains(t, w.Body.String(), testRemindersPath)
+	assert.Contains(t, w.Body.String(), "Birthdays")
+	assert.Contains(t, w.Body.String(), "Reminders")
+}
+
+func TestCalDAV_BirthdayEvents(t *testing.T) {
+	db, router, userID := setupCalDAV(t)
+
+	alice := models.Contact{UserID: userID, Firstname: "Alice", Lastname: "Smith", Birthday: "1985-04-12", Anniversary: "--06-20"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&models.Relationship{UserID: userID, ContactID: alice.ID, Name: "Tom", Type: "Child", Birthday: "--02-29"}).Error)
+	archived := models.Contact{UserID: userID, Firstname: "Old", Birthday: "1970-01-01", Archived: true}
+	require.NoError(t, db.Create(&archived).Error)
+
+	cal, etag := getObject(t, router, testBirthdaysPath+"birthday-contact-1.ics")
+	assert.NotEmpty(t, etag)
+	events := cal.Events()
+	require.Len(t, events, 1)
+	summary, _ := events[0].Props.Text(ical.PropSummary)
+	assert.Equal(t, "Alice Smith's birthday (born 12.04.1985)", summary)
+	assert.Equal(t, "FREQ=YEARLY", events[0].Props.Get(ical.PropRecurrenceRule).Value)
+	start, err := events[0].DateTimeStart(time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC), start)
+
+	cal, _ = getObject(t, router, testBirthdaysPath+"birthday-relationship-1.ics")
+	description, _ := cal.Events()[0].Props.Text(ical.PropDescription)
+	assert.Equal(t, "Child of Alice Smith", description)
+
+	cal, _ = getObject(t, router, testBirthdaysPath+"anniversary-contact-1.ics")
+	summary, _ = cal.Events()[0].Props.Text(ical.PropSummary)
+	assert.Equal(t, "Alice Smith's anniversary", summary)
+
+	// Archived contacts are left out
+	w := doDAV(router, http.MethodGet, testBirthdaysPath+"birthday-contact-2.ics", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Recurring events match time ranges in later years
+	query := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">
+    <c:time-range start="20300401T000000Z" end="20300501T000000Z"/>
+  </c:comp-filter></c:comp-filter></c:filter>
+</c:calendar-query>`
+	w = doDAV(router, "REPORT", testBirthdaysPath, query, map[string]string{"Depth": "1"})
+	require.Equal(t, http.StatusMultiStatus, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "birthday-contact-1.ics")
+	assert.NotContains(t, w.Body.String(), "anniversary-contact-1.ics")
+
+	// Birthdays are read-only
+	w = putTodo(router, testBirthdaysPath+"birthday-contact-1.ics", "UID:x\r\nSUMMARY:x\r\n", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doDAV(router, http.MethodDelete, testBirthdaysPath+"birthday-contact-1.ics", "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCalDAV_CompleteRecurringReminder(t *testing.T) {
+	db, router, userID := setupCalDAV(t)
+
+	contact := models.Contact{UserID: userID, Firstname: "Bob"}
+	require.NoError(t, db.Create(&contact).Error)
+	due := time.Now().UTC().AddDate(0, 0, -3).Truncate(24 * time.Hour)
+	reminder := models.Reminder{UserID: userID, ContactID: &contact.ID, Message: "Call Bob", Recurrence: "weekly", RemindAt: due}
+	require.NoError(t, db.Create(&reminder).Error)
+
+	path := testRemindersPath + "reminder-1.ics"
+	cal, etag := getObject(t, router, path)
+	todo := findTodo(cal)
+	require.NotNil(t, todo)
+	summary, _ := todo.Props.Text(ical.PropSummary)
+	assert.Equal(t, "Call Bob", summary)
+	status, _ := todo.Props.Text(ical.PropStatus)
+	assert.Equal(t, "NEEDS-ACTION", status)
+
+	// A stale ETag is rejected
+	w := putTodo(router, path, "UID:meerkat-reminder-1\r\nSUMMARY:Call Bob\r\nSTATUS:COMPLETED\r\n", map[string]string{"If-Match": `"stale"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = putTodo(router, path, "UID:meerkat-reminder-1\r\nSUMMARY:Call Bob\r\nSTATUS:COMPLETED\r\n", map[string]string{"If-Match": etag})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Empty(t, w.Header().Get("ETag"))
+
+	// Completed like in the web UI: a timeline entry and the next occurrence
+	var reloaded models.Reminder
+	require.NoError(t, db.First(&reloaded, reminder.ID).Error)
+	assert.False(t, reloaded.Completed)
+	assert.True(t, reloaded.RemindAt.After(time.Now()))
+	var completions int64
+	db.Model(&models.ReminderCompletion{}).Where("reminder_id = ?", reminder.ID).Count(&completions)
+	assert.Equal(t, int64(1), completions)
+
+	_, newETag := getObject(t, router, path)
+	assert.NotEqual(t, etag, newETag)
+}
+
+func TestCalDAV_CompleteOnceReminderDeletesIt(t *testing.T) {
+	db, router, userID := setupCalDAV(t)
+
+	contact := models.Contact{UserID: userID, Firstname: "Bob"}
+	require.NoError(t, db.Create(&contact).Error)
+	reminder := models.Reminder{UserID: userID, ContactID: &contact.ID, Message: "Send card", Recurrence: "once", RemindAt: time.Now()}
+	require.NoError(t, db.Create(&reminder).Error)
+
+	w := putTodo(router, testRemindersPath+"reminder-1.ics", "UID:meerkat-reminder-1\r\nSUMMARY:Send card\r\nCOMPLETED:20300101T000000Z\r\n", nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	assert.ErrorIs(t, db.First(&models.Reminder{}, reminder.ID).Error, gorm.ErrRecordNotFound)
+	assert.Equal(t, http.StatusNotFound, doDAV(router, http.MethodGet, testRemindersPath+"reminder-1.ics", "", nil).Code)
+}
+
+func TestCalDAV_EditAndDeleteReminder(t *testing.T) {
+	db, router, userID := setupCalDAV(t)
+
+	contact := models.Contact{UserID: userID, Firstname: "Bob"}
+	require.NoError(t, db.Create(&contact).Error)
+	reminder := models.Reminder{UserID: userID, ContactID: &contact.ID, Message: "Call Bob", Recurrence: "monthly", RemindAt: time.Date(2030, 5, 1, 0, 0, 0, 0, time.UTC)}
+	require.NoError(t, db.Create(&reminder).Error)
+
+	path := testRemindersPath + "reminder-1.ics"
+	w := putTodo(router, path, "UID:meerkat-reminder-1\r\nSUMMARY:Call Bob back\r\nDUE;VALUE=DATE:20300510\r\nSTATUS:NEEDS-ACTION\r\n", nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var reloaded models.Reminder
+	require.NoError(t, db.First(&reloaded, reminder.ID).Error)
+	assert.Equal(t, "Call Bob back", reloaded.Message)
+	assert.Equal(t, time.Date(2030, 5, 10, 0, 0, 0, 0, time.UTC), reloaded.RemindAt.UTC())
+	assert.False(t, reloaded.Completed)
+
+	// New tasks cannot be created from the client
+	w = putTodo(router, testRemindersPath+"new-task.ics", "UID:new-task\r\nSUMMARY:Something\r\n", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doDAV(router, http.MethodDelete, path, "", nil)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	assert.ErrorIs(t, db.First(&models.Reminder{}, reminder.ID).Error, gorm.ErrRecordNotFound)
+}
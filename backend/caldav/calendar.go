@@ -0,0 +1,110 @@
+package caldav
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"meerkat/models"
+	"meerkat/services"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+const productID = "-//Meerkat CRM//CalDAV//EN"
+
+// newCalendar wraps a single component in a VCALENDAR
+func newCalendar(comp *ical.Component) *ical.Calendar {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, productID)
+	cal.Children = append(cal.Children, comp)
+	return cal
+}
+
+// calendarETag derives an object's ETag from its encoded content. DTSTAMP never uses the current
+// time, so the ETag only changes when the rendered data does.
+func calendarETag(cal *ical.Calendar) (string, int64, error) {
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return "", 0, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return fmt.Sprintf("%x", sum[:8]), int64(buf.Len()), nil
+}
+
+// birthdayEvent renders a contact's or relationship's birthday as a yearly event, in the user's
+// language like the ICS feed
+func birthdayEvent(birthday models.Birthday, user models.User) (*ical.Calendar, bool) {
+	event, ok := services.BirthdayEvent(birthday, user)
+	if !ok {
+		return nil, false
+	}
+	return newCalendar(event), true
+}
+
+// anniversaryEvent renders a contact's anniversary as a yearly event
+func anniversaryEvent(contact models.Contact, user models.User) (*ical.Calendar, bool) {
+	event, ok := services.AnniversaryEvent(contact, user)
+	if !ok {
+		return nil, false
+	}
+	return newCalendar(event), true
+}
+
+func reminderUID(reminderID uint) string {
+	return fmt.Sprintf("meerkat-reminder-%d", reminderID)
+}
+
+// reminderTodo renders a reminder as a task due on its reminder date. Recurrence is not exported:
+// Meerkat reschedules a recurring reminder itself once the task is completed.
+func reminderTodo(reminder models.Reminder) *ical.Calendar {
+	todo := ical.NewComponent(ical.CompToDo)
+	todo.Props.SetText(ical.PropUID, reminderUID(reminder.ID))
+	todo.Props.SetDateTime(ical.PropDateTimeStamp, reminder.UpdatedAt.UTC())
+	todo.Props.SetText(ical.PropSummary, reminder.Message)
+	if reminder.Contact.ID != 0 {
+		todo.Props.SetText(ical.PropDescription, services.ContactDisplayName(reminder.Contact))
+	}
+	todo.Props.SetDate(ical.PropDue, reminder.RemindAt.UTC())
+	if reminder.Completed {
+		todo.Props.SetText(ical.PropStatus, "COMPLETED")
+		if reminder.LastSent != nil {
+			todo.Props.SetDateTime(ical.PropCompleted, reminder.LastSent.UTC())
+		}
+	} else {
+		todo.Props.SetText(ical.PropStatus, "NEEDS-ACTION")
+	}
+	return newCalendar(todo)
+}
+
+// findTodo returns the VTODO of a calendar object uploaded by a client
+func findTodo(cal *ical.Calendar) *ical.Component {
+	for _, child := range cal.Children {
+		if child.Name == ical.CompToDo {
+			return child
+		}
+	}
+	return nil
+}
+
+// todoCompleted reports whether a client marked the task as done
+func todoCompleted(todo *ical.Component) bool {
+	if status, err := todo.Props.Text(ical.PropStatus); err == nil && strings.EqualFold(status, "COMPLETED") {
+		return true
+	}
+	return todo.Props.Get(ical.PropCompleted) != nil
+}
+
+// todoDue returns the due date of a task as midnight UTC, the form reminder dates are stored in
+func todoDue(todo *ical.Component) (time.Time, bool) {
+	if todo.Props.Get(ical.PropDue) == nil {
+		return time.Time{}, false
+	}
+	due, err := todo.Props.DateTime(ical.PropDue, time.UTC)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, time.UTC), true
+}
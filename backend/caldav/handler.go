@@ -0,0 +1,67 @@
+package caldav
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/caldav"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler wraps the go-webdav CalDAV handler for use with Gin
+type Handler struct {
+	handler *caldav.Handler
+	db      *gorm.DB
+}
+
+// NewHandler creates a new CalDAV handler
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{
+		handler: &caldav.Handler{
+			Backend: NewBackend(db),
+			Prefix:  "/caldav",
+		},
+		db: db,
+	}
+}
+
+// GinHandler returns a Gin handler function that wraps the CalDAV handler
+func (h *Handler) GinHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get user info from Gin context (set by BasicAuthMiddleware)
+		userID, _ := c.Get("userID")
+		username, _ := c.Get("username")
+
+		ctx := ContextWithUser(c.Request.Context(), userID.(uint), username.(string), h.db)
+		c.Request = c.Request.WithContext(ctx)
+
+		// Handle the root and principals paths for discovery
+		path := c.Request.URL.Path
+		if path == "/caldav" || path == "/caldav/" || strings.HasPrefix(path, "/caldav/principals/") {
+			h.servePrincipal(c.Writer, c.Request, username.(string))
+			return
+		}
+
+		h.handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// servePrincipal handles PROPFIND requests for principal discovery
+func (h *Handler) servePrincipal(w http.ResponseWriter, r *http.Request, username string) {
+	webdav.ServePrincipal(w, r, &webdav.ServePrincipalOptions{
+		CurrentUserPrincipalPath: "/caldav/principals/" + username + "/",
+		HomeSets: []webdav.BackendSuppliedHomeSet{
+			caldav.NewCalendarHomeSet("/caldav/calendars/" + username + "/"),
+		},
+		Capabilities: []webdav.Capability{
+			caldav.CapabilityCalendar,
+		},
+	})
+}
+
+// WellKnownRedirect handles the /.well-known/caldav discovery redirect
+func WellKnownRedirect(c *gin.Context) {
+	c.Redirect(http.StatusMovedPermanently, "/caldav/")
+}
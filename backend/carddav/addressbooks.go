@@ -0,0 +1,94 @@
+package carddav
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"meerkat/database"
+	"meerkat/models"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/emersion/go-webdav/carddav"
+	"gorm.io/gorm"
+)
+
+// Every user has an "All" address book holding all contacts, plus one address book per circle.
+// Circle names are free text, so their path segment is the base64url-encoded name.
+const (
+	allContactsSegment  = "contacts"
+	circleSegmentPrefix = "circle-"
+)
+
+// addressBook describes the "All" address book (circle == "") or a circle's address book
+func (b *Backend) addressBook(ctx context.Context, circle string) *carddav.AddressBook {
+	ab := &carddav.AddressBook{
+		Path:        b.addressBookPath(ctx, circle),
+		Name:        "All",
+		Description: "All Meerkat CRM contacts",
+		SupportedAddressData: []carddav.AddressDataType{
+			{ContentType: "text/vcard", Version: VCardVersion3},
+			{ContentType: "text/vcard", Version: VCardVersion4},
+		},
+	}
+	if circle != "" {
+		ab.Name = circle
+		ab.Description = fmt.Sprintf("Meerkat CRM contacts in the %s circle", circle)
+	}
+	return ab
+}
+
+// addressBookPath returns the collection path of the "All" address book or of a circle's address book
+func (b *Backend) addressBookPath(ctx context.Context, circle string) string {
+	segment := allContactsSegment
+	if circle != "" {
+		segment = circleSegmentPrefix + base64.RawURLEncoding.EncodeToString([]byte(circle))
+	}
+	return "/carddav/addressbooks/" + b.getUsername(ctx) + "/" + segment + "/"
+}
+
+// circleFromPath resolves an address book or address object path to its circle ("" for the "All" book)
+func (b *Backend) circleFromPath(ctx context.Context, urlPath string) (string, error) {
+	homeSet := "/carddav/addressbooks/" + b.getUsername(ctx) + "/"
+	rest, ok := strings.CutPrefix(urlPath, homeSet)
+	if !ok {
+		return "", fmt.Errorf("address book not found")
+	}
+
+	segment, _, _ := strings.Cut(rest, "/")
+	if segment == allContactsSegment {
+		return "", nil
+	}
+	if encoded, ok := strings.CutPrefix(segment, circleSegmentPrefix); ok {
+		name, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err == nil && len(name) > 0 && utf8.Valid(name) {
+			return string(name), nil
+		}
+	}
+	return "", fmt.Errorf("address book not found")
+}
+
+// inCircle restricts a contacts query to members of the circle
+func inCircle(query *gorm.DB, circle string) *gorm.DB {
+	return query.Where(database.JSONArrayContains(query, "contacts.circles"), circle)
+}
+
+// contactInCircle reports whether the contact belongs to the circle; every contact is in the "All" book
+func contactInCircle(contact *models.Contact, circle string) bool {
+	if circle == "" {
+		return true
+	}
+	return slices.Contains(contact.Circles, circle)
+}
+
+// removeCircle returns circles without the given circle
+func removeCircle(circles []string, circle string) []string {
+	remaining := make([]string, 0, len(circles))
+	for _, c := range circles {
+		if c != circle {
+			remaining = append(remaining, c)
+		}
+	}
+	return remaining
+}
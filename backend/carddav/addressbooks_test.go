@@ -0,0 +1,134 @@
+package carddav
+
+import (
+	"encoding/base64"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func circleBookPath(circle string) string {
+	return "/carddav/addressbooks/tester/circle-" + base64.RawURLEncoding.EncodeToString([]byte(circle)) + "/"
+}
+
+func propFindDepth(router http.Handler, path, depth string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PROPFIND", path, strings.NewReader(
+		`<d:propfind xmlns:d="DAV:"><d:prop><d:displayname/><d:getetag/></d:prop></d:propfind>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", depth)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAddressBooks_OnePerCircle(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Alice", Circles: []string{"Work", "Friends & Family"}}).Error)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Bob", Circles: []string{"Work"}}).Error)
+	gone := models.Contact{UserID: userID, Firstname: "Gone", Circles: []string{"Old"}}
+	require.NoError(t, db.Create(&gone).Error)
+	require.NoError(t, db.Delete(&gone).Error)
+
+	ms := decodeMultiStatus(t, propFindDepth(router, "/carddav/addressbooks/tester/", "1"))
+
+	books := map[string]string{}
+	for _, resp := range ms.Responses {
+		for _, ps := range resp.PropStats {
+			for _, prop := range ps.Prop.Raw {
+				if prop.XMLName.Local == "displayname" && ps.Status == statusLine(http.StatusOK) {
+					books[resp.Hrefs[0]] = string(prop.Inner)
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]string{
+		testAddressBookPath:                "All",
+		circleBookPath("Work"):             "Work",
+		circleBookPath("Friends & Family"): "Friends &amp; Family",
+	}, books)
+
+	// Circle books only contain their members
+	ms = decodeMultiStatus(t, propFindDepth(router, circleBookPath("Friends & Family"), "1"))
+	assert.Len(t, ms.Responses, 2) // the collection and Alice
+
+	// Circles without live members have no address book
+	assert.NotEqual(t, http.StatusMultiStatus, propFindDepth(router, circleBookPath("Old"), "0").Code)
+}
+
+func TestAddressBooks_PutInCircleBookJoinsCircle(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Alice", Circles: []string{"Work"}}).Error)
+
+	card := "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:new-colleague\r\nFN:Carol\r\nN:;Carol;;;\r\nCATEGORIES:Friends\r\nEND:VCARD\r\n"
+	req, _ := http.NewRequest(http.MethodPut, circleBookPath("Work")+"new-colleague.vcf", strings.NewReader(card))
+	req.Header.Set("Content-Type", "text/vcard")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, circleBookPath("Work")+"new-colleague.vcf", w.Header().Get("Location"))
+
+	var carol models.Contact
+	require.NoError(t, db.Where("vcard_uid = ?", "new-colleague").First(&carol).Error)
+	assert.Equal(t, userID, carol.UserID)
+	assert.ElementsMatch(t, []string{"Friends", "Work"}, carol.Circles)
+}
+
+func TestAddressBooks_DeleteInCircleBookLeavesCircle(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	alice := models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice", Circles: []string{"Work", "Friends"}}
+	require.NoError(t, db.Create(&alice).Error)
+
+	token := decodeMultiStatus(t, doDAV(router, "REPORT", circleBookPath("Work"), syncRequest("", 0))).SyncToken
+
+	w := doDAV(router, http.MethodDelete, circleBookPath("Work")+"alice.vcf", "")
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+	var reloaded models.Contact
+	require.NoError(t, db.First(&reloaded, alice.ID).Error)
+	assert.Equal(t, []string{"Friends"}, reloaded.Circles)
+
+	// The contact left the circle, so the circle's book reports it as removed
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Bob", Circles: []string{"Work"}}).Error)
+	ms := decodeMultiStatus(t, doDAV(router, "REPORT", circleBookPath("Work"), syncRequest(token, 0)))
+	_, deleted := responsesByStatus(ms)
+	assert.Equal(t, []string{circleBookPath("Work") + "alice.vcf"}, deleted)
+}
+
+func TestAddressBooks_DeleteCircleBook(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	alice := models.Contact{UserID: userID, Firstname: "Alice", Circles: []string{"Work", "Friends"}}
+	require.NoError(t, db.Create(&alice).Error)
+
+	w := doDAV(router, http.MethodDelete, testAddressBookPath, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doDAV(router, http.MethodDelete, circleBookPath("Work"), "")
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+	var reloaded models.Contact
+	require.NoError(t, db.First(&reloaded, alice.ID).Error)
+	assert.Equal(t, []string{"Friends"}, reloaded.Circles)
+}
+
+func TestCircleFromPath(t *testing.T) {
+	b := NewBackend(nil, "")
+	ctx := ContextWithUser(t.Context(), 1, "tester", nil, "")
+
+	circle, err := b.circleFromPath(ctx, testAddressBookPath+"x.vcf")
+	require.NoError(t, err)
+	assert.Equal(t, "", circle)
+
+	circle, err = b.circleFromPath(ctx, circleBookPath("a/b")+"x.vcf")
+	require.NoError(t, err)
+	assert.Equal(t, "a/b", circle)
+
+	for _, p := range []string{"/carddav/addressbooks/other/contacts/", "/carddav/addressbooks/tester/circle-!!/", "/carddav/addressbooks/tester/unknown/"} {
+		_, err := b.circleFromPath(ctx, p)
+		assert.Error(t, err, p)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -22,10 +23,12 @@ var dummyBcryptHash = func() []byte {
 	return hash
 }()
 
-// BasicAuthMiddleware provides HTTP Basic Authentication for CardDAV
+// BasicAuthMiddleware provides HTTP Basic Authentication for CardDAV and CalDAV
 // It supports both username and email as the login identifier
+// The password is checked against the user's app passwords for protocol first; the account
+// password is only accepted when allowAccountPassword is set
 // Includes account-based rate limiting to prevent brute force attacks
-func BasicAuthMiddleware() gin.HandlerFunc {
+func BasicAuthMiddleware(protocol string, allowAccountPassword bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		username, password, ok := c.Request.BasicAuth()
 		if !ok {
@@ -70,8 +73,8 @@ func BasicAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Validate password
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		// Validate password: app passwords first, then (if allowed) the account password
+		if !checkAppPassword(db, user.ID, protocol, password) && !checkAccountPassword(allowAccountPassword, &user, password) {
 			// Record failed attempt for password mismatch
 			isLocked, _ := accountLimiter.RecordFailedAttempt(identifier)
 			logger.Warn().
@@ -100,3 +103,30 @@ func BasicAuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// checkAppPassword reports whether password is one of the user's active app passwords for protocol
+// and records its use
+func checkAppPassword(db *gorm.DB, userID uint, protocol, password string) bool {
+	var appPassword models.CardDAVAppPassword
+	if err := db.Where("user_id = ? AND protocol = ? AND password_hash = ? AND revoked_at IS NULL", userID, protocol, models.HashCardDAVAppPassword(password)).
+		First(&appPassword).Error; err != nil {
+		return false
+	}
+
+	go func(id uint) {
+		if err := db.Model(&models.CardDAVAppPassword{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error; err != nil {
+			logger.Warn().Err(err).Uint("app_password_id", id).Msg("Failed to update CardDAV app password last_used_at")
+		}
+	}(appPassword.ID)
+	return true
+}
+
+// checkAccountPassword compares against the account's bcrypt password, burning the same cost when
+// account passwords are disabled so the response time does not reveal the setting
+func checkAccountPassword(allowed bool, user *models.User, password string) bool {
+	if !allowed {
+		_ = bcrypt.CompareHashAndPassword(dummyBcryptHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil
+}
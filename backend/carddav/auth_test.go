@@ -0,0 +1,100 @@
+package carddav
+
+import (
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func setupAuthRouter(t *testing.T, protocol string, allowAccountPassword bool) (*gorm.DB, *gin.Engine, models.User) {
+	gin.SetMode(gin.ReleaseMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.CardDAVAppPassword{}))
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("account-secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := models.User{Username: "davuser", Email: "davuser@example.com", Password: string(hash)}
+	require.NoError(t, db.Create(&user).Error)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Next()
+	})
+	router.Use(BasicAuthMiddleware(protocol, allowAccountPassword))
+	router.GET("/carddav/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("username"))
+	})
+	return db, router, user
+}
+
+func basicAuthStatus(router *gin.Engine, username, password string) int {
+	req, _ := http.NewRequest(http.MethodGet, "/carddav/", nil)
+	req.SetBasicAuth(username, password)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestBasicAuth_AppPassword(t *testing.T) {
+	db, router, user := setupAuthRouter(t, models.AppPasswordProtocolCardDAV, false)
+
+	appPassword := models.CardDAVAppPassword{UserID: user.ID, Name: "iPhone", PasswordHash: models.HashCardDAVAppPassword("abcd-efgh-ijkl-mnop")}
+	require.NoError(t, db.Create(&appPassword).Error)
+
+	assert.Equal(t, http.StatusOK, basicAuthStatus(router, "davuser", "abcd-efgh-ijkl-mnop"))
+	// Dashes and case do not matter when typing the password on a phone
+	assert.Equal(t, http.StatusOK, basicAuthStatus(router, "davuser@example.com", "ABCDEFGHIJKLMNOP"))
+
+	assert.Eventually(t, func() bool {
+		var reloaded models.CardDAVAppPassword
+		db.First(&reloaded, appPassword.ID)
+		return reloaded.LastUsedAt != nil
+	}, time.Second, 10*time.Millisecond)
+
+	now := time.Now()
+	require.NoError(t, db.Model(&appPassword).Update("revoked_at", now).Error)
+	assert.Equal(t, http.StatusUnauthorized, basicAuthStatus(router, "davuser", "abcd-efgh-ijkl-mnop"))
+}
+
+func TestBasicAuth_AppPasswordOfOtherUser(t *testing.T) {
+	db, router, _ := setupAuthRouter(t, models.AppPasswordProtocolCardDAV, true)
+
+	other := models.User{Username: "other", Email: "other@example.com", Password: "x"}
+	require.NoError(t, db.Create(&other).Error)
+	require.NoError(t, db.Create(&models.CardDAVAppPassword{UserID: other.ID, Name: "phone", PasswordHash: models.HashCardDAVAppPassword("other-secret")}).Error)
+
+	assert.Equal(t, http.StatusUnauthorized, basicAuthStatus(router, "davuser", "other-secret"))
+}
+
+func TestBasicAuth_AppPasswordOfOtherProtocol(t *testing.T) {
+	for protocol, want := range map[string]int{
+		models.AppPasswordProtocolCardDAV: http.StatusUnauthorized,
+		models.AppPasswordProtocolCalDAV:  http.StatusOK,
+	} {
+		db, router, user := setupAuthRouter(t, protocol, false)
+		require.NoError(t, db.Create(&models.CardDAVAppPassword{UserID: user.ID, Name: "calendar", Protocol: models.AppPasswordProtocolCalDAV, PasswordHash: models.HashCardDAVAppPassword("caldav-secret")}).Error)
+		assert.Equal(t, want, basicAuthStatus(router, "davuser", "caldav-secret"), protocol)
+	}
+}
+
+func TestBasicAuth_AccountPassword(t *testing.T) {
+	_, allowed, _ := setupAuthRouter(t, models.AppPasswordProtocolCardDAV, true)
+	assert.Equal(t, http.StatusOK, basicAuthStatus(allowed, "davuser", "account-secret"))
+
+	_, disabled, _ := setupAuthRouter(t, models.AppPasswordProtocolCardDAV, false)
+	assert.Equal(t, http.StatusUnauthorized, basicAuthStatus(disabled, "davuser", "account-secret"))
+}
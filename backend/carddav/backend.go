@@ -3,10 +3,12 @@ package carddav
 import (
 	"context"
 	"fmt"
+	"meerkat/database"
 	"meerkat/logger"
 	"meerkat/models"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
 
 	"github.com/emersion/go-vcard"
@@ -94,55 +96,123 @@ func (b *Backend) AddressBookHomeSetPath(ctx context.Context) (string, error) {
 	return "/carddav/addressbooks/" + username + "/", nil
 }
 
-// ListAddressBooks returns the list of address books for the current user
+// ListAddressBooks returns the "All" address book plus one address book per circle and smart circle
 func (b *Backend) ListAddressBooks(ctx context.Context) ([]carddav.AddressBook, error) {
-	username := b.getUsername(ctx)
-	if username == "" {
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if b.getUsername(ctx) == "" {
 		return nil, fmt.Errorf("user not authenticated")
 	}
 
-	return []carddav.AddressBook{
-		{
-			Path:        "/carddav/addressbooks/" + username + "/contacts/",
-			Name:        "Contacts",
-			Description: "Meerkat CRM Contacts",
-			SupportedAddressData: []carddav.AddressDataType{
-				{ContentType: "text/vcard", Version: "3.0"},
-			},
-		},
-	}, nil
+	var circles []string
+	db := b.getDB(ctx)
+	if err := db.Raw(`SELECT DISTINCT json_each.value AS circle
+		FROM contacts, `+database.JSONArrayValues(db, "contacts.circles")+`
+		WHERE contacts.user_id = ? AND contacts.deleted_at IS NULL
+		ORDER BY circle`, userID).Scan(&circles).Error; err != nil {
+		return nil, err
+	}
+
+	addressBooks := []carddav.AddressBook{*b.addressBook(ctx, "")}
+	for _, circle := range circles {
+		if circle != "" {
+			addressBooks = append(addressBooks, *b.addressBook(ctx, circle))
+		}
+	}
+
+	smartCircles, err := models.ListSmartCircles(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sc := range smartCircles {
+		addressBooks = append(addressBooks, *b.smartAddressBook(ctx, sc.Name))
+	}
+	return addressBooks, nil
 }
 
 // GetAddressBook returns a specific address book
 func (b *Backend) GetAddressBook(ctx context.Context, urlPath string) (*carddav.AddressBook, error) {
-	username := b.getUsername(ctx)
-	if username == "" {
-		return nil, fmt.Errorf("user not authenticated")
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if book, ok, err := b.smartBookFromPath(ctx, urlPath); ok {
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSuffix(urlPath, "/")+"/" != b.smartAddressBookPath(ctx, book.circle.Name) {
+			return nil, fmt.Errorf("address book not found")
+		}
+		return b.smartAddressBook(ctx, book.circle.Name), nil
 	}
 
-	expectedPath := "/carddav/addressbooks/" + username + "/contacts/"
-	if urlPath != expectedPath && urlPath+"/" != expectedPath {
+	circle, err := b.circleFromPath(ctx, urlPath)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(urlPath, "/")+"/" != b.addressBookPath(ctx, circle) {
 		return nil, fmt.Errorf("address book not found")
 	}
 
-	return &carddav.AddressBook{
-		Path:        expectedPath,
-		Name:        "Contacts",
-		Description: "Meerkat CRM Contacts",
-		SupportedAddressData: []carddav.AddressDataType{
-			{ContentType: "text/vcard", Version: "3.0"},
-		},
-	}, nil
+	// A circle only exists while at least one contact belongs to it
+	if circle != "" {
+		var count int64
+		if err := inCircle(b.getDB(ctx).Model(&models.Contact{}).Where("user_id = ?", userID), circle).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("address book not found")
+		}
+	}
+
+	return b.addressBook(ctx, circle), nil
 }
 
-// CreateAddressBook creates a new address book (not supported - single address book per user)
+// CreateAddressBook creates a new address book (not supported - address books follow the contacts' circles)
 func (b *Backend) CreateAddressBook(ctx context.Context, addressBook *carddav.AddressBook) error {
-	return fmt.Errorf("creating address books is not supported")
+	return webdav.NewHTTPError(http.StatusForbidden, fmt.Errorf("address books are created by adding contacts to a circle"))
 }
 
-// DeleteAddressBook deletes an address book (not supported)
+// DeleteAddressBook deletes a circle's address book by removing the circle from all its contacts,
+// and a smart circle's address book by deleting the smart circle. The contacts themselves are
+// kept; the "All" address book cannot be deleted.
 func (b *Backend) DeleteAddressBook(ctx context.Context, urlPath string) error {
-	return fmt.Errorf("deleting address books is not supported")
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if book, ok, err := b.smartBookFromPath(ctx, urlPath); ok {
+		if err != nil {
+			return err
+		}
+		return b.getDB(ctx).Delete(&book.circle).Error
+	}
+
+	circle, err := b.circleFromPath(ctx, urlPath)
+	if err != nil {
+		return webdav.NewHTTPError(http.StatusNotFound, err)
+	}
+	if circle == "" {
+		return webdav.NewHTTPError(http.StatusForbidden, fmt.Errorf("the address book of all contacts cannot be deleted"))
+	}
+
+	return b.getDB(ctx).Transaction(func(tx *gorm.DB) error {
+		var contacts []models.Contact
+		if err := inCircle(tx.Where("user_id = ?", userID), circle).Find(&contacts).Error; err != nil {
+			return err
+		}
+		for i := range contacts {
+			contacts[i].Circles = removeCircle(contacts[i].Circles, circle)
+			if err := tx.Save(&contacts[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // GetAddressObject returns a single address object (contact)
@@ -152,29 +222,36 @@ func (b *Backend) GetAddressObject(ctx context.Context, urlPath string, req *car
 		return nil, err
 	}
 
+	if book, ok, err := b.smartBookFromPath(ctx, urlPath); ok {
+		if err != nil {
+			return nil, err
+		}
+		return b.smartBookObject(ctx, book, urlPath)
+	}
+
+	circle, err := b.circleFromPath(ctx, urlPath)
+	if err != nil {
+		return nil, err
+	}
+
 	// Extract UID from path (e.g., /carddav/addressbooks/user/contacts/uid.vcf)
 	uid := extractUIDFromPath(urlPath)
 	if uid == "" {
 		return nil, fmt.Errorf("invalid path")
 	}
 
-	db := b.getDB(ctx)
-	var contact models.Contact
-
-	// Try to find by vcard_uid first, then by ID
-	err = db.Where("user_id = ? AND vcard_uid = ?", userID, uid).First(&contact).Error
-	if err == gorm.ErrRecordNotFound {
-		// Try parsing as numeric ID for backwards compatibility
-		var id uint
-		if _, scanErr := fmt.Sscanf(uid, "%d", &id); scanErr == nil {
-			err = db.Where("user_id = ? AND id = ?", userID, id).First(&contact).Error
+	contact, err := b.findContact(b.getDB(ctx), userID, uid)
+	if err != nil && circle == "" {
+		// The "All" book also holds a group card per circle
+		if group, groupErr := b.findGroup(ctx, uid); groupErr == nil {
+			return b.groupToAddressObject(ctx, group), nil
 		}
 	}
-	if err != nil {
-		return nil, fmt.Errorf("contact not found")
+	if err != nil || !contactInCircle(contact, circle) {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("contact not found"))
 	}
 
-	return b.contactToAddressObject(ctx, &contact), nil
+	return b.contactToAddressObject(ctx, circle, contact), nil
 }
 
 // ListAddressObjects returns all address objects in an address book
@@ -184,15 +261,41 @@ func (b *Backend) ListAddressObjects(ctx context.Context, urlPath string, req *c
 		return nil, err
 	}
 
-	db := b.getDB(ctx)
+	if book, ok, err := b.smartBookFromPath(ctx, urlPath); ok {
+		if err != nil {
+			return nil, err
+		}
+		return b.listSmartBookObjects(ctx, book)
+	}
+
+	circle, err := b.circleFromPath(ctx, urlPath)
+	if err != nil {
+		return nil, err
+	}
+
+	query := b.getDB(ctx).Where("user_id = ?", userID)
+	if circle != "" {
+		query = inCircle(query, circle)
+	}
+
 	var contacts []models.Contact
-	if err := db.Where("user_id = ?", userID).Find(&contacts).Error; err != nil {
+	if err := query.Find(&contacts).Error; err != nil {
 		return nil, err
 	}
 
 	objects := make([]carddav.AddressObject, 0, len(contacts))
-	for _, contact := range contacts {
-		objects = append(objects, *b.contactToAddressObject(ctx, &contact))
+	for i := range contacts {
+		objects = append(objects, *b.contactToAddressObject(ctx, circle, &contacts[i]))
+	}
+
+	if circle == "" {
+		groups, _, err := b.planGroups(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i := range groups {
+			objects = append(objects, *b.groupToAddressObject(ctx, &groups[i]))
+		}
 	}
 
 	return objects, nil
@@ -216,9 +319,29 @@ func (b *Backend) PutAddressObject(ctx context.Context, urlPath string, card vca
 		return nil, err
 	}
 
+	if _, ok, err := b.smartBookFromPath(ctx, urlPath); ok {
+		if err != nil {
+			return nil, err
+		}
+		return nil, errSmartCircleReadOnly
+	}
+
+	circle, err := b.circleFromPath(ctx, urlPath)
+	if err != nil {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, err)
+	}
+
 	db := b.getDB(ctx)
 	uid := extractUIDFromPath(urlPath)
 
+	// Group cards become circles; they only live in the "All" book
+	if IsGroupCard(card) {
+		if circle != "" {
+			return nil, webdav.NewHTTPError(http.StatusForbidden, fmt.Errorf("groups can only be created in the All address book"))
+		}
+		return b.putGroup(ctx, uid, card, opts)
+	}
+
 	// Check for UID from card if not in path
 	if uid == "" {
 		uid = card.Value(vcard.FieldUID)
@@ -239,18 +362,28 @@ func (b *Backend) PutAddressObject(ctx context.Context, urlPath string, card vca
 		isNew = true
 	}
 
-	// Check ETag for conflict detection on updates (If-Match header)
-	if !isNew && opts != nil && opts.IfMatch.IsSet() {
-		matched, err := opts.IfMatch.MatchETag(contact.ETag)
-		if err != nil || !matched {
-			return nil, webdav.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("ETag mismatch: resource has been modified"))
-		}
+	// Conflict detection: If-Match guards updates, If-None-Match: * guards creations.
+	// A contact outside a circle does not exist at that circle book's path.
+	if err := putPreconditions(opts).check(!isNew && contactInCircle(&contact, circle), contact.ETag); err != nil {
+		return nil, err
+	}
+
+	// Keep the stored state for the contact's history, the conversion updates it in place
+	var before *models.Contact
+	if !isNew {
+		previous := contact
+		before = &previous
 	}
 
 	// Convert vCard to contact
 	updatedContact, photoData, photoMediaType, photoURL := VCardToContact(card, &contact)
 	updatedContact.UserID = userID
 
+	// Contacts written through a circle's address book always belong to that circle
+	if !contactInCircle(updatedContact, circle) {
+		updatedContact.Circles = append(updatedContact.Circles, circle)
+	}
+
 	// Ensure VCardUID is set (RFC 6352 requires every contact to have a UID)
 	if updatedContact.VCardUID == "" {
 		updatedContact.VCardUID = uid
@@ -302,20 +435,38 @@ func (b *Backend) PutAddressObject(ctx context.Context, urlPath string, card vca
 	}
 
 	// Save contact
-	if err := db.Save(updatedContact).Error; err != nil {
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(updatedContact).Error; err != nil {
+			return err
+		}
+		return models.RecordContactVersion(tx, before, updatedContact, b.contactEditor(ctx))
+	}); err != nil {
 		return nil, err
 	}
 
-	return b.contactToAddressObject(ctx, updatedContact), nil
+	return b.contactToAddressObject(ctx, circle, updatedContact), nil
 }
 
-// DeleteAddressObject deletes an address object (soft delete)
+// DeleteAddressObject deletes an address object (soft delete).
+// In a circle's address book the contact only leaves that circle; smart circle books are read-only.
 func (b *Backend) DeleteAddressObject(ctx context.Context, urlPath string) error {
 	userID, err := b.getUserID(ctx)
 	if err != nil {
 		return err
 	}
 
+	if _, ok, err := b.smartBookFromPath(ctx, urlPath); ok {
+		if err != nil {
+			return err
+		}
+		return errSmartCircleReadOnly
+	}
+
+	circle, err := b.circleFromPath(ctx, urlPath)
+	if err != nil {
+		return err
+	}
+
 	uid := extractUIDFromPath(urlPath)
 	if uid == "" {
 		return fmt.Errorf("invalid path")
@@ -323,45 +474,106 @@ func (b *Backend) DeleteAddressObject(ctx context.Context, urlPath string) error
 
 	db := b.getDB(ctx)
 
-	// Find contact by vcard_uid or ID
+	conditions := preconditionsFromContext(ctx)
+
+	contact, err := b.findContact(db, userID, uid)
+	if err != nil && circle == "" {
+		if group, groupErr := b.findGroup(ctx, uid); groupErr == nil {
+			if err := conditions.check(true, group.ETag); err != nil {
+				return err
+			}
+			return b.deleteGroup(ctx, group)
+		}
+	}
+	if err != nil || !contactInCircle(contact, circle) {
+		if err := conditions.check(false, ""); err != nil {
+			return err
+		}
+		return webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("contact not found"))
+	}
+
+	// Refuse to delete a card the client has not seen in its current state
+	if err := conditions.check(true, contact.ETag); err != nil {
+		return err
+	}
+
+	if circle != "" {
+		return db.Transaction(func(tx *gorm.DB) error {
+			return b.saveCircles(ctx, tx, contact, removeCircle(contact.Circles, circle))
+		})
+	}
+
+	// Soft delete
+	return db.Delete(contact).Error
+}
+
+// contactEditor returns who contact changes made through CardDAV are recorded as
+func (b *Backend) contactEditor(ctx context.Context) models.ContactEditor {
+	return models.ContactEditor{Source: models.ContactSourceCardDAV, Actor: b.getUsername(ctx)}
+}
+
+// saveCircles saves a contact with new circles and records the change in its history
+func (b *Backend) saveCircles(ctx context.Context, tx *gorm.DB, contact *models.Contact, circles []string) error {
+	before := *contact
+	contact.Circles = circles
+	if err := tx.Save(contact).Error; err != nil {
+		return err
+	}
+	return models.RecordContactVersion(tx, &before, contact, b.contactEditor(ctx))
+}
+
+// findContact looks a contact up by vcard_uid, falling back to its numeric ID
+func (b *Backend) findContact(db *gorm.DB, userID uint, uid string) (*models.Contact, error) {
 	var contact models.Contact
-	err = db.Where("user_id = ? AND vcard_uid = ?", userID, uid).First(&contact).Error
+	err := db.Where("user_id = ? AND vcard_uid = ?", userID, uid).First(&contact).Error
 	if err == gorm.ErrRecordNotFound {
-		var id uint
-		if _, scanErr := fmt.Sscanf(uid, "%d", &id); scanErr == nil {
+		// Try parsing as numeric ID for backwards compatibility; the whole
+		// UID must be numeric so UUIDs with leading digits don't match
+		if id, parseErr := strconv.ParseUint(uid, 10, 64); parseErr == nil {
 			err = db.Where("user_id = ? AND id = ?", userID, id).First(&contact).Error
 		}
 	}
 	if err != nil {
-		return fmt.Errorf("contact not found")
+		return nil, err
 	}
+	return &contact, nil
+}
 
-	// Soft delete
-	return db.Delete(&contact).Error
+// contactToAddressObject converts a Contact to a CardDAV AddressObject in the given circle's address book
+func (b *Backend) contactToAddressObject(ctx context.Context, circle string, contact *models.Contact) *carddav.AddressObject {
+	return b.contactObjectIn(ctx, b.addressBookPath(ctx, circle), contact)
 }
 
-// contactToAddressObject converts a Contact to a CardDAV AddressObject
-func (b *Backend) contactToAddressObject(ctx context.Context, contact *models.Contact) *carddav.AddressObject {
-	username := b.getUsername(ctx)
+// contactObjectIn converts a Contact to a CardDAV AddressObject in the address book at bookPath
+func (b *Backend) contactObjectIn(ctx context.Context, bookPath string, contact *models.Contact) *carddav.AddressObject {
 	photoDir := b.getPhotoDir(ctx)
 
-	// Determine UID for path
-	uid := contact.VCardUID
-	if uid == "" {
-		uid = fmt.Sprintf("%d", contact.ID)
-	}
-
 	// Generate vCard
-	card := ContactToVCard(contact, photoDir)
+	card := ContactToVCardVersion(contact, photoDir, b.getVCardVersion(ctx))
 
 	return &carddav.AddressObject{
-		Path:    "/carddav/addressbooks/" + username + "/contacts/" + uid + ".vcf",
+		Path:    bookPath + contactFileName(contact),
 		ModTime: contact.UpdatedAt,
 		ETag:    contact.ETag,
 		Card:    card,
 	}
 }
 
+// contactPath returns the address object path of a contact in the given circle's address book
+func (b *Backend) contactPath(ctx context.Context, circle string, contact *models.Contact) string {
+	return b.addressBookPath(ctx, circle) + contactFileName(contact)
+}
+
+// contactFileName returns the last path segment of a contact's address object
+func contactFileName(contact *models.Contact) string {
+	// Determine UID for path
+	uid := contact.VCardUID
+	if uid == "" {
+		uid = fmt.Sprintf("%d", contact.ID)
+	}
+	return uid + ".vcf"
+}
+
 // extractUIDFromPath extracts the UID from a CardDAV path
 // e.g., /carddav/addressbooks/user/contacts/uid.vcf -> uid
 func extractUIDFromPath(urlPath string) string {
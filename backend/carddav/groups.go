@@ -0,0 +1,431 @@
+package carddav
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"meerkat/models"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-vcard"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/carddav"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Apple Contacts predates KIND/MEMBER and marks group cards in vCard 3.0 with these instead
+const (
+	fieldAppleKind   = "X-ADDRESSBOOKSERVER-KIND"
+	fieldAppleMember = "X-ADDRESSBOOKSERVER-MEMBER"
+)
+
+// memberURIPrefix is how group cards reference their members' UIDs
+const memberURIPrefix = "urn:uuid:"
+
+// groupCard is a circle's group vCard together with the UIDs of its current members
+type groupCard struct {
+	models.CardDAVGroup
+	Members []string
+	changed bool // the row is missing or out of date, see planGroups
+}
+
+// IsGroupCard reports whether a vCard describes a group (KIND:group) rather than a person
+func IsGroupCard(card vcard.Card) bool {
+	return strings.EqualFold(card.Value(vcard.FieldKind), string(vcard.KindGroup)) ||
+		strings.EqualFold(card.Value(fieldAppleKind), string(vcard.KindGroup))
+}
+
+// groupMemberUIDs returns the member UIDs referenced by a group card
+func groupMemberUIDs(card vcard.Card) []string {
+	var uids []string
+	for _, name := range []string{vcard.FieldMember, fieldAppleMember} {
+		for _, f := range card[name] {
+			uid := strings.TrimSpace(f.Value)
+			if len(uid) >= len(memberURIPrefix) && strings.EqualFold(uid[:len(memberURIPrefix)], memberURIPrefix) {
+				uid = uid[len(memberURIPrefix):]
+			}
+			if uid != "" && !slices.Contains(uids, uid) {
+				uids = append(uids, uid)
+			}
+		}
+	}
+	return uids
+}
+
+// groupETag derives a group card's ETag from its name and (sorted) members
+func groupETag(name string, members []string) string {
+	sum := sha256.Sum256([]byte(name + "\n" + strings.Join(members, "\n")))
+	return fmt.Sprintf("g-%x", sum[:8])
+}
+
+// GroupToVCard renders a circle as a group card: KIND/MEMBER in vCard 4.0 and Apple's
+// X-ADDRESSBOOKSERVER-KIND/-MEMBER in vCard 3.0.
+func GroupToVCard(uid, name string, members []string, version string) vcard.Card {
+	card := make(vcard.Card)
+	kindField, memberField := fieldAppleKind, fieldAppleMember
+	if version == VCardVersion4 {
+		card.SetValue(vcard.FieldVersion, VCardVersion4)
+		kindField, memberField = vcard.FieldKind, vcard.FieldMember
+	} else {
+		card.SetValue(vcard.FieldVersion, VCardVersion3)
+	}
+	card.SetValue(vcard.FieldUID, uid)
+	card.SetValue(vcard.FieldFormattedName, name)
+	card.SetValue(vcard.FieldName, escapeComponent(name)+";;;;")
+	card.SetValue(kindField, string(vcard.KindGroup))
+	for _, member := range members {
+		card.Add(memberField, &vcard.Field{Value: memberURIPrefix + member})
+	}
+	return card
+}
+
+// groupUID returns the UID of the group card for a circle that has no group row yet. It is derived
+// from the name, so the card keeps its UID between reads until a sync stores it. attempt moves on
+// to another UID when a renamed group already uses the first one.
+func groupUID(userID uint, name string, attempt int) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, fmt.Appendf(nil, "meerkat:carddav-group:%d:%d:%s", userID, attempt, name)).String()
+}
+
+// circleMembers returns the sorted UIDs of the members of each of the user's circles
+func circleMembers(db *gorm.DB, userID uint) (map[string][]string, error) {
+	var contacts []models.Contact
+	if err := db.Select("id", "vcard_uid", "circles").Where("user_id = ?", userID).Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+	members := map[string][]string{}
+	for _, contact := range contacts {
+		for _, circle := range contact.Circles {
+			if circle != "" && contact.VCardUID != "" {
+				members[circle] = append(members[circle], contact.VCardUID)
+			}
+		}
+	}
+	for circle := range members {
+		sort.Strings(members[circle])
+	}
+	return members, nil
+}
+
+// planGroups works out the user's group cards from the circles on their contacts without writing
+// anything. It returns the live groups sorted by name, with changed marking those whose row is
+// missing (ID 0) or out of date, and the rows to remove: groups whose circle lost its last member
+// and duplicates of a name. Groups created empty from a client are kept until they gain and lose
+// members.
+func (b *Backend) planGroups(ctx context.Context) (groups []groupCard, removed []models.CardDAVGroup, err error) {
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	db := b.getDB(ctx)
+
+	members, err := circleMembers(db, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rows []models.CardDAVGroup
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	groups = make([]groupCard, 0, len(members))
+	seen := map[string]bool{}
+	uids := map[string]bool{}
+	for _, row := range rows {
+		m := members[row.Name]
+		if seen[row.Name] || (len(m) == 0 && row.ETag != groupETag(row.Name, nil)) {
+			removed = append(removed, row)
+			continue
+		}
+		seen[row.Name] = true
+		uids[row.VCardUID] = true
+		group := groupCard{CardDAVGroup: row, Members: m}
+		if etag := groupETag(row.Name, m); row.ETag != etag {
+			group.ETag, group.changed = etag, true
+		}
+		groups = append(groups, group)
+	}
+
+	now := time.Now()
+	for circle, m := range members {
+		if seen[circle] {
+			continue
+		}
+		uid := groupUID(userID, circle, 0)
+		for attempt := 1; uids[uid]; attempt++ {
+			uid = groupUID(userID, circle, attempt)
+		}
+		row := models.CardDAVGroup{UserID: userID, Name: circle, VCardUID: uid, ETag: groupETag(circle, m)}
+		row.UpdatedAt = now
+		groups = append(groups, groupCard{CardDAVGroup: row, Members: m, changed: true})
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, removed, nil
+}
+
+// reconcileGroups stores the changes worked out by planGroups and returns the live groups. Every
+// change is stamped with the current revision: it was caused by a contact change that already
+// bumped it. It writes, so it only runs once per sync and before a client changes a group; reads
+// use planGroups.
+func (b *Backend) reconcileGroups(ctx context.Context) ([]groupCard, error) {
+	groups, removed, err := b.planGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db := b.getDB(ctx)
+	current, err := models.CurrentCardDAVRevision(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range removed {
+		if err := db.Model(&removed[i]).Update("sync_revision", current).Error; err != nil {
+			return nil, err
+		}
+		if err := db.Delete(&removed[i]).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range groups {
+		group := &groups[i]
+		if !group.changed {
+			continue
+		}
+		group.SyncRevision = current
+		if group.ID != 0 {
+			if err := db.Model(&group.CardDAVGroup).Updates(map[string]any{"etag": group.ETag, "sync_revision": current}).Error; err != nil {
+				return nil, err
+			}
+		} else {
+			// A circle that comes back takes over the tombstone of its earlier group
+			var tombstone models.CardDAVGroup
+			if err := db.Unscoped().Where("user_id = ? AND vcard_uid = ?", userID, group.VCardUID).Limit(1).Find(&tombstone).Error; err != nil {
+				return nil, err
+			}
+			group.ID, group.CreatedAt = tombstone.ID, tombstone.CreatedAt
+			if err := db.Unscoped().Save(&group.CardDAVGroup).Error; err != nil {
+				return nil, err
+			}
+		}
+		group.changed = false
+	}
+	return groups, nil
+}
+
+// findGroup returns the live group card with the given UID, without writing anything. A stored
+// group is looked up directly; only UIDs that match no row need the circles of every contact.
+func (b *Backend) findGroup(ctx context.Context, uid string) (*groupCard, error) {
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db := b.getDB(ctx)
+
+	var row models.CardDAVGroup
+	err = db.Where("user_id = ? AND vcard_uid = ?", userID, uid).First(&row).Error
+	if err == nil {
+		var members []string
+		if err := inCircle(db.Model(&models.Contact{}).Where("user_id = ? AND vcard_uid <> ''", userID), row.Name).
+			Pluck("vcard_uid", &members).Error; err != nil {
+			return nil, err
+		}
+		sort.Strings(members)
+		// The same checks as planGroups: an emptied circle's group is gone, and of two groups with
+		// the same name only the older one counts
+		var older int64
+		if err := db.Model(&models.CardDAVGroup{}).Where("user_id = ? AND name = ? AND id < ?", userID, row.Name, row.ID).Count(&older).Error; err != nil {
+			return nil, err
+		}
+		if older > 0 || (len(members) == 0 && row.ETag != groupETag(row.Name, nil)) {
+			return nil, fmt.Errorf("group not found")
+		}
+		row.ETag = groupETag(row.Name, members)
+		return &groupCard{CardDAVGroup: row, Members: members}, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	groups, _, err := b.planGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		if groups[i].ID == 0 && groups[i].VCardUID == uid {
+			return &groups[i], nil
+		}
+	}
+	return nil, fmt.Errorf("group not found")
+}
+
+// groupToAddressObject converts a group card to a CardDAV AddressObject in the "All" address book
+func (b *Backend) groupToAddressObject(ctx context.Context, group *groupCard) *carddav.AddressObject {
+	return &carddav.AddressObject{
+		Path:    b.groupPath(ctx, &group.CardDAVGroup),
+		ModTime: group.UpdatedAt,
+		ETag:    group.ETag,
+		Card:    GroupToVCard(group.VCardUID, group.Name, group.Members, b.getVCardVersion(ctx)),
+	}
+}
+
+// groupPath returns the address object path of a group card
+func (b *Backend) groupPath(ctx context.Context, group *models.CardDAVGroup) string {
+	return b.addressBookPath(ctx, "") + group.VCardUID + ".vcf"
+}
+
+// putGroup applies a group card written by a client: the group's name becomes a circle and
+// exactly the listed members belong to it. Renaming a group renames the circle.
+func (b *Backend) putGroup(ctx context.Context, uid string, card vcard.Card, opts *carddav.PutAddressObjectOptions) (*carddav.AddressObject, error) {
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(card.Value(vcard.FieldFormattedName))
+	if name == "" {
+		if n := card.Name(); n != nil {
+			name = strings.TrimSpace(n.FamilyName)
+		}
+	}
+	if name == "" {
+		return nil, webdav.NewHTTPError(http.StatusBadRequest, fmt.Errorf("group card has no name"))
+	}
+	if uid == "" {
+		uid = card.Value(vcard.FieldUID)
+	}
+	if uid == "" {
+		uid = uuid.New().String()
+	}
+
+	// Bring the rows up to date first so the rename/membership diff starts from the real state
+	if _, err := b.reconcileGroups(ctx); err != nil {
+		return nil, err
+	}
+
+	db := b.getDB(ctx)
+	var group models.CardDAVGroup
+	err = db.Unscoped().Where("user_id = ? AND vcard_uid = ?", userID, uid).First(&group).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	exists := err == nil && !group.DeletedAt.Valid
+
+	if err := putPreconditions(opts).check(exists, group.ETag); err != nil {
+		return nil, err
+	}
+
+	oldName := ""
+	if exists && group.Name != name {
+		oldName = group.Name
+	}
+	wanted := groupMemberUIDs(card)
+
+	var members []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var contacts []models.Contact
+		if err := tx.Where("user_id = ?", userID).Find(&contacts).Error; err != nil {
+			return err
+		}
+		for i := range contacts {
+			contact := &contacts[i]
+			circles := slices.Clone(contact.Circles)
+			if oldName != "" {
+				circles = removeCircle(circles, oldName)
+			}
+			want := slices.Contains(wanted, contact.VCardUID)
+			switch has := slices.Contains(circles, name); {
+			case want && !has:
+				circles = append(circles, name)
+			case !want && has:
+				circles = removeCircle(circles, name)
+			}
+			if want {
+				members = append(members, contact.VCardUID)
+			}
+			if slices.Equal(circles, contact.Circles) {
+				continue
+			}
+			if err := b.saveCircles(ctx, tx, contact, circles); err != nil {
+				return err
+			}
+		}
+
+		// The group itself is a change too, even when no contact's circles moved
+		revision, err := models.NextCardDAVRevision(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// Another group of the same name (e.g. the one we created for the circle) is replaced by this one
+		var duplicates []models.CardDAVGroup
+		if err := tx.Where("user_id = ? AND name = ? AND vcard_uid <> ?", userID, name, uid).Find(&duplicates).Error; err != nil {
+			return err
+		}
+		for i := range duplicates {
+			if err := tx.Model(&duplicates[i]).Update("sync_revision", revision).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&duplicates[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		sort.Strings(members)
+		group.UserID = userID
+		group.VCardUID = uid
+		group.Name = name
+		group.ETag = groupETag(name, members)
+		group.SyncRevision = revision
+		group.DeletedAt = gorm.DeletedAt{}
+		return tx.Unscoped().Save(&group).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.groupToAddressObject(ctx, &groupCard{CardDAVGroup: group, Members: members}), nil
+}
+
+// deleteGroup removes a group card and its circle from every member
+func (b *Backend) deleteGroup(ctx context.Context, group *groupCard) error {
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	return b.getDB(ctx).Transaction(func(tx *gorm.DB) error {
+		var contacts []models.Contact
+		if err := inCircle(tx.Where("user_id = ?", userID), group.Name).Find(&contacts).Error; err != nil {
+			return err
+		}
+		for i := range contacts {
+			if err := b.saveCircles(ctx, tx, &contacts[i], removeCircle(contacts[i].Circles, group.Name)); err != nil {
+				return err
+			}
+		}
+
+		// A group that no sync has stored yet leaves no tombstone
+		if group.ID == 0 {
+			return nil
+		}
+		revision, err := models.NextCardDAVRevision(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&group.CardDAVGroup).Update("sync_revision", revision).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&group.CardDAVGroup).Error
+	})
+}
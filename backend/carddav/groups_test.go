@@ -0,0 +1,200 @@
+package carddav
+
+import (
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func putCard(router http.Handler, path, card string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPut, path, strings.NewReader(card))
+	req.Header.Set("Content-Type", "text/vcard")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// groupCards returns the address data of the group cards in a sync response, keyed by href
+func groupCards(ms multiStatus) map[string]string {
+	cards := map[string]string{}
+	for _, resp := range ms.Responses {
+		for _, ps := range resp.PropStats {
+			for _, prop := range ps.Prop.Raw {
+				if prop.XMLName == addressDataName && strings.Contains(string(prop.Inner), "KIND:group") {
+					cards[resp.Hrefs[0]] = string(prop.Inner)
+				}
+			}
+		}
+	}
+	return cards
+}
+
+func TestGroups_CirclesAreGroupCards(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice", Circles: []string{"Work"}}).Error)
+	bob := models.Contact{UserID: userID, Firstname: "Bob", VCardUID: "bob", Circles: []string{"Work", "Chess"}}
+	require.NoError(t, db.Create(&bob).Error)
+
+	ms := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest("", 0)))
+	groups := groupCards(ms)
+	require.Len(t, groups, 2)
+	var workPath, chessPath string
+	for href, card := range groups {
+		switch {
+		case strings.Contains(card, "FN:Work"):
+			workPath = href
+			assert.Contains(t, card, "X-ADDRESSBOOKSERVER-KIND:group")
+			assert.Contains(t, card, "X-ADDRESSBOOKSERVER-MEMBER:urn:uuid:alice")
+			assert.Contains(t, card, "X-ADDRESSBOOKSERVER-MEMBER:urn:uuid:bob")
+		case strings.Contains(card, "FN:Chess"):
+			chessPath = href
+		}
+	}
+	require.NotEmpty(t, workPath)
+	require.NotEmpty(t, chessPath)
+
+	// Group cards only live in the "All" book
+	circleSync := decodeMultiStatus(t, doDAV(router, "REPORT", circleBookPath("Work"), syncRequest("", 0)))
+	assert.Empty(t, groupCards(circleSync))
+
+	// vCard 4.0 clients get KIND/MEMBER
+	req, _ := http.NewRequest(http.MethodGet, workPath, nil)
+	req.Header.Set("Accept", "text/vcard; version=4.0")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "KIND:group")
+	assert.Contains(t, w.Body.String(), "MEMBER:urn:uuid:alice")
+
+	// Bob leaves Chess: its group disappears, and Work's group is unchanged
+	bob.Circles = []string{"Work"}
+	require.NoError(t, db.Save(&bob).Error)
+	next := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest(ms.SyncToken, 0)))
+	updated, deleted := responsesByStatus(next)
+	assert.Equal(t, []string{testAddressBookPath + "bob.vcf"}, updated)
+	assert.Equal(t, []string{chessPath}, deleted)
+}
+
+func TestGroups_PagedInitialSync(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice", Circles: []string{"Work"}}).Error)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Bob", VCardUID: "bob"}).Error)
+	// Store the group card, then add contacts with later revisions
+	groups := groupCards(decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest("", 0))))
+	require.Len(t, groups, 1)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Carol", VCardUID: "carol"}).Error)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Dave", VCardUID: "dave"}).Error)
+
+	// A new client pages through the book one card at a time
+	var hrefs []string
+	token := ""
+	for page := 0; page < 10; page++ {
+		ms := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest(token, 1)))
+		updated, _ := responsesByStatus(ms)
+		hrefs = append(hrefs, updated...)
+		token = ms.SyncToken
+		if last := ms.Responses[len(ms.Responses)-1]; last.Status != statusLine(http.StatusInsufficientStorage) {
+			break
+		}
+	}
+	for groupPath := range groups {
+		assert.Contains(t, hrefs, groupPath)
+	}
+	assert.Len(t, hrefs, 5)
+}
+
+func TestGroups_ReadsDoNotWriteGroupRows(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice", Circles: []string{"Work"}}).Error)
+	groupRows := func() int64 {
+		var count int64
+		require.NoError(t, db.Unscoped().Model(&models.CardDAVGroup{}).Count(&count).Error)
+		return count
+	}
+
+	// Listing, fetching the group and missing a card leave the table alone
+	listing := decodeMultiStatus(t, propFindDepth(router, testAddressBookPath, "1"))
+	var groupPath string
+	for _, resp := range listing.Responses {
+		href := resp.Hrefs[0]
+		if href != testAddressBookPath && href != testAddressBookPath+"alice.vcf" {
+			groupPath = href
+		}
+	}
+	require.NotEmpty(t, groupPath)
+	assert.Equal(t, http.StatusOK, doDAV(router, http.MethodGet, groupPath, "").Code)
+	assert.Equal(t, http.StatusNotFound, doDAV(router, http.MethodGet, testAddressBookPath+"missing.vcf", "").Code)
+	assert.Zero(t, groupRows())
+
+	// A sync persists the group under the href clients already saw
+	ms := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest("", 0)))
+	groups := groupCards(ms)
+	assert.Contains(t, groups, groupPath)
+	assert.Equal(t, int64(1), groupRows())
+}
+
+func TestGroups_ClientCreatesRenamesAndDeletesGroup(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	alice := models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice"}
+	bob := models.Contact{UserID: userID, Firstname: "Bob", VCardUID: "bob", Circles: []string{"Family"}}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+	token := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest("", 0))).SyncToken
+
+	circlesOf := func(c *models.Contact) []string {
+		var reloaded models.Contact
+		require.NoError(t, db.First(&reloaded, c.ID).Error)
+		return reloaded.Circles
+	}
+
+	// Apple Contacts creates an empty group, then adds members
+	groupPath := testAddressBookPath + "phone-group.vcf"
+	group := "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:phone-group\r\nFN:Friends\r\nN:Friends;;;;\r\nX-ADDRESSBOOKSERVER-KIND:group\r\nEND:VCARD\r\n"
+	require.Equal(t, http.StatusCreated, putCard(router, groupPath, group).Code)
+	assert.Empty(t, circlesOf(&alice))
+
+	ms := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest(token, 0)))
+	updated, _ := responsesByStatus(ms)
+	assert.Equal(t, []string{groupPath}, updated, "empty groups created on the phone are kept")
+
+	group = strings.Replace(group, "END:VCARD", "X-ADDRESSBOOKSERVER-MEMBER:urn:uuid:alice\r\nX-ADDRESSBOOKSERVER-MEMBER:urn:uuid:bob\r\nEND:VCARD", 1)
+	require.Equal(t, http.StatusCreated, putCard(router, groupPath, group).Code)
+	assert.Equal(t, []string{"Friends"}, circlesOf(&alice))
+	assert.Equal(t, []string{"Family", "Friends"}, circlesOf(&bob))
+
+	// Renaming the group renames the circle; dropping a member removes it
+	renamed := "BEGIN:VCARD\r\nVERSION:4.0\r\nUID:phone-group\r\nFN:Close friends\r\nKIND:group\r\nMEMBER:urn:uuid:bob\r\nEND:VCARD\r\n"
+	require.Equal(t, http.StatusCreated, putCard(router, groupPath, renamed).Code)
+	assert.Empty(t, circlesOf(&alice))
+	assert.Equal(t, []string{"Family", "Close friends"}, circlesOf(&bob))
+
+	var row models.CardDAVGroup
+	require.NoError(t, db.Where("vcard_uid = ?", "phone-group").First(&row).Error)
+	assert.Equal(t, "Close friends", row.Name)
+
+	// Groups cannot be written into a circle's book
+	assert.Equal(t, http.StatusForbidden, putCard(router, circleBookPath("Family")+"g.vcf", renamed).Code)
+
+	// Deleting the group removes the circle from its members
+	ms = decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest("", 0)))
+	w := doDAV(router, http.MethodDelete, groupPath, "")
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	assert.Equal(t, []string{"Family"}, circlesOf(&bob))
+
+	next := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest(ms.SyncToken, 0)))
+	_, deleted := responsesByStatus(next)
+	assert.Equal(t, []string{groupPath}, deleted)
+}
+
+func TestGroupMemberUIDs(t *testing.T) {
+	card := GroupToVCard("g", "Work", []string{"a", "b"}, VCardVersion4)
+	card.Add(fieldAppleMember, card["MEMBER"][0])
+	assert.Equal(t, []string{"a", "b"}, groupMemberUIDs(card))
+	assert.True(t, IsGroupCard(card))
+	assert.False(t, IsGroupCard(ContactToVCardVersion(&models.Contact{Firstname: "Ada"}, "", VCardVersion4)))
+}
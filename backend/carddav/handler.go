@@ -43,6 +43,8 @@ func (h *Handler) GinHandler() gin.HandlerFunc {
 
 		// Set in request context for the backend
 		ctx := ContextWithUser(c.Request.Context(), userID.(uint), username.(string), h.db, h.photoDir)
+		ctx = ContextWithVCardVersion(ctx, requestedVCardVersion(c.Request))
+		ctx = contextWithPreconditions(ctx, c.Request)
 		c.Request = c.Request.WithContext(ctx)
 
 		// Handle principals endpoint specially for proper discovery
@@ -57,6 +59,16 @@ func (h *Handler) GinHandler() gin.HandlerFunc {
 			return
 		}
 
+		switch c.Request.Method {
+		case "REPORT":
+			if h.serveSyncReport(c.Writer, c.Request) {
+				return
+			}
+		case "PROPFIND":
+			h.servePropFind(c.Writer, c.Request)
+			return
+		}
+
 		h.handler.ServeHTTP(c.Writer, c.Request)
 	}
 }
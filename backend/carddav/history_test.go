@@ -0,0 +1,56 @@
+package carddav
+
+import (
+	"meerkat/models"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutAddressObject_RecordsHistory(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+
+	card := "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:alice\r\nFN:Alice Liddell\r\nN:Liddell;Alice;;;\r\nEND:VCARD\r\n"
+	path := testAddressBookPath + "alice.vcf"
+	require.Equal(t, http.StatusCreated, putCard(router, path, card).Code)
+	require.Equal(t, http.StatusCreated, putCard(router, path, strings.ReplaceAll(card, "Liddell", "Hargreaves")).Code)
+
+	var versions []models.ContactVersion
+	require.NoError(t, db.Where("user_id = ?", userID).Order("version").Find(&versions).Error)
+	require.Len(t, versions, 2)
+	for _, version := range versions {
+		assert.Equal(t, models.ContactSourceCardDAV, version.Source)
+		assert.Equal(t, "tester", version.Actor)
+	}
+	assert.Equal(t, "Hargreaves", versions[1].Snapshot.Lastname)
+	assert.JSONEq(t, `"Liddell"`, string(versions[1].Changes["lastname"].Old))
+}
+
+func TestGroupAndCircleEdits_RecordHistory(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	alice := models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice", Circles: []string{"Work"}}
+	require.NoError(t, db.Create(&alice).Error)
+	circlesOf := func(version models.ContactVersion) []string { return version.Snapshot.Circles }
+
+	// Adding to a group, deleting the group, and leaving a circle's book are all revertible
+	groupPath := testAddressBookPath + "friends.vcf"
+	group := "BEGIN:VCARD\r\nVERSION:4.0\r\nUID:friends\r\nFN:Friends\r\nKIND:group\r\nMEMBER:urn:uuid:alice\r\nEND:VCARD\r\n"
+	require.Equal(t, http.StatusCreated, putCard(router, groupPath, group).Code)
+	require.Equal(t, http.StatusNoContent, doDAV(router, http.MethodDelete, groupPath, "").Code)
+	require.Equal(t, http.StatusNoContent, doDAV(router, http.MethodDelete, circleBookPath("Work")+"alice.vcf", "").Code)
+
+	var versions []models.ContactVersion
+	require.NoError(t, db.Where("contact_id = ?", alice.ID).Order("version").Find(&versions).Error)
+	require.Len(t, versions, 4) // the state before history, then the three edits
+	assert.Equal(t, []string{"Work"}, circlesOf(versions[0]))
+	assert.Equal(t, []string{"Work", "Friends"}, circlesOf(versions[1]))
+	assert.Equal(t, []string{"Work"}, circlesOf(versions[2]))
+	assert.Empty(t, circlesOf(versions[3]))
+	for _, version := range versions[1:] {
+		assert.Equal(t, models.ContactSourceCardDAV, version.Source)
+		assert.Equal(t, "tester", version.Actor)
+	}
+}
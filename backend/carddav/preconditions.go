@@ -0,0 +1,68 @@
+package carddav
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/carddav"
+)
+
+const preconditionsKey contextKey = "preconditions"
+
+// preconditions are a request's If-Match / If-None-Match headers. go-webdav passes them to
+// PutAddressObject but not to DeleteAddressObject, so they also travel in the request context.
+type preconditions struct {
+	IfMatch     webdav.ConditionalMatch
+	IfNoneMatch webdav.ConditionalMatch
+}
+
+// contextWithPreconditions records the conditional headers of r in ctx
+func contextWithPreconditions(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, preconditionsKey, preconditions{
+		IfMatch:     webdav.ConditionalMatch(r.Header.Get("If-Match")),
+		IfNoneMatch: webdav.ConditionalMatch(r.Header.Get("If-None-Match")),
+	})
+}
+
+func preconditionsFromContext(ctx context.Context) preconditions {
+	p, _ := ctx.Value(preconditionsKey).(preconditions)
+	return p
+}
+
+// check evaluates the preconditions against the target resource (RFC 9110 section 13.1).
+// exists is false when nothing lives at the path yet; etag is the resource's current ETag.
+func (p preconditions) check(exists bool, etag string) error {
+	if p.IfMatch.IsSet() && !(exists && matchesETag(p.IfMatch, etag)) {
+		return webdav.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("ETag mismatch: resource has been modified"))
+	}
+	if p.IfNoneMatch.IsSet() && exists && matchesETag(p.IfNoneMatch, etag) {
+		return webdav.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("resource already exists"))
+	}
+	return nil
+}
+
+// putPreconditions returns the preconditions of a PUT
+func putPreconditions(opts *carddav.PutAddressObjectOptions) preconditions {
+	if opts == nil {
+		return preconditions{}
+	}
+	return preconditions{IfMatch: opts.IfMatch, IfNoneMatch: opts.IfNoneMatch}
+}
+
+// matchesETag reports whether a conditional header ("*" or a list of entity tags) matches etag.
+// Weak tags compare by their opaque value, as RFC 9110 prescribes for If-None-Match.
+func matchesETag(cond webdav.ConditionalMatch, etag string) bool {
+	if cond.IsWildcard() {
+		return true
+	}
+	for _, tag := range strings.Split(string(cond), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if len(tag) >= 2 && tag[0] == '"' && tag[len(tag)-1] == '"' && tag[1:len(tag)-1] == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package carddav
+
+import (
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-webdav"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func conditionalRequest(router http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/vcard")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPreconditions_Put(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	alice := models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice"}
+	require.NoError(t, db.Create(&alice).Error)
+	etag := strconv.Quote(alice.ETag)
+
+	card := "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:alice\r\nFN:Alice Liddell\r\nN:Liddell;Alice;;;\r\nEND:VCARD\r\n"
+	path := testAddressBookPath + "alice.vcf"
+
+	// Creating over an existing card
+	w := conditionalRequest(router, http.MethodPut, path, card, map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Updating a card that changed since the client fetched it
+	w = conditionalRequest(router, http.MethodPut, path, card, map[string]string{"If-Match": `"e-stale"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Updating from the current state succeeds and yields a new ETag
+	w = conditionalRequest(router, http.MethodPut, path, card, map[string]string{"If-Match": etag})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// A second device still holding the old ETag now conflicts, even within the same second
+	w = conditionalRequest(router, http.MethodPut, path, card, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	var reloaded models.Contact
+	require.NoError(t, db.First(&reloaded, alice.ID).Error)
+	assert.Equal(t, "Liddell", reloaded.Lastname)
+	assert.NotEqual(t, alice.ETag, reloaded.ETag)
+
+	// If-Match on a card that does not exist yet, If-None-Match: * on a new one
+	newCard := strings.ReplaceAll(card, "alice", "carol")
+	w = conditionalRequest(router, http.MethodPut, testAddressBookPath+"carol.vcf", newCard, map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = conditionalRequest(router, http.MethodPut, testAddressBookPath+"carol.vcf", newCard, map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestPreconditions_Delete(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	alice := models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice"}
+	require.NoError(t, db.Create(&alice).Error)
+	path := testAddressBookPath + "alice.vcf"
+
+	w := conditionalRequest(router, http.MethodDelete, path, "", map[string]string{"If-Match": `"e-stale"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	require.NoError(t, db.First(&models.Contact{}, alice.ID).Error, "contact must survive a failed precondition")
+
+	w = conditionalRequest(router, http.MethodDelete, path, "", map[string]string{"If-Match": `"other", ` + strconv.Quote(alice.ETag)})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = conditionalRequest(router, http.MethodDelete, path, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = conditionalRequest(router, http.MethodDelete, path, "", map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestMatchesETag(t *testing.T) {
+	assert.True(t, matchesETag(webdav.ConditionalMatch("*"), "e-1-1"))
+	assert.True(t, matchesETag(webdav.ConditionalMatch(`"e-1-1"`), "e-1-1"))
+	assert.True(t, matchesETag(webdav.ConditionalMatch(`"x", W/"e-1-1"`), "e-1-1"))
+	assert.False(t, matchesETag(webdav.ConditionalMatch(`"e-1-2"`), "e-1-1"))
+	assert.False(t, matchesETag(webdav.ConditionalMatch(`e-1-1`), "e-1-1"))
+}
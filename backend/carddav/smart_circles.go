@@ -0,0 +1,224 @@
+package carddav
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"meerkat/filters"
+	"meerkat/models"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/carddav"
+	"gorm.io/gorm"
+)
+
+// Every smart circle has a read-only address book of the contacts its filter currently matches.
+// Membership can change without any contact changing (e.g. "NOT activity:<90d" as time passes), so
+// the sync tokens of these books also carry a digest of the members: a token issued for another
+// member set is rejected and the client falls back to a full sync.
+const smartCircleSegmentPrefix = "smart-"
+
+// errSmartCircleReadOnly is returned for writes to a smart circle's address book
+var errSmartCircleReadOnly = webdav.NewHTTPError(http.StatusForbidden,
+	fmt.Errorf("smart circle address books are read-only; change the contacts or the smart circle's filter in Meerkat"))
+
+// smartBook is a smart circle together with its parsed filter
+type smartBook struct {
+	circle models.SmartCircle
+	filter *filters.ContactFilter
+}
+
+// smartAddressBook describes a smart circle's address book
+func (b *Backend) smartAddressBook(ctx context.Context, name string) *carddav.AddressBook {
+	ab := b.addressBook(ctx, name)
+	ab.Path = b.smartAddressBookPath(ctx, name)
+	ab.Description = fmt.Sprintf("Meerkat CRM contacts in the %s smart circle", name)
+	return ab
+}
+
+// smartAddressBookPath returns the collection path of a smart circle's address book
+func (b *Backend) smartAddressBookPath(ctx context.Context, name string) string {
+	return "/carddav/addressbooks/" + b.getUsername(ctx) + "/" + smartCircleSegmentPrefix +
+		base64.RawURLEncoding.EncodeToString([]byte(name)) + "/"
+}
+
+// smartBookFromPath resolves the path of a smart circle's address book, or of a card in it. ok is
+// false for paths outside smart circle books; a missing smart circle is an error.
+func (b *Backend) smartBookFromPath(ctx context.Context, urlPath string) (book *smartBook, ok bool, err error) {
+	homeSet := "/carddav/addressbooks/" + b.getUsername(ctx) + "/"
+	rest, found := strings.CutPrefix(urlPath, homeSet)
+	if !found {
+		return nil, false, nil
+	}
+	segment, _, _ := strings.Cut(rest, "/")
+	encoded, found := strings.CutPrefix(segment, smartCircleSegmentPrefix)
+	if !found {
+		return nil, false, nil
+	}
+
+	notFound := webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("address book not found"))
+	name, decodeErr := base64.RawURLEncoding.DecodeString(encoded)
+	if decodeErr != nil || len(name) == 0 || !utf8.Valid(name) {
+		return nil, true, notFound
+	}
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, true, err
+	}
+	circle, err := models.FindSmartCircle(b.getDB(ctx), userID, string(name))
+	if err != nil {
+		return nil, true, err
+	}
+	if circle == nil {
+		return nil, true, notFound
+	}
+	filter, err := filters.ParseContactFilter(circle.Filter)
+	if err != nil {
+		return nil, true, err
+	}
+	return &smartBook{circle: *circle, filter: filter}, true, nil
+}
+
+// members restricts a contacts query to the smart circle's members
+func (s *smartBook) members(query *gorm.DB) *gorm.DB {
+	return s.filter.Members(query, time.Now())
+}
+
+// smartBookMemberIDs returns the IDs of the smart circle's current members in ascending order
+func (b *Backend) smartBookMemberIDs(ctx context.Context, book *smartBook) ([]uint, error) {
+	var ids []uint
+	err := book.members(b.getDB(ctx).Model(&models.Contact{}).Where("contacts.user_id = ?", book.circle.UserID)).
+		Order("contacts.id").Pluck("contacts.id", &ids).Error
+	return ids, err
+}
+
+// smartBookSyncToken returns the sync token of a smart circle book at the given revision
+func smartBookSyncToken(revision int64, members []uint) string {
+	hash := sha256.New()
+	for _, id := range members {
+		_ = binary.Write(hash, binary.BigEndian, uint64(id))
+	}
+	return fmt.Sprintf("%s-%x", models.CardDAVSyncToken(revision), hash.Sum(nil)[:8])
+}
+
+// parseSmartBookSyncToken returns the revision of a token issued by smartBookSyncToken for the
+// given members
+func parseSmartBookSyncToken(token string, members []uint) (int64, error) {
+	i := strings.LastIndex(token, "-")
+	if i < 0 {
+		return 0, errInvalidSyncToken
+	}
+	revision, err := models.ParseCardDAVSyncToken(token[:i])
+	if err != nil || smartBookSyncToken(revision, members) != token {
+		return 0, errInvalidSyncToken
+	}
+	return revision, nil
+}
+
+// smartBookObject returns a member of the smart circle as an address object
+func (b *Backend) smartBookObject(ctx context.Context, book *smartBook, urlPath string) (*carddav.AddressObject, error) {
+	uid := extractUIDFromPath(urlPath)
+	if uid == "" {
+		return nil, fmt.Errorf("invalid path")
+	}
+	notFound := webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("contact not found"))
+	contact, err := b.findContact(b.getDB(ctx), book.circle.UserID, uid)
+	if err != nil {
+		return nil, notFound
+	}
+
+	var count int64
+	if err := book.members(b.getDB(ctx).Model(&models.Contact{}).Where("contacts.id = ?", contact.ID)).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, notFound
+	}
+	return b.contactObjectIn(ctx, b.smartAddressBookPath(ctx, book.circle.Name), contact), nil
+}
+
+// listSmartBookObjects returns all members of the smart circle as address objects
+func (b *Backend) listSmartBookObjects(ctx context.Context, book *smartBook) ([]carddav.AddressObject, error) {
+	var contacts []models.Contact
+	if err := book.members(b.getDB(ctx).Where("contacts.user_id = ?", book.circle.UserID)).Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+
+	bookPath := b.smartAddressBookPath(ctx, book.circle.Name)
+	objects := make([]carddav.AddressObject, 0, len(contacts))
+	for i := range contacts {
+		objects = append(objects, *b.contactObjectIn(ctx, bookPath, &contacts[i]))
+	}
+	return objects, nil
+}
+
+// syncSmartBook returns the changes in a smart circle's address book since query.SyncToken. A
+// token is only honoured while the members are the same as when it was issued; contacts that
+// changed since are then reported as updated when they are members and as deleted otherwise.
+func (b *Backend) syncSmartBook(ctx context.Context, book *smartBook, query *carddav.SyncQuery) (*syncResult, error) {
+	db := b.getDB(ctx)
+	userID := book.circle.UserID
+	current, err := models.CurrentCardDAVRevision(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs, err := b.smartBookMemberIDs(ctx, book)
+	if err != nil {
+		return nil, err
+	}
+	isMember := make(map[uint]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		isMember[id] = true
+	}
+
+	var since int64
+	if query.SyncToken != "" {
+		since, err = parseSmartBookSyncToken(query.SyncToken, memberIDs)
+		if err != nil {
+			return nil, errInvalidSyncToken
+		}
+		if valid, err := models.ValidCardDAVSyncRevision(db, userID, since, current); err != nil {
+			return nil, err
+		} else if !valid {
+			return nil, errInvalidSyncToken
+		}
+	}
+
+	q := db.Where("user_id = ? AND sync_revision <= ?", userID, current).Order("sync_revision, id")
+	if since > 0 {
+		q = q.Unscoped().Where("sync_revision > ?", since)
+	} else {
+		q = q.Where("id IN ?", memberIDs)
+	}
+	if query.Limit > 0 {
+		q = q.Limit(query.Limit + 1)
+	}
+
+	var contacts []models.Contact
+	if err := q.Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+
+	result := &syncResult{SyncResponse: carddav.SyncResponse{SyncToken: smartBookSyncToken(current, memberIDs)}}
+	if query.Limit > 0 && len(contacts) > query.Limit {
+		contacts = contacts[:query.Limit]
+		result.Truncated = true
+		result.SyncToken = smartBookSyncToken(contacts[len(contacts)-1].SyncRevision, memberIDs)
+	}
+
+	bookPath := b.smartAddressBookPath(ctx, book.circle.Name)
+	for i := range contacts {
+		if contacts[i].DeletedAt.Valid || !isMember[contacts[i].ID] {
+			result.Deleted = append(result.Deleted, bookPath+contactFileName(&contacts[i]))
+			continue
+		}
+		result.Updated = append(result.Updated, *b.contactObjectIn(ctx, bookPath, &contacts[i]))
+	}
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package carddav
+
+import (
+	"encoding/base64"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func smartBookPath(name string) string {
+	return "/carddav/addressbooks/tester/smart-" + base64.RawURLEncoding.EncodeToString([]byte(name)) + "/"
+}
+
+func TestSmartCircleBooks(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	alice := models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice", Organization: "ACME"}
+	bob := models.Contact{UserID: userID, Firstname: "Bob", VCardUID: "bob", Organization: "Globex"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Old", VCardUID: "old", Organization: "ACME", Archived: true}).Error)
+	require.NoError(t, db.Create(&models.SmartCircle{UserID: userID, Name: "ACME", Filter: "org:acme"}).Error)
+	book := smartBookPath("ACME")
+
+	// Listed next to the other address books, holding the members only
+	ms := decodeMultiStatus(t, propFindDepth(router, "/carddav/addressbooks/tester/", "1"))
+	var hrefs []string
+	for _, resp := range ms.Responses {
+		hrefs = append(hrefs, resp.Hrefs[0])
+	}
+	assert.Contains(t, hrefs, book)
+
+	ms = decodeMultiStatus(t, propFindDepth(router, book, "1"))
+	hrefs = nil
+	for _, resp := range ms.Responses {
+		hrefs = append(hrefs, resp.Hrefs[0])
+	}
+	assert.ElementsMatch(t, []string{book, book + "alice.vcf"}, hrefs)
+	assert.Equal(t, http.StatusOK, doDAV(router, http.MethodGet, book+"alice.vcf", "").Code)
+	assert.Equal(t, http.StatusNotFound, doDAV(router, http.MethodGet, book+"bob.vcf", "").Code)
+	assert.NotEqual(t, http.StatusMultiStatus, propFindDepth(router, smartBookPath("Missing"), "0").Code)
+
+	// Read-only
+	card := "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:carol\r\nFN:Carol\r\nN:;Carol;;;\r\nEND:VCARD\r\n"
+	req, _ := http.NewRequest(http.MethodPut, book+"carol.vcf", strings.NewReader(card))
+	req.Header.Set("Content-Type", "text/vcard")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusForbidden, doDAV(router, http.MethodDelete, book+"alice.vcf", "").Code)
+
+	// Incremental syncs work while the members stay the same
+	first := decodeMultiStatus(t, doDAV(router, "REPORT", book, syncRequest("", 0)))
+	updated, _ := responsesByStatus(first)
+	assert.Equal(t, []string{book + "alice.vcf"}, updated)
+
+	require.NoError(t, db.Model(&alice).Update("lastname", "Liddell").Error)
+	require.NoError(t, db.Model(&bob).Update("lastname", "Builder").Error)
+	next := decodeMultiStatus(t, doDAV(router, "REPORT", book, syncRequest(first.SyncToken, 0)))
+	updated, deleted := responsesByStatus(next)
+	assert.Equal(t, []string{book + "alice.vcf"}, updated)
+	assert.Equal(t, []string{book + "bob.vcf"}, deleted)
+
+	// Once they change, the client has to start over
+	require.NoError(t, db.Model(&bob).Update("organization", "ACME").Error)
+	w = doDAV(router, "REPORT", book, syncRequest(next.SyncToken, 0))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "valid-sync-token")
+	updated, _ = responsesByStatus(decodeMultiStatus(t, doDAV(router, "REPORT", book, syncRequest("", 0))))
+	assert.ElementsMatch(t, []string{book + "alice.vcf", book + "bob.vcf"}, updated)
+
+	// Deleting the address book deletes the smart circle, not its contacts
+	assert.Equal(t, http.StatusNoContent, doDAV(router, http.MethodDelete, book, "").Code)
+	var count int64
+	db.Model(&models.SmartCircle{}).Count(&count)
+	assert.Zero(t, count)
+	db.Model(&models.Contact{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
@@ -0,0 +1,558 @@
+package carddav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"meerkat/logger"
+	"meerkat/models"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-vcard"
+	"github.com/emersion/go-webdav/carddav"
+)
+
+// go-webdav only serves addressbook-query and addressbook-multiget REPORTs and does not know the
+// sync-token/getctag collection properties. This file adds RFC 6578 sync-collection on top of it:
+// sync-collection REPORTs are answered here, and PROPFIND responses for address books are
+// post-processed to fill in the properties the library reports as 404.
+
+const (
+	carddavNamespace        = "urn:ietf:params:xml:ns:carddav"
+	calendarServerNamespace = "http://calendarserver.org/ns/"
+)
+
+var (
+	syncCollectionName     = xml.Name{Space: "DAV:", Local: "sync-collection"}
+	syncTokenName          = xml.Name{Space: "DAV:", Local: "sync-token"}
+	supportedReportSetName = xml.Name{Space: "DAV:", Local: "supported-report-set"}
+	getETagName            = xml.Name{Space: "DAV:", Local: "getetag"}
+	getContentTypeName     = xml.Name{Space: "DAV:", Local: "getcontenttype"}
+	getLastModifiedName    = xml.Name{Space: "DAV:", Local: "getlastmodified"}
+	getCTagName            = xml.Name{Space: calendarServerNamespace, Local: "getctag"}
+	addressDataName        = xml.Name{Space: carddavNamespace, Local: "address-data"}
+)
+
+// errInvalidSyncToken signals a sync token this server did not issue or can no longer honour
+var errInvalidSyncToken = errors.New("invalid sync token")
+
+// syncResult is the outcome of a sync-collection query
+type syncResult struct {
+	carddav.SyncResponse
+	// Truncated is set when the limit cut the change set short; SyncToken then only covers what was returned
+	Truncated bool
+}
+
+// SyncAddressObjects returns the changes in an address book since query.SyncToken.
+// An empty token returns every contact in the book; otherwise soft-deleted contacts and, in a
+// circle's book, changed contacts outside the circle are reported in Deleted.
+func (b *Backend) SyncAddressObjects(ctx context.Context, urlPath string, query *carddav.SyncQuery) (*syncResult, error) {
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := b.GetAddressBook(ctx, urlPath); err != nil {
+		return nil, err
+	}
+	if book, ok, err := b.smartBookFromPath(ctx, urlPath); ok {
+		if err != nil {
+			return nil, err
+		}
+		return b.syncSmartBook(ctx, book, query)
+	}
+	circle, err := b.circleFromPath(ctx, urlPath)
+	if err != nil {
+		return nil, err
+	}
+
+	db := b.getDB(ctx)
+	current, err := models.CurrentCardDAVRevision(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var since int64
+	if query.SyncToken != "" {
+		since, err = models.ParseCardDAVSyncToken(query.SyncToken)
+		if err != nil {
+			return nil, errInvalidSyncToken
+		}
+		if valid, err := models.ValidCardDAVSyncRevision(db, userID, since, current); err != nil {
+			return nil, err
+		} else if !valid {
+			return nil, errInvalidSyncToken
+		}
+	}
+
+	q := db.Where("user_id = ? AND sync_revision <= ?", userID, current).Order("sync_revision, id")
+	if since > 0 {
+		// Incremental syncs include soft-deleted rows (and, for circles, contacts that may have
+		// left the circle) so removals can be reported
+		q = q.Unscoped().Where("sync_revision > ?", since)
+	} else if circle != "" {
+		q = inCircle(q, circle)
+	}
+	if query.Limit > 0 {
+		q = q.Limit(query.Limit + 1)
+	}
+
+	var contacts []models.Contact
+	if err := q.Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+	contactsCut := query.Limit > 0 && len(contacts) > query.Limit
+
+	// Group cards of the "All" book are stamped with contact revisions, so they are sorted in
+	// among the contacts and a page ends at the same revision for both
+	items := make([]syncItem, 0, len(contacts))
+	for i := range contacts {
+		items = append(items, syncItem{revision: contacts[i].SyncRevision, contact: &contacts[i]})
+	}
+	if circle == "" {
+		groups, err := b.syncGroups(ctx, since)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, groups...)
+		sort.SliceStable(items, func(i, j int) bool { return items[i].revision < items[j].revision })
+	}
+
+	result := &syncResult{SyncResponse: carddav.SyncResponse{SyncToken: models.CardDAVSyncToken(current)}}
+	if query.Limit > 0 && len(items) > query.Limit {
+		// The next page starts after the last revision on this one, so a revision is never split
+		end := query.Limit
+		for end < len(items) && items[end].revision == items[end-1].revision {
+			end++
+		}
+		if end < len(items) || contactsCut {
+			items = items[:end]
+			result.Truncated = true
+			result.SyncToken = models.CardDAVSyncToken(items[end-1].revision)
+		}
+	}
+
+	for _, item := range items {
+		switch {
+		case item.group != nil:
+			result.Updated = append(result.Updated, *b.groupToAddressObject(ctx, item.group))
+		case item.removedGroup != nil:
+			result.Deleted = append(result.Deleted, b.groupPath(ctx, item.removedGroup))
+		case item.contact.DeletedAt.Valid || !contactInCircle(item.contact, circle):
+			result.Deleted = append(result.Deleted, b.contactPath(ctx, circle, item.contact))
+		default:
+			result.Updated = append(result.Updated, *b.contactToAddressObject(ctx, circle, item.contact))
+		}
+	}
+
+	return result, nil
+}
+
+// syncItem is a contact, group card or removed group card in a sync-collection response
+type syncItem struct {
+	revision     int64
+	contact      *models.Contact
+	group        *groupCard
+	removedGroup *models.CardDAVGroup
+}
+
+// syncGroups returns the group cards of the "All" book that changed since the given revision,
+// and with a token also the ones removed since
+func (b *Backend) syncGroups(ctx context.Context, since int64) ([]syncItem, error) {
+	userID, err := b.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := b.reconcileGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var items []syncItem
+	for i := range groups {
+		if groups[i].SyncRevision > since {
+			items = append(items, syncItem{revision: groups[i].SyncRevision, group: &groups[i]})
+		}
+	}
+	if since == 0 {
+		return items, nil
+	}
+
+	var removed []models.CardDAVGroup
+	if err := b.getDB(ctx).Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL AND sync_revision > ?", userID, since).Find(&removed).Error; err != nil {
+		return nil, err
+	}
+	for i := range removed {
+		items = append(items, syncItem{revision: removed[i].SyncRevision, removedGroup: &removed[i]})
+	}
+	return items, nil
+}
+
+// rawElement captures an arbitrary XML element so it can be passed through unchanged
+type rawElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   []byte     `xml:",innerxml"`
+}
+
+// MarshalXML drops the namespace declarations captured on decode; the encoder emits its own
+func (e rawElement) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	type plain rawElement
+	out := plain{XMLName: e.XMLName, Inner: e.Inner}
+	for _, attr := range e.Attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		out.Attrs = append(out.Attrs, attr)
+	}
+	return enc.Encode(out)
+}
+
+// textElement builds an element holding escaped character data
+func textElement(name xml.Name, value string) rawElement {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(value))
+	return rawElement{XMLName: name, Inner: buf.Bytes()}
+}
+
+// multiStatus mirrors the DAV:multistatus structure go-webdav writes
+type multiStatus struct {
+	XMLName             xml.Name      `xml:"DAV: multistatus"`
+	Responses           []davResponse `xml:"DAV: response"`
+	ResponseDescription string        `xml:"DAV: responsedescription,omitempty"`
+	SyncToken           string        `xml:"DAV: sync-token,omitempty"`
+}
+
+type davResponse struct {
+	Hrefs               []string    `xml:"DAV: href"`
+	PropStats           []propStat  `xml:"DAV: propstat,omitempty"`
+	Status              string      `xml:"DAV: status,omitempty"`
+	Error               *rawElement `xml:"DAV: error,omitempty"`
+	ResponseDescription string      `xml:"DAV: responsedescription,omitempty"`
+	Location            *rawElement `xml:"DAV: location,omitempty"`
+}
+
+type propStat struct {
+	Prop                prop   `xml:"DAV: prop"`
+	Status              string `xml:"DAV: status"`
+	ResponseDescription string `xml:"DAV: responsedescription,omitempty"`
+}
+
+type prop struct {
+	Raw []rawElement `xml:",any"`
+}
+
+type syncCollectionRequest struct {
+	XMLName   xml.Name `xml:"DAV: sync-collection"`
+	SyncToken string   `xml:"DAV: sync-token"`
+	SyncLevel string   `xml:"DAV: sync-level"`
+	NResults  int      `xml:"DAV: limit>nresults"`
+	Prop      prop     `xml:"DAV: prop"`
+}
+
+func statusLine(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+func hrefFor(p string) string {
+	return (&url.URL{Path: p}).String()
+}
+
+// serveSyncReport answers a sync-collection REPORT. It returns false (with the body restored)
+// for any other REPORT so go-webdav can handle it.
+func (h *Handler) serveSyncReport(w http.ResponseWriter, r *http.Request) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "carddav: failed to read request body", http.StatusBadRequest)
+		return true
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if !isRootElement(body, syncCollectionName) {
+		return false
+	}
+
+	var req syncCollectionRequest
+	if err := xml.Unmarshal(body, &req); err != nil {
+		http.Error(w, "carddav: malformed sync-collection request", http.StatusBadRequest)
+		return true
+	}
+	// The address book is flat, so "infinite" is equivalent to "1"
+	if level := strings.TrimSpace(req.SyncLevel); level != "" && level != "1" && level != "infinite" {
+		http.Error(w, "carddav: unsupported sync-level", http.StatusBadRequest)
+		return true
+	}
+
+	ctx := r.Context()
+	ab, err := h.backend.GetAddressBook(ctx, r.URL.Path)
+	if err != nil {
+		http.Error(w, "carddav: address book not found", http.StatusNotFound)
+		return true
+	}
+
+	result, err := h.backend.SyncAddressObjects(ctx, ab.Path, &carddav.SyncQuery{
+		SyncToken: strings.TrimSpace(req.SyncToken),
+		Limit:     req.NResults,
+	})
+	if errors.Is(err, errInvalidSyncToken) {
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: "DAV:", Local: "valid-sync-token"})
+		return true
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("CardDAV sync-collection failed")
+		http.Error(w, "carddav: sync failed", http.StatusInternalServerError)
+		return true
+	}
+
+	ms := multiStatus{SyncToken: result.SyncToken}
+	for i := range result.Updated {
+		ms.Responses = append(ms.Responses, syncObjectResponse(&result.Updated[i], req.Prop.Raw))
+	}
+	for _, p := range result.Deleted {
+		ms.Responses = append(ms.Responses, davResponse{Hrefs: []string{hrefFor(p)}, Status: statusLine(http.StatusNotFound)})
+	}
+	if result.Truncated {
+		ms.Responses = append(ms.Responses, davResponse{
+			Hrefs:  []string{hrefFor(ab.Path)},
+			Status: statusLine(http.StatusInsufficientStorage),
+			Error: &rawElement{
+				XMLName: xml.Name{Space: "DAV:", Local: "error"},
+				Inner:   []byte(`<number-of-matches-within-limits xmlns="DAV:"/>`),
+			},
+		})
+	}
+
+	writeMultiStatus(w, &ms)
+	return true
+}
+
+// syncObjectResponse renders the requested properties of a changed contact
+func syncObjectResponse(ao *carddav.AddressObject, requested []rawElement) davResponse {
+	var found, missing []rawElement
+	for _, requestedProp := range requested {
+		switch name := requestedProp.XMLName; name {
+		case getETagName:
+			found = append(found, textElement(getETagName, strconv.Quote(ao.ETag)))
+		case getContentTypeName:
+			found = append(found, textElement(getContentTypeName, vcard.MIMEType))
+		case getLastModifiedName:
+			found = append(found, textElement(getLastModifiedName, ao.ModTime.UTC().Format(http.TimeFormat)))
+		case addressDataName:
+			var buf bytes.Buffer
+			if err := vcard.NewEncoder(&buf).Encode(ao.Card); err != nil {
+				missing = append(missing, rawElement{XMLName: name})
+				continue
+			}
+			found = append(found, textElement(addressDataName, buf.String()))
+		default:
+			missing = append(missing, rawElement{XMLName: name})
+		}
+	}
+
+	resp := davResponse{Hrefs: []string{hrefFor(ao.Path)}}
+	if len(found) > 0 || len(missing) == 0 {
+		resp.PropStats = append(resp.PropStats, propStat{Prop: prop{Raw: found}, Status: statusLine(http.StatusOK)})
+	}
+	if len(missing) > 0 {
+		resp.PropStats = append(resp.PropStats, propStat{Prop: prop{Raw: missing}, Status: statusLine(http.StatusNotFound)})
+	}
+	return resp
+}
+
+// servePropFind runs the PROPFIND through go-webdav and fills in the sync properties of address book collections
+func (h *Handler) servePropFind(w http.ResponseWriter, r *http.Request) {
+	buf := &bufferedResponseWriter{header: http.Header{}, status: http.StatusOK}
+	h.handler.ServeHTTP(buf, r)
+
+	body := buf.body.Bytes()
+	if buf.status == http.StatusMultiStatus {
+		if rewritten, err := h.fillCollectionProps(r.Context(), body); err != nil {
+			logger.Warn().Err(err).Msg("Failed to add CardDAV sync properties to PROPFIND response")
+		} else {
+			body = rewritten
+		}
+	}
+
+	for key, values := range buf.header {
+		if key == "Content-Length" {
+			continue
+		}
+		w.Header()[key] = values
+	}
+	w.WriteHeader(buf.status)
+	_, _ = w.Write(body)
+}
+
+// fillCollectionProps moves sync-token, getctag and supported-report-set of address books from the
+// 404 propstat go-webdav produces into a 200 propstat with their actual values
+func (h *Handler) fillCollectionProps(ctx context.Context, body []byte) ([]byte, error) {
+	var ms multiStatus
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for i := range ms.Responses {
+		resp := &ms.Responses[i]
+		if len(resp.Hrefs) != 1 {
+			continue
+		}
+		p, err := url.PathUnescape(resp.Hrefs[0])
+		if err != nil {
+			continue
+		}
+		if _, err := h.backend.GetAddressBook(ctx, p); err != nil {
+			continue
+		}
+
+		values, err := h.collectionProps(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		if resolveMissingProps(resp, values) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return body, nil
+	}
+
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	if err := xml.NewEncoder(&out).Encode(&ms); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// collectionProps returns the values of the address book properties go-webdav does not provide
+// for the address book at bookPath
+func (h *Handler) collectionProps(ctx context.Context, bookPath string) (map[xml.Name]rawElement, error) {
+	userID, err := h.backend.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	revision, err := models.CurrentCardDAVRevision(h.backend.getDB(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	token := models.CardDAVSyncToken(revision)
+	if book, ok, err := h.backend.smartBookFromPath(ctx, bookPath); ok {
+		if err != nil {
+			return nil, err
+		}
+		memberIDs, err := h.backend.smartBookMemberIDs(ctx, book)
+		if err != nil {
+			return nil, err
+		}
+		token = smartBookSyncToken(revision, memberIDs)
+	}
+
+	return map[xml.Name]rawElement{
+		syncTokenName: textElement(syncTokenName, token),
+		// The ctag only has to change whenever the collection does, so the sync token serves
+		getCTagName: textElement(getCTagName, token),
+		supportedReportSetName: {
+			XMLName: supportedReportSetName,
+			Inner: []byte(`<supported-report><report><addressbook-query xmlns="` + carddavNamespace + `"/></report></supported-report>` +
+				`<supported-report><report><addressbook-multiget xmlns="` + carddavNamespace + `"/></report></supported-report>` +
+				`<supported-report><report><sync-collection/></report></supported-report>`),
+		},
+	}, nil
+}
+
+// resolveMissingProps moves properties present in values out of the response's 404 propstat
+func resolveMissingProps(resp *davResponse, values map[xml.Name]rawElement) bool {
+	var resolved []rawElement
+	notFound := statusLine(http.StatusNotFound)
+	propStats := resp.PropStats[:0]
+	for _, ps := range resp.PropStats {
+		if ps.Status == notFound {
+			remaining := ps.Prop.Raw[:0]
+			for _, el := range ps.Prop.Raw {
+				if value, ok := values[el.XMLName]; ok {
+					resolved = append(resolved, value)
+				} else {
+					remaining = append(remaining, el)
+				}
+			}
+			ps.Prop.Raw = remaining
+			if len(remaining) == 0 {
+				continue
+			}
+		}
+		propStats = append(propStats, ps)
+	}
+	resp.PropStats = propStats
+
+	if len(resolved) == 0 {
+		return false
+	}
+
+	ok := statusLine(http.StatusOK)
+	for i := range resp.PropStats {
+		if resp.PropStats[i].Status == ok {
+			resp.PropStats[i].Prop.Raw = append(resp.PropStats[i].Prop.Raw, resolved...)
+			return true
+		}
+	}
+	resp.PropStats = append(resp.PropStats, propStat{Prop: prop{Raw: resolved}, Status: ok})
+	return true
+}
+
+// isRootElement reports whether the XML document's root element has the given name
+func isRootElement(body []byte, name xml.Name) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name == name
+		}
+	}
+}
+
+func writeMultiStatus(w http.ResponseWriter, ms *multiStatus) {
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(ms)
+}
+
+// writeDAVError writes a DAV:error body naming the failed precondition
+func writeDAVError(w http.ResponseWriter, status int, condition xml.Name) {
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(&rawElement{
+		XMLName: xml.Name{Space: "DAV:", Local: "error"},
+		Inner:   []byte(`<` + condition.Local + ` xmlns="` + condition.Space + `"/>`),
+	})
+}
+
+// bufferedResponseWriter holds a response in memory so it can be rewritten before sending
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
@@ -0,0 +1,201 @@
+package carddav
+
+import (
+	"encoding/xml"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const testAddressBookPath = "/carddav/addressbooks/tester/contacts/"
+
+func setupCardDAV(t *testing.T) (*gorm.DB, *gin.Engine, uint) {
+	gin.SetMode(gin.ReleaseMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Contact{}, &models.CardDAVSync{}, &models.CardDAVGroup{}, &models.SmartCircle{}, &models.ContactVersion{}, &models.ReminderSnooze{}))
+
+	user := models.User{Username: "tester", Password: "password123", Email: "tester@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+
+	handler := NewHandler(db, t.TempDir())
+	router := gin.New()
+	group := router.Group("/carddav")
+	group.Use(func(c *gin.Context) {
+		c.Set("userID", user.ID)
+		c.Set("username", user.Username)
+		c.Next()
+	})
+	group.Any("/*path", handler.GinHandler())
+	group.Handle("PROPFIND", "/*path", handler.GinHandler())
+	group.Handle("REPORT", "/*path", handler.GinHandler())
+
+	return db, router, user.ID
+}
+
+func syncRequest(token string, limit int) string {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<d:sync-collection xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav">
+  <d:sync-token>` + token + `</d:sync-token>
+  <d:sync-level>1</d:sync-level>`
+	if limit > 0 {
+		body += `<d:limit><d:nresults>` + strconv.Itoa(limit) + `</d:nresults></d:limit>`
+	}
+	return body + `
+  <d:prop><d:getetag/><card:address-data/></d:prop>
+</d:sync-collection>`
+}
+
+func doDAV(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "0")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func decodeMultiStatus(t *testing.T, w *httptest.ResponseRecorder) multiStatus {
+	require.Equal(t, http.StatusMultiStatus, w.Code, w.Body.String())
+	var ms multiStatus
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &ms))
+	return ms
+}
+
+// responsesByStatus splits a sync response into changed hrefs and deleted hrefs
+func responsesByStatus(ms multiStatus) (updated, deleted []string) {
+	for _, resp := range ms.Responses {
+		if resp.Status == statusLine(http.StatusNotFound) {
+			deleted = append(deleted, resp.Hrefs[0])
+		} else if len(resp.PropStats) > 0 {
+			updated = append(updated, resp.Hrefs[0])
+		}
+	}
+	return updated, deleted
+}
+
+func TestSyncCollection_InitialAndIncremental(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+
+	alice := models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice"}
+	bob := models.Contact{UserID: userID, Firstname: "Bob", VCardUID: "bob"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+
+	ms := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest("", 0)))
+	updated, deleted := responsesByStatus(ms)
+	assert.ElementsMatch(t, []string{testAddressBookPath + "alice.vcf", testAddressBookPath + "bob.vcf"}, updated)
+	assert.Empty(t, deleted)
+	require.NotEmpty(t, ms.SyncToken)
+
+	// The full card and etag are returned for changed contacts
+	props := ms.Responses[0].PropStats[0].Prop.Raw
+	require.Len(t, props, 2)
+	assert.Equal(t, getETagName, props[0].XMLName)
+	assert.Contains(t, string(props[1].Inner), "BEGIN:VCARD")
+
+	// No changes: empty response with the same token
+	same := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest(ms.SyncToken, 0)))
+	assert.Empty(t, same.Responses)
+	assert.Equal(t, ms.SyncToken, same.SyncToken)
+
+	carol := models.Contact{UserID: userID, Firstname: "Carol", VCardUID: "carol"}
+	require.NoError(t, db.Create(&carol).Error)
+	require.NoError(t, db.Model(&alice).Update("lastname", "Liddell").Error)
+	require.NoError(t, db.Delete(&bob).Error)
+
+	next := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest(ms.SyncToken, 0)))
+	updated, deleted = responsesByStatus(next)
+	assert.ElementsMatch(t, []string{testAddressBookPath + "alice.vcf", testAddressBookPath + "carol.vcf"}, updated)
+	assert.Equal(t, []string{testAddressBookPath + "bob.vcf"}, deleted)
+	assert.NotEqual(t, ms.SyncToken, next.SyncToken)
+}
+
+func TestSyncCollection_Limit(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: name, VCardUID: name}).Error)
+	}
+
+	first := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest("", 2)))
+	updated, _ := responsesByStatus(first)
+	assert.Equal(t, []string{testAddressBookPath + "a.vcf", testAddressBookPath + "b.vcf"}, updated)
+	last := first.Responses[len(first.Responses)-1]
+	assert.Equal(t, statusLine(http.StatusInsufficientStorage), last.Status)
+	assert.Equal(t, testAddressBookPath, last.Hrefs[0])
+
+	rest := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, syncRequest(first.SyncToken, 2)))
+	updated, _ = responsesByStatus(rest)
+	assert.Equal(t, []string{testAddressBookPath + "c.vcf"}, updated)
+}
+
+func TestSyncCollection_InvalidToken(t *testing.T) {
+	_, router, _ := setupCardDAV(t)
+
+	for _, token := range []string{"bogus", models.CardDAVSyncToken(99)} {
+		w := doDAV(router, "REPORT", testAddressBookPath, syncRequest(token, 0))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "valid-sync-token")
+	}
+}
+
+func TestPropFind_AddressBookSyncProperties(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Alice"}).Error)
+
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/">
+  <d:prop><d:displayname/><d:resourcetype/><d:sync-token/><cs:getctag/><d:supported-report-set/><d:quota-used-bytes/></d:prop>
+</d:propfind>`
+	w := doDAV(router, "PROPFIND", testAddressBookPath, body)
+	ms := decodeMultiStatus(t, w)
+	require.Len(t, ms.Responses, 1)
+	// Rewritten properties must not carry duplicate namespace declarations
+	assert.NotContains(t, w.Body.String(), `xmlns="DAV:" xmlns="DAV:"`)
+
+	found := map[xml.Name]string{}
+	var missing []xml.Name
+	for _, ps := range ms.Responses[0].PropStats {
+		for _, prop := range ps.Prop.Raw {
+			if ps.Status == statusLine(http.StatusOK) {
+				found[prop.XMLName] = string(prop.Inner)
+			} else {
+				missing = append(missing, prop.XMLName)
+			}
+		}
+	}
+
+	assert.Equal(t, models.CardDAVSyncToken(1), found[syncTokenName])
+	assert.Equal(t, models.CardDAVSyncToken(1), found[getCTagName])
+	assert.Contains(t, found[supportedReportSetName], "sync-collection")
+	assert.Equal(t, "All", found[xml.Name{Space: "DAV:", Local: "displayname"}])
+	assert.Equal(t, []xml.Name{{Space: "DAV:", Local: "quota-used-bytes"}}, missing)
+}
+
+func TestReport_OtherReportsPassThrough(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice"}).Error)
+
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<card:addressbook-multiget xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav">
+  <d:prop><d:getetag/></d:prop>
+  <d:href>` + testAddressBookPath + `alice.vcf</d:href>
+</card:addressbook-multiget>`
+	ms := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, body))
+	require.Len(t, ms.Responses, 1)
+	assert.Equal(t, testAddressBookPath+"alice.vcf", ms.Responses[0].Hrefs[0])
+}
@@ -28,10 +28,22 @@ type VCardExtra struct {
 
 // ContactToVCard converts a Contact to a vCard 3.0 card.
 func ContactToVCard(contact *models.Contact, photoDir string) vcard.Card {
+	return ContactToVCardVersion(contact, photoDir, VCardVersion3)
+}
+
+// ContactToVCardVersion converts a Contact to a card of the given vCard version (3.0 or 4.0).
+// vCard 3.0 has no ANNIVERSARY, GENDER or KIND, so those use the X- extensions common clients read.
+func ContactToVCardVersion(contact *models.Contact, photoDir string, version string) vcard.Card {
 	card := make(vcard.Card)
+	v4 := version == VCardVersion4
 
-	// Required: VERSION - use 3.0 for iOS compatibility
-	card.SetValue(vcard.FieldVersion, "3.0")
+	// Required: VERSION - 3.0 unless 4.0 was negotiated (iOS only understands 3.0)
+	if v4 {
+		card.SetValue(vcard.FieldVersion, VCardVersion4)
+		card.SetKind(vcard.KindIndividual)
+	} else {
+		card.SetValue(vcard.FieldVersion, VCardVersion3)
+	}
 
 	// UID - use VCardUID if set, otherwise generate a new one
 	uid := contact.VCardUID
@@ -77,8 +89,12 @@ func ContactToVCard(contact *models.Contact, photoDir string) vcard.Card {
 		if e.Value == "" {
 			continue
 		}
-		// EMAIL always carries INTERNET (vCard 3.0) regardless of label.
-		addTypedField(card, vcard.FieldEmail, &vcard.Field{Value: e.Value}, e.Type, nextGroup, "INTERNET")
+		// EMAIL always carries INTERNET in vCard 3.0 regardless of label; 4.0 dropped it.
+		if v4 {
+			addTypedField(card, vcard.FieldEmail, &vcard.Field{Value: e.Value}, e.Type, nextGroup)
+		} else {
+			addTypedField(card, vcard.FieldEmail, &vcard.Field{Value: e.Value}, e.Type, nextGroup, "INTERNET")
+		}
 	}
 
 	// TEL (phone) - emit every entry; fall back to the legacy scalar if the array is empty
@@ -118,7 +134,8 @@ func ContactToVCard(contact *models.Contact, photoDir string) vcard.Card {
 		addTypedField(card, vcard.FieldURL, &vcard.Field{Value: u.Value}, u.Type, nextGroup)
 	}
 
-	// IMPP (instant messaging / social handles) - service goes in the X-SERVICE-TYPE param
+	// IMPP (instant messaging / social handles) - service goes in the X-SERVICE-TYPE param.
+	// vCard 4.0 requires a URI value, so the handle gets the service's scheme there.
 	for _, im := range contact.IMPPs {
 		if im.Value == "" {
 			continue
@@ -127,17 +144,35 @@ func ContactToVCard(contact *models.Contact, photoDir string) vcard.Card {
 		if im.Type != "" {
 			params["X-SERVICE-TYPE"] = []string{im.Type}
 		}
-		card.Add(vcard.FieldIMPP, &vcard.Field{Value: im.Value, Params: params})
+		value := im.Value
+		if v4 {
+			value = imppURI(im.Type, im.Value)
+		}
+		card.Add(vcard.FieldIMPP, &vcard.Field{Value: value, Params: params})
 	}
 
-	// BDAY (birthday) - vCard 3.0 uses YYYY-MM-DD; store as-is (--MM-DD is also accepted)
+	// BDAY (birthday) - vCard 3.0 uses YYYY-MM-DD as stored (--MM-DD is also accepted);
+	// vCard 4.0 uses the basic format (YYYYMMDD / --MMDD)
 	if contact.Birthday != "" {
-		card.SetValue(vcard.FieldBirthday, contact.Birthday)
+		card.SetValue(vcard.FieldBirthday, formatVCardDate(contact.Birthday, v4))
 	}
 
-	// ANNIVERSARY
+	// ANNIVERSARY (X-ANNIVERSARY in vCard 3.0)
 	if contact.Anniversary != "" {
-		card.SetValue(vcard.FieldAnniversary, contact.Anniversary)
+		if v4 {
+			card.SetValue(vcard.FieldAnniversary, formatVCardDate(contact.Anniversary, true))
+		} else {
+			card.SetValue(fieldXAnniversary, contact.Anniversary)
+		}
+	}
+
+	// GENDER (X-GENDER in vCard 3.0)
+	if sex := mapGenderToVCard(contact.Gender); sex != vcard.SexUnspecified {
+		if v4 {
+			card.SetGender(sex, "")
+		} else {
+			card.SetValue(fieldXGender, string(sex))
+		}
 	}
 
 	// CATEGORIES (circles)
@@ -168,11 +203,12 @@ func ContactToVCard(contact *models.Contact, photoDir string) vcard.Card {
 	}
 
 	// PHOTO - read from disk, fall back to thumbnail
-	// Include both vCard 3.0 and 4.0 parameters for maximum compatibility:
-	// - ENCODING=b and TYPE=JPEG for vCard 3.0 (required by iOS)
-	// - MEDIATYPE=image/jpeg for vCard 4.0
+	// - vCard 3.0: inline base64 with ENCODING=b and TYPE=JPEG (required by iOS)
+	// - vCard 4.0: data: URI carrying the media type
 	photoData, mediaType := readContactPhoto(contact, photoDir)
-	if photoData != "" {
+	if photoData != "" && v4 {
+		card.Set(vcard.FieldPhoto, &vcard.Field{Value: "data:" + mediaType + ";base64," + photoData})
+	} else if photoData != "" {
 		// Extract just the image type (e.g., "JPEG" from "image/jpeg")
 		imageType := "JPEG"
 		if strings.Contains(mediaType, "png") {
@@ -327,9 +363,13 @@ func VCardToContact(card vcard.Card, existing *models.Contact) (*models.Contact,
 			if service == "" {
 				service = typeFromField(f)
 			}
+			schemeService, handle := parseIMPP(f.Value)
+			if service == "" {
+				service = schemeService
+			}
 			contact.IMPPs = append(contact.IMPPs, models.ContactIMPP{
 				Type:  service,
-				Value: f.Value,
+				Value: handle,
 			})
 		}
 	}
@@ -339,8 +379,10 @@ func VCardToContact(card vcard.Card, existing *models.Contact) (*models.Contact,
 		contact.Birthday = normalizeBirthday(bday)
 	}
 
-	// GENDER
-	if gender := card.Value(vcard.FieldGender); gender != "" {
+	// GENDER (vCard 4.0) or X-GENDER (vCard 3.0)
+	if sex, _ := card.Gender(); sex != vcard.SexUnspecified {
+		contact.Gender = mapGenderFromVCard(string(sex))
+	} else if gender := card.Value(fieldXGender); gender != "" {
 		contact.Gender = mapGenderFromVCard(gender)
 	}
 
@@ -369,9 +411,11 @@ func VCardToContact(card vcard.Card, existing *models.Contact) (*models.Contact,
 		contact.Role = role
 	}
 
-	// ANNIVERSARY
+	// ANNIVERSARY (vCard 4.0) or X-ANNIVERSARY (vCard 3.0)
 	if anniv := card.Value(vcard.FieldAnniversary); anniv != "" {
 		contact.Anniversary = normalizeBirthday(anniv)
+	} else if anniv := card.Value(fieldXAnniversary); anniv != "" {
+		contact.Anniversary = normalizeBirthday(anniv)
 	}
 
 	// Extract photo data for separate processing
@@ -627,6 +671,13 @@ func typeTokens(t string) []string {
 	}
 }
 
+// fieldXAnniversary and fieldXGender carry ANNIVERSARY and GENDER in vCard 3.0, which has no
+// standard property for them (understood by Apple Contacts, Thunderbird and DAVx5).
+const (
+	fieldXAnniversary = "X-ANNIVERSARY"
+	fieldXGender      = "X-GENDER"
+)
+
 // fieldABLabel is the (non-standard but ubiquitous) property Apple Contacts and
 // most CardDAV clients use to carry a human-readable custom label for a value,
 // linked to that value via a shared property group (e.g. item1.X-ABLabel).
@@ -792,12 +843,12 @@ func nonEmpty(values ...string) []string {
 
 // mapGenderFromVCard converts vCard gender to internal format
 func mapGenderFromVCard(gender string) string {
-	switch strings.ToUpper(gender) {
-	case "M":
+	switch strings.ToUpper(strings.TrimSpace(gender)) {
+	case "M", "MALE":
 		return "male"
-	case "F":
+	case "F", "FEMALE":
 		return "female"
-	case "O":
+	case "O", "OTHER":
 		return "other"
 	case "N", "U":
 		return "prefer_not_to_say"
@@ -806,6 +857,104 @@ func mapGenderFromVCard(gender string) string {
 	}
 }
 
+// mapGenderToVCard converts the internal gender to a vCard 4.0 sex value ("" when unset)
+func mapGenderToVCard(gender string) vcard.Sex {
+	switch gender {
+	case "male":
+		return vcard.SexMale
+	case "female":
+		return vcard.SexFemale
+	case "other":
+		return vcard.SexOther
+	case "prefer_not_to_say":
+		return vcard.SexUnknown
+	default:
+		return vcard.SexUnspecified
+	}
+}
+
+// formatVCardDate converts a stored date (YYYY-MM-DD or --MM-DD) to the vCard 4.0 basic
+// format (YYYYMMDD or --MMDD) when basic is set; other values are returned unchanged.
+func formatVCardDate(date string, basic bool) string {
+	if !basic {
+		return date
+	}
+	if len(date) == 10 && date[4] == '-' && date[7] == '-' {
+		return date[:4] + date[5:7] + date[8:]
+	}
+	if len(date) == 7 && strings.HasPrefix(date, "--") && date[4] == '-' {
+		return date[:4] + date[5:]
+	}
+	return date
+}
+
+// imppSchemes maps IMPP service names to the URI scheme used for them in vCard 4.0
+var imppSchemes = map[string]string{
+	"aim":    "aim",
+	"icq":    "icq",
+	"irc":    "irc",
+	"jabber": "xmpp",
+	"matrix": "matrix",
+	"msn":    "msnim",
+	"sip":    "sip",
+	"skype":  "skype",
+	"xmpp":   "xmpp",
+	"yahoo":  "ymsgr",
+}
+
+// imppSchemeServices names the service of schemes that differ from it
+var imppSchemeServices = map[string]string{
+	"msnim": "msn",
+	"ymsgr": "yahoo",
+}
+
+// imppFallbackScheme is the scheme Apple Contacts uses for services without a registered one
+const imppFallbackScheme = "x-apple"
+
+// imppURI turns a stored handle into an IMPP URI for vCard 4.0. Values that already carry a
+// known scheme are kept; otherwise the service's scheme (or x-apple:) is prepended.
+func imppURI(service, handle string) string {
+	if scheme, _, ok := strings.Cut(handle, ":"); ok && isIMPPScheme(scheme) {
+		return handle
+	}
+	scheme, ok := imppSchemes[strings.ToLower(strings.TrimSpace(service))]
+	if !ok {
+		scheme = imppFallbackScheme
+	}
+	return scheme + ":" + handle
+}
+
+// parseIMPP strips a known URI scheme from an IMPP value, returning the service it implies
+// (empty for x-apple:) and the bare handle. Values without a known scheme are returned as-is.
+func parseIMPP(value string) (string, string) {
+	scheme, handle, ok := strings.Cut(value, ":")
+	if !ok || !isIMPPScheme(scheme) {
+		return "", value
+	}
+	scheme = strings.ToLower(scheme)
+	if scheme == imppFallbackScheme {
+		return "", handle
+	}
+	if service, ok := imppSchemeServices[scheme]; ok {
+		return service, handle
+	}
+	return scheme, handle
+}
+
+// isIMPPScheme reports whether scheme is one imppURI may emit
+func isIMPPScheme(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	if scheme == imppFallbackScheme {
+		return true
+	}
+	for _, s := range imppSchemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
 // normalizeBirthday ensures birthday is in YYYY-MM-DD or --MM-DD format for storage
 func normalizeBirthday(bday string) string {
 	// Already in correct format (YYYY-MM-DD)
@@ -853,6 +1002,9 @@ func mappedVCardFields() map[string]bool {
 		vcard.FieldTitle:         true,
 		vcard.FieldRole:          true,
 		vcard.FieldAnniversary:   true,
+		vcard.FieldKind:          true,
+		fieldXAnniversary:        true,
+		fieldXGender:             true,
 		fieldABLabel:             true,
 	}
 }
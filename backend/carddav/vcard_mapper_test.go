@@ -254,3 +254,81 @@ func TestApplePseudoLabelImport(t *testing.T) {
 		t.Errorf("apple pseudo-label not normalized to cell: %+v", got.Phones)
 	}
 }
+
+// TestVCard40Output verifies vCard 4.0 uses the standard properties that 3.0 lacks
+// and that both versions import back to the same contact.
+func TestVCard40Output(t *testing.T) {
+	original := &models.Contact{
+		Firstname:   "Ada",
+		Gender:      "female",
+		Emails:      []models.ContactEmail{{Type: "home", Value: "ada@home.example"}},
+		IMPPs:       []models.ContactIMPP{{Type: "xmpp", Value: "ada@jabber.example"}, {Type: "telegram", Value: "@ada"}},
+		Birthday:    "1815-12-10",
+		Anniversary: "--07-08",
+	}
+
+	card := ContactToVCardVersion(original, "", VCardVersion4)
+	if v := card.Value(vcard.FieldVersion); v != "4.0" {
+		t.Errorf("version = %q", v)
+	}
+	if card.Kind() != vcard.KindIndividual || card.Value(vcard.FieldKind) == "" {
+		t.Errorf("KIND not emitted")
+	}
+	if sex, _ := card.Gender(); sex != vcard.SexFemale {
+		t.Errorf("gender = %q", sex)
+	}
+	if v := card.Value(vcard.FieldBirthday); v != "18151210" {
+		t.Errorf("bday = %q", v)
+	}
+	if v := card.Value(vcard.FieldAnniversary); v != "--0708" {
+		t.Errorf("anniversary = %q", v)
+	}
+	if card.Value(fieldXAnniversary) != "" || card.Value(fieldXGender) != "" {
+		t.Errorf("X- fallbacks emitted in vCard 4.0")
+	}
+	if types := card.Get(vcard.FieldEmail).Params.Types(); len(types) != 1 || types[0] != "home" {
+		t.Errorf("email types = %v", types)
+	}
+	impps := card[vcard.FieldIMPP]
+	if len(impps) != 2 || impps[0].Value != "xmpp:ada@jabber.example" || impps[1].Value != "x-apple:@ada" {
+		t.Errorf("impp URIs = %+v", impps)
+	}
+
+	legacy := ContactToVCard(original, "")
+	if legacy.Value(vcard.FieldAnniversary) != "" || legacy.Value(fieldXAnniversary) != "--07-08" || legacy.Value(fieldXGender) != "F" {
+		t.Errorf("vCard 3.0 fallbacks missing: %+v", legacy)
+	}
+	if legacy.Value(vcard.FieldKind) != "" || legacy.Value(vcard.FieldGender) != "" {
+		t.Errorf("vCard 4.0 properties emitted in 3.0")
+	}
+
+	for _, c := range []vcard.Card{card, legacy} {
+		got, _, _, _ := VCardToContact(c, nil)
+		if got.Gender != "female" || got.Birthday != "1815-12-10" || got.Anniversary != "--07-08" {
+			t.Errorf("dates/gender lost: %+v", got)
+		}
+		if len(got.IMPPs) != 2 || got.IMPPs[0].Value != "ada@jabber.example" || got.IMPPs[1].Value != "@ada" || got.IMPPs[1].Type != "telegram" {
+			t.Errorf("impp lost: %+v", got.IMPPs)
+		}
+		if got.VCardExtra != "" {
+			t.Errorf("mapped properties leaked into vcard_extra: %s", got.VCardExtra)
+		}
+	}
+}
+
+func TestParseIMPP(t *testing.T) {
+	cases := map[string][2]string{
+		"xmpp:ada@example.org": {"xmpp", "ada@example.org"},
+		"YMSGR:ada":            {"yahoo", "ada"},
+		"x-apple:ada":          {"", "ada"},
+		"@ada":                 {"", "@ada"},
+		"https://t.me/ada":     {"", "https://t.me/ada"},
+		"skype:ada.lovelace":   {"skype", "ada.lovelace"},
+	}
+	for value, want := range cases {
+		service, handle := parseIMPP(value)
+		if service != want[0] || handle != want[1] {
+			t.Errorf("parseIMPP(%q) = %q, %q; want %q, %q", value, service, handle, want[0], want[1])
+		}
+	}
+}
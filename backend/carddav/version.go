@@ -0,0 +1,117 @@
+package carddav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-vcard"
+)
+
+// Supported vCard versions. 3.0 stays the default because iOS and most older clients only speak 3.0.
+const (
+	VCardVersion3 = "3.0"
+	VCardVersion4 = "4.0"
+)
+
+const vcardVersionKey contextKey = "vcardVersion"
+
+// ContextWithVCardVersion records the vCard version negotiated for the current request
+func ContextWithVCardVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, vcardVersionKey, version)
+}
+
+func (b *Backend) getVCardVersion(ctx context.Context) string {
+	if version, ok := ctx.Value(vcardVersionKey).(string); ok && isSupportedVCardVersion(version) {
+		return version
+	}
+	return VCardVersion3
+}
+
+func isSupportedVCardVersion(version string) bool {
+	return version == VCardVersion3 || version == VCardVersion4
+}
+
+// NegotiateVCardVersion picks the vCard version from an Accept header such as
+// "text/vcard; version=4.0". The highest-q supported version wins; anything else yields 3.0.
+func NegotiateVCardVersion(accept string) string {
+	type candidate struct {
+		version string
+		q       float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || (mediaType != vcard.MIMEType && mediaType != "text/x-vcard") {
+			continue
+		}
+		version := params["version"]
+		if !isSupportedVCardVersion(version) {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{version: version, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return VCardVersion3
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].version
+}
+
+// requestedVCardVersion determines the vCard version a CardDAV request asks for. REPORT bodies may
+// carry it on the address-data element (RFC 6352 section 10.4); otherwise the Accept header decides.
+// The request body is restored so later handlers can read it again.
+func requestedVCardVersion(r *http.Request) string {
+	if r.Method == "REPORT" && r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err == nil {
+			if version, ok := addressDataVersion(body); ok {
+				return version
+			}
+		}
+	}
+	return NegotiateVCardVersion(r.Header.Get("Accept"))
+}
+
+// addressDataVersion returns the supported version requested by the first address-data element of a REPORT body
+func addressDataVersion(body []byte) (string, bool) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", false
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name != addressDataName {
+			continue
+		}
+		var contentType, version string
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "content-type":
+				contentType = attr.Value
+			case "version":
+				version = attr.Value
+			}
+		}
+		if contentType != "" && contentType != vcard.MIMEType {
+			return "", false
+		}
+		return version, isSupportedVCardVersion(version)
+	}
+}
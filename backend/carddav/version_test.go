@@ -0,0 +1,59 @@
+package carddav
+
+import (
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateVCardVersion(t *testing.T) {
+	assert.Equal(t, VCardVersion3, NegotiateVCardVersion(""))
+	assert.Equal(t, VCardVersion3, NegotiateVCardVersion("*/*"))
+	assert.Equal(t, VCardVersion3, NegotiateVCardVersion("text/vcard; version=2.1"))
+	assert.Equal(t, VCardVersion4, NegotiateVCardVersion("text/vcard; version=4.0"))
+	assert.Equal(t, VCardVersion4, NegotiateVCardVersion("text/vcard;version=3.0;q=0.5, text/vcard;version=4.0"))
+	assert.Equal(t, VCardVersion3, NegotiateVCardVersion("text/vcard;version=4.0;q=0.2, text/vcard;version=3.0"))
+}
+
+func TestCardDAV_VCardVersionNegotiation(t *testing.T) {
+	db, router, userID := setupCardDAV(t)
+	require.NoError(t, db.Create(&models.Contact{UserID: userID, Firstname: "Alice", VCardUID: "alice", Gender: "female"}).Error)
+
+	// GET honours the Accept header
+	req, _ := http.NewRequest(http.MethodGet, testAddressBookPath+"alice.vcf", nil)
+	req.Header.Set("Accept", "text/vcard; version=4.0")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "VERSION:4.0")
+	assert.Contains(t, w.Body.String(), "GENDER:F")
+
+	w = doDAV(router, http.MethodGet, testAddressBookPath+"alice.vcf", "")
+	assert.Contains(t, w.Body.String(), "VERSION:3.0")
+	assert.Contains(t, w.Body.String(), "X-GENDER:F")
+
+	// REPORTs honour the address-data attributes
+	multiget := func(version string) string {
+		return `<?xml version="1.0" encoding="utf-8"?>
+<card:addressbook-multiget xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav">
+  <d:prop><card:address-data content-type="text/vcard" version="` + version + `"/></d:prop>
+  <d:href>` + testAddressBookPath + `alice.vcf</d:href>
+</card:addressbook-multiget>`
+	}
+	w = doDAV(router, "REPORT", testAddressBookPath, multiget("4.0"))
+	require.Equal(t, http.StatusMultiStatus, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "VERSION:4.0")
+
+	w = doDAV(router, "REPORT", testAddressBookPath, multiget("3.0"))
+	assert.Contains(t, w.Body.String(), "VERSION:3.0")
+
+	sync := strings.Replace(syncRequest("", 0), "<card:address-data/>", `<card:address-data content-type="text/vcard" version="4.0"/>`, 1)
+	ms := decodeMultiStatus(t, doDAV(router, "REPORT", testAddressBookPath, sync))
+	require.Len(t, ms.Responses, 1)
+	assert.Contains(t, string(ms.Responses[0].PropStats[0].Prop.Raw[1].Inner), "VERSION:4.0")
+}
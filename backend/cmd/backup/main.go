@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"meerkat/config"
+	"meerkat/database"
+	"meerkat/logger"
+	"meerkat/services"
+	"os"
+	"time"
+)
+
+const usage = `Usage: go run cmd/backup/main.go [create [dir]|list [dir]|restore <archive>]
+
+  create   Take a snapshot of the database and photo directory while the server keeps running.
+           The directory defaults to BACKUP_DIR; snapshots beyond BACKUP_RETENTION are pruned.
+  list     List the snapshots in the directory, oldest first.
+  restore  Replace the database and restore the photos from a snapshot. Stop the server first.
+
+SQLITE_DB_PATH and PROFILE_PHOTO_DIR are read from the environment like the server does.`
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	logger.InitLogger(logger.Config{Level: "warn", Pretty: true})
+	cfg := config.LoadConfig()
+	if cfg.DBDriver == database.DriverPostgres {
+		log.Fatal("Snapshots only work with SQLite. Back up PostgreSQL with pg_dump.")
+	}
+
+	switch os.Args[1] {
+	case "create":
+		dir := backupDir(cfg)
+		if _, err := os.Stat(cfg.DBPath); err != nil {
+			log.Fatalf("Database not found: %v", err)
+		}
+
+		db, err := sql.Open("sqlite", cfg.DBPath)
+		if err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		archivePath, err := services.CreateSnapshot(db, cfg.ProfilePhotoDir, dir, time.Now())
+		if err != nil {
+			log.Fatalf("Failed to create snapshot: %v", err)
+		}
+		fmt.Printf("Snapshot written to %s\n", archivePath)
+
+		removed, err := services.PruneSnapshots(dir, cfg.BackupRetention)
+		for _, name := range removed {
+			fmt.Printf("Removed old snapshot %s\n", name)
+		}
+		if err != nil {
+			log.Fatalf("Failed to prune snapshots: %v", err)
+		}
+	case "list":
+		names, err := services.ListSnapshots(backupDir(cfg))
+		if err != nil {
+			log.Fatalf("Failed to list snapshots: %v", err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case "restore":
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run cmd/backup/main.go restore <archive>")
+		}
+		if cfg.ProfilePhotoDir == "" {
+			log.Fatal("PROFILE_PHOTO_DIR is not set")
+		}
+
+		version, err := services.RestoreSnapshot(os.Args[2], cfg.DBPath, cfg.ProfilePhotoDir, time.Now())
+		if errors.Is(err, services.ErrInvalidSnapshot) {
+			log.Fatalf("Cannot restore %s: %v", os.Args[2], err)
+		}
+		if err != nil {
+			log.Fatalf("Failed to restore snapshot: %v", err)
+		}
+		fmt.Printf("Snapshot restored to %s (taken at schema version %d)\n", cfg.DBPath, version)
+	default:
+		log.Fatalf("Unknown command: %s\n\n%s", os.Args[1], usage)
+	}
+}
+
+// backupDir returns the directory given on the command line, falling back to BACKUP_DIR
+func backupDir(cfg *config.Config) string {
+	if len(os.Args) > 2 {
+		return os.Args[2]
+	}
+	if cfg.BackupDir == "" {
+		log.Fatal("No backup directory given. Pass one or set BACKUP_DIR.")
+	}
+	return cfg.BackupDir
+}
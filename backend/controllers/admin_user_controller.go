@@ -63,6 +63,8 @@ func GetCurrentUser(c *gin.Context) {
 		},
 		CustomFieldNames:     user.CustomFieldNames,
 		EnabledContactFields: user.EnabledContactFields,
+		Timezone:             user.Timezone,
+		ReminderTime:         user.ReminderTime,
 	})
 }
 
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	apperrors "meerkat/errors"
+	"meerkat/logger"
+	"meerkat/services"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExportBackup downloads a ZIP archive with all of the user's data and contact photos, which
+// RestoreBackup can read back on this or another instance
+func ExportBackup(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	log := logger.FromContext(c)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteBackup(db, userID, currentConfig(c).ProfilePhotoDir, &buf, time.Now()); err != nil {
+		log.Error().Err(err).Msg("Failed to create backup")
+		apperrors.AbortWithError(c, apperrors.ErrInternal("Failed to create backup"))
+		return
+	}
+
+	filename := fmt.Sprintf("meerkat-backup-%s.zip", time.Now().Format("2006-01-02"))
+
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Header("Content-Length", fmt.Sprintf("%d", buf.Len()))
+
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+
+	log.Info().Int("bytes", buf.Len()).Msg("Backup export completed successfully")
+}
+
+// RestoreBackup adds the contents of an uploaded backup archive to the user's account
+func RestoreBackup(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	log := logger.FromContext(c)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		log.Warn().Err(err).Msg("No file uploaded")
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("file", "No file uploaded"))
+		return
+	}
+
+	if file.Size > services.MaxBackupSize {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("file", fmt.Sprintf("File too large. Maximum size is %d MB", services.MaxBackupSize/(1024*1024))))
+		return
+	}
+
+	if !strings.HasSuffix(strings.ToLower(file.Filename), ".zip") {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("file", "File must be a ZIP file"))
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to open uploaded file")
+		apperrors.AbortWithError(c, apperrors.ErrInternal("Failed to process file"))
+		return
+	}
+	defer f.Close()
+
+	result, err := services.RestoreBackup(db, userID, currentConfig(c).ProfilePhotoDir, f, file.Size)
+	if errors.Is(err, services.ErrInvalidBackup) {
+		log.Warn().Err(err).Msg("Rejected backup file")
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("file", err.Error()))
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to restore backup")
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("restore").WithError(err))
+		return
+	}
+
+	log.Info().
+		Int("contacts", result.Contacts).
+		Int("activities", result.Activities).
+		Int("notes", result.Notes).
+		Int("reminders", result.Reminders).
+		Int("photos", result.Photos).
+		Msg("Backup restored successfully")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Backup restored successfully", "restored": result})
+}
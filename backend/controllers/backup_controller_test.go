@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"meerkat/config"
+	"meerkat/models"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func uploadBackup(router *gin.Engine, filename string, content []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write(content)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/backup/restore", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestBackup_ExportAndRestore(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.ReminderCompletion{})
+	router.Use(func(c *gin.Context) {
+		c.Set("cfg", config.Config{ProfilePhotoDir: t.TempDir()})
+	})
+
+	var user models.User
+	db.First(&user)
+	alice := models.Contact{UserID: user.ID, Firstname: "Alice"}
+	db.Create(&alice)
+	db.Create(&models.Note{UserID: user.ID, ContactID: &alice.ID, Content: "Met at the conference"})
+
+	router.GET("/backup", ExportBackup)
+	router.POST("/backup/restore", RestoreBackup)
+
+	req, _ := http.NewRequest("GET", "/backup", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "meerkat-backup-")
+
+	w = uploadBackup(router, "backup.zip", w.Body.Bytes())
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Restored models.BackupRestoreResult `json:"restored"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Restored.Contacts)
+	assert.Equal(t, 1, resp.Restored.Notes)
+
+	var notes int64
+	db.Model(&models.Note{}).Where("user_id = ?", user.ID).Count(&notes)
+	assert.Equal(t, int64(2), notes)
+}
+
+func TestRestoreBackup_RejectsInvalidFile(t *testing.T) {
+	_, router := setupRouter()
+	router.POST("/backup/restore", RestoreBackup)
+
+	w := uploadBackup(router, "contacts.csv", []byte("a,b"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = uploadBackup(router, "backup.zip", []byte("not a zip"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid backup")
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"meerkat/logger"
+	"meerkat/middleware"
+	"meerkat/models"
+	"meerkat/services"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	apperrors "meerkat/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// calendarFeedPathPrefix is where feeds are served, relative to the site root
+const calendarFeedPathPrefix = "/api/v1/calendar-feed/"
+
+func toCalendarFeedTokenResponse(t models.CalendarFeedToken) models.CalendarFeedTokenResponse {
+	return models.CalendarFeedTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		CreatedAt:  t.CreatedAt,
+		LastUsedAt: t.LastUsedAt,
+		RevokedAt:  t.RevokedAt,
+	}
+}
+
+func ListCalendarFeedTokens(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var tokens []models.CalendarFeedToken
+	if err := db.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("query"))
+		return
+	}
+
+	response := make([]models.CalendarFeedTokenResponse, len(tokens))
+	for i, t := range tokens {
+		response[i] = toCalendarFeedTokenResponse(t)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"feeds": response})
+}
+
+func CreateCalendarFeedToken(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	input, appErr := middleware.GetValidated[models.CalendarFeedTokenInput](c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+
+	// 32 random bytes → base64url, safe to use as a URL path segment
+	rawBytes := make([]byte, 32)
+	if _, err := rand.Read(rawBytes); err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrInternal("token generation failed"))
+		return
+	}
+	plaintext := base64.RawURLEncoding.EncodeToString(rawBytes)
+
+	token := models.CalendarFeedToken{
+		UserID:    userID,
+		Name:      input.Name,
+		TokenHash: models.HashCalendarFeedToken(plaintext),
+	}
+	if err := db.Create(&token).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("insert"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CalendarFeedTokenCreateResponse{
+		CalendarFeedTokenResponse: toCalendarFeedTokenResponse(token),
+		Token:                     plaintext,
+		Path:                      calendarFeedPathPrefix + plaintext + ".ics",
+	})
+}
+
+func RevokeCalendarFeedToken(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("id", "must be a positive integer"))
+		return
+	}
+
+	var token models.CalendarFeedToken
+	if err := db.Where("id = ? AND user_id = ?", id, userID).First(&token).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrNotFound("Calendar feed"))
+		return
+	}
+
+	now := time.Now()
+	if err := db.Model(&token).Update("revoked_at", now).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("update"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed revoked successfully"})
+}
+
+// ServeCalendarFeed serves a user's ICS feed. It is public: the token in the URL is the only
+// credential, so unknown and revoked tokens get the same 404.
+func ServeCalendarFeed(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	plaintext := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	var token models.CalendarFeedToken
+	if err := db.Where("token_hash = ? AND revoked_at IS NULL", models.HashCalendarFeedToken(plaintext)).First(&token).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrNotFound("Calendar feed"))
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, token.UserID).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrNotFound("Calendar feed"))
+		return
+	}
+
+	cal, err := services.BuildCalendarFeed(db, user, time.Now())
+	if err != nil {
+		logger.FromContext(c).Error().Err(err).Uint("user_id", user.ID).Msg("Failed to build calendar feed")
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("query"))
+		return
+	}
+	data, err := services.EncodeCalendarFeed(cal)
+	if err != nil {
+		logger.FromContext(c).Error().Err(err).Uint("user_id", user.ID).Msg("Failed to encode calendar feed")
+		apperrors.AbortWithError(c, apperrors.ErrInternal("calendar encoding failed"))
+		return
+	}
+
+	if err := db.Model(&token).Update("last_used_at", time.Now()).Error; err != nil {
+		logger.FromContext(c).Warn().Err(err).Uint("calendar_feed_token_id", token.ID).Msg("Failed to update calendar feed last_used_at")
+	}
+
+	c.Header("Content-Disposition", `inline; filename="meerkat.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", data)
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"meerkat/i18n"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendarFeed_CreateServeRevoke(t *testing.T) {
+	require.NoError(t, i18n.Init())
+	db, router := setupRouter()
+	db.AutoMigrate(&models.CalendarFeedToken{})
+
+	var user models.User
+	db.First(&user)
+	db.Model(&user).Updates(models.User{Language: "de", DateFormat: "us"})
+	db.Create(&models.Contact{UserID: user.ID, Firstname: "Alice", Birthday: "1990-07-04"})
+
+	router.POST("/calendar-feeds", withValidated(func() any { return &models.CalendarFeedTokenInput{} }), CreateCalendarFeedToken)
+	router.DELETE("/calendar-feeds/:id", RevokeCalendarFeedToken)
+	router.GET("/api/v1/calendar-feed/:token", ServeCalendarFeed)
+
+	body, _ := json.Marshal(models.CalendarFeedTokenInput{Name: "Google Calendar"})
+	req, _ := http.NewRequest("POST", "/calendar-feeds", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var created models.CalendarFeedTokenCreateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "/api/v1/calendar-feed/"+created.Token+".ics", created.Path)
+
+	// Only the hash is stored
+	var stored models.CalendarFeedToken
+	require.NoError(t, db.First(&stored, created.ID).Error)
+	assert.Equal(t, models.HashCalendarFeedToken(created.Token), stored.TokenHash)
+
+	req, _ = http.NewRequest("GET", created.Path, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/calendar")
+	assert.Contains(t, w.Body.String(), "SUMMARY:Geburtstag von Alice (geb. 07/04/1990)")
+
+	require.NoError(t, db.First(&stored, created.ID).Error)
+	assert.NotNil(t, stored.LastUsedAt)
+
+	req, _ = http.NewRequest("DELETE", "/calendar-feeds/"+strconv.Itoa(int(created.ID)), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// A revoked feed looks like one that never existed
+	req, _ = http.NewRequest("GET", created.Path, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRevokeCalendarFeedToken_OtherUser(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.CalendarFeedToken{})
+
+	other := models.User{Username: "other", Email: "other@example.com", Password: "x"}
+	db.Create(&other)
+	token := models.CalendarFeedToken{UserID: other.ID, Name: "Theirs", TokenHash: "h"}
+	db.Create(&token)
+
+	router.DELETE("/calendar-feeds/:id", RevokeCalendarFeedToken)
+
+	req, _ := http.NewRequest("DELETE", "/calendar-feeds/"+strconv.Itoa(int(token.ID)), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var stored models.CalendarFeedToken
+	db.First(&stored, token.ID)
+	assert.Nil(t, stored.RevokedAt)
+}
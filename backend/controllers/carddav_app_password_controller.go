@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"meerkat/middleware"
+	"meerkat/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	apperrors "meerkat/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func toCardDAVAppPasswordResponse(p models.CardDAVAppPassword) models.CardDAVAppPasswordResponse {
+	return models.CardDAVAppPasswordResponse{
+		ID:         p.ID,
+		Name:       p.Name,
+		Protocol:   p.Protocol,
+		CreatedAt:  p.CreatedAt,
+		LastUsedAt: p.LastUsedAt,
+		RevokedAt:  p.RevokedAt,
+	}
+}
+
+func ListCardDAVAppPasswords(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var passwords []models.CardDAVAppPassword
+	if err := db.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&passwords).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("query"))
+		return
+	}
+
+	response := make([]models.CardDAVAppPasswordResponse, len(passwords))
+	for i, p := range passwords {
+		response[i] = toCardDAVAppPasswordResponse(p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"app_passwords": response})
+}
+
+func CreateCardDAVAppPassword(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	input, appErr := middleware.GetValidated[models.CardDAVAppPasswordInput](c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+
+	// 15 random bytes → 24 lowercase base32 characters, grouped as xxxx-xxxx-… for typing on a phone
+	rawBytes := make([]byte, 15)
+	if _, err := rand.Read(rawBytes); err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrInternal("password generation failed"))
+		return
+	}
+	encoded := strings.ToLower(base32.StdEncoding.EncodeToString(rawBytes))
+	groups := make([]string, 0, len(encoded)/4)
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	plaintext := strings.Join(groups, "-")
+
+	protocol := input.Protocol
+	if protocol == "" {
+		protocol = models.AppPasswordProtocolCardDAV
+	}
+
+	password := models.CardDAVAppPassword{
+		UserID:       userID,
+		Name:         input.Name,
+		Protocol:     protocol,
+		PasswordHash: models.HashCardDAVAppPassword(plaintext),
+	}
+	if err := db.Create(&password).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("insert"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CardDAVAppPasswordCreateResponse{
+		CardDAVAppPasswordResponse: toCardDAVAppPasswordResponse(password),
+		Password:                   plaintext,
+	})
+}
+
+func RevokeCardDAVAppPassword(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("id", "must be a positive integer"))
+		return
+	}
+
+	var password models.CardDAVAppPassword
+	if err := db.Where("id = ? AND user_id = ?", id, userID).First(&password).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrNotFound("App password"))
+		return
+	}
+
+	now := time.Now()
+	if err := db.Model(&password).Update("revoked_at", now).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("update"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "App password revoked successfully"})
+}
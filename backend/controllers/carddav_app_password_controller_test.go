@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateCardDAVAppPassword_Success(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.CardDAVAppPassword{})
+
+	router.POST("/carddav/app-passwords", withValidated(func() any { return &models.CardDAVAppPasswordInput{} }), CreateCardDAVAppPassword)
+
+	body, _ := json.Marshal(models.CardDAVAppPasswordInput{Name: "iPhone"})
+	req, _ := http.NewRequest("POST", "/carddav/app-passwords", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var resp models.CardDAVAppPasswordCreateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "iPhone", resp.Name)
+	assert.Equal(t, models.AppPasswordProtocolCardDAV, resp.Protocol)
+	assert.Regexp(t, regexp.MustCompile(`^[a-z2-7]{4}(-[a-z2-7]{4}){5}$`), resp.Password)
+
+	// Only the hash is stored
+	var stored models.CardDAVAppPassword
+	require.NoError(t, db.First(&stored, resp.ID).Error)
+	assert.Equal(t, models.HashCardDAVAppPassword(resp.Password), stored.PasswordHash)
+	assert.NotContains(t, stored.PasswordHash, resp.Password)
+}
+
+func TestCreateCardDAVAppPassword_Protocol(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.CardDAVAppPassword{})
+
+	router.POST("/carddav/app-passwords", withValidated(func() any { return &models.CardDAVAppPasswordInput{} }), CreateCardDAVAppPassword)
+
+	body, _ := json.Marshal(models.CardDAVAppPasswordInput{Name: "Calendar", Protocol: models.AppPasswordProtocolCalDAV})
+	req, _ := http.NewRequest("POST", "/carddav/app-passwords", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp models.CardDAVAppPasswordCreateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	var stored models.CardDAVAppPassword
+	require.NoError(t, db.First(&stored, resp.ID).Error)
+	assert.Equal(t, models.AppPasswordProtocolCalDAV, resp.Protocol)
+	assert.Equal(t, models.AppPasswordProtocolCalDAV, stored.Protocol)
+}
+
+func TestListCardDAVAppPasswords_ScopedToUser(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.CardDAVAppPassword{})
+
+	var user models.User
+	db.First(&user)
+	other := models.User{Username: "other", Email: "other@example.com", Password: "x"}
+	db.Create(&other)
+
+	db.Create(&models.CardDAVAppPassword{UserID: user.ID, Name: "iPhone", PasswordHash: "h1"})
+	db.Create(&models.CardDAVAppPassword{UserID: other.ID, Name: "Other phone", PasswordHash: "h2"})
+
+	router.GET("/carddav/app-passwords", ListCardDAVAppPasswords)
+
+	req, _ := http.NewRequest("GET", "/carddav/app-passwords", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "h1")
+
+	var body struct {
+		AppPasswords []models.CardDAVAppPasswordResponse `json:"app_passwords"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.AppPasswords, 1)
+	assert.Equal(t, "iPhone", body.AppPasswords[0].Name)
+}
+
+func TestRevokeCardDAVAppPassword(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.CardDAVAppPassword{})
+
+	var user models.User
+	db.First(&user)
+	other := models.User{Username: "other", Email: "other@example.com", Password: "x"}
+	db.Create(&other)
+
+	mine := models.CardDAVAppPassword{UserID: user.ID, Name: "iPhone", PasswordHash: "h1"}
+	theirs := models.CardDAVAppPassword{UserID: other.ID, Name: "Other phone", PasswordHash: "h2"}
+	db.Create(&mine)
+	db.Create(&theirs)
+
+	router.DELETE("/carddav/app-passwords/:id", RevokeCardDAVAppPassword)
+
+	req, _ := http.NewRequest("DELETE", "/carddav/app-passwords/"+strconv.Itoa(int(mine.ID)), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var revoked models.CardDAVAppPassword
+	db.First(&revoked, mine.ID)
+	assert.NotNil(t, revoked.RevokedAt)
+
+	// Another user's app password cannot be revoked
+	req, _ = http.NewRequest("DELETE", "/carddav/app-passwords/"+strconv.Itoa(int(theirs.ID)), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"errors"
+	"meerkat/middleware"
+	"meerkat/models"
+	"meerkat/services"
+	"net/http"
+	"strconv"
+
+	apperrors "meerkat/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxCardDAVRemotesPerUser     = 10
+	defaultCardDAVRemoteInterval = 60
+)
+
+func toCardDAVRemoteResponse(r models.CardDAVRemote) models.CardDAVRemoteResponse {
+	return models.CardDAVRemoteResponse{
+		ID:              r.ID,
+		Name:            r.Name,
+		URL:             r.URL,
+		Username:        r.Username,
+		Mode:            r.Mode,
+		IntervalMinutes: r.IntervalMinutes,
+		IsActive:        r.IsActive,
+		LastSyncAt:      r.LastSyncAt,
+		LastError:       r.LastError,
+		CreatedAt:       r.CreatedAt,
+	}
+}
+
+func ListCardDAVRemotes(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var remotes []models.CardDAVRemote
+	if err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&remotes).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("query"))
+		return
+	}
+
+	response := make([]models.CardDAVRemoteResponse, len(remotes))
+	for i, r := range remotes {
+		response[i] = toCardDAVRemoteResponse(r)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"remotes": response})
+}
+
+func CreateCardDAVRemote(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var count int64
+	if err := db.Model(&models.CardDAVRemote{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("count"))
+		return
+	}
+	if count >= maxCardDAVRemotesPerUser {
+		apperrors.AbortWithError(c, apperrors.ErrConflict("maximum of 10 CardDAV remotes per user reached"))
+		return
+	}
+
+	input, appErr := middleware.GetValidated[models.CardDAVRemoteInput](c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+
+	if services.URLBlocked(currentConfig(c), input.URL) {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("url", "must not point to a private or loopback address"))
+		return
+	}
+
+	remote := models.CardDAVRemote{UserID: userID}
+	applyCardDAVRemoteInput(&remote, input)
+	if err := db.Create(&remote).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("insert"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCardDAVRemoteResponse(remote))
+}
+
+func UpdateCardDAVRemote(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	remote, found := findCardDAVRemote(c, db, userID)
+	if !found {
+		return
+	}
+
+	input, appErr := middleware.GetValidated[models.CardDAVRemoteInput](c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+
+	if services.URLBlocked(currentConfig(c), input.URL) {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("url", "must not point to a private or loopback address"))
+		return
+	}
+
+	// Cards are matched by href on the remote, so a different address book starts from scratch
+	if input.URL != remote.URL {
+		if err := db.Where("remote_id = ?", remote.ID).Delete(&models.CardDAVRemoteObject{}).Error; err != nil {
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("delete"))
+			return
+		}
+	}
+
+	applyCardDAVRemoteInput(&remote, input)
+	if err := db.Save(&remote).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("update"))
+		return
+	}
+
+	c.JSON(http.StatusOK, toCardDAVRemoteResponse(remote))
+}
+
+func DeleteCardDAVRemote(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	remote, found := findCardDAVRemote(c, db, userID)
+	if !found {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("remote_id = ?", remote.ID).Delete(&models.CardDAVRemoteObject{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&remote).Error
+	})
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("delete"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "CardDAV remote deleted"})
+}
+
+// SyncCardDAVRemoteNow runs a sync with the remote immediately instead of waiting for the schedule
+func SyncCardDAVRemoteNow(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	remote, found := findCardDAVRemote(c, db, userID)
+	if !found {
+		return
+	}
+
+	result, err := services.SyncCardDAVRemote(c.Request.Context(), db, currentConfig(c), &remote)
+	if errors.Is(err, services.ErrCardDAVRemoteSyncRunning) {
+		apperrors.AbortWithError(c, apperrors.ErrConflict(err.Error()))
+		return
+	}
+	if errors.Is(err, services.ErrCardDAVRemoteURLBlocked) {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("url", "must not point to a private or loopback address"))
+		return
+	}
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrExternal("CardDAV remote", err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": result, "remote": toCardDAVRemoteResponse(remote)})
+}
+
+func applyCardDAVRemoteInput(remote *models.CardDAVRemote, input *models.CardDAVRemoteInput) {
+	remote.Name = input.Name
+	remote.URL = input.URL
+	remote.Username = input.Username
+	if input.Password != "" {
+		remote.Password = input.Password
+	}
+	remote.Mode = input.Mode
+	remote.IntervalMinutes = input.IntervalMinutes
+	if remote.IntervalMinutes == 0 {
+		remote.IntervalMinutes = defaultCardDAVRemoteInterval
+	}
+	remote.IsActive = input.IsActive
+}
+
+func findCardDAVRemote(c *gin.Context, db *gorm.DB, userID uint) (models.CardDAVRemote, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("id", "must be a positive integer"))
+		return models.CardDAVRemote{}, false
+	}
+
+	var remote models.CardDAVRemote
+	if err := db.Where("id = ? AND user_id = ?", id, userID).First(&remote).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperrors.AbortWithError(c, apperrors.ErrNotFound("CardDAV remote"))
+		} else {
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("query"))
+		}
+		return models.CardDAVRemote{}, false
+	}
+	return remote, true
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"meerkat/config"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateCardDAVRemote_PasswordNotReturned(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.CardDAVRemote{}, &models.CardDAVRemoteObject{})
+
+	router.POST("/carddav/remotes", withValidated(func() any { return &models.CardDAVRemoteInput{} }), CreateCardDAVRemote)
+
+	body, _ := json.Marshal(models.CardDAVRemoteInput{
+		Name:     "Nextcloud",
+		URL:      "https://cloud.example.com/remote.php/dav/addressbooks/users/me/contacts/",
+		Username: "me",
+		Password: "app-secret",
+		Mode:     models.CardDAVRemoteModeTwoWay,
+		IsActive: true,
+	})
+	req, _ := http.NewRequest("POST", "/carddav/remotes", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "app-secret")
+
+	var resp models.CardDAVRemoteResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 60, resp.IntervalMinutes)
+
+	var stored models.CardDAVRemote
+	require.NoError(t, db.First(&stored, resp.ID).Error)
+	assert.Equal(t, "app-secret", stored.Password)
+}
+
+func TestCreateCardDAVRemote_BlocksPrivateURLs(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.CardDAVRemote{}, &models.CardDAVRemoteObject{})
+
+	router.POST("/carddav/remotes", func(c *gin.Context) {
+		c.Set("cfg", config.Config{WebhookBlockPrivateURLs: true})
+	}, withValidated(func() any { return &models.CardDAVRemoteInput{} }), CreateCardDAVRemote)
+
+	body, _ := json.Marshal(models.CardDAVRemoteInput{
+		Name:     "Internal",
+		URL:      "http://127.0.0.1:8080/carddav/",
+		Username: "me",
+		Password: "app-secret",
+		Mode:     models.CardDAVRemoteModePull,
+		IsActive: true,
+	})
+	req, _ := http.NewRequest("POST", "/carddav/remotes", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	var count int64
+	db.Model(&models.CardDAVRemote{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestUpdateCardDAVRemote_KeepsPasswordAndResetsLinksOnNewURL(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.CardDAVRemote{}, &models.CardDAVRemoteObject{})
+
+	var user models.User
+	db.First(&user)
+	remote := models.CardDAVRemote{UserID: user.ID, Name: "Old", URL: "https://a.example.com/dav/", Password: "secret", Mode: models.CardDAVRemoteModePull, IntervalMinutes: 60}
+	db.Create(&remote)
+	db.Create(&models.CardDAVRemoteObject{RemoteID: remote.ID, VCardUID: "alice", Href: "/dav/alice.vcf"})
+
+	router.PUT("/carddav/remotes/:id", withValidated(func() any { return &models.CardDAVRemoteInput{} }), UpdateCardDAVRemote)
+
+	body, _ := json.Marshal(models.CardDAVRemoteInput{Name: "New", URL: "https://b.example.com/dav/", Mode: models.CardDAVRemoteModePush, IntervalMinutes: 30})
+	req, _ := http.NewRequest("PUT", "/carddav/remotes/"+strconv.Itoa(int(remote.ID)), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var stored models.CardDAVRemote
+	require.NoError(t, db.First(&stored, remote.ID).Error)
+	assert.Equal(t, "secret", stored.Password)
+	assert.Equal(t, models.CardDAVRemoteModePush, stored.Mode)
+	assert.Equal(t, 30, stored.IntervalMinutes)
+
+	var links int64
+	db.Model(&models.CardDAVRemoteObject{}).Where("remote_id = ?", remote.ID).Count(&links)
+	assert.Zero(t, links)
+}
+
+func TestDeleteCardDAVRemote_OtherUser(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.CardDAVRemote{}, &models.CardDAVRemoteObject{})
+
+	other := models.User{Username: "other", Email: "other@example.com", Password: "x"}
+	db.Create(&other)
+	remote := models.CardDAVRemote{UserID: other.ID, Name: "Theirs", URL: "https://example.com/dav/", Mode: models.CardDAVRemoteModePull}
+	db.Create(&remote)
+
+	router.DELETE("/carddav/remotes/:id", DeleteCardDAVRemote)
+
+	req, _ := http.NewRequest("DELETE", "/carddav/remotes/"+strconv.Itoa(int(remote.ID)), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -2,15 +2,16 @@ package controllers
 
 import (
 	"errors"
+	"meerkat/database"
 	apperrors "meerkat/errors"
+	"meerkat/filters"
 	"meerkat/logger"
 	"meerkat/middleware"
 	"meerkat/models"
 	"meerkat/services"
 	"net/http"
-	"os"
-	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,37 +36,14 @@ func CreateContact(c *gin.Context) {
 	}
 
 	// Create contact from validated input
-	contact := models.Contact{
-		UserID:             userID,
-		Firstname:          contactInput.Firstname,
-		Lastname:           contactInput.Lastname,
-		Nickname:           contactInput.Nickname,
-		Gender:             contactInput.Gender,
-		Email:              contactInput.Email,
-		Phone:              contactInput.Phone,
-		Birthday:           contactInput.Birthday,
-		Address:            contactInput.Address,
-		HowWeMet:           contactInput.HowWeMet,
-		FoodPreference:     contactInput.FoodPreference,
-		WorkInformation:    contactInput.WorkInformation,
-		ContactInformation: contactInput.ContactInformation,
-		Circles:            contactInput.Circles,
-		CustomFields:       contactInput.CustomFields,
-		Emails:             contactInput.Emails,
-		Phones:             contactInput.Phones,
-		Addresses:          contactInput.Addresses,
-		URLs:               contactInput.URLs,
-		IMPPs:              contactInput.IMPPs,
-		Prefix:             contactInput.Prefix,
-		MiddleName:         contactInput.MiddleName,
-		Suffix:             contactInput.Suffix,
-		Organization:       contactInput.Organization,
-		Department:         contactInput.Department,
-		JobTitle:           contactInput.JobTitle,
-		Role:               contactInput.Role,
-		Anniversary:        contactInput.Anniversary,
-	}
-	if err := db.Create(&contact).Error; err != nil {
+	contact := models.Contact{UserID: userID}
+	contact.ApplyInput(*contactInput)
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&contact).Error; err != nil {
+			return err
+		}
+		return models.RecordContactVersion(tx, nil, &contact, currentEditor(c))
+	}); err != nil {
 		logger.FromContext(c).Error().Err(err).Msg("Error saving contact to database")
 		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to save contact").WithError(err))
 		return
@@ -77,15 +55,8 @@ func CreateContact(c *gin.Context) {
 
 // filters a contacts query by a free-text term
 func applyContactSearch(query *gorm.DB, searchTerm string) *gorm.DB {
-	like := "%" + searchTerm + "%"
-	return query.Where(
-		"firstname LIKE ? OR lastname LIKE ? OR nickname LIKE ? "+
-			"OR (firstname || ' ' || lastname) LIKE ? OR (nickname || ' ' || lastname) LIKE ? "+
-			"OR email LIKE ? OR phone LIKE ? "+
-			"OR (json_valid(emails) AND EXISTS (SELECT 1 FROM json_each(contacts.emails) WHERE json_extract(json_each.value, '$.value') LIKE ?)) "+
-			"OR (json_valid(phones) AND EXISTS (SELECT 1 FROM json_each(contacts.phones) WHERE json_extract(json_each.value, '$.value') LIKE ?))",
-		like, like, like, like, like, like, like, like, like,
-	)
+	condition, args := filters.ContactSearchCondition(query, searchTerm)
+	return query.Where(condition, args...)
 }
 
 func GetContacts(c *gin.Context) {
@@ -99,7 +70,7 @@ func GetContacts(c *gin.Context) {
 	pagination := GetPaginationParams(c)
 
 	// Define allowed fields and parse requested fields with validation
-	allowedFields := []string{"ID", "firstname", "lastname", "nickname", "gender", "email", "phone", "birthday", "address", "how_we_met", "food_preference", "work_information", "contact_information", "circles", "photo", "photo_thumbnail", "custom_fields", "archived", "emails", "phones", "addresses", "urls", "impps", "prefix", "middle_name", "suffix", "organization", "department", "job_title", "role", "anniversary"}
+	allowedFields := []string{"ID", "firstname", "lastname", "nickname", "gender", "email", "phone", "birthday", "address", "how_we_met", "food_preference", "work_information", "contact_information", "circles", "photo", "photo_thumbnail", "custom_fields", "archived", "emails", "phones", "addresses", "urls", "impps", "prefix", "middle_name", "suffix", "organization", "department", "job_title", "role", "anniversary", "contact_frequency_days"}
 	var selectedFields []string
 	fields := c.Query("fields")
 	if fields != "" {
@@ -138,8 +109,31 @@ func GetContacts(c *gin.Context) {
 		sortOrder = "desc"
 	}
 
-	// Parse archive filtering parameters
-	includeArchived := c.Query("include_archived") == "true"
+	// Parse the filter expression, e.g. circle:Work AND birthday:<30d
+	var filter *filters.ContactFilter
+	if expression := strings.TrimSpace(c.Query("filter")); expression != "" {
+		var err error
+		if filter, err = filters.ParseContactFilter(expression); err != nil {
+			apperrors.AbortWithError(c, apperrors.ErrInvalidInput("filter", err.Error()))
+			return
+		}
+	}
+	now := time.Now()
+
+	// A smart circle of that name takes precedence over the circles stored on contacts
+	circle := c.Query("circle")
+	var circleFilter *filters.ContactFilter
+	if circle != "" {
+		var err error
+		if circleFilter, err = smartCircleFilter(db, userID, circle); err != nil {
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve smart circle").WithError(err))
+			return
+		}
+	}
+
+	// Parse archive filtering parameters. A filter that mentions archived decides on its own.
+	includeArchived := c.Query("include_archived") == "true" ||
+		(filter != nil && filter.References("archived")) || (circleFilter != nil && circleFilter.References("archived"))
 	archivedOnly := c.Query("archived") == "true"
 
 	var contacts []models.Contact
@@ -161,8 +155,10 @@ func GetContacts(c *gin.Context) {
 	}
 	if sortField == "random" {
 		query = query.Order("RANDOM()")
-	} else {
+	} else if sortField == "id" {
 		query = query.Order(sortField + " " + sortOrder)
+	} else {
+		query = query.Order(database.CaseInsensitive(db, sortField) + " " + sortOrder)
 	}
 
 	if len(selectedFields) > 0 {
@@ -174,8 +170,14 @@ func GetContacts(c *gin.Context) {
 		query = applyContactSearch(query, searchTerm)
 	}
 
-	if circle := c.Query("circle"); circle != "" {
-		query = query.Where("EXISTS (SELECT 1 FROM json_each(contacts.circles) WHERE json_each.value = ?)", circle)
+	if circleFilter != nil {
+		query = circleFilter.Apply(query, now)
+	} else if circle != "" {
+		query = query.Where(database.JSONArrayContains(db, "contacts.circles"), circle)
+	}
+
+	if filter != nil {
+		query = filter.Apply(query, now)
 	}
 
 	// Preload requested relationships
@@ -217,8 +219,14 @@ func GetContacts(c *gin.Context) {
 		countQuery = applyContactSearch(countQuery, searchTerm)
 	}
 
-	if circle := c.Query("circle"); circle != "" {
-		countQuery = countQuery.Where("EXISTS (SELECT 1 FROM json_each(contacts.circles) WHERE json_each.value = ?)", circle)
+	if circleFilter != nil {
+		countQuery = circleFilter.Apply(countQuery, now)
+	} else if circle != "" {
+		countQuery = countQuery.Where(database.JSONArrayContains(db, "contacts.circles"), circle)
+	}
+
+	if filter != nil {
+		countQuery = filter.Apply(countQuery, now)
 	}
 
 	countQuery.Count(&total)
@@ -282,6 +290,7 @@ func GetContactsRandom(c *gin.Context) {
 	})
 }
 
+// GetUpcomingBirthdays lists upcoming birthdays and anniversaries, within the optional days window
 func GetUpcomingBirthdays(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
 
@@ -290,7 +299,22 @@ func GetUpcomingBirthdays(c *gin.Context) {
 		return
 	}
 
-	birthdays, err := services.GetUpcomingBirthdays(db, userID, time.Now())
+	// "Today" is the user's date
+	now := services.UserNow(db, userID, currentConfig(c))
+
+	// Without a window the dashboard's short list is returned
+	var birthdays []models.Birthday
+	var err error
+	if raw := c.Query("days"); raw != "" {
+		days, parseErr := strconv.Atoi(raw)
+		if parseErr != nil || days < 0 || days > 366 {
+			apperrors.AbortWithError(c, apperrors.ErrInvalidInput("days", "must be a number from 0 to 366"))
+			return
+		}
+		birthdays, err = services.ListUpcomingDates(db, userID, now, days)
+	} else {
+		birthdays, err = services.GetUpcomingBirthdays(db, userID, now)
+	}
 	if err != nil {
 		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve upcoming birthdays").WithError(err))
 		return
@@ -301,6 +325,26 @@ func GetUpcomingBirthdays(c *gin.Context) {
 	})
 }
 
+// GetOverdueContacts lists the contacts the user is due to get in touch with, most overdue first
+func GetOverdueContacts(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	contacts, err := services.GetOverdueContacts(db, userID, time.Now())
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve overdue contacts").WithError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"contacts": contacts,
+	})
+}
+
 func GetContact(c *gin.Context) {
 	id := c.Param("id")
 
@@ -376,35 +420,15 @@ func UpdateContact(c *gin.Context) {
 	}
 
 	// Updateable fields
-	contact.Firstname = contactInput.Firstname
-	contact.Lastname = contactInput.Lastname
-	contact.Nickname = contactInput.Nickname
-	contact.Gender = contactInput.Gender
-	contact.Email = contactInput.Email
-	contact.Phone = contactInput.Phone
-	contact.Birthday = contactInput.Birthday
-	contact.Address = contactInput.Address
-	contact.HowWeMet = contactInput.HowWeMet
-	contact.FoodPreference = contactInput.FoodPreference
-	contact.WorkInformation = contactInput.WorkInformation
-	contact.ContactInformation = contactInput.ContactInformation
-	contact.Circles = contactInput.Circles
-	contact.CustomFields = contactInput.CustomFields
-	contact.Emails = contactInput.Emails
-	contact.Phones = contactInput.Phones
-	contact.Addresses = contactInput.Addresses
-	contact.URLs = contactInput.URLs
-	contact.IMPPs = contactInput.IMPPs
-	contact.Prefix = contactInput.Prefix
-	contact.MiddleName = contactInput.MiddleName
-	contact.Suffix = contactInput.Suffix
-	contact.Organization = contactInput.Organization
-	contact.Department = contactInput.Department
-	contact.JobTitle = contactInput.JobTitle
-	contact.Role = contactInput.Role
-	contact.Anniversary = contactInput.Anniversary
-
-	if err := db.Save(&contact).Error; err != nil {
+	before := contact
+	contact.ApplyInput(*contactInput)
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&contact).Error; err != nil {
+			return err
+		}
+		return models.RecordContactVersion(tx, &before, &contact, currentEditor(c))
+	}); err != nil {
 		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to update contact").WithError(err))
 		return
 	}
@@ -433,8 +457,10 @@ func DeleteContact(c *gin.Context) {
 		return
 	}
 
-	// Start a transaction to ensure all deletes succeed together
-	err := db.Transaction(func(tx *gorm.DB) error {
+	// Start a transaction to ensure all deletes succeed together. Everything deleted with the
+	// contact gets the same deletion time, so restoring it from the trash can bring it all back.
+	deletedAt := time.Now()
+	err := db.Session(&gorm.Session{NowFunc: func() time.Time { return deletedAt }}).Transaction(func(tx *gorm.DB) error {
 		// Manually delete associated reminders (soft delete doesn't trigger CASCADE)
 		if err := tx.Where("contact_id = ? AND user_id = ?", id, userID).Delete(&models.Reminder{}).Error; err != nil {
 			return err
@@ -450,12 +476,7 @@ func DeleteContact(c *gin.Context) {
 			return err
 		}
 
-		// Delete activity associations (many-to-many)
-		if err := tx.Exec("DELETE FROM activity_contacts WHERE contact_id = ? AND activity_id IN (SELECT id FROM activities WHERE user_id = ?)", id, userID).Error; err != nil {
-			return err
-		}
-
-		// Finally, delete the contact
+		// Finally, delete the contact. Its activity links and photo stay until the trash is purged.
 		if err := tx.Delete(&contact).Error; err != nil {
 			return err
 		}
@@ -468,46 +489,11 @@ func DeleteContact(c *gin.Context) {
 		return
 	}
 
-	// Cleanup profile photos after successful database transaction
-	// This is done outside the transaction since file deletion cannot be rolled back
-	deleteContactPhotos(c, contact)
-
 	go services.TriggerWebhooks(db, currentConfig(c), userID, "contact.deleted", gin.H{"id": contact.ID})
 	c.JSON(http.StatusOK, gin.H{"message": "Contact deleted"})
 }
 
-// deleteContactPhotos removes the profile photo file for a contact
-// Note: thumbnails are stored as base64 in the database, not as files
-func deleteContactPhotos(c *gin.Context, contact models.Contact) {
-	uploadDir := os.Getenv("PROFILE_PHOTO_DIR")
-	if uploadDir == "" {
-		return
-	}
-
-	log := logger.FromContext(c)
-
-	// Delete main photo if it exists
-	if contact.Photo != "" {
-		photoPath := filepath.Join(uploadDir, contact.Photo)
-		if err := os.Remove(photoPath); err != nil && !os.IsNotExist(err) {
-			log.Warn().Err(err).Str("path", photoPath).Msg("Failed to delete contact photo")
-		} else if err == nil {
-			log.Debug().Str("path", photoPath).Msg("Deleted contact photo")
-		}
-	}
-
-	// Delete legacy file-based thumbnail if it exists (not base64 data URL)
-	if contact.PhotoThumbnail != "" && !strings.HasPrefix(contact.PhotoThumbnail, "data:") {
-		thumbnailPath := filepath.Join(uploadDir, contact.PhotoThumbnail)
-		if err := os.Remove(thumbnailPath); err != nil && !os.IsNotExist(err) {
-			log.Warn().Err(err).Str("path", thumbnailPath).Msg("Failed to delete contact thumbnail")
-		} else if err == nil {
-			log.Debug().Str("path", thumbnailPath).Msg("Deleted contact thumbnail")
-		}
-	}
-}
-
-// GetCircles returns all unique circles associated with contacts.
+// GetCircles returns all unique circles associated with contacts, followed by the smart circles.
 func GetCircles(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
 
@@ -519,13 +505,25 @@ func GetCircles(c *gin.Context) {
 
 	// Raw SQL query to extract unique circle names
 	err := db.Raw(`SELECT DISTINCT json_each.value AS circle
-	               FROM contacts, json_each(contacts.circles)
+	               FROM contacts, `+database.JSONArrayValues(db, "contacts.circles")+`
 	               WHERE contacts.user_id = ?`, userID).Scan(&circleNames).Error
 	if err != nil {
 		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve circles").WithError(err))
 		return
 	}
 
+	// Smart circles are listed after the stored ones, a name used by both only once
+	smartCircles, err := models.ListSmartCircles(db, userID)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve smart circles").WithError(err))
+		return
+	}
+	for _, sc := range smartCircles {
+		if !slices.Contains(circleNames, sc.Name) {
+			circleNames = append(circleNames, sc.Name)
+		}
+	}
+
 	// Return the list of unique circle names
 	c.JSON(http.StatusOK, circleNames)
 }
@@ -602,3 +600,40 @@ func UnarchiveContact(c *gin.Context) {
 	contact.Archived = false
 	c.JSON(http.StatusOK, contact)
 }
+
+// SetContactFrequency sets how many days may pass between interactions with a contact before it
+// is overdue; 0 stops tracking it
+func SetContactFrequency(c *gin.Context) {
+	id := c.Param("id")
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	input, appErr := middleware.GetValidated[models.ContactFrequencyInput](c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+
+	var contact models.Contact
+	if err := db.Where("user_id = ?", userID).First(&contact, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperrors.AbortWithError(c, apperrors.ErrNotFound("Contact").WithDetails("id", id))
+		} else {
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve contact").WithError(err))
+		}
+		return
+	}
+
+	// The frequency is not part of the vCard, so CardDAV clients need not sync the change
+	if err := db.Model(&contact).UpdateColumn("contact_frequency_days", input.Days).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to update contact frequency").WithError(err))
+		return
+	}
+
+	contact.ContactFrequencyDays = input.Days
+	c.JSON(http.StatusOK, contact)
+}
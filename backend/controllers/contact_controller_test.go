@@ -6,6 +6,7 @@ import (
 	"meerkat/models"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -355,6 +356,57 @@ func TestGetContactsWithSearchCriteria(t *testing.T) {
 	assert.Len(t, returnedContacts, 0)
 }
 
+func TestGetContactsWithFilter(t *testing.T) {
+	db, router := setupRouter()
+
+	var user models.User
+	db.First(&user)
+
+	router.GET("/contacts", GetContacts)
+
+	contacts := []models.Contact{
+		{UserID: user.ID, Firstname: "Alice", Circles: []string{"Work"}},
+		{UserID: user.ID, Firstname: "Bob", Circles: []string{"Work"}, Archived: true},
+		{UserID: user.ID, Firstname: "Carol", Circles: []string{"Family"}},
+	}
+	for _, c := range contacts {
+		db.Create(&c)
+	}
+
+	get := func(filter string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/contacts?filter="+url.QueryEscape(filter), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	names := func(w *httptest.ResponseRecorder) []string {
+		var responseBody struct {
+			Contacts []models.Contact `json:"contacts"`
+			Total    int64            `json:"total"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &responseBody)
+		result := []string{}
+		for _, c := range responseBody.Contacts {
+			result = append(result, c.Firstname)
+		}
+		assert.Equal(t, int64(len(result)), responseBody.Total)
+		return result
+	}
+
+	// Archived contacts stay hidden unless the filter asks about them
+	w := get("circle:Work")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"Alice"}, names(w))
+
+	w = get("circle:Work AND archived")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"Bob"}, names(w))
+
+	w = get("circle:Work (circle:Work")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "missing closing parenthesis")
+}
+
 func TestCreateContact(t *testing.T) {
 	_, router := setupRouter()
 
@@ -588,7 +640,7 @@ func TestGetCircles(t *testing.T) {
 	assert.ElementsMatch(t, []string{"Friends", "Family", "Work"}, responseBody)
 }
 
-func TestDeleteContactCleansUpPhotos(t *testing.T) {
+func TestDeleteContactKeepsPhotosForTrash(t *testing.T) {
 	db, router := setupRouter()
 
 	var user models.User
@@ -644,11 +696,11 @@ func TestDeleteContactCleansUpPhotos(t *testing.T) {
 	json.Unmarshal(w.Body.Bytes(), &respBody)
 	assert.Equal(t, "Contact deleted", respBody["message"])
 
-	// Verify photo files are deleted
+	// Photo files stay until the trash is purged, so the contact can be restored with them
 	_, err = os.Stat(photoPath)
-	assert.True(t, os.IsNotExist(err), "Photo file should be deleted")
+	assert.NoError(t, err, "Photo file should be kept")
 	_, err = os.Stat(thumbnailPath)
-	assert.True(t, os.IsNotExist(err), "Thumbnail file should be deleted")
+	assert.NoError(t, err, "Thumbnail file should be kept")
 }
 
 func TestDeleteContactWithNoPhotos(t *testing.T) {
@@ -680,3 +732,58 @@ func TestDeleteContactWithNoPhotos(t *testing.T) {
 	json.Unmarshal(w.Body.Bytes(), &respBody)
 	assert.Equal(t, "Contact deleted", respBody["message"])
 }
+
+func TestContactFrequencyAndOverdue(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.ReminderCompletion{})
+
+	var user models.User
+	db.First(&user)
+
+	router.PUT("/contacts/:id/frequency", withValidated(func() any { return &models.ContactFrequencyInput{} }), SetContactFrequency)
+	router.PUT("/contacts/:id", withValidated(func() any { return &models.ContactInput{} }), UpdateContact)
+	router.GET("/contacts/overdue", GetOverdueContacts)
+
+	contact := models.Contact{UserID: user.ID, Firstname: "Alice"}
+	contact.CreatedAt = time.Now().AddDate(0, 0, -60)
+	db.Create(&contact)
+	path := "/contacts/" + strconv.Itoa(int(contact.ID))
+
+	overdue := func() []models.OverdueContact {
+		req, _ := http.NewRequest("GET", "/contacts/overdue", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Contacts []models.OverdueContact `json:"contacts"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Contacts
+	}
+	assert.Empty(t, overdue(), "contacts without a frequency are not tracked")
+
+	body, _ := json.Marshal(models.ContactFrequencyInput{Days: 30})
+	req, _ := http.NewRequest("PUT", path+"/frequency", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	result := overdue()
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, contact.ID, result[0].ID)
+		assert.Equal(t, 30, result[0].DaysOverdue)
+	}
+
+	// Editing the contact's fields keeps its frequency
+	body, _ = json.Marshal(models.ContactInput{Firstname: "Alicia"})
+	req, _ = http.NewRequest("PUT", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updated models.Contact
+	db.First(&updated, contact.ID)
+	assert.Equal(t, 30, updated.ContactFrequencyDays)
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"errors"
+	apperrors "meerkat/errors"
+	"meerkat/models"
+	"meerkat/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetContactHistory lists the recorded versions of a contact, newest first
+func GetContactHistory(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	contact, ok := findHistoryContact(c, db, userID)
+	if !ok {
+		return
+	}
+
+	var versions []models.ContactVersion
+	if err := db.Where("user_id = ? AND contact_id = ?", userID, contact.ID).
+		Order("version DESC").Find(&versions).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve contact history").WithError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// RevertContactVersion sets a contact's fields back to those of one of its versions. The revert
+// is recorded as a new version.
+func RevertContactVersion(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number < 1 {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("version", "must be a positive integer"))
+		return
+	}
+
+	contact, ok := findHistoryContact(c, db, userID)
+	if !ok {
+		return
+	}
+
+	var version models.ContactVersion
+	if err := db.Where("user_id = ? AND contact_id = ? AND version = ?", userID, contact.ID, number).
+		First(&version).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperrors.AbortWithError(c, apperrors.ErrNotFound("Contact version").WithDetails("version", c.Param("version")))
+		} else {
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve contact version").WithError(err))
+		}
+		return
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return models.RevertContact(tx, &contact, &version, currentEditor(c))
+	}); err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to revert contact").WithError(err))
+		return
+	}
+
+	go services.TriggerWebhooks(db, currentConfig(c), userID, "contact.updated", contact)
+	c.JSON(http.StatusOK, contact)
+}
+
+// findHistoryContact loads the contact in the path, aborting the request if it is not the user's
+func findHistoryContact(c *gin.Context, db *gorm.DB, userID uint) (models.Contact, bool) {
+	var contact models.Contact
+	if err := db.Where("user_id = ?", userID).First(&contact, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperrors.AbortWithError(c, apperrors.ErrNotFound("Contact").WithDetails("id", c.Param("id")))
+		} else {
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve contact").WithError(err))
+		}
+		return contact, false
+	}
+	return contact, true
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactHistory(t *testing.T) {
+	db, router := setupRouter()
+
+	var user models.User
+	db.First(&user)
+
+	router.Use(func(c *gin.Context) {
+		c.Set("username", user.Username)
+		c.Next()
+	})
+	router.POST("/contacts", withValidated(func() any { return &models.ContactInput{} }), CreateContact)
+	router.PUT("/contacts/:id", withValidated(func() any { return &models.ContactInput{} }), UpdateContact)
+	router.GET("/contacts/:id/history", GetContactHistory)
+	router.POST("/contacts/:id/history/:version/revert", RevertContactVersion)
+
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	history := func(contactID uint) []models.ContactVersion {
+		w := do("GET", "/contacts/"+strconv.Itoa(int(contactID))+"/history", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response struct {
+			Versions []models.ContactVersion `json:"versions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Versions
+	}
+
+	w := do("POST", "/contacts", models.ContactInput{Firstname: "Alice", Lastname: "Smith", Circles: []string{"Friends"}})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created struct {
+		Contact models.Contact `json:"contact"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	id := strconv.Itoa(int(created.Contact.ID))
+
+	w = do("PUT", "/contacts/"+id, models.ContactInput{Firstname: "Alice", Lastname: "Jones", Circles: []string{"Friends", "Work"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	// Saving without changes records nothing
+	w = do("PUT", "/contacts/"+id, models.ContactInput{Firstname: "Alice", Lastname: "Jones", Circles: []string{"Friends", "Work"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	versions := history(created.Contact.ID)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 2, versions[0].Version)
+	assert.Equal(t, models.ContactSourceWeb, versions[0].Source)
+	assert.Equal(t, "tester", versions[0].Actor)
+	require.Len(t, versions[0].Changes, 2)
+	assert.JSONEq(t, `"Smith"`, string(versions[0].Changes["lastname"].Old))
+	assert.JSONEq(t, `"Jones"`, string(versions[0].Changes["lastname"].New))
+	assert.JSONEq(t, `["Friends","Work"]`, string(versions[0].Changes["circles"].New))
+	assert.Contains(t, versions[1].Changes, "firstname", "the first version holds the fields the contact was created with")
+	assert.NotContains(t, versions[1].Changes, "nickname")
+
+	// Reverting restores the fields and is recorded as a change of its own
+	w = do("POST", "/contacts/"+id+"/history/1/revert", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var reverted models.Contact
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reverted))
+	assert.Equal(t, "Smith", reverted.Lastname)
+	assert.Equal(t, []string{"Friends"}, reverted.Circles)
+
+	versions = history(created.Contact.ID)
+	require.Len(t, versions, 3)
+	require.NotNil(t, versions[0].RevertOf)
+	assert.Equal(t, 1, *versions[0].RevertOf)
+	assert.JSONEq(t, `"Smith"`, string(versions[0].Changes["lastname"].New))
+
+	assert.Equal(t, http.StatusNotFound, do("POST", "/contacts/"+id+"/history/9/revert", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/contacts/"+id+"/history/latest/revert", nil).Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/contacts/9999/history", nil).Code)
+
+	// A contact from before history was recorded gets its old state as the first version
+	legacy := models.Contact{UserID: user.ID, Firstname: "Bob", Nickname: "Bobby"}
+	require.NoError(t, db.Create(&legacy).Error)
+	w = do("PUT", "/contacts/"+strconv.Itoa(int(legacy.ID)), models.ContactInput{Firstname: "Bob"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	versions = history(legacy.ID)
+	require.Len(t, versions, 2)
+	assert.Equal(t, models.ContactSourceInitial, versions[1].Source)
+	assert.Equal(t, "Bobby", versions[1].Snapshot.Nickname)
+	assert.JSONEq(t, `"Bobby"`, string(versions[0].Changes["nickname"].Old))
+}
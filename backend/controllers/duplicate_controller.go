@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	apperrors "meerkat/errors"
+	"meerkat/middleware"
+	"meerkat/models"
+	"meerkat/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetDuplicateContacts scans the user's contacts for probable duplicates. The optional min_score
+// (0 to 1) sets how confident a match has to be.
+func GetDuplicateContacts(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	minScore := services.DefaultDuplicateMinScore
+	if raw := c.Query("min_score"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			apperrors.AbortWithError(c, apperrors.ErrInvalidInput("min_score", "must be a number greater than 0 and at most 1"))
+			return
+		}
+		minScore = parsed
+	}
+
+	clusters, err := services.FindDuplicateClusters(db, userID, minScore)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to scan for duplicates").WithError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clusters": clusters})
+}
+
+// MergeContacts merges the given duplicates into the contact in the path and deletes them
+func MergeContacts(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("id", "must be a positive integer"))
+		return
+	}
+
+	input, appErr := middleware.GetValidated[models.MergeContactsInput](c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+
+	survivor, merged, err := services.MergeContacts(db, userID, uint(id), input.DuplicateIDs, currentEditor(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMergeIntoSelf):
+			apperrors.AbortWithError(c, apperrors.ErrInvalidInput("duplicate_ids", err.Error()))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			apperrors.AbortWithError(c, apperrors.ErrNotFound("Contact"))
+		default:
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to merge contacts").WithError(err))
+		}
+		return
+	}
+
+	for _, contact := range merged {
+		go services.TriggerWebhooks(db, currentConfig(c), userID, "contact.deleted", gin.H{"id": contact.ID})
+	}
+	go services.TriggerWebhooks(db, currentConfig(c), userID, "contact.updated", survivor)
+	c.JSON(http.StatusOK, survivor)
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicateContacts(t *testing.T) {
+	db, router := setupRouter()
+	require.NoError(t, db.AutoMigrate(&models.ReminderCompletion{}))
+
+	var user models.User
+	db.First(&user)
+
+	router.GET("/contacts/duplicates", GetDuplicateContacts)
+	router.POST("/contacts/:id/merge", withValidated(func() any { return &models.MergeContactsInput{} }), MergeContacts)
+
+	first := models.Contact{UserID: user.ID, Firstname: "Ada", Lastname: "Lovelace", Email: "ada@example.com"}
+	second := models.Contact{UserID: user.ID, Firstname: "Ada", Lastname: "Lovelace", Phone: "+44 20 7946 0018"}
+	require.NoError(t, db.Create(&first).Error)
+	require.NoError(t, db.Create(&second).Error)
+
+	req, _ := http.NewRequest("GET", "/contacts/duplicates", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Clusters []models.DuplicateCluster `json:"clusters"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Clusters, 1)
+	assert.Equal(t, []string{"name"}, response.Clusters[0].Pairs[0].Reasons)
+
+	req, _ = http.NewRequest("GET", "/contacts/duplicates?min_score=1.5", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	merge := func(id uint, duplicateIDs ...uint) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.MergeContactsInput{DuplicateIDs: duplicateIDs})
+		req, _ := http.NewRequest("POST", "/contacts/"+strconv.Itoa(int(id))+"/merge", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, merge(first.ID, first.ID).Code)
+	assert.Equal(t, http.StatusNotFound, merge(first.ID, 9999).Code)
+
+	w = merge(first.ID, second.ID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var merged models.Contact
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &merged))
+	assert.Equal(t, first.ID, merged.ID)
+	assert.Equal(t, "ada@example.com", merged.Email)
+	assert.Equal(t, "+44 20 7946 0018", merged.Phone)
+
+	var count int64
+	db.Model(&models.Contact{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
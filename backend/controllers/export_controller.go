@@ -258,7 +258,7 @@ func ExportData(c *gin.Context) {
 
 	reminderHeaders := []string{
 		"ID", "Contact ID", "Contact Name", "Message", "Remind At", "Recurrence",
-		"By Mail", "Reoccur From Completion", "Completed", "Last Sent", "Created At", "Updated At",
+		"Recurrence Rule", "By Mail", "Reoccur From Completion", "Completed", "Last Sent", "Created At", "Updated At",
 	}
 	if err := writer.Write(reminderHeaders); err != nil {
 		log.Error().Err(err).Msg("Failed to write reminder headers")
@@ -296,6 +296,7 @@ func ExportData(c *gin.Context) {
 			reminder.Message,
 			reminder.RemindAt.Format(time.RFC3339),
 			reminder.Recurrence,
+			reminder.RecurrenceRule,
 			byMail,
 			reoccurFromCompletion,
 			fmt.Sprintf("%t", reminder.Completed),
@@ -337,7 +338,9 @@ func ExportData(c *gin.Context) {
 		Msg("Data export completed successfully")
 }
 
-// ExportContactsAsVCF exports all user contacts as a VCF (vCard) file
+// ExportContactsAsVCF exports all user contacts as a VCF (vCard) file.
+// The vCard version is 3.0 unless 4.0 is requested via ?version=4.0 or an
+// Accept header such as "text/vcard; version=4.0".
 func ExportContactsAsVCF(c *gin.Context, photoDir string) {
 	db := c.MustGet("db").(*gorm.DB)
 	log := logger.FromContext(c)
@@ -357,12 +360,21 @@ func ExportContactsAsVCF(c *gin.Context, photoDir string) {
 		return
 	}
 
+	version := carddav.NegotiateVCardVersion(c.GetHeader("Accept"))
+	if v := c.Query("version"); v != "" {
+		if v != carddav.VCardVersion3 && v != carddav.VCardVersion4 {
+			apperrors.AbortWithError(c, apperrors.ErrInvalidInput("version", "must be 3.0 or 4.0"))
+			return
+		}
+		version = v
+	}
+
 	// Generate VCF content
 	var buf bytes.Buffer
 	encoder := vcard.NewEncoder(&buf)
 
 	for _, contact := range contacts {
-		card := carddav.ContactToVCard(&contact, photoDir)
+		card := carddav.ContactToVCardVersion(&contact, photoDir, version)
 		if err := encoder.Encode(card); err != nil {
 			log.Error().Err(err).Uint("contact_id", contact.ID).Msg("Failed to encode contact as vCard")
 			// Continue with other contacts instead of failing completely
@@ -383,5 +395,6 @@ func ExportContactsAsVCF(c *gin.Context, photoDir string) {
 
 	log.Info().
 		Int("contacts", len(contacts)).
+		Str("version", version).
 		Msg("VCF export completed successfully")
 }
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -209,3 +210,40 @@ func TestExportDataUserScoping(t *testing.T) {
 	assert.True(t, strings.Contains(body, "UserContact"))
 	assert.False(t, strings.Contains(body, "OtherUserContact"))
 }
+
+func TestExportContactsAsVCFVersion(t *testing.T) {
+	db, router := setupRouter()
+
+	var user models.User
+	db.First(&user)
+	db.Create(&models.Contact{UserID: user.ID, Firstname: "Alice", Anniversary: "2010-06-12"})
+
+	router.GET("/export/vcf", func(c *gin.Context) { ExportContactsAsVCF(c, "") })
+
+	export := func(query, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/export/vcf"+query, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := export("", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "VERSION:3.0")
+	assert.Contains(t, w.Body.String(), "X-ANNIVERSARY:2010-06-12")
+
+	w = export("", "text/vcard; version=4.0")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "VERSION:4.0")
+	assert.Contains(t, w.Body.String(), "ANNIVERSARY:20100612")
+	assert.NotContains(t, w.Body.String(), "X-ANNIVERSARY")
+
+	w = export("?version=4.0", "")
+	assert.Contains(t, w.Body.String(), "VERSION:4.0")
+
+	w = export("?version=2.1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
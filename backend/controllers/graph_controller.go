@@ -2,9 +2,12 @@ package controllers
 
 import (
 	"fmt"
+	"meerkat/filters"
 	"meerkat/models"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -45,6 +48,33 @@ func GetGraph(c *gin.Context) {
 		return
 	}
 
+	// 4. Work out smart circle membership, so the graph can be filtered by smart circles too
+	smartCircles, err := models.ListSmartCircles(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch smart circles"})
+		return
+	}
+	now := time.Now()
+	smartCircleNames := make(map[uint][]string)
+	smartCircleSet := make(map[string]bool)
+	for _, sc := range smartCircles {
+		smartCircleSet[sc.Name] = true
+		filter, err := filters.ParseContactFilter(sc.Filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch smart circles"})
+			return
+		}
+		var memberIDs []uint
+		if err := filter.Members(db.Model(&models.Contact{}).Where("contacts.user_id = ?", userID), now).
+			Pluck("contacts.id", &memberIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch smart circles"})
+			return
+		}
+		for _, id := range memberIDs {
+			smartCircleNames[id] = append(smartCircleNames[id], sc.Name)
+		}
+	}
+
 	// Build nodes array
 	nodes := make([]models.GraphNode, 0, len(contacts)+len(activities))
 
@@ -54,12 +84,15 @@ func GetGraph(c *gin.Context) {
 		if label == "" {
 			label = "Unknown"
 		}
+		// As in the contacts list, a smart circle replaces a stored circle of the same name
+		circles := slices.DeleteFunc(slices.Clone(contact.Circles), func(name string) bool { return smartCircleSet[name] })
+		circles = append(circles, smartCircleNames[contact.ID]...)
 		nodes = append(nodes, models.GraphNode{
 			ID:             fmt.Sprintf("c-%d", contact.ID),
 			Type:           "contact",
 			Label:          label,
 			PhotoThumbnail: contact.PhotoThumbnail,
-			Circles:        contact.Circles,
+			Circles:        circles,
 		})
 	}
 
@@ -3,6 +3,7 @@ package controllers
 import (
 	apperrors "meerkat/errors"
 	"meerkat/config"
+	"meerkat/models"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -46,6 +47,14 @@ func currentConfig(c *gin.Context) config.Config {
 	return config.Config{}
 }
 
+// currentEditor describes the current request as the source of a contact change
+func currentEditor(c *gin.Context) models.ContactEditor {
+	if c.GetBool("isAPIToken") {
+		return models.ContactEditor{Source: models.ContactSourceAPIToken, Actor: c.GetString("apiTokenName")}
+	}
+	return models.ContactEditor{Source: models.ContactSourceWeb, Actor: c.GetString("username")}
+}
+
 // GetPaginationParams extracts pagination query params using shared defaults and bounds.
 func GetPaginationParams(c *gin.Context) PaginationParams {
 	page := parsePositiveOrDefault(c.DefaultQuery("page", "1"), defaultPage)
@@ -204,7 +204,7 @@ func ConfirmImport(c *gin.Context) {
 		return
 	}
 
-	result, appErr := importSessions.Confirm(db, userID, *request, log)
+	result, appErr := importSessions.Confirm(db, userID, *request, importEditor(c), log)
 	if appErr != nil {
 		apperrors.AbortWithError(c, appErr)
 		return
@@ -229,7 +229,7 @@ func ConfirmVCFImport(c *gin.Context, cfg *config.Config) {
 		return
 	}
 
-	result, appErr := importSessions.ConfirmVCF(db, userID, *request, cfg, log)
+	result, appErr := importSessions.ConfirmVCF(db, userID, *request, importEditor(c), cfg, log)
 	if appErr != nil {
 		apperrors.AbortWithError(c, appErr)
 		return
@@ -237,3 +237,10 @@ func ConfirmVCFImport(c *gin.Context, cfg *config.Config) {
 
 	c.JSON(http.StatusOK, result)
 }
+
+// importEditor describes the current request as the source of imported contact changes
+func importEditor(c *gin.Context) models.ContactEditor {
+	editor := currentEditor(c)
+	editor.Source = models.ContactSourceImport
+	return editor
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"errors"
+	"meerkat/middleware"
+	"meerkat/models"
+	"meerkat/services"
+	"net/http"
+	"strconv"
+
+	apperrors "meerkat/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxNotificationChannelsPerUser = 20
+
+func toNotificationChannelResponse(ch models.NotificationChannel) models.NotificationChannelResponse {
+	return models.NotificationChannelResponse{
+		ID:         ch.ID,
+		Name:       ch.Name,
+		Type:       ch.Type,
+		URL:        ch.URL,
+		Target:     ch.Target,
+		HasToken:   ch.Token != "",
+		Kinds:      ch.Kinds,
+		IsActive:   ch.IsActive,
+		LastSentAt: ch.LastSentAt,
+		LastError:  ch.LastError,
+		CreatedAt:  ch.CreatedAt,
+	}
+}
+
+func ListNotificationChannels(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var channels []models.NotificationChannel
+	if err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&channels).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("query"))
+		return
+	}
+
+	response := make([]models.NotificationChannelResponse, len(channels))
+	for i, ch := range channels {
+		response[i] = toNotificationChannelResponse(ch)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"channels": response})
+}
+
+func CreateNotificationChannel(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var count int64
+	if err := db.Model(&models.NotificationChannel{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("count"))
+		return
+	}
+	if count >= maxNotificationChannelsPerUser {
+		apperrors.AbortWithError(c, apperrors.ErrConflict("maximum of 20 notification channels per user reached"))
+		return
+	}
+
+	input, appErr := middleware.GetValidated[models.NotificationChannelInput](c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+
+	channel := models.NotificationChannel{UserID: userID}
+	if !applyNotificationChannelInput(c, &channel, input) {
+		return
+	}
+	if err := db.Create(&channel).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("insert"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, toNotificationChannelResponse(channel))
+}
+
+func UpdateNotificationChannel(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	channel, found := findNotificationChannel(c, db, userID)
+	if !found {
+		return
+	}
+
+	input, appErr := middleware.GetValidated[models.NotificationChannelInput](c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+
+	// A token belongs to its service, so it is not carried over to a different one
+	if input.Type != channel.Type || input.URL != channel.URL {
+		channel.Token = ""
+	}
+	if !applyNotificationChannelInput(c, &channel, input) {
+		return
+	}
+	if err := db.Save(&channel).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("update"))
+		return
+	}
+
+	c.JSON(http.StatusOK, toNotificationChannelResponse(channel))
+}
+
+func DeleteNotificationChannel(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	channel, found := findNotificationChannel(c, db, userID)
+	if !found {
+		return
+	}
+
+	if err := db.Delete(&channel).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("delete"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification channel deleted"})
+}
+
+// TestNotificationChannel sends a test notification through the channel right away
+func TestNotificationChannel(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	channel, found := findNotificationChannel(c, db, userID)
+	if !found {
+		return
+	}
+
+	var user models.User
+	if err := db.Select("id", "language").First(&user, userID).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("query user").WithError(err))
+		return
+	}
+
+	if err := services.TestNotificationChannel(c.Request.Context(), db, currentConfig(c), &channel, user.Language); err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrExternal("Notification channel", err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"channel": toNotificationChannelResponse(channel)})
+}
+
+// applyNotificationChannelInput copies the input onto the channel. Gotify and Matrix cannot be
+// reached without a token, so it aborts with a validation error if there is none.
+func applyNotificationChannelInput(c *gin.Context, channel *models.NotificationChannel, input *models.NotificationChannelInput) bool {
+	channel.Name = input.Name
+	channel.Type = input.Type
+	channel.URL = input.URL
+	channel.Target = input.Target
+	if input.Token != "" {
+		channel.Token = input.Token
+	}
+	channel.Kinds = input.Kinds
+	channel.IsActive = input.IsActive
+
+	if channel.Token == "" && (channel.Type == models.NotificationChannelGotify || channel.Type == models.NotificationChannelMatrix) {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("token", "is required for "+channel.Type+" channels"))
+		return false
+	}
+	return true
+}
+
+func findNotificationChannel(c *gin.Context, db *gorm.DB, userID uint) (models.NotificationChannel, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("id", "must be a positive integer"))
+		return models.NotificationChannel{}, false
+	}
+
+	var channel models.NotificationChannel
+	if err := db.Where("id = ? AND user_id = ?", id, userID).First(&channel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperrors.AbortWithError(c, apperrors.ErrNotFound("Notification channel"))
+		} else {
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("query"))
+		}
+		return models.NotificationChannel{}, false
+	}
+	return channel, true
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"meerkat/i18n"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationChannelLifecycle(t *testing.T) {
+	require.NoError(t, i18n.Init())
+	db, router := setupRouter()
+	db.AutoMigrate(&models.NotificationChannel{})
+
+	var received []byte
+	gotify := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/message", r.URL.Path)
+		assert.Equal(t, "app-token", r.Header.Get("X-Gotify-Key"))
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer gotify.Close()
+
+	validated := withValidated(func() any { return &models.NotificationChannelInput{} })
+	router.POST("/notification-channels", validated, CreateNotificationChannel)
+	router.PUT("/notification-channels/:id", validated, UpdateNotificationChannel)
+	router.POST("/notification-channels/:id/test", TestNotificationChannel)
+
+	send := func(method, path string, input any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(input)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	input := models.NotificationChannelInput{Name: "Phone", Type: models.NotificationChannelGotify, URL: gotify.URL, Kinds: []string{models.NotificationKindReminder}, IsActive: true}
+	w := send("POST", "/notification-channels", input)
+	require.Equal(t, http.StatusBadRequest, w.Code, "Gotify needs an application token")
+
+	input.Token = "app-token"
+	w = send("POST", "/notification-channels", input)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "app-token")
+	var resp models.NotificationChannelResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.HasToken)
+
+	// An empty token on update keeps the stored one
+	input.Token = ""
+	input.Kinds = []string{models.NotificationKindReminder, models.NotificationKindBirthday}
+	path := "/notification-channels/" + strconv.Itoa(int(resp.ID))
+	w = send("PUT", path, input)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = send("POST", path+"/test", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, string(received), "This is a test notification from Meerkat CRM.")
+
+	var stored models.NotificationChannel
+	require.NoError(t, db.First(&stored, resp.ID).Error)
+	assert.Equal(t, "app-token", stored.Token)
+	assert.Len(t, stored.Kinds, 2)
+	assert.NotNil(t, stored.LastSentAt)
+	assert.Nil(t, stored.LastError)
+}
+
+func TestTestNotificationChannel_ReportsFailure(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.NotificationChannel{})
+
+	ntfy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ntfy.Close()
+
+	var user models.User
+	db.First(&user)
+	channel := models.NotificationChannel{UserID: user.ID, Name: "ntfy", Type: models.NotificationChannelNtfy, URL: ntfy.URL, Target: "meerkat", Kinds: []string{models.NotificationKindReminder}, IsActive: true}
+	require.NoError(t, db.Create(&channel).Error)
+
+	router.POST("/notification-channels/:id/test", TestNotificationChannel)
+	req, _ := http.NewRequest("POST", "/notification-channels/"+strconv.Itoa(int(channel.ID))+"/test", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var stored models.NotificationChannel
+	require.NoError(t, db.First(&stored, channel.ID).Error)
+	require.NotNil(t, stored.LastError)
+	assert.Contains(t, *stored.LastError, "403")
+}
@@ -50,6 +50,7 @@ func CreateReminder(c *gin.Context) {
 	reminder.RemindAt = time.Date(reminder.RemindAt.Year(),
 		reminder.RemindAt.Month(),
 		reminder.RemindAt.Day(), 0, 0, 0, 0, reminder.RemindAt.Location())
+	reminder.StartRecurrence()
 
 	// Save the new reminder to the database
 	if err := db.Create(&reminder).Error; err != nil {
@@ -113,15 +114,29 @@ func UpdateReminder(c *gin.Context) {
 	}
 
 	// Updateable fields
-	reminder.Message = updatedReminder.Message
-	reminder.ByMail = updatedReminder.ByMail
-	reminder.RemindAt = time.Date(updatedReminder.RemindAt.Year(),
+	remindAt := time.Date(updatedReminder.RemindAt.Year(),
 		updatedReminder.RemindAt.Month(),
 		updatedReminder.RemindAt.Day(), 0, 0, 0, 0,
 		updatedReminder.RemindAt.Location())
+	// A changed rule or date starts the rule over from the new date
+	restartRecurrence := reminder.Recurrence != updatedReminder.Recurrence ||
+		reminder.RecurrenceRule != updatedReminder.RecurrenceRule ||
+		!reminder.RemindAt.Equal(remindAt)
+	// A reminder moved to a later date or time is sent again
+	if !reminder.RemindAt.Equal(remindAt) || reminder.RemindTime != updatedReminder.RemindTime {
+		reminder.EmailSent = false
+	}
+	reminder.Message = updatedReminder.Message
+	reminder.ByMail = updatedReminder.ByMail
+	reminder.RemindAt = remindAt
+	reminder.RemindTime = updatedReminder.RemindTime
 	reminder.Recurrence = updatedReminder.Recurrence
+	reminder.RecurrenceRule = updatedReminder.RecurrenceRule
 	reminder.ReoccurFromCompletion = updatedReminder.ReoccurFromCompletion
 	reminder.ContactID = updatedReminder.ContactID
+	if restartRecurrence {
+		reminder.StartRecurrence()
+	}
 
 	if reminder.ContactID != nil {
 		var contact models.Contact
@@ -135,7 +150,15 @@ func UpdateReminder(c *gin.Context) {
 		}
 	}
 
-	db.Updates(&reminder)
+	if err := db.Updates(&reminder).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to update reminder").WithError(err))
+		return
+	}
+	// Updates skips zero values, which clear the rule when switching away from "custom" or the time
+	if err := db.Model(&reminder).Select("recurrence_rule", "recurrence_start", "remind_time", "email_sent").Updates(&reminder).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to update reminder").WithError(err))
+		return
+	}
 
 	// Clear the Contact association to avoid including it in the response
 	reminder.Contact = models.Contact{}
@@ -285,40 +308,23 @@ func CompleteReminder(c *gin.Context) {
 		return
 	}
 
-	// Mark as completed
-	reminder.Completed = true
-	reminder.LastSent = new(time.Time)
-	*reminder.LastSent = time.Now()
-
-	// Create a completion record for the timeline (unless skipping)
-	if !skip {
-		completion := models.ReminderCompletion{
-			UserID:      userID,
-			ReminderID:  &reminder.ID,
-			ContactID:   *reminder.ContactID,
-			Message:     reminder.Message,
-			CompletedAt: time.Now(),
-		}
-		if err := db.Create(&completion).Error; err != nil {
-			logger.FromContext(c).Error().Err(err).Msg("Failed to create reminder completion record")
-			// Don't fail the entire operation if completion record fails
-		}
-	}
-
 	action := "completed"
 	if skip {
 		action = "skipped"
 	}
 
-	// If reoccur from completion, calculate next reminder time
-	// Default to true if not specified (nil)
-	reoccurFromCompletion := reminder.ReoccurFromCompletion == nil || *reminder.ReoccurFromCompletion
-	if reoccurFromCompletion && reminder.Recurrence != "once" {
-		reminder.RemindAt = services.CalculateNextReminderTime(reminder)
-		// Reset completed and email_sent flags for recurring reminders
-		reminder.Completed = false
-		reminder.EmailSent = false
+	deleted, err := services.CompleteReminder(db, &reminder, skip)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to update reminder").WithError(err))
+		return
+	}
 
+	if deleted {
+		logger.FromContext(c).Info().Uint("reminder_id", reminder.ID).Str("action", action).Msg("Deleted 'once' reminder")
+		c.JSON(http.StatusOK, gin.H{"message": "Reminder " + action + " and deleted"})
+		return
+	}
+	if !reminder.Completed {
 		logger.FromContext(c).Info().
 			Time("next_remind_at", reminder.RemindAt).
 			Uint("reminder_id", reminder.ID).
@@ -326,34 +332,83 @@ func CompleteReminder(c *gin.Context) {
 			Msg("Reminder processed, next occurrence scheduled")
 	}
 
-	// Delete "once" reminders after completion
-	if reminder.Recurrence == "once" {
-		if err := db.Delete(&reminder).Error; err != nil {
-			apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to delete 'once' reminder").WithError(err))
-			return
+	// Clear the Contact association to avoid including it in the response
+	reminder.Contact = models.Contact{}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Reminder " + action + " successfully",
+		"reminder": reminder,
+	})
+}
+
+// SnoozeReminder moves a reminder to a later date without completing it, either by a number of
+// days or to a given date. The snooze is recorded on the contact's timeline.
+func SnoozeReminder(c *gin.Context) {
+	id := c.Param("id")
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var reminder models.Reminder
+	if err := db.Where("user_id = ?", userID).First(&reminder, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperrors.AbortWithError(c, apperrors.ErrNotFound("Reminder").WithDetails("id", id))
+		} else {
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve reminder").WithError(err))
 		}
+		return
+	}
+	if reminder.Completed {
+		apperrors.AbortWithError(c, apperrors.ErrConflict("Completed reminders cannot be snoozed"))
+		return
+	}
 
-		logger.FromContext(c).Info().Uint("reminder_id", reminder.ID).Str("action", action).Msg("Deleted 'once' reminder")
-		c.JSON(http.StatusOK, gin.H{"message": "Reminder " + action + " and deleted"})
+	input, err := middleware.GetValidated[models.ReminderSnoozeInput](c)
+	if err != nil {
+		apperrors.AbortWithError(c, err)
 		return
 	}
 
-	// Save the updated reminder
-	if err := db.Save(&reminder).Error; err != nil {
-		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to update reminder").WithError(err))
+	now := services.UserNow(db, userID, currentConfig(c))
+	var until time.Time
+	if input.Until != nil {
+		if input.Days != 0 {
+			apperrors.AbortWithError(c, apperrors.ErrInvalidInput("until", "cannot be combined with days"))
+			return
+		}
+		until = time.Date(input.Until.Year(), input.Until.Month(), input.Until.Day(), 0, 0, 0, 0, input.Until.Location())
+		// Snoozing only moves a reminder forward
+		if until.Before(services.SnoozeDate(reminder.RemindAt, 1, now)) {
+			apperrors.AbortWithError(c, apperrors.ErrInvalidInput("until", "must be after today and after the reminder's date"))
+			return
+		}
+	} else {
+		until = services.SnoozeDate(reminder.RemindAt, input.Days, now)
+	}
+
+	snooze, snoozeErr := services.SnoozeReminder(db, &reminder, until)
+	if snoozeErr != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to snooze reminder").WithError(snoozeErr))
 		return
 	}
+	logger.FromContext(c).Info().
+		Time("remind_at", reminder.RemindAt).
+		Uint("reminder_id", reminder.ID).
+		Msg("Reminder snoozed")
 
-	// Clear the Contact association to avoid including it in the response
-	reminder.Contact = models.Contact{}
+	go services.TriggerWebhooks(db, currentConfig(c), userID, "reminder.snoozed", reminder)
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":  "Reminder " + action + " successfully",
+		"message":  "Reminder snoozed successfully",
 		"reminder": reminder,
+		"snooze":   snooze,
 	})
 }
 
-// GetCompletionsForContact returns all reminder completions for a specific contact
+// GetCompletionsForContact returns all reminder completions and snoozes for a specific contact
 func GetCompletionsForContact(c *gin.Context) {
 	contactID := c.Param("id")
 	db := c.MustGet("db").(*gorm.DB)
@@ -382,8 +437,17 @@ func GetCompletionsForContact(c *gin.Context) {
 		return
 	}
 
+	var snoozes []models.ReminderSnooze
+	if err := db.Where("user_id = ? AND contact_id = ?", userID, contactID).
+		Order("snoozed_at DESC").
+		Find(&snoozes).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve reminder snoozes").WithError(err))
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"completions": completions,
+		"snoozes":     snoozes,
 	})
 }
 
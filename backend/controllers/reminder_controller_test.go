@@ -150,6 +150,138 @@ func TestUpdateReminder(t *testing.T) {
 	var responseBody map[string]any
 	json.Unmarshal(w.Body.Bytes(), &responseBody)
 	assert.Equal(t, "Reminder updated successfully", responseBody["message"])
+
+	// Setting a time of day sends the reminder again at that time
+	db.Model(&reminder).Update("email_sent", true)
+	updatedReminder.RemindTime = "15:00"
+	jsonValue, _ = json.Marshal(updatedReminder)
+	req, _ = http.NewRequest("PUT", "/reminders/"+strconv.Itoa(int(reminder.ID)), bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stored models.Reminder
+	db.First(&stored, reminder.ID)
+	assert.Equal(t, "15:00", stored.RemindTime)
+	assert.False(t, stored.EmailSent)
+}
+
+func TestCustomReminderRecurrence(t *testing.T) {
+	db, router := setupRouter()
+
+	var user models.User
+	db.First(&user)
+	router.POST("/contacts/:id/reminders", withValidated(func() any { return &models.Reminder{} }), CreateReminder)
+	router.PUT("/reminders/:id", withValidated(func() any { return &models.Reminder{} }), UpdateReminder)
+
+	contact := models.Contact{UserID: user.ID, Firstname: "Anna"}
+	db.Create(&contact)
+
+	send := func(method, path string, reminder models.Reminder) models.Reminder {
+		jsonValue, _ := json.Marshal(reminder)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response struct {
+			Reminder models.Reminder `json:"reminder"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Reminder
+	}
+
+	remindAt := time.Date(2030, 3, 5, 15, 0, 0, 0, time.UTC)
+	created := send("POST", "/contacts/"+strconv.Itoa(int(contact.ID))+"/reminders", models.Reminder{
+		Message:        "Physio",
+		RemindAt:       remindAt,
+		Recurrence:     "custom",
+		RecurrenceRule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;COUNT=6",
+	})
+	if assert.NotNil(t, created.RecurrenceStart) {
+		assert.Equal(t, time.Date(2030, 3, 5, 0, 0, 0, 0, time.UTC), created.RecurrenceStart.UTC())
+	}
+
+	// Switching to a preset clears the rule
+	path := "/reminders/" + strconv.Itoa(int(created.ID))
+	send("PUT", path, models.Reminder{Message: "Physio", RemindAt: remindAt, Recurrence: "weekly", RecurrenceRule: created.RecurrenceRule})
+
+	var stored models.Reminder
+	db.First(&stored, created.ID)
+	assert.Equal(t, "weekly", stored.Recurrence)
+	assert.Empty(t, stored.RecurrenceRule)
+	assert.Nil(t, stored.RecurrenceStart)
+}
+
+func TestSnoozeReminder(t *testing.T) {
+	db, router := setupRouter()
+	db.AutoMigrate(&models.ReminderCompletion{})
+
+	var user models.User
+	db.First(&user)
+	router.POST("/reminders/:id/snooze", withValidated(func() any { return &models.ReminderSnoozeInput{} }), SnoozeReminder)
+	router.GET("/contacts/:id/reminder-completions", GetCompletionsForContact)
+
+	contact := models.Contact{UserID: user.ID, Firstname: "Anna"}
+	db.Create(&contact)
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	reminder := models.Reminder{UserID: user.ID, ContactID: &contact.ID, Message: "Call Anna", RemindAt: today.AddDate(0, 0, -2), Recurrence: "once", EmailSent: true}
+	db.Create(&reminder)
+	path := "/reminders/" + strconv.Itoa(int(reminder.ID)) + "/snooze"
+
+	snooze := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// An overdue reminder is snoozed from today
+	w := snooze(`{"days": 1}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var stored models.Reminder
+	db.First(&stored, reminder.ID)
+	assert.Equal(t, today.AddDate(0, 0, 1), stored.RemindAt.UTC())
+	assert.False(t, stored.EmailSent, "the reminder is sent again on its new date")
+
+	// A reminder that is not due yet is snoozed from its date
+	w = snooze(`{"days": 7}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	db.First(&stored, reminder.ID)
+	assert.Equal(t, today.AddDate(0, 0, 8), stored.RemindAt.UTC())
+
+	until := today.AddDate(0, 1, 0)
+	w = snooze(`{"until": "` + until.Format(time.RFC3339) + `"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	db.First(&stored, reminder.ID)
+	assert.Equal(t, until, stored.RemindAt.UTC())
+
+	assert.Equal(t, http.StatusBadRequest, snooze(`{"until": "`+today.Format(time.RFC3339)+`"}`).Code, "snoozing cannot move a reminder back")
+	assert.Equal(t, http.StatusBadRequest, snooze(`{"days": 1, "until": "`+until.AddDate(0, 1, 0).Format(time.RFC3339)+`"}`).Code)
+
+	// Snoozes show up on the timeline instead of completions
+	req, _ := http.NewRequest("GET", "/contacts/"+strconv.Itoa(int(contact.ID))+"/reminder-completions", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var timeline struct {
+		Completions []models.ReminderCompletion `json:"completions"`
+		Snoozes     []models.ReminderSnooze     `json:"snoozes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &timeline)
+	assert.Empty(t, timeline.Completions)
+	if assert.Len(t, timeline.Snoozes, 3) {
+		assert.Equal(t, until, timeline.Snoozes[0].RemindAt.UTC())
+		assert.Equal(t, today.AddDate(0, 0, 8), timeline.Snoozes[0].PreviousRemindAt.UTC())
+		assert.Equal(t, "Call Anna", timeline.Snoozes[0].Message)
+	}
+
+	db.Model(&stored).Update("completed", true)
+	assert.Equal(t, http.StatusConflict, snooze(`{"days": 1}`).Code)
 }
 
 func TestDeleteReminder(t *testing.T) {
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"errors"
+	apperrors "meerkat/errors"
+	"meerkat/services"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+)
+
+// Search runs a full-text search across the user's contacts, notes and activities.
+// Query parameters: q (required), types (comma-separated subset of contact, note, activity) and limit.
+func Search(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		apperrors.AbortWithError(c, apperrors.ErrMissingField("q"))
+		return
+	}
+
+	var types []string
+	if raw := c.Query("types"); raw != "" {
+		for _, searchType := range strings.Split(raw, ",") {
+			searchType = strings.TrimSpace(searchType)
+			if !slices.Contains(services.SearchTypes, searchType) {
+				apperrors.AbortWithError(c, apperrors.ErrInvalidInput("types", "must be contact, note or activity"))
+				return
+			}
+			if !slices.Contains(types, searchType) {
+				types = append(types, searchType)
+			}
+		}
+	}
+
+	limit := parsePositiveOrDefault(c.DefaultQuery("limit", "20"), defaultSearchLimit)
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	results, err := services.Search(db, userID, query, types, limit)
+	if errors.Is(err, services.ErrEmptySearchQuery) {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("q", "must contain at least one letter or digit"))
+		return
+	}
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to search").WithError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   query,
+		"results": results,
+	})
+}
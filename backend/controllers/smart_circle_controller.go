@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"errors"
+	"meerkat/database"
+	"meerkat/filters"
+	"meerkat/middleware"
+	"meerkat/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	apperrors "meerkat/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxSmartCirclesPerUser = 50
+
+func toSmartCircleResponse(sc models.SmartCircle) models.SmartCircleResponse {
+	return models.SmartCircleResponse{
+		ID:        sc.ID,
+		Name:      sc.Name,
+		Filter:    sc.Filter,
+		CreatedAt: sc.CreatedAt,
+		UpdatedAt: sc.UpdatedAt,
+	}
+}
+
+func ListSmartCircles(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	circles, err := models.ListSmartCircles(db, userID)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("query"))
+		return
+	}
+
+	response := make([]models.SmartCircleResponse, len(circles))
+	for i, sc := range circles {
+		response[i] = toSmartCircleResponse(sc)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"smart_circles": response})
+}
+
+func CreateSmartCircle(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var count int64
+	if err := db.Model(&models.SmartCircle{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("count"))
+		return
+	}
+	if count >= maxSmartCirclesPerUser {
+		apperrors.AbortWithError(c, apperrors.ErrConflict("maximum of 50 smart circles per user reached"))
+		return
+	}
+
+	input, appErr := middleware.GetValidated[models.SmartCircleInput](c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+
+	sc := models.SmartCircle{UserID: userID}
+	if !applySmartCircleInput(c, db, &sc, input) {
+		return
+	}
+	if err := db.Create(&sc).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("insert"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, toSmartCircleResponse(sc))
+}
+
+func UpdateSmartCircle(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sc, found := findSmartCircle(c, db, userID)
+	if !found {
+		return
+	}
+
+	input, appErr := middleware.GetValidated[models.SmartCircleInput](c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+
+	if !applySmartCircleInput(c, db, &sc, input) {
+		return
+	}
+	if err := db.Save(&sc).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("update"))
+		return
+	}
+
+	c.JSON(http.StatusOK, toSmartCircleResponse(sc))
+}
+
+func DeleteSmartCircle(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sc, found := findSmartCircle(c, db, userID)
+	if !found {
+		return
+	}
+
+	if err := db.Delete(&sc).Error; err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("delete"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Smart circle deleted successfully"})
+}
+
+// applySmartCircleInput validates the input and copies it onto sc. The filter has to parse, and the
+// name must not belong to another smart circle or to a circle on the user's contacts, since both
+// are addressed by name.
+func applySmartCircleInput(c *gin.Context, db *gorm.DB, sc *models.SmartCircle, input *models.SmartCircleInput) bool {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("name", "must not be blank"))
+		return false
+	}
+	filter := strings.TrimSpace(input.Filter)
+	if _, err := filters.ParseContactFilter(filter); err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("filter", err.Error()))
+		return false
+	}
+
+	if name != sc.Name {
+		existing, err := models.FindSmartCircle(db, sc.UserID, name)
+		if err != nil {
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("query"))
+			return false
+		}
+		var contacts int64
+		if existing == nil {
+			err = db.Model(&models.Contact{}).
+				Where("user_id = ?", sc.UserID).
+				Where(database.JSONArrayContains(db, "contacts.circles"), name).
+				Count(&contacts).Error
+			if err != nil {
+				apperrors.AbortWithError(c, apperrors.ErrDatabase("count"))
+				return false
+			}
+		}
+		if existing != nil || contacts > 0 {
+			apperrors.AbortWithError(c, apperrors.ErrAlreadyExists("Circle").WithDetails("name", name))
+			return false
+		}
+	}
+
+	sc.Name = name
+	sc.Filter = filter
+	return true
+}
+
+func findSmartCircle(c *gin.Context, db *gorm.DB, userID uint) (models.SmartCircle, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("id", "must be a positive integer"))
+		return models.SmartCircle{}, false
+	}
+
+	var sc models.SmartCircle
+	if err := db.Where("id = ? AND user_id = ?", id, userID).First(&sc).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperrors.AbortWithError(c, apperrors.ErrNotFound("Smart circle"))
+		} else {
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("query"))
+		}
+		return models.SmartCircle{}, false
+	}
+	return sc, true
+}
+
+// smartCircleFilter returns the parsed filter of the user's smart circle with the given name, or
+// nil if the name is not a smart circle
+func smartCircleFilter(db *gorm.DB, userID uint, name string) (*filters.ContactFilter, error) {
+	sc, err := models.FindSmartCircle(db, userID, name)
+	if err != nil || sc == nil {
+		return nil, err
+	}
+	return filters.ParseContactFilter(sc.Filter)
+}
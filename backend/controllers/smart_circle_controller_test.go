@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmartCircles(t *testing.T) {
+	db, router := setupRouter()
+
+	var user models.User
+	db.First(&user)
+
+	router.POST("/smart-circles", withValidated(func() any { return &models.SmartCircleInput{} }), CreateSmartCircle)
+	router.PUT("/smart-circles/:id", withValidated(func() any { return &models.SmartCircleInput{} }), UpdateSmartCircle)
+	router.GET("/contacts", GetContacts)
+	router.GET("/contacts/circles", GetCircles)
+	router.GET("/graph", GetGraph)
+
+	contacts := []models.Contact{
+		{UserID: user.ID, Firstname: "Alice", Organization: "ACME", Circles: []string{"Work"}},
+		{UserID: user.ID, Firstname: "Bob", Organization: "Acme Ltd", Archived: true},
+		{UserID: user.ID, Firstname: "Carol", Organization: "Globex"},
+	}
+	for i := range contacts {
+		require.NoError(t, db.Create(&contacts[i]).Error)
+	}
+
+	send := func(method, path string, input models.SmartCircleInput) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(input)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/smart-circles", models.SmartCircleInput{Name: " ACME people ", Filter: "org:acme"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.SmartCircleResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "ACME people", created.Name)
+
+	// Filters are validated, and names are shared with the circles on contacts
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/smart-circles", models.SmartCircleInput{Name: "Broken", Filter: "org:acme AND"}).Code)
+	assert.Equal(t, http.StatusConflict, send("POST", "/smart-circles", models.SmartCircleInput{Name: "ACME people", Filter: "org:acme"}).Code)
+	assert.Equal(t, http.StatusConflict, send("POST", "/smart-circles", models.SmartCircleInput{Name: "Work", Filter: "org:acme"}).Code)
+	assert.Equal(t, http.StatusOK, send("PUT", "/smart-circles/"+strconv.Itoa(int(created.ID)), models.SmartCircleInput{Name: "ACME people", Filter: "org:acme"}).Code)
+
+	// Listed with the other circles
+	req, _ := http.NewRequest("GET", "/contacts/circles", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var circles []string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &circles))
+	assert.ElementsMatch(t, []string{"Work", "ACME people"}, circles)
+
+	// Usable as the circle of the contacts list; archived contacts stay hidden as usual
+	names := func(query string) []string {
+		req, _ := http.NewRequest("GET", "/contacts?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var responseBody struct {
+			Contacts []models.Contact `json:"contacts"`
+			Total    int64            `json:"total"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &responseBody))
+		result := []string{}
+		for _, c := range responseBody.Contacts {
+			result = append(result, c.Firstname)
+		}
+		assert.Equal(t, int64(len(result)), responseBody.Total)
+		return result
+	}
+	assert.Equal(t, []string{"Alice"}, names("circle="+url.QueryEscape("ACME people")))
+	assert.ElementsMatch(t, []string{"Alice", "Bob"}, names("include_archived=true&circle="+url.QueryEscape("ACME people")))
+	assert.Equal(t, []string{"Alice"}, names("circle=Work"))
+
+	// And in the graph
+	req, _ = http.NewRequest("GET", "/graph", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var graph models.GraphResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &graph))
+	nodeCircles := map[string][]string{}
+	for _, node := range graph.Nodes {
+		nodeCircles[node.Label] = node.Circles
+	}
+	assert.ElementsMatch(t, []string{"Work", "ACME people"}, nodeCircles["Alice"])
+	assert.Empty(t, nodeCircles["Carol"])
+
+	// A stored filter that no longer parses is an error, not an empty circle
+	require.NoError(t, db.Model(&models.SmartCircle{}).Where("id = ?", created.ID).Update("filter", "org:acme AND").Error)
+	req, _ = http.NewRequest("GET", "/graph", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"errors"
+	apperrors "meerkat/errors"
+	"meerkat/services"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetTrash lists the current user's deleted contacts, notes, activities and reminders
+func GetTrash(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	cfg := currentConfig(c)
+	items, err := services.ListTrash(db, userID, cfg.TrashRetention())
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to retrieve trash").WithError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":          items,
+		"retention_days": cfg.TrashRetentionDays,
+	})
+}
+
+// RestoreTrashItem restores a deleted item, and for a contact what was deleted along with it
+func RestoreTrashItem(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	itemType := c.Param("type")
+	if !slices.Contains(services.TrashTypes, itemType) {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("type", "must be one of: "+strings.Join(services.TrashTypes, ", ")))
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apperrors.AbortWithError(c, apperrors.ErrInvalidInput("id", "must be a positive integer"))
+		return
+	}
+
+	restored, err := services.RestoreTrashItem(db, userID, itemType, uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			apperrors.AbortWithError(c, apperrors.ErrNotFound("Deleted "+itemType).WithDetails("id", c.Param("id")))
+		case errors.Is(err, services.ErrTrashContactDeleted):
+			apperrors.AbortWithError(c, apperrors.ErrConflict(err.Error()))
+		default:
+			apperrors.AbortWithError(c, apperrors.ErrDatabase("Failed to restore "+itemType).WithError(err))
+		}
+		return
+	}
+
+	// To webhook consumers a restored item is a new one; reminders have no such event
+	if itemType != services.TrashTypeReminder {
+		go services.TriggerWebhooks(db, currentConfig(c), userID, itemType+".created", restored)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Restored from trash", "type": itemType, itemType: restored})
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"encoding/json"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrash(t *testing.T) {
+	db, router := setupRouter()
+
+	var user models.User
+	db.First(&user)
+
+	router.DELETE("/contacts/:id", DeleteContact)
+	router.GET("/trash", GetTrash)
+	router.POST("/trash/:type/:id/restore", RestoreTrashItem)
+
+	contact := models.Contact{UserID: user.ID, Firstname: "Alice"}
+	require.NoError(t, db.Create(&contact).Error)
+	note := models.Note{UserID: user.ID, Content: "Likes tea", Date: time.Now(), ContactID: &contact.ID}
+	require.NoError(t, db.Create(&note).Error)
+	activity := models.Activity{UserID: user.ID, Title: "Tea", Date: time.Now(), Contacts: []models.Contact{contact}}
+	require.NoError(t, db.Omit("Contacts.*").Create(&activity).Error)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, do("DELETE", "/contacts/"+strconv.Itoa(int(contact.ID))).Code)
+
+	w := do("GET", "/trash")
+	require.Equal(t, http.StatusOK, w.Code)
+	var trash struct {
+		Items         []models.TrashItem `json:"items"`
+		RetentionDays int                `json:"retention_days"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &trash))
+	require.Len(t, trash.Items, 1)
+	assert.Equal(t, "contact", trash.Items[0].Type)
+	assert.Equal(t, "Alice", trash.Items[0].Title)
+
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/trash/webhook/1/restore").Code)
+	assert.Equal(t, http.StatusNotFound, do("POST", "/trash/note/9999/restore").Code)
+
+	// The contact comes back with its note and its activity
+	w = do("POST", "/trash/contact/"+strconv.Itoa(int(contact.ID))+"/restore")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var restored models.Contact
+	require.NoError(t, db.Preload("Notes").Preload("Activities").First(&restored, contact.ID).Error)
+	assert.Len(t, restored.Notes, 1)
+	assert.Len(t, restored.Activities, 1)
+
+	w = do("GET", "/trash")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &trash))
+	assert.Empty(t, trash.Items)
+}
@@ -606,6 +606,46 @@ func GetEnabledContactFields(c *gin.Context) {
 	})
 }
 
+// UpdateReminderSchedule updates the timezone and time of day of the user's daily reminder email.
+// Empty values fall back to the instance defaults.
+func UpdateReminderSchedule(c *gin.Context) {
+	log := logger.FromContext(c)
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	input, err := middleware.GetValidated[models.ReminderScheduleInput](c)
+	if err != nil {
+		apperrors.AbortWithError(c, err)
+		return
+	}
+
+	db := c.MustGet("db").(*gorm.DB)
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		log.Error().Err(err).Uint("user_id", userID).Msg("Failed to lookup user for reminder schedule update")
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("query user").WithError(err))
+		return
+	}
+
+	user.Timezone = input.Timezone
+	user.ReminderTime = input.ReminderTime
+	if err := db.Model(&user).Select("Timezone", "ReminderTime").Updates(&user).Error; err != nil {
+		log.Error().Err(err).Uint("user_id", user.ID).Msg("Failed to update user reminder schedule")
+		apperrors.AbortWithError(c, apperrors.ErrDatabase("update user").WithError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Reminder schedule updated successfully",
+		"timezone":      user.Timezone,
+		"reminder_time": user.ReminderTime,
+	})
+}
+
 func ChangePassword(context *gin.Context) {
 	// Check if demo mode is enabled - password changes are disabled in demo
 	if os.Getenv("DEMO_MODE") == "true" {
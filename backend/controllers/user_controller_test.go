@@ -440,3 +440,36 @@ func TestEnabledContactFieldsNullVsEmpty(t *testing.T) {
 	patch(`{"fields":[]}`)
 	assert.Equal(t, "[]", rawField())
 }
+
+func TestUpdateReminderSchedule(t *testing.T) {
+	db, router := setupRouter()
+	var user models.User
+	db.First(&user)
+
+	router.PATCH("/reminder-schedule",
+		middleware.ValidateJSONMiddleware(&models.ReminderScheduleInput{}),
+		UpdateReminderSchedule)
+
+	patch := func(jsonBody string) int {
+		req, _ := http.NewRequest("PATCH", "/reminder-schedule", bytes.NewBufferString(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, patch(`{"timezone":"America/New_York","reminder_time":"07:30"}`))
+	var updated models.User
+	db.First(&updated, user.ID)
+	assert.Equal(t, "America/New_York", updated.Timezone)
+	assert.Equal(t, "07:30", updated.ReminderTime)
+
+	assert.Equal(t, http.StatusBadRequest, patch(`{"timezone":"Mars/Olympus_Mons"}`))
+	assert.Equal(t, http.StatusBadRequest, patch(`{"reminder_time":"25:00"}`))
+
+	// Empty values go back to the instance defaults
+	assert.Equal(t, http.StatusOK, patch(`{}`))
+	db.First(&updated, user.ID)
+	assert.Empty(t, updated.Timezone)
+	assert.Empty(t, updated.ReminderTime)
+}
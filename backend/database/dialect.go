@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// The helpers below return SQL fragments for the few queries that need different syntax on SQLite
+// and PostgreSQL. Column and field names are interpolated, so only pass names from the code,
+// never user input. Values go into the placeholders.
+
+// IsPostgres reports whether db is connected to PostgreSQL
+func IsPostgres(db *gorm.DB) bool {
+	return db.Dialector.Name() == DriverPostgres
+}
+
+// ILike returns the operator for a case-insensitive LIKE. SQLite's LIKE already ignores case
+// (for ASCII), PostgreSQL's does not.
+func ILike(db *gorm.DB) string {
+	if IsPostgres(db) {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+// CaseInsensitive returns an ORDER BY expression that sorts a text column without regard to case
+func CaseInsensitive(db *gorm.DB, column string) string {
+	if IsPostgres(db) {
+		return "LOWER(" + column + ")"
+	}
+	return column + " COLLATE NOCASE"
+}
+
+// JSONArrayContains returns a condition with one placeholder that holds when the JSON array of
+// strings stored in column contains the placeholder's value
+func JSONArrayContains(db *gorm.DB, column string) string {
+	if IsPostgres(db) {
+		return fmt.Sprintf("%s @> jsonb_build_array(CAST(? AS text))", postgresJSONArray(column))
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) WHERE json_each.value = ?)", column)
+}
+
+// JSONArrayValues returns a table expression for the FROM clause that lists the strings of the
+// JSON array stored in column as json_each.value, on both databases
+func JSONArrayValues(db *gorm.DB, column string) string {
+	if IsPostgres(db) {
+		return fmt.Sprintf("jsonb_array_elements_text(%s) AS json_each(value)", postgresJSONArray(column))
+	}
+	return fmt.Sprintf("json_each(%s)", column)
+}
+
+// JSONArrayFieldLike returns a condition with one placeholder that holds when a field of any
+// object in the JSON array stored in column matches the placeholder's pattern, ignoring case
+func JSONArrayFieldLike(db *gorm.DB, column, field string) string {
+	if IsPostgres(db) {
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM jsonb_array_elements(%s) AS elem(value) WHERE elem.value ->> '%s' ILIKE ?)", postgresJSONArray(column), field)
+	}
+	return fmt.Sprintf("(json_valid(%[1]s) AND EXISTS (SELECT 1 FROM json_each(%[1]s) WHERE json_extract(json_each.value, '$.%[2]s') LIKE ?))", column, field)
+}
+
+// JSONArrayElementsWhere returns a condition that holds when any object in the JSON array stored
+// in column satisfies predicate. The predicate reads the object's fields through JSONElementField.
+func JSONArrayElementsWhere(db *gorm.DB, column, predicate string) string {
+	if IsPostgres(db) {
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM jsonb_array_elements(%s) AS elem(value) WHERE jsonb_typeof(elem.value) = 'object' AND (%s))", postgresJSONArray(column), predicate)
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(CASE WHEN json_valid(%[1]s) THEN %[1]s END) AS elem WHERE elem.type = 'object' AND (%[2]s))", column, predicate)
+}
+
+// JSONElementField returns the text of an object field for use in a JSONArrayElementsWhere predicate
+func JSONElementField(db *gorm.DB, field string) string {
+	if IsPostgres(db) {
+		return fmt.Sprintf("(elem.value ->> '%s')", field)
+	}
+	return fmt.Sprintf("json_extract(elem.value, '$.%s')", field)
+}
+
+// JSONObjectEntriesWhere returns a condition that holds when any entry of the JSON object stored
+// in column satisfies predicate. The predicate reads the entry as entry.key and entry.value.
+func JSONObjectEntriesWhere(db *gorm.DB, column, predicate string) string {
+	if IsPostgres(db) {
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM jsonb_each_text(%s) AS entry(key, value) WHERE %s)", postgresJSON(column, "object"), predicate)
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(CASE WHEN json_valid(%[1]s) AND json_type(%[1]s) = 'object' THEN %[1]s END) AS entry WHERE %[2]s)", column, predicate)
+}
+
+// postgresJSONArray converts a text column holding JSON to jsonb, or NULL unless it holds an
+// array. JSON columns are text on both databases so that GORM's JSON serializer works unchanged.
+func postgresJSONArray(column string) string {
+	return postgresJSON(column, "array")
+}
+
+// postgresJSON converts a text column holding JSON to jsonb, or NULL unless its type is jsonType
+func postgresJSON(column, jsonType string) string {
+	value := fmt.Sprintf("CAST(NULLIF(%s, '') AS jsonb)", column)
+	return fmt.Sprintf("(CASE WHEN jsonb_typeof(%[1]s) = '%[2]s' THEN %[1]s END)", value, jsonType)
+}
@@ -3,7 +3,9 @@ package database
 import (
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
 	"meerkat/logger"
 
 	"github.com/glebarez/sqlite"
@@ -12,13 +14,24 @@ import (
 	"gorm.io/gorm"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*.sql migrations/postgres/*.sql
 var migrationsFS embed.FS
 
-// InitDB initializes the database connection and runs migrations
-func InitDB(dbPath string) (*gorm.DB, error) {
+// Supported values of DB_DRIVER
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// InitDB initializes the database connection and runs migrations. For SQLite dsn is the path of
+// the database file, for PostgreSQL a connection URL.
+func InitDB(driver, dsn string) (*gorm.DB, error) {
+	if driver == DriverPostgres {
+		return initPostgres(dsn)
+	}
+
 	// Open database connection for migrations
-	sqlDB, err := sql.Open("sqlite", dbPath)
+	sqlDB, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -29,7 +42,7 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 	}
 
 	// Open GORM connection
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect with GORM: %w", err)
 	}
@@ -37,7 +50,7 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 	return db, nil
 }
 
-// RunMigrations runs all pending database migrations
+// RunMigrations runs all pending SQLite migrations
 func RunMigrations(db *sql.DB) error {
 	driver, err := withInstance(db, &sqliteConfig{})
 	if err != nil {
@@ -54,6 +67,11 @@ func RunMigrations(db *sql.DB) error {
 		return fmt.Errorf("failed to create migration instance: %w", err)
 	}
 
+	return applyMigrations(m)
+}
+
+// applyMigrations brings a database up to the newest migration of its set
+func applyMigrations(m *migrate.Migrate) error {
 	// Get current version
 	version, dirty, err := m.Version()
 	if err != nil && err != migrate.ErrNilVersion {
@@ -117,3 +135,38 @@ func MigrateDown(dbPath string) error {
 	logger.Info().Msg("Migration rolled back successfully")
 	return nil
 }
+
+// LatestMigrationVersion returns the version of the newest SQLite migration embedded in this binary
+func LatestMigrationVersion() (uint, error) {
+	sourceDriver, err := iofs.New(migrationsFS, "migrations")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create migration source: %w", err)
+	}
+	defer sourceDriver.Close()
+
+	version, err := sourceDriver.First()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read first migration: %w", err)
+	}
+	for {
+		next, err := sourceDriver.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read migration after %d: %w", version, err)
+		}
+		version = next
+	}
+}
+
+// SchemaVersion reads the migration version of a database without changing it. Unlike the
+// migration driver it does not create the migrations table, so it fails for databases that
+// were never migrated.
+func SchemaVersion(db *sql.DB) (version uint, dirty bool, err error) {
+	query := "SELECT version, dirty FROM " + defaultMigrationsTable + " LIMIT 1"
+	if err := db.QueryRow(query).Scan(&version, &dirty); err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, dirty, nil
+}
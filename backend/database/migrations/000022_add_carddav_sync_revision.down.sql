@@ -0,0 +1,5 @@
+-- NOTE: ALTER TABLE ... DROP COLUMN requires SQLite >= 3.35.0 (2021-03-12).
+DROP INDEX IF EXISTS idx_contacts_user_sync_revision;
+
+ALTER TABLE carddav_sync DROP COLUMN revision;
+ALTER TABLE contacts DROP COLUMN sync_revision;
@@ -0,0 +1,27 @@
+-- Per-user revision counter for RFC 6578 sync-collection. Every contact change
+-- (including soft deletes) bumps carddav_sync.revision and stamps the new value on
+-- the contact row, so a sync token is simply "the highest revision the client saw".
+ALTER TABLE contacts ADD COLUMN sync_revision INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE carddav_sync ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_contacts_user_sync_revision ON contacts(user_id, sync_revision);
+
+-- Give existing contacts (soft-deleted ones included) distinct revisions per user
+UPDATE contacts
+SET sync_revision = numbered.revision
+FROM (
+  SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY id) AS revision
+  FROM contacts
+) AS numbered
+WHERE contacts.id = numbered.id;
+
+-- Start each user's counter at their highest backfilled revision
+INSERT INTO carddav_sync (user_id, sync_token, last_modified, revision)
+SELECT user_id, 'urn:meerkat:sync:' || MAX(sync_revision), CURRENT_TIMESTAMP, MAX(sync_revision)
+FROM contacts
+WHERE true
+GROUP BY user_id
+ON CONFLICT(user_id) DO UPDATE SET
+  revision = excluded.revision,
+  sync_token = excluded.sync_token,
+  last_modified = excluded.last_modified;
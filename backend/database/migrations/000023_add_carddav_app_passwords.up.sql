@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS carddav_app_passwords (
+    id            INTEGER  PRIMARY KEY AUTOINCREMENT,
+    created_at    DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at    DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at    DATETIME,
+    user_id       INTEGER  NOT NULL,
+    name          TEXT     NOT NULL,
+    password_hash TEXT     NOT NULL UNIQUE,
+    last_used_at  DATETIME,
+    revoked_at    DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_carddav_app_passwords_user_id ON carddav_app_passwords(user_id);
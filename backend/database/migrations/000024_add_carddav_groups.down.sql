@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_carddav_groups_user_uid;
+DROP TABLE IF EXISTS carddav_groups;
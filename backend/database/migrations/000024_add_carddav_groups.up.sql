@@ -0,0 +1,16 @@
+-- Group vCards (KIND:group) that represent circles over CardDAV. Circles only exist as
+-- labels on contacts; a row keeps the group's UID stable across syncs, and soft-deleted
+-- rows keep their sync_revision so incremental syncs can report removed groups.
+CREATE TABLE IF NOT EXISTS carddav_groups (
+    id            INTEGER  PRIMARY KEY AUTOINCREMENT,
+    created_at    DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at    DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at    DATETIME,
+    user_id       INTEGER  NOT NULL,
+    name          TEXT     NOT NULL,
+    vcard_uid     TEXT     NOT NULL,
+    etag          TEXT     NOT NULL DEFAULT '',
+    sync_revision INTEGER  NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_carddav_groups_user_uid ON carddav_groups(user_id, vcard_uid);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_carddav_remote_objects_uid;
+DROP TABLE IF EXISTS carddav_remote_objects;
+DROP INDEX IF EXISTS idx_carddav_remotes_user_id;
+DROP TABLE IF EXISTS carddav_remotes;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS carddav_remotes (
+    id               INTEGER  PRIMARY KEY AUTOINCREMENT,
+    created_at       DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at       DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at       DATETIME,
+    user_id          INTEGER  NOT NULL,
+    name             TEXT     NOT NULL,
+    url              TEXT     NOT NULL,
+    username         TEXT,
+    password         TEXT,
+    mode             TEXT     NOT NULL DEFAULT 'two_way',
+    interval_minutes INTEGER  NOT NULL DEFAULT 60,
+    is_active        BOOLEAN  DEFAULT 1,
+    last_sync_at     DATETIME,
+    last_error       TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_carddav_remotes_user_id ON carddav_remotes(user_id);
+
+-- Which remote card each contact is synced with, and both sides' state after the last sync
+CREATE TABLE IF NOT EXISTS carddav_remote_objects (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    remote_id      INTEGER NOT NULL,
+    vcard_uid      TEXT    NOT NULL,
+    href           TEXT    NOT NULL,
+    remote_etag    TEXT    NOT NULL DEFAULT '',
+    local_revision INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (remote_id) REFERENCES carddav_remotes(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_carddav_remote_objects_uid ON carddav_remote_objects(remote_id, vcard_uid);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_calendar_feed_tokens_user_id;
+DROP TABLE IF EXISTS calendar_feed_tokens;
@@ -0,0 +1,16 @@
+DROP TRIGGER IF EXISTS activities_fts_delete;
+DROP TRIGGER IF EXISTS activities_fts_update;
+DROP TRIGGER IF EXISTS activities_fts_insert;
+DROP TABLE IF EXISTS activities_fts;
+
+DROP TRIGGER IF EXISTS notes_fts_delete;
+DROP TRIGGER IF EXISTS notes_fts_update;
+DROP TRIGGER IF EXISTS notes_fts_insert;
+DROP TABLE IF EXISTS notes_fts;
+
+DROP TRIGGER IF EXISTS contacts_fts_delete;
+DROP TRIGGER IF EXISTS contacts_fts_update;
+DROP TRIGGER IF EXISTS contacts_fts_insert;
+DROP TABLE IF EXISTS contacts_fts;
+
+DROP VIEW IF EXISTS contacts_search_documents;
@@ -0,0 +1,109 @@
+-- Full-text search over contacts, notes and activities. Each FTS5 table uses the id of the
+-- indexed row as its rowid and is kept in sync by triggers, so every write path (API, CardDAV,
+-- imports, restores) updates the index. Soft-deleted rows are not indexed.
+
+-- The text indexed for each contact, in one place for the triggers and the backfill below
+CREATE VIEW contacts_search_documents AS
+SELECT
+    c.id,
+    c.user_id,
+    concat_ws(' ', NULLIF(c.prefix, ''), c.firstname, NULLIF(c.middle_name, ''), NULLIF(c.lastname, ''),
+        NULLIF(c.suffix, ''), NULLIF(c.nickname, '')) AS name,
+    concat_ws(' ', NULLIF(c.organization, ''), NULLIF(c.department, ''), NULLIF(c.job_title, ''),
+        NULLIF(c.role, '')) AS organization,
+    concat_ws(' ',
+        (SELECT group_concat(json_extract(e.value, '$.value'), ' ')
+           FROM json_each(CASE WHEN json_valid(c.emails) THEN c.emails END) e WHERE e.type = 'object'),
+        (SELECT group_concat(json_extract(p.value, '$.value'), ' ')
+           FROM json_each(CASE WHEN json_valid(c.phones) THEN c.phones END) p WHERE p.type = 'object'),
+        (SELECT group_concat(concat_ws(' ', json_extract(a.value, '$.street'), json_extract(a.value, '$.city'),
+                json_extract(a.value, '$.region'), json_extract(a.value, '$.postal'), json_extract(a.value, '$.country')), ' ')
+           FROM json_each(CASE WHEN json_valid(c.addresses) THEN c.addresses END) a WHERE a.type = 'object'),
+        (SELECT group_concat(f.value, ' ')
+           FROM json_each(CASE WHEN json_valid(c.custom_fields) THEN c.custom_fields END) f WHERE f.type = 'text'),
+        NULLIF(c.how_we_met, ''), NULLIF(c.food_preference, ''), NULLIF(c.work_information, ''),
+        NULLIF(c.contact_information, '')
+    ) AS details
+FROM contacts c
+WHERE c.deleted_at IS NULL;
+
+CREATE VIRTUAL TABLE contacts_fts USING fts5(
+    user_id UNINDEXED,
+    name,
+    organization,
+    details,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER contacts_fts_insert AFTER INSERT ON contacts BEGIN
+    INSERT INTO contacts_fts (rowid, user_id, name, organization, details)
+    SELECT id, user_id, name, organization, details FROM contacts_search_documents WHERE id = new.id;
+END;
+
+-- Only the indexed columns, so the ETag and revision updates after every save skip the index
+CREATE TRIGGER contacts_fts_update AFTER UPDATE OF
+    user_id, deleted_at, prefix, firstname, middle_name, lastname, suffix, nickname,
+    organization, department, job_title, role, emails, phones, addresses, custom_fields,
+    how_we_met, food_preference, work_information, contact_information
+ON contacts BEGIN
+    DELETE FROM contacts_fts WHERE rowid = old.id;
+    INSERT INTO contacts_fts (rowid, user_id, name, organization, details)
+    SELECT id, user_id, name, organization, details FROM contacts_search_documents WHERE id = new.id;
+END;
+
+CREATE TRIGGER contacts_fts_delete AFTER DELETE ON contacts BEGIN
+    DELETE FROM contacts_fts WHERE rowid = old.id;
+END;
+
+CREATE VIRTUAL TABLE notes_fts USING fts5(
+    user_id UNINDEXED,
+    content,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER notes_fts_insert AFTER INSERT ON notes WHEN new.deleted_at IS NULL BEGIN
+    INSERT INTO notes_fts (rowid, user_id, content) VALUES (new.id, new.user_id, new.content);
+END;
+
+CREATE TRIGGER notes_fts_update AFTER UPDATE OF user_id, deleted_at, content ON notes BEGIN
+    DELETE FROM notes_fts WHERE rowid = old.id;
+    INSERT INTO notes_fts (rowid, user_id, content)
+    SELECT new.id, new.user_id, new.content WHERE new.deleted_at IS NULL;
+END;
+
+CREATE TRIGGER notes_fts_delete AFTER DELETE ON notes BEGIN
+    DELETE FROM notes_fts WHERE rowid = old.id;
+END;
+
+CREATE VIRTUAL TABLE activities_fts USING fts5(
+    user_id UNINDEXED,
+    title,
+    description,
+    location,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER activities_fts_insert AFTER INSERT ON activities WHEN new.deleted_at IS NULL BEGIN
+    INSERT INTO activities_fts (rowid, user_id, title, description, location)
+    VALUES (new.id, new.user_id, new.title, new.description, new.location);
+END;
+
+CREATE TRIGGER activities_fts_update AFTER UPDATE OF user_id, deleted_at, title, description, location ON activities BEGIN
+    DELETE FROM activities_fts WHERE rowid = old.id;
+    INSERT INTO activities_fts (rowid, user_id, title, description, location)
+    SELECT new.id, new.user_id, new.title, new.description, new.location WHERE new.deleted_at IS NULL;
+END;
+
+CREATE TRIGGER activities_fts_delete AFTER DELETE ON activities BEGIN
+    DELETE FROM activities_fts WHERE rowid = old.id;
+END;
+
+-- Index the existing data
+INSERT INTO contacts_fts (rowid, user_id, name, organization, details)
+SELECT id, user_id, name, organization, details FROM contacts_search_documents;
+
+INSERT INTO notes_fts (rowid, user_id, content)
+SELECT id, user_id, content FROM notes WHERE deleted_at IS NULL;
+
+INSERT INTO activities_fts (rowid, user_id, title, description, location)
+SELECT id, user_id, title, description, location FROM activities WHERE deleted_at IS NULL;
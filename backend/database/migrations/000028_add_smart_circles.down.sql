@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_smart_circles_user_id;
+DROP TABLE IF EXISTS smart_circles;
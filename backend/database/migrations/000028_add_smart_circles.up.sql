@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS smart_circles (
+    id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    user_id    INTEGER  NOT NULL,
+    name       TEXT     NOT NULL,
+    filter     TEXT     NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_smart_circles_user_id ON smart_circles(user_id);
@@ -0,0 +1 @@
+ALTER TABLE carddav_sync DROP COLUMN purged_revision;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS contact_versions (
+    id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    user_id    INTEGER  NOT NULL,
+    contact_id INTEGER  NOT NULL,
+    version    INTEGER  NOT NULL,
+    source     TEXT     NOT NULL,
+    actor      TEXT     NOT NULL DEFAULT '',
+    changes    TEXT,
+    snapshot   TEXT,
+    revert_of  INTEGER,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_contact_versions_contact_version ON contact_versions(contact_id, version);
+CREATE INDEX idx_contact_versions_user_id ON contact_versions(user_id);
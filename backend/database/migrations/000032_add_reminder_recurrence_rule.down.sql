@@ -0,0 +1,2 @@
+ALTER TABLE reminders DROP COLUMN recurrence_start;
+ALTER TABLE reminders DROP COLUMN recurrence_rule;
@@ -0,0 +1,3 @@
+-- RFC 5545 recurrence rule of reminders with the "custom" recurrence, and the date it counts from
+ALTER TABLE reminders ADD COLUMN recurrence_rule TEXT NOT NULL DEFAULT '';
+ALTER TABLE reminders ADD COLUMN recurrence_start DATETIME;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_reminder_snoozes_user_id;
+DROP INDEX IF EXISTS idx_reminder_snoozes_contact_id;
+DROP TABLE IF EXISTS reminder_snoozes;
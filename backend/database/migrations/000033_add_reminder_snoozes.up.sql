@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS reminder_snoozes (
+    id                 INTEGER  PRIMARY KEY AUTOINCREMENT,
+    created_at         DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at         DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at         DATETIME,
+    user_id            INTEGER  NOT NULL,
+    reminder_id        INTEGER,
+    contact_id         INTEGER  NOT NULL,
+    message            TEXT     NOT NULL,
+    snoozed_at         DATETIME NOT NULL,
+    previous_remind_at DATETIME NOT NULL,
+    remind_at          DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_reminder_snoozes_contact_id ON reminder_snoozes(contact_id);
+CREATE INDEX idx_reminder_snoozes_user_id ON reminder_snoozes(user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN reminder_digest_date;
+ALTER TABLE users DROP COLUMN reminder_time;
+ALTER TABLE users DROP COLUMN timezone;
@@ -0,0 +1,5 @@
+-- Per-user timezone and time of the daily reminder email; empty means the instance default.
+-- reminder_digest_date is the user's local date of the last daily email.
+ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN reminder_time TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN reminder_digest_date TEXT NOT NULL DEFAULT '';
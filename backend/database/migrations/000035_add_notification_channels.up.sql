@@ -0,0 +1,19 @@
+-- Push services, chat rooms and endpoints that reminder, birthday and keep-in-touch notifications are sent to
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id           INTEGER  PRIMARY KEY AUTOINCREMENT,
+    created_at   DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at   DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at   DATETIME,
+    user_id      INTEGER  NOT NULL,
+    name         TEXT     NOT NULL,
+    type         TEXT     NOT NULL,
+    url          TEXT     NOT NULL,
+    target       TEXT     NOT NULL DEFAULT '',
+    token        TEXT     NOT NULL DEFAULT '',
+    kinds        TEXT,
+    is_active    BOOLEAN  DEFAULT 1,
+    last_sent_at DATETIME,
+    last_error   TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_notification_channels_user_id ON notification_channels(user_id);
@@ -0,0 +1,2 @@
+-- Time of day (HH:MM in the user's timezone) a reminder is sent at; empty means with the daily email
+ALTER TABLE reminders ADD COLUMN remind_time TEXT NOT NULL DEFAULT '';
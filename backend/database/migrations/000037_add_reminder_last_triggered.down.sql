@@ -0,0 +1 @@
+ALTER TABLE reminders DROP COLUMN last_triggered;
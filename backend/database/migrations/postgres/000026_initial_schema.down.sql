@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS calendar_feed_tokens;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS carddav_remote_objects;
+DROP TABLE IF EXISTS carddav_remotes;
+DROP TABLE IF EXISTS carddav_groups;
+DROP TABLE IF EXISTS carddav_app_passwords;
+DROP TABLE IF EXISTS carddav_sync;
+DROP TABLE IF EXISTS job_executions;
+DROP TABLE IF EXISTS reminder_completions;
+DROP TABLE IF EXISTS reminders;
+DROP TABLE IF EXISTS relationships;
+DROP TABLE IF EXISTS notes;
+DROP TABLE IF EXISTS activity_contacts;
+DROP TABLE IF EXISTS activities;
+DROP TABLE IF EXISTS contacts;
+DROP TABLE IF EXISTS users;
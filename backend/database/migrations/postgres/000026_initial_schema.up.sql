@@ -0,0 +1,317 @@
+-- PostgreSQL schema equivalent to SQLite migrations 000001 to 000026. Later migrations use the
+-- same version numbers in both sets, so a schema version means the same tables on either database.
+-- JSON columns are TEXT like on SQLite, since GORM serializes them to strings.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                          BIGSERIAL PRIMARY KEY,
+    created_at                  TIMESTAMPTZ,
+    updated_at                  TIMESTAMPTZ,
+    deleted_at                  TIMESTAMPTZ,
+    username                    TEXT UNIQUE NOT NULL,
+    password                    TEXT NOT NULL,
+    email                       TEXT UNIQUE NOT NULL,
+    password_reset_token_hash   TEXT,
+    password_reset_expires_at   TIMESTAMPTZ,
+    password_reset_requested_at TIMESTAMPTZ,
+    language                    TEXT DEFAULT 'en',
+    custom_field_names          TEXT DEFAULT '[]',
+    is_admin                    BOOLEAN DEFAULT FALSE,
+    date_format                 TEXT DEFAULT 'eu',
+    oidc_subject                TEXT,
+    oidc_provider               TEXT,
+    enabled_contact_fields      TEXT DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_users_password_reset_token_hash ON users(password_reset_token_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_subject ON users(oidc_subject, oidc_provider)
+    WHERE oidc_subject IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS contacts (
+    id                  BIGSERIAL PRIMARY KEY,
+    created_at          TIMESTAMPTZ,
+    updated_at          TIMESTAMPTZ,
+    deleted_at          TIMESTAMPTZ,
+    user_id             BIGINT,
+    firstname           TEXT NOT NULL,
+    lastname            TEXT,
+    nickname            TEXT,
+    gender              TEXT,
+    email               TEXT,
+    phone               TEXT,
+    birthday            TEXT,
+    photo               TEXT,
+    photo_thumbnail     TEXT,
+    address             TEXT,
+    how_we_met          TEXT,
+    food_preference     TEXT,
+    work_information    TEXT,
+    contact_information TEXT,
+    circles             TEXT,
+    vcard_uid           TEXT,
+    vcard_extra         TEXT,
+    etag                TEXT,
+    custom_fields       TEXT DEFAULT '{}',
+    archived            BOOLEAN NOT NULL DEFAULT FALSE,
+    emails              TEXT DEFAULT '[]',
+    phones              TEXT DEFAULT '[]',
+    addresses           TEXT DEFAULT '[]',
+    urls                TEXT DEFAULT '[]',
+    impps               TEXT DEFAULT '[]',
+    prefix              TEXT DEFAULT '',
+    middle_name         TEXT DEFAULT '',
+    suffix              TEXT DEFAULT '',
+    organization        TEXT DEFAULT '',
+    department          TEXT DEFAULT '',
+    job_title           TEXT DEFAULT '',
+    role                TEXT DEFAULT '',
+    anniversary         TEXT DEFAULT '',
+    sync_revision       BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_contacts_deleted_at ON contacts(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_contacts_firstname ON contacts(LOWER(firstname));
+CREATE INDEX IF NOT EXISTS idx_contacts_lastname ON contacts(LOWER(lastname));
+CREATE INDEX IF NOT EXISTS idx_contacts_email ON contacts(LOWER(email));
+CREATE INDEX IF NOT EXISTS idx_contacts_user_id ON contacts(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_contacts_vcard_uid_user ON contacts(user_id, vcard_uid) WHERE vcard_uid IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_contacts_user_sync_revision ON contacts(user_id, sync_revision);
+
+CREATE TABLE IF NOT EXISTS activities (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    user_id     BIGINT,
+    title       TEXT NOT NULL,
+    description TEXT,
+    location    TEXT,
+    date        TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_activities_deleted_at ON activities(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_activities_date ON activities(date);
+CREATE INDEX IF NOT EXISTS idx_activities_user_id ON activities(user_id);
+
+CREATE TABLE IF NOT EXISTS activity_contacts (
+    activity_id BIGINT NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+    contact_id  BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    PRIMARY KEY (activity_id, contact_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_activity_contacts_activity_id ON activity_contacts(activity_id);
+CREATE INDEX IF NOT EXISTS idx_activity_contacts_contact_id ON activity_contacts(contact_id);
+
+CREATE TABLE IF NOT EXISTS notes (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    user_id    BIGINT,
+    content    TEXT NOT NULL,
+    date       TIMESTAMPTZ NOT NULL,
+    contact_id BIGINT REFERENCES contacts(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notes_deleted_at ON notes(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_notes_contact_id ON notes(contact_id);
+CREATE INDEX IF NOT EXISTS idx_notes_date ON notes(date);
+CREATE INDEX IF NOT EXISTS idx_notes_user_id ON notes(user_id);
+
+CREATE TABLE IF NOT EXISTS relationships (
+    id                 BIGSERIAL PRIMARY KEY,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    deleted_at         TIMESTAMPTZ,
+    user_id            BIGINT,
+    name               TEXT NOT NULL,
+    type               TEXT NOT NULL,
+    gender             TEXT,
+    birthday           TEXT,
+    contact_id         BIGINT NOT NULL REFERENCES contacts(id),
+    related_contact_id BIGINT REFERENCES contacts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_relationships_deleted_at ON relationships(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_relationships_contact_id ON relationships(contact_id);
+CREATE INDEX IF NOT EXISTS idx_relationships_related_contact_id ON relationships(related_contact_id);
+CREATE INDEX IF NOT EXISTS idx_relationships_user_id ON relationships(user_id);
+
+CREATE TABLE IF NOT EXISTS reminders (
+    id                      BIGSERIAL PRIMARY KEY,
+    created_at              TIMESTAMPTZ,
+    updated_at              TIMESTAMPTZ,
+    deleted_at              TIMESTAMPTZ,
+    user_id                 BIGINT,
+    message                 TEXT NOT NULL,
+    by_mail                 BOOLEAN DEFAULT FALSE,
+    remind_at               TIMESTAMPTZ NOT NULL,
+    recurrence              TEXT NOT NULL,
+    reoccur_from_completion BOOLEAN DEFAULT TRUE,
+    last_sent               TIMESTAMPTZ,
+    completed               BOOLEAN NOT NULL DEFAULT FALSE,
+    email_sent              BOOLEAN NOT NULL DEFAULT FALSE,
+    contact_id              BIGINT NOT NULL REFERENCES contacts(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_reminders_deleted_at ON reminders(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_reminders_contact_id ON reminders(contact_id);
+CREATE INDEX IF NOT EXISTS idx_reminders_remind_at ON reminders(remind_at);
+CREATE INDEX IF NOT EXISTS idx_reminders_user_id ON reminders(user_id);
+
+CREATE TABLE IF NOT EXISTS reminder_completions (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at   TIMESTAMPTZ,
+    user_id      BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reminder_id  BIGINT,
+    contact_id   BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    message      TEXT NOT NULL,
+    completed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_reminder_completions_contact_id ON reminder_completions(contact_id);
+CREATE INDEX IF NOT EXISTS idx_reminder_completions_user_id ON reminder_completions(user_id);
+
+CREATE TABLE IF NOT EXISTS job_executions (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    job_name    TEXT UNIQUE NOT NULL,
+    last_run_at TIMESTAMPTZ NOT NULL,
+    locked_at   TIMESTAMPTZ,
+    locked_by   TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_executions_deleted_at ON job_executions(deleted_at);
+
+CREATE TABLE IF NOT EXISTS carddav_sync (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       BIGINT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    sync_token    TEXT NOT NULL,
+    last_modified TIMESTAMPTZ NOT NULL,
+    revision      BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS carddav_app_passwords (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at    TIMESTAMPTZ,
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    password_hash TEXT NOT NULL UNIQUE,
+    last_used_at  TIMESTAMPTZ,
+    revoked_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_carddav_app_passwords_user_id ON carddav_app_passwords(user_id);
+
+CREATE TABLE IF NOT EXISTS carddav_groups (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at    TIMESTAMPTZ,
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    vcard_uid     TEXT NOT NULL,
+    etag          TEXT NOT NULL DEFAULT '',
+    sync_revision BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_carddav_groups_user_uid ON carddav_groups(user_id, vcard_uid);
+
+CREATE TABLE IF NOT EXISTS carddav_remotes (
+    id               BIGSERIAL PRIMARY KEY,
+    created_at       TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at       TIMESTAMPTZ,
+    user_id          BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name             TEXT NOT NULL,
+    url              TEXT NOT NULL,
+    username         TEXT,
+    password         TEXT,
+    mode             TEXT NOT NULL DEFAULT 'two_way',
+    interval_minutes INTEGER NOT NULL DEFAULT 60,
+    is_active        BOOLEAN DEFAULT TRUE,
+    last_sync_at     TIMESTAMPTZ,
+    last_error       TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_carddav_remotes_user_id ON carddav_remotes(user_id);
+
+CREATE TABLE IF NOT EXISTS carddav_remote_objects (
+    id             BIGSERIAL PRIMARY KEY,
+    remote_id      BIGINT NOT NULL REFERENCES carddav_remotes(id) ON DELETE CASCADE,
+    vcard_uid      TEXT NOT NULL,
+    href           TEXT NOT NULL,
+    remote_etag    TEXT NOT NULL DEFAULT '',
+    local_revision BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_carddav_remote_objects_uid ON carddav_remote_objects(remote_id, vcard_uid);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at   TIMESTAMPTZ,
+    user_id      BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    token_hash   TEXT NOT NULL UNIQUE,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS calendar_feed_tokens (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at   TIMESTAMPTZ,
+    user_id      BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    token_hash   TEXT NOT NULL UNIQUE,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_calendar_feed_tokens_user_id ON calendar_feed_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name       TEXT NOT NULL,
+    url        TEXT NOT NULL,
+    events     TEXT NOT NULL DEFAULT '[]',
+    secret     TEXT NOT NULL,
+    is_active  BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks(user_id);
+CREATE INDEX IF NOT EXISTS idx_webhooks_deleted_at ON webhooks(deleted_at);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ,
+    webhook_id    BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_type    TEXT NOT NULL,
+    payload       TEXT NOT NULL,
+    status_code   INTEGER,
+    error         TEXT,
+    attempts      INTEGER NOT NULL DEFAULT 1,
+    next_retry_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_retry_at ON webhook_deliveries(next_retry_at);
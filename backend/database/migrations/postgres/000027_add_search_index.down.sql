@@ -0,0 +1,13 @@
+DROP TRIGGER IF EXISTS activities_fts_refresh ON activities;
+DROP FUNCTION IF EXISTS activities_fts_refresh();
+DROP TABLE IF EXISTS activities_fts;
+
+DROP TRIGGER IF EXISTS notes_fts_refresh ON notes;
+DROP FUNCTION IF EXISTS notes_fts_refresh();
+DROP TABLE IF EXISTS notes_fts;
+
+DROP TRIGGER IF EXISTS contacts_fts_refresh ON contacts;
+DROP FUNCTION IF EXISTS contacts_fts_refresh();
+DROP TABLE IF EXISTS contacts_fts;
+
+DROP VIEW IF EXISTS contacts_search_documents;
@@ -0,0 +1,135 @@
+-- Full-text search over contacts, notes and activities, the PostgreSQL counterpart of the FTS5
+-- tables on SQLite. Each search table holds the indexed text of one row under the same id and a
+-- weighted tsvector over it, kept in sync by triggers. Soft-deleted rows are not indexed.
+
+-- The text indexed for each contact, in one place for the trigger and the backfill below
+CREATE VIEW contacts_search_documents AS
+SELECT
+    c.id,
+    c.user_id,
+    concat_ws(' ', NULLIF(c.prefix, ''), c.firstname, NULLIF(c.middle_name, ''), NULLIF(c.lastname, ''),
+        NULLIF(c.suffix, ''), NULLIF(c.nickname, '')) AS name,
+    concat_ws(' ', NULLIF(c.organization, ''), NULLIF(c.department, ''), NULLIF(c.job_title, ''),
+        NULLIF(c.role, '')) AS organization,
+    concat_ws(' ',
+        (SELECT string_agg(e.value ->> 'value', ' ')
+           FROM jsonb_array_elements(CASE WHEN jsonb_typeof(CAST(NULLIF(c.emails, '') AS jsonb)) = 'array'
+                THEN CAST(c.emails AS jsonb) END) AS e(value)),
+        (SELECT string_agg(p.value ->> 'value', ' ')
+           FROM jsonb_array_elements(CASE WHEN jsonb_typeof(CAST(NULLIF(c.phones, '') AS jsonb)) = 'array'
+                THEN CAST(c.phones AS jsonb) END) AS p(value)),
+        (SELECT string_agg(concat_ws(' ', a.value ->> 'street', a.value ->> 'city', a.value ->> 'region',
+                a.value ->> 'postal', a.value ->> 'country'), ' ')
+           FROM jsonb_array_elements(CASE WHEN jsonb_typeof(CAST(NULLIF(c.addresses, '') AS jsonb)) = 'array'
+                THEN CAST(c.addresses AS jsonb) END) AS a(value)),
+        (SELECT string_agg(f.value, ' ')
+           FROM jsonb_each_text(CASE WHEN jsonb_typeof(CAST(NULLIF(c.custom_fields, '') AS jsonb)) = 'object'
+                THEN CAST(c.custom_fields AS jsonb) END) AS f),
+        NULLIF(c.how_we_met, ''), NULLIF(c.food_preference, ''), NULLIF(c.work_information, ''),
+        NULLIF(c.contact_information, '')
+    ) AS details
+FROM contacts c
+WHERE c.deleted_at IS NULL;
+
+CREATE TABLE contacts_fts (
+    id           BIGINT PRIMARY KEY,
+    user_id      BIGINT,
+    name         TEXT,
+    organization TEXT,
+    details      TEXT,
+    document     TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(organization, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(details, '')), 'D')
+    ) STORED
+);
+
+CREATE INDEX idx_contacts_fts_user_id ON contacts_fts(user_id);
+CREATE INDEX idx_contacts_fts_document ON contacts_fts USING GIN (document);
+
+CREATE FUNCTION contacts_fts_refresh() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        DELETE FROM contacts_fts WHERE id = OLD.id;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        INSERT INTO contacts_fts (id, user_id, name, organization, details)
+        SELECT id, user_id, name, organization, details FROM contacts_search_documents WHERE id = NEW.id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Only the indexed columns, so the ETag and revision updates after every save skip the index
+CREATE TRIGGER contacts_fts_refresh AFTER INSERT OR DELETE OR UPDATE OF
+    user_id, deleted_at, prefix, firstname, middle_name, lastname, suffix, nickname,
+    organization, department, job_title, role, emails, phones, addresses, custom_fields,
+    how_we_met, food_preference, work_information, contact_information
+ON contacts FOR EACH ROW EXECUTE FUNCTION contacts_fts_refresh();
+
+CREATE TABLE notes_fts (
+    id       BIGINT PRIMARY KEY,
+    user_id  BIGINT,
+    content  TEXT,
+    document TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', coalesce(content, ''))) STORED
+);
+
+CREATE INDEX idx_notes_fts_user_id ON notes_fts(user_id);
+CREATE INDEX idx_notes_fts_document ON notes_fts USING GIN (document);
+
+CREATE FUNCTION notes_fts_refresh() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        DELETE FROM notes_fts WHERE id = OLD.id;
+    END IF;
+    IF TG_OP <> 'DELETE' AND NEW.deleted_at IS NULL THEN
+        INSERT INTO notes_fts (id, user_id, content) VALUES (NEW.id, NEW.user_id, NEW.content);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notes_fts_refresh AFTER INSERT OR DELETE OR UPDATE OF user_id, deleted_at, content
+ON notes FOR EACH ROW EXECUTE FUNCTION notes_fts_refresh();
+
+CREATE TABLE activities_fts (
+    id          BIGINT PRIMARY KEY,
+    user_id     BIGINT,
+    title       TEXT,
+    description TEXT,
+    location    TEXT,
+    document    TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(location, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(description, '')), 'D')
+    ) STORED
+);
+
+CREATE INDEX idx_activities_fts_user_id ON activities_fts(user_id);
+CREATE INDEX idx_activities_fts_document ON activities_fts USING GIN (document);
+
+CREATE FUNCTION activities_fts_refresh() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        DELETE FROM activities_fts WHERE id = OLD.id;
+    END IF;
+    IF TG_OP <> 'DELETE' AND NEW.deleted_at IS NULL THEN
+        INSERT INTO activities_fts (id, user_id, title, description, location)
+        VALUES (NEW.id, NEW.user_id, NEW.title, NEW.description, NEW.location);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER activities_fts_refresh AFTER INSERT OR DELETE OR UPDATE OF user_id, deleted_at, title, description, location
+ON activities FOR EACH ROW EXECUTE FUNCTION activities_fts_refresh();
+
+-- Index the existing data
+INSERT INTO contacts_fts (id, user_id, name, organization, details)
+SELECT id, user_id, name, organization, details FROM contacts_search_documents;
+
+INSERT INTO notes_fts (id, user_id, content)
+SELECT id, user_id, content FROM notes WHERE deleted_at IS NULL;
+
+INSERT INTO activities_fts (id, user_id, title, description, location)
+SELECT id, user_id, title, description, location FROM activities WHERE deleted_at IS NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS smart_circles (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ,
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name       TEXT NOT NULL,
+    filter     TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_smart_circles_user_id ON smart_circles(user_id);
@@ -0,0 +1,3 @@
+-- Highest revision of a contact tombstone removed when the trash is purged. Sync tokens from
+-- before it would miss that deletion, so clients holding one have to sync from scratch.
+ALTER TABLE carddav_sync ADD COLUMN IF NOT EXISTS purged_revision BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_contact_versions_user_id;
+DROP INDEX IF EXISTS idx_contact_versions_contact_version;
+DROP TABLE IF EXISTS contact_versions;
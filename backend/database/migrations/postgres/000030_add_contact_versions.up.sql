@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS contact_versions (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    contact_id BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    version    INTEGER NOT NULL,
+    source     TEXT NOT NULL,
+    actor      TEXT NOT NULL DEFAULT '',
+    changes    TEXT,
+    snapshot   TEXT,
+    revert_of  INTEGER
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_contact_versions_contact_version ON contact_versions(contact_id, version);
+CREATE INDEX IF NOT EXISTS idx_contact_versions_user_id ON contact_versions(user_id);
@@ -0,0 +1,2 @@
+-- Desired number of days between interactions with a contact, 0 when it is not tracked
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS contact_frequency_days INTEGER NOT NULL DEFAULT 0;
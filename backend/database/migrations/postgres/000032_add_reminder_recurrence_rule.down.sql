@@ -0,0 +1,2 @@
+ALTER TABLE reminders DROP COLUMN IF EXISTS recurrence_start;
+ALTER TABLE reminders DROP COLUMN IF EXISTS recurrence_rule;
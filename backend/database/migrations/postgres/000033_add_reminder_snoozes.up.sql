@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS reminder_snoozes (
+    id                 BIGSERIAL PRIMARY KEY,
+    created_at         TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at         TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at         TIMESTAMPTZ,
+    user_id            BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reminder_id        BIGINT,
+    contact_id         BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    message            TEXT NOT NULL,
+    snoozed_at         TIMESTAMPTZ NOT NULL,
+    previous_remind_at TIMESTAMPTZ NOT NULL,
+    remind_at          TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_reminder_snoozes_contact_id ON reminder_snoozes(contact_id);
+CREATE INDEX IF NOT EXISTS idx_reminder_snoozes_user_id ON reminder_snoozes(user_id);
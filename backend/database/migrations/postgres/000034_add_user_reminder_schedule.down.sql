@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS reminder_digest_date;
+ALTER TABLE users DROP COLUMN IF EXISTS reminder_time;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
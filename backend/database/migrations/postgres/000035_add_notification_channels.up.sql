@@ -0,0 +1,19 @@
+-- Push services, chat rooms and endpoints that reminder, birthday and keep-in-touch notifications are sent to
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at   TIMESTAMPTZ,
+    user_id      BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    type         TEXT NOT NULL,
+    url          TEXT NOT NULL,
+    target       TEXT NOT NULL DEFAULT '',
+    token        TEXT NOT NULL DEFAULT '',
+    kinds        TEXT,
+    is_active    BOOLEAN DEFAULT TRUE,
+    last_sent_at TIMESTAMPTZ,
+    last_error   TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_channels_user_id ON notification_channels(user_id);
@@ -0,0 +1,2 @@
+-- When the reminder.triggered webhook last fired, so that it fires once per reminder date
+ALTER TABLE reminders ADD COLUMN IF NOT EXISTS last_triggered TIMESTAMPTZ;
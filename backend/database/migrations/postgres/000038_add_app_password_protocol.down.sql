@@ -0,0 +1 @@
+ALTER TABLE carddav_app_passwords DROP COLUMN IF EXISTS protocol;
@@ -0,0 +1,2 @@
+-- Which DAV server an app password is accepted by; existing passwords were created for CardDAV
+ALTER TABLE carddav_app_passwords ADD COLUMN IF NOT EXISTS protocol TEXT NOT NULL DEFAULT 'carddav';
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratePgx "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// initPostgres runs the PostgreSQL migrations and opens a GORM connection. Several instances may
+// start at once against the same database; the migration driver serializes them with an advisory
+// lock.
+func initPostgres(dsn string) (*gorm.DB, error) {
+	if err := RunPostgresMigrations(dsn); err != nil {
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect with GORM: %w", err)
+	}
+
+	return db, nil
+}
+
+// RunPostgresMigrations runs all pending migrations of the PostgreSQL set in
+// migrations/postgres. It uses its own connection, which is closed when it returns.
+func RunPostgresMigrations(dsn string) error {
+	sqlDB, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
+	driver, err := migratePgx.WithInstance(sqlDB, &migratePgx.Config{})
+	if err != nil {
+		sqlDB.Close()
+		return fmt.Errorf("failed to create migration driver: %w", err)
+	}
+
+	sourceDriver, err := iofs.New(migrationsFS, "migrations/postgres")
+	if err != nil {
+		driver.Close()
+		return fmt.Errorf("failed to create migration source: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", sourceDriver, "pgx", driver)
+	if err != nil {
+		driver.Close()
+		return fmt.Errorf("failed to create migration instance: %w", err)
+	}
+	defer m.Close()
+
+	return applyMigrations(m)
+}
@@ -0,0 +1,921 @@
+package filters
+
+import (
+	"errors"
+	"fmt"
+	"meerkat/database"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidFilter is returned when a contact filter expression cannot be parsed
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Limits that keep a filter from turning into an unreasonably large query
+const (
+	maxFilterLength = 2000
+	maxFilterTerms  = 50
+	maxFilterDepth  = 20
+)
+
+// ContactSearchCondition returns the condition used for free-text contact search: the term must
+// appear in the name, nickname or any e-mail address or phone number, ignoring case
+func ContactSearchCondition(db *gorm.DB, term string) (string, []interface{}) {
+	like := "%" + term + "%"
+	condition := fmt.Sprintf("firstname %[1]s ? OR lastname %[1]s ? OR nickname %[1]s ? "+
+		"OR (firstname || ' ' || lastname) %[1]s ? OR (nickname || ' ' || lastname) %[1]s ? "+
+		"OR email %[1]s ? OR phone %[1]s ? OR %[2]s OR %[3]s",
+		database.ILike(db),
+		database.JSONArrayFieldLike(db, "contacts.emails", "value"),
+		database.JSONArrayFieldLike(db, "contacts.phones", "value"))
+	return condition, []interface{}{like, like, like, like, like, like, like, like, like}
+}
+
+// ContactFilter is a parsed filter expression such as
+//
+//	circle:Work AND birthday:<30d AND NOT archived AND custom.Company:"ACME"
+//
+// Terms are combined with AND, OR and NOT (or a leading -) and grouped with parentheses;
+// adjacent terms without an operator are combined with AND. A term is field:value, a bare word
+// or "quoted phrase" for free-text search, or the name of a flag such as archived. Values are
+// only ever passed to the database as parameters.
+type ContactFilter struct {
+	root             *filterNode
+	referencesFields map[string]bool
+}
+
+type filterNodeKind int
+
+const (
+	filterAnd filterNodeKind = iota
+	filterOr
+	filterNot
+	filterTerm
+)
+
+type filterNode struct {
+	kind     filterNodeKind
+	children []*filterNode
+	term     *filterCondition
+}
+
+type filterFieldKind int
+
+const (
+	fieldText      filterFieldKind = iota // scalar text columns
+	fieldList                             // JSON array of objects, matched on some of their fields
+	fieldCircle                           // the JSON array of circle names
+	fieldCustom                           // one key of the custom fields object
+	fieldAnnual                           // birthday or anniversary, YYYY-MM-DD or --MM-DD
+	fieldTimestamp                        // created_at or updated_at, or the date of a related row
+	fieldFlag                             // boolean column
+	fieldFreeText                         // bare words
+)
+
+type filterField struct {
+	kind    filterFieldKind
+	columns []string // column expressions, or the JSON column for lists
+	fields  []string // object fields of list entries
+	related string   // for columns of related rows, the EXISTS subquery with %s for the condition
+}
+
+// contactFilterFields maps the field names of the filter language to columns. All names and
+// expressions here are constants; user input only ever ends up in query parameters.
+var contactFilterFields = map[string]filterField{
+	"name":                {kind: fieldText, columns: []string{"contacts.firstname", "contacts.lastname", "contacts.nickname", "contacts.firstname || ' ' || contacts.lastname"}},
+	"firstname":           {kind: fieldText, columns: []string{"contacts.firstname"}},
+	"lastname":            {kind: fieldText, columns: []string{"contacts.lastname"}},
+	"nickname":            {kind: fieldText, columns: []string{"contacts.nickname"}},
+	"prefix":              {kind: fieldText, columns: []string{"contacts.prefix"}},
+	"middle_name":         {kind: fieldText, columns: []string{"contacts.middle_name"}},
+	"suffix":              {kind: fieldText, columns: []string{"contacts.suffix"}},
+	"gender":              {kind: fieldText, columns: []string{"contacts.gender"}},
+	"organization":        {kind: fieldText, columns: []string{"contacts.organization"}},
+	"department":          {kind: fieldText, columns: []string{"contacts.department"}},
+	"job_title":           {kind: fieldText, columns: []string{"contacts.job_title"}},
+	"role":                {kind: fieldText, columns: []string{"contacts.role"}},
+	"how_we_met":          {kind: fieldText, columns: []string{"contacts.how_we_met"}},
+	"food_preference":     {kind: fieldText, columns: []string{"contacts.food_preference"}},
+	"work_information":    {kind: fieldText, columns: []string{"contacts.work_information"}},
+	"contact_information": {kind: fieldText, columns: []string{"contacts.contact_information"}},
+	"photo":               {kind: fieldText, columns: []string{"contacts.photo"}},
+	"email":               {kind: fieldList, columns: []string{"contacts.emails"}, fields: []string{"value"}},
+	"phone":               {kind: fieldList, columns: []string{"contacts.phones"}, fields: []string{"value"}},
+	"url":                 {kind: fieldList, columns: []string{"contacts.urls"}, fields: []string{"value"}},
+	"impp":                {kind: fieldList, columns: []string{"contacts.impps"}, fields: []string{"value"}},
+	"address":             {kind: fieldList, columns: []string{"contacts.addresses"}, fields: []string{"street", "city", "region", "postal", "country"}},
+	"street":              {kind: fieldList, columns: []string{"contacts.addresses"}, fields: []string{"street"}},
+	"city":                {kind: fieldList, columns: []string{"contacts.addresses"}, fields: []string{"city"}},
+	"region":              {kind: fieldList, columns: []string{"contacts.addresses"}, fields: []string{"region"}},
+	"postal":              {kind: fieldList, columns: []string{"contacts.addresses"}, fields: []string{"postal"}},
+	"country":             {kind: fieldList, columns: []string{"contacts.addresses"}, fields: []string{"country"}},
+	"circle":              {kind: fieldCircle, columns: []string{"contacts.circles"}},
+	"birthday":            {kind: fieldAnnual, columns: []string{"contacts.birthday"}},
+	"anniversary":         {kind: fieldAnnual, columns: []string{"contacts.anniversary"}},
+	"created":             {kind: fieldTimestamp, columns: []string{"contacts.created_at"}},
+	"updated":             {kind: fieldTimestamp, columns: []string{"contacts.updated_at"}},
+	"archived":            {kind: fieldFlag, columns: []string{"contacts.archived"}},
+	"activity": {kind: fieldTimestamp, columns: []string{"activities.date"},
+		related: "EXISTS (SELECT 1 FROM activity_contacts JOIN activities ON activities.id = activity_contacts.activity_id " +
+			"WHERE activity_contacts.contact_id = contacts.id AND activities.deleted_at IS NULL AND %s)"},
+	"note": {kind: fieldTimestamp, columns: []string{"notes.date"},
+		related: "EXISTS (SELECT 1 FROM notes WHERE notes.contact_id = contacts.id AND notes.deleted_at IS NULL AND %s)"},
+}
+
+// contactFilterAliases are alternative names for fields
+var contactFilterAliases = map[string]string{
+	"org":        "organization",
+	"company":    "organization",
+	"title":      "job_title",
+	"circles":    "circle",
+	"activities": "activity",
+	"notes":      "note",
+}
+
+const customFieldPrefix = "custom."
+
+// Comparison operators of a term
+const (
+	opContains = ":"
+	opEquals   = "="
+	opPresent  = "*"
+	opRange    = ".."
+	opLess     = "<"
+	opLessEq   = "<="
+	opGreater  = ">"
+	opGreaterE = ">="
+)
+
+// filterCondition is a single validated term with its value already parsed
+type filterCondition struct {
+	name   string // field name as resolved, for error messages
+	field  filterField
+	key    string // custom field name
+	op     string
+	value  string
+	flag   bool
+	from   string // dates and range bounds, validated
+	to     string
+	isSpan bool // value is a relative duration rather than a date
+	span   filterSpan
+}
+
+// filterSpan is a relative duration such as 30d, 2w, 6m or 1y
+type filterSpan struct {
+	n    int
+	unit byte
+}
+
+var (
+	spanPattern     = regexp.MustCompile(`^(\d{1,4})([dwmy])$`)
+	datePattern     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	monthDayPattern = regexp.MustCompile(`^(--)?\d{2}-\d{2}$`)
+	yearPattern     = regexp.MustCompile(`^\d{4}$`)
+)
+
+// ParseContactFilter parses a filter expression
+func ParseContactFilter(expression string) (*ContactFilter, error) {
+	if len(expression) > maxFilterLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidFilter, maxFilterLength)
+	}
+	tokens, err := lexFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty expression", ErrInvalidFilter)
+	}
+
+	p := &filterParser{tokens: tokens, referencesFields: map[string]bool{}}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.unexpected()
+	}
+	return &ContactFilter{root: root, referencesFields: p.referencesFields}, nil
+}
+
+// References reports whether the filter has a term on the given field, e.g. "archived"
+func (f *ContactFilter) References(field string) bool {
+	return f.referencesFields[field]
+}
+
+// Apply adds the filter to a contacts query. Relative dates such as birthday:<30d are resolved
+// against now.
+func (f *ContactFilter) Apply(query *gorm.DB, now time.Time) *gorm.DB {
+	condition, args := f.root.sql(query, now)
+	return query.Where(condition, args...)
+}
+
+// Members restricts a contacts query to the members of a smart circle with this filter. As in the
+// contacts list, archived contacts only match a filter that asks for them.
+func (f *ContactFilter) Members(query *gorm.DB, now time.Time) *gorm.DB {
+	if !f.References("archived") {
+		query = query.Where("contacts.archived = ?", false)
+	}
+	return f.Apply(query, now)
+}
+
+// Lexer
+
+type filterTokenKind int
+
+const (
+	tokenLParen filterTokenKind = iota
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenTerm
+)
+
+type filterToken struct {
+	kind     filterTokenKind
+	pos      int // 1-based character position, for error messages
+	text     string
+	field    string // empty for bare words
+	op       string
+	value    string
+	quoted   bool
+	hasField bool
+}
+
+func lexFilter(expression string) ([]filterToken, error) {
+	runes := []rune(expression)
+	var tokens []filterToken
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: tokenLParen, pos: i + 1, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: tokenRParen, pos: i + 1, text: ")"})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			tokens = append(tokens, filterToken{kind: tokenNot, pos: i + 1, text: "-"})
+			i++
+		default:
+			token, next, err := lexFilterTerm(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			i = next
+		}
+	}
+	return tokens, nil
+}
+
+func isFilterDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')'
+}
+
+// lexFilterTerm reads a term starting at runes[start]: an optional field name and colon, an
+// optional operator and a value that is either quoted or runs until whitespace or a parenthesis
+func lexFilterTerm(runes []rune, start int) (filterToken, int, error) {
+	token := filterToken{kind: tokenTerm, pos: start + 1}
+	i := start
+	for i < len(runes) && !isFilterDelimiter(runes[i]) && runes[i] != ':' && runes[i] != '"' {
+		i++
+	}
+	head := string(runes[start:i])
+
+	// custom."Field name":value quotes a custom field name with spaces
+	if strings.EqualFold(head, customFieldPrefix) && i < len(runes) && runes[i] == '"' {
+		key, next, err := lexFilterQuoted(runes, i)
+		if err != nil {
+			return token, 0, err
+		}
+		if next >= len(runes) || runes[next] != ':' {
+			return token, 0, fmt.Errorf("%w: expected ':' after custom field name at position %d", ErrInvalidFilter, next+1)
+		}
+		head += key
+		i = next
+	}
+
+	if i < len(runes) && runes[i] == ':' {
+		token.hasField = true
+		token.field = head
+		i++
+		for _, op := range []string{opGreaterE, opLessEq, opGreater, opLess, opEquals} {
+			if strings.HasPrefix(string(runes[i:]), op) {
+				token.op = op
+				i += len([]rune(op))
+				break
+			}
+		}
+	} else if head != "" {
+		token.text = head
+		if i >= len(runes) || isFilterDelimiter(runes[i]) {
+			switch head {
+			case "AND":
+				token.kind = tokenAnd
+			case "OR":
+				token.kind = tokenOr
+			case "NOT":
+				token.kind = tokenNot
+			}
+			token.value = head
+			return token, i, nil
+		}
+		// A quote in the middle of a word is part of it
+		for i < len(runes) && !isFilterDelimiter(runes[i]) {
+			i++
+		}
+		token.value = string(runes[start:i])
+		token.text = token.value
+		return token, i, nil
+	}
+
+	if i < len(runes) && runes[i] == '"' {
+		value, next, err := lexFilterQuoted(runes, i)
+		if err != nil {
+			return token, 0, err
+		}
+		token.value = value
+		token.quoted = true
+		i = next
+		if i < len(runes) && !isFilterDelimiter(runes[i]) {
+			return token, 0, fmt.Errorf("%w: unexpected %q after closing quote at position %d", ErrInvalidFilter, runes[i], i+1)
+		}
+	} else {
+		valueStart := i
+		for i < len(runes) && !isFilterDelimiter(runes[i]) {
+			i++
+		}
+		token.value = string(runes[valueStart:i])
+	}
+	token.text = string(runes[start:i])
+	return token, i, nil
+}
+
+// lexFilterQuoted reads a double-quoted string starting at runes[start]; \" and \\ are escapes
+func lexFilterQuoted(runes []rune, start int) (string, int, error) {
+	var value strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				value.WriteRune(runes[i])
+			}
+		case '"':
+			return value.String(), i + 1, nil
+		default:
+			value.WriteRune(runes[i])
+		}
+	}
+	return "", 0, fmt.Errorf("%w: unterminated quote at position %d", ErrInvalidFilter, start+1)
+}
+
+// Parser
+
+type filterParser struct {
+	tokens           []filterToken
+	pos              int
+	terms            int
+	referencesFields map[string]bool
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *filterParser) unexpected() error {
+	token := p.peek()
+	if token == nil {
+		return fmt.Errorf("%w: unexpected end of expression", ErrInvalidFilter)
+	}
+	return fmt.Errorf("%w: unexpected %q at position %d", ErrInvalidFilter, token.text, token.pos)
+}
+
+func (p *filterParser) parseOr(depth int) (*filterNode, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	node := &filterNode{kind: filterOr, children: []*filterNode{left}}
+	for token := p.peek(); token != nil && token.kind == tokenOr; token = p.peek() {
+		p.pos++
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, right)
+	}
+	if len(node.children) == 1 {
+		return left, nil
+	}
+	return node, nil
+}
+
+func (p *filterParser) parseAnd(depth int) (*filterNode, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	node := &filterNode{kind: filterAnd, children: []*filterNode{left}}
+	for token := p.peek(); token != nil; token = p.peek() {
+		if token.kind == tokenAnd {
+			p.pos++
+		} else if token.kind != tokenTerm && token.kind != tokenNot && token.kind != tokenLParen {
+			break
+		}
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, right)
+	}
+	if len(node.children) == 1 {
+		return left, nil
+	}
+	return node, nil
+}
+
+func (p *filterParser) parseUnary(depth int) (*filterNode, error) {
+	if depth > maxFilterDepth {
+		return nil, fmt.Errorf("%w: nested more than %d levels deep", ErrInvalidFilter, maxFilterDepth)
+	}
+	token := p.peek()
+	if token == nil {
+		return nil, p.unexpected()
+	}
+	switch token.kind {
+	case tokenNot:
+		p.pos++
+		child, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &filterNode{kind: filterNot, children: []*filterNode{child}}, nil
+	case tokenLParen:
+		p.pos++
+		node, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing == nil || closing.kind != tokenRParen {
+			if closing == nil {
+				return nil, fmt.Errorf("%w: missing closing parenthesis for position %d", ErrInvalidFilter, token.pos)
+			}
+			return nil, p.unexpected()
+		}
+		p.pos++
+		return node, nil
+	case tokenTerm:
+		p.pos++
+		p.terms++
+		if p.terms > maxFilterTerms {
+			return nil, fmt.Errorf("%w: more than %d terms", ErrInvalidFilter, maxFilterTerms)
+		}
+		condition, err := parseFilterCondition(*token)
+		if err != nil {
+			return nil, err
+		}
+		p.referencesFields[condition.name] = true
+		return &filterNode{kind: filterTerm, term: condition}, nil
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+// parseFilterCondition resolves the field of a term and validates its operator and value
+func parseFilterCondition(token filterToken) (*filterCondition, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s at position %d", ErrInvalidFilter, fmt.Sprintf(format, args...), token.pos)
+	}
+
+	if !token.hasField {
+		// A bare flag name such as archived, otherwise free text
+		if field, ok := contactFilterFields[strings.ToLower(token.value)]; ok && field.kind == fieldFlag && !token.quoted {
+			return &filterCondition{name: strings.ToLower(token.value), field: field, flag: true}, nil
+		}
+		if strings.TrimSpace(token.value) == "" {
+			return nil, invalid("empty search term")
+		}
+		return &filterCondition{name: "text", field: filterField{kind: fieldFreeText}, value: token.value}, nil
+	}
+
+	condition := &filterCondition{op: token.op, value: token.value}
+	name := strings.ToLower(token.field)
+	if strings.HasPrefix(name, customFieldPrefix) && len(token.field) > len(customFieldPrefix) {
+		condition.name = "custom"
+		condition.field = filterField{kind: fieldCustom, columns: []string{"contacts.custom_fields"}}
+		condition.key = token.field[len(customFieldPrefix):]
+	} else {
+		if alias, ok := contactFilterAliases[name]; ok {
+			name = alias
+		}
+		field, ok := contactFilterFields[name]
+		if !ok {
+			return nil, invalid("unknown field %q", token.field)
+		}
+		condition.name = name
+		condition.field = field
+	}
+
+	if condition.op == "" {
+		condition.op = opContains
+		if !token.quoted && token.value == opPresent {
+			condition.op = opPresent
+		}
+	}
+	if condition.value == "" && !token.quoted && condition.op != opPresent {
+		return nil, invalid("missing value for %q", token.field)
+	}
+
+	switch condition.field.kind {
+	case fieldText, fieldList, fieldCircle, fieldCustom:
+		if condition.op != opContains && condition.op != opEquals && condition.op != opPresent {
+			return nil, invalid("%q only supports field:value, field:=value and field:*", token.field)
+		}
+	case fieldFlag:
+		if condition.op != opContains {
+			return nil, invalid("%q is true or false", token.field)
+		}
+		switch strings.ToLower(condition.value) {
+		case "true", "yes":
+			condition.flag = true
+		case "false", "no":
+			condition.flag = false
+		default:
+			return nil, invalid("%q is true or false", token.field)
+		}
+	case fieldAnnual, fieldTimestamp:
+		if err := parseDateCondition(condition); err != nil {
+			return nil, invalid("%v", err)
+		}
+	}
+	return condition, nil
+}
+
+// parseDateCondition validates the value of a birthday, anniversary or timestamp term
+func parseDateCondition(condition *filterCondition) error {
+	annual := condition.field.kind == fieldAnnual
+	switch condition.op {
+	case opPresent:
+		return nil
+	case opLess, opLessEq, opGreater, opGreaterE:
+		if span, ok := parseFilterSpan(condition.value); ok {
+			condition.isSpan = true
+			condition.span = span
+			return nil
+		}
+		if !datePattern.MatchString(condition.value) || !validDate(condition.value) {
+			return fmt.Errorf("%q needs a date (YYYY-MM-DD) or a duration such as 30d, 2w, 6m or 1y", condition.name)
+		}
+		condition.from = condition.value
+		return nil
+	case opContains:
+		if from, to, ok := strings.Cut(condition.value, opRange); ok {
+			condition.op = opRange
+			return parseDateRange(condition, from, to)
+		}
+		value := condition.value
+		switch {
+		case datePattern.MatchString(value) && validDate(value):
+		case yearPattern.MatchString(value):
+		case annual && monthDayPattern.MatchString(value) && validMonthDay(value):
+			condition.value = strings.TrimPrefix(value, "--")
+		default:
+			if annual {
+				return fmt.Errorf("%q needs YYYY-MM-DD, YYYY or MM-DD", condition.name)
+			}
+			return fmt.Errorf("%q needs YYYY-MM-DD or YYYY", condition.name)
+		}
+		condition.op = opEquals
+		return nil
+	default:
+		return fmt.Errorf("%q does not support %s", condition.name, condition.op)
+	}
+}
+
+// parseDateRange validates the bounds of a date range such as 2026-01-01..2026-03-31
+func parseDateRange(condition *filterCondition, from, to string) error {
+	annual := condition.field.kind == fieldAnnual
+	condition.from, condition.to = from, to
+	switch {
+	case datePattern.MatchString(from) && datePattern.MatchString(to) && validDate(from) && validDate(to):
+	case yearPattern.MatchString(from) && yearPattern.MatchString(to):
+	case annual && monthDayPattern.MatchString(from) && monthDayPattern.MatchString(to) && validMonthDay(from) && validMonthDay(to):
+		condition.from, condition.to = strings.TrimPrefix(from, "--"), strings.TrimPrefix(to, "--")
+	default:
+		if annual {
+			return fmt.Errorf("%q ranges are YYYY-MM-DD..YYYY-MM-DD, YYYY..YYYY or MM-DD..MM-DD", condition.name)
+		}
+		return fmt.Errorf("%q ranges are YYYY-MM-DD..YYYY-MM-DD or YYYY..YYYY", condition.name)
+	}
+	return nil
+}
+
+func parseFilterSpan(value string) (filterSpan, bool) {
+	match := spanPattern.FindStringSubmatch(value)
+	if match == nil {
+		return filterSpan{}, false
+	}
+	n, _ := strconv.Atoi(match[1])
+	return filterSpan{n: n, unit: match[2][0]}, true
+}
+
+// after returns the time span after t
+func (s filterSpan) after(t time.Time) time.Time {
+	switch s.unit {
+	case 'w':
+		return t.AddDate(0, 0, 7*s.n)
+	case 'm':
+		return t.AddDate(0, s.n, 0)
+	case 'y':
+		return t.AddDate(s.n, 0, 0)
+	default:
+		return t.AddDate(0, 0, s.n)
+	}
+}
+
+// before returns the time span before t
+func (s filterSpan) before(t time.Time) time.Time {
+	return filterSpan{n: -s.n, unit: s.unit}.after(t)
+}
+
+func validDate(value string) bool {
+	_, err := time.Parse("2006-01-02", value)
+	return err == nil
+}
+
+func validMonthDay(value string) bool {
+	// 2000 is a leap year, so February 29 is valid
+	_, err := time.Parse("2006-01-02", "2000-"+strings.TrimPrefix(value, "--"))
+	return err == nil
+}
+
+// SQL rendering
+
+func (n *filterNode) sql(db *gorm.DB, now time.Time) (string, []interface{}) {
+	switch n.kind {
+	case filterTerm:
+		return n.term.sql(db, now)
+	case filterNot:
+		condition, args := n.children[0].sql(db, now)
+		return "NOT (" + condition + ")", args
+	default:
+		separator := " AND "
+		if n.kind == filterOr {
+			separator = " OR "
+		}
+		parts := make([]string, len(n.children))
+		var args []interface{}
+		for i, child := range n.children {
+			condition, childArgs := child.sql(db, now)
+			parts[i] = "(" + condition + ")"
+			args = append(args, childArgs...)
+		}
+		return strings.Join(parts, separator), args
+	}
+}
+
+// sql renders a term as a condition that is never NULL, so that NOT inverts it exactly
+func (c *filterCondition) sql(db *gorm.DB, now time.Time) (string, []interface{}) {
+	switch c.field.kind {
+	case fieldFreeText:
+		condition, args := ContactSearchCondition(db, c.value)
+		return "COALESCE(" + condition + ", FALSE)", args
+	case fieldFlag:
+		return c.field.columns[0] + " = ?", []interface{}{c.flag}
+	case fieldText:
+		var parts []string
+		var args []interface{}
+		for _, column := range c.field.columns {
+			condition, arg := c.textSQL(db, "COALESCE("+column+", '')")
+			parts = append(parts, condition)
+			args = append(args, arg...)
+		}
+		return strings.Join(parts, " OR "), args
+	case fieldList:
+		if c.op == opPresent {
+			var parts []string
+			for _, field := range c.field.fields {
+				parts = append(parts, "COALESCE("+database.JSONElementField(db, field)+", '') <> ''")
+			}
+			return database.JSONArrayElementsWhere(db, c.field.columns[0], strings.Join(parts, " OR ")), nil
+		}
+		var parts []string
+		var args []interface{}
+		for _, field := range c.field.fields {
+			condition, arg := c.textSQL(db, "COALESCE("+database.JSONElementField(db, field)+", '')")
+			parts = append(parts, condition)
+			args = append(args, arg...)
+		}
+		return database.JSONArrayElementsWhere(db, c.field.columns[0], strings.Join(parts, " OR ")), args
+	case fieldCircle:
+		column := c.field.columns[0]
+		if c.op == opPresent {
+			return fmt.Sprintf("COALESCE(%s, '') NOT IN ('', '[]', 'null')", column), nil
+		}
+		return "COALESCE(" + database.JSONArrayContains(db, column) + ", FALSE)", []interface{}{c.value}
+	case fieldCustom:
+		condition, args := c.textSQL(db, "COALESCE(entry.value, '')")
+		if c.op == opPresent {
+			condition, args = "COALESCE(entry.value, '') <> ''", nil
+		}
+		return database.JSONObjectEntriesWhere(db, c.field.columns[0], "LOWER(entry.key) = LOWER(?) AND "+condition),
+			append([]interface{}{c.key}, args...)
+	case fieldAnnual:
+		return c.annualSQL(now)
+	case fieldTimestamp:
+		return c.timestampSQL(now)
+	}
+	return "1 = 0", nil
+}
+
+// textSQL matches a non-NULL text expression
+func (c *filterCondition) textSQL(db *gorm.DB, expression string) (string, []interface{}) {
+	switch c.op {
+	case opPresent:
+		return expression + " <> ''", nil
+	case opEquals:
+		return "LOWER(" + expression + ") = LOWER(?)", []interface{}{c.value}
+	default:
+		return fmt.Sprintf("%s %s ? ESCAPE '\\'", expression, database.ILike(db)), []interface{}{"%" + escapeLike(c.value) + "%"}
+	}
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// annualSQL matches birthdays and anniversaries, stored as YYYY-MM-DD or --MM-DD. Durations look
+// ahead to the next occurrence, e.g. birthday:<30d is a birthday within the next 30 days.
+func (c *filterCondition) annualSQL(now time.Time) (string, []interface{}) {
+	column := "COALESCE(" + c.field.columns[0] + ", '')"
+	// Month and day are the last five characters in both formats
+	monthDay := fmt.Sprintf("SUBSTR(%[1]s, LENGTH(%[1]s) - 4, 5)", column)
+	full := column + " NOT LIKE '--%'"
+
+	switch c.op {
+	case opPresent:
+		return column + " <> ''", nil
+	case opEquals:
+		switch {
+		case yearPattern.MatchString(c.value):
+			return column + " LIKE ?", []interface{}{c.value + "-%"}
+		case datePattern.MatchString(c.value):
+			return column + " = ?", []interface{}{c.value}
+		default:
+			return column + " <> '' AND " + monthDay + " = ?", []interface{}{c.value}
+		}
+	case opRange:
+		switch {
+		case yearPattern.MatchString(c.from):
+			return full + " AND " + column + " >= ? AND " + column + " < ?", []interface{}{c.from + "-", nextYear(c.to) + "-"}
+		case datePattern.MatchString(c.from):
+			return full + " AND " + column + " BETWEEN ? AND ?", []interface{}{c.from, c.to}
+		case c.from <= c.to:
+			return column + " <> '' AND " + monthDay + " BETWEEN ? AND ?", []interface{}{c.from, c.to}
+		default:
+			// Wraps around the end of the year, e.g. 12-15..01-15
+			return column + " <> '' AND (" + monthDay + " >= ? OR " + monthDay + " <= ?)", []interface{}{c.from, c.to}
+		}
+	}
+
+	if !c.isSpan {
+		switch c.op {
+		case opLess:
+			return full + " AND " + column + " <> '' AND " + column + " < ?", []interface{}{c.from}
+		case opLessEq:
+			return full + " AND " + column + " <> '' AND " + column + " <= ?", []interface{}{c.from}
+		case opGreater:
+			return full + " AND " + column + " > ?", []interface{}{c.from}
+		default:
+			return full + " AND " + column + " >= ?", []interface{}{c.from}
+		}
+	}
+
+	// Upcoming occurrences within the span, counted in whole days from today
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	days := int(c.span.after(today).Sub(today).Hours()/24 + 0.5)
+	last := days
+	if c.op == opLess || c.op == opGreaterE {
+		last--
+	}
+	within := upcomingMonthDays(today, last)
+	if len(within) == 0 {
+		within = []string{""}
+	}
+	if c.op == opLess || c.op == opLessEq {
+		return column + " <> '' AND " + monthDay + " IN ?", []interface{}{within}
+	}
+	return column + " <> '' AND " + monthDay + " NOT IN ?", []interface{}{within}
+}
+
+// upcomingMonthDays lists the MM-DD of today and the following days up to today+last. February 29
+// is included with February 28 in years without it, when such birthdays are usually celebrated.
+func upcomingMonthDays(today time.Time, last int) []string {
+	if last > 366 {
+		last = 366
+	}
+	seen := map[string]bool{}
+	var monthDays []string
+	add := func(md string) {
+		if !seen[md] {
+			seen[md] = true
+			monthDays = append(monthDays, md)
+		}
+	}
+	for i := 0; i <= last; i++ {
+		day := today.AddDate(0, 0, i)
+		add(day.Format("01-02"))
+		if day.Month() == time.February && day.Day() == 28 && day.AddDate(0, 0, 1).Month() == time.March {
+			add("02-29")
+		}
+	}
+	return monthDays
+}
+
+func nextYear(year string) string {
+	n, _ := strconv.Atoi(year)
+	return fmt.Sprintf("%04d", n+1)
+}
+
+// timestampSQL matches created_at and updated_at. Durations look back from now, e.g.
+// updated:<7d was changed within the last seven days; dates are whole days in now's location.
+// For related rows the contact matches when any of them does, so activity:<90d is a contact
+// with an activity in the last 90 days and NOT activity:<90d one without.
+func (c *filterCondition) timestampSQL(now time.Time) (string, []interface{}) {
+	condition, args := c.timestampComparison(now)
+	if c.op != opPresent {
+		condition = c.field.columns[0] + " IS NOT NULL AND " + condition
+	}
+	if c.field.related != "" {
+		return fmt.Sprintf(c.field.related, condition), args
+	}
+	return condition, args
+}
+
+func (c *filterCondition) timestampComparison(now time.Time) (string, []interface{}) {
+	column := c.field.columns[0]
+	day := func(value string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02", value, now.Location())
+		return t
+	}
+	year := func(value string) time.Time {
+		n, _ := strconv.Atoi(value)
+		return time.Date(n, time.January, 1, 0, 0, 0, 0, now.Location())
+	}
+
+	switch c.op {
+	case opPresent:
+		return column + " IS NOT NULL", nil
+	case opEquals:
+		if yearPattern.MatchString(c.value) {
+			start := year(c.value)
+			return column + " >= ? AND " + column + " < ?", []interface{}{start, start.AddDate(1, 0, 0)}
+		}
+		start := day(c.value)
+		return column + " >= ? AND " + column + " < ?", []interface{}{start, start.AddDate(0, 0, 1)}
+	case opRange:
+		if yearPattern.MatchString(c.from) {
+			return column + " >= ? AND " + column + " < ?", []interface{}{year(c.from), year(c.to).AddDate(1, 0, 0)}
+		}
+		return column + " >= ? AND " + column + " < ?", []interface{}{day(c.from), day(c.to).AddDate(0, 0, 1)}
+	}
+
+	if c.isSpan {
+		since := c.span.before(now)
+		switch c.op {
+		case opLess:
+			return column + " > ?", []interface{}{since}
+		case opLessEq:
+			return column + " >= ?", []interface{}{since}
+		case opGreater:
+			return column + " < ?", []interface{}{since}
+		default:
+			return column + " <= ?", []interface{}{since}
+		}
+	}
+
+	start := day(c.from)
+	switch c.op {
+	case opLess:
+		return column + " < ?", []interface{}{start}
+	case opLessEq:
+		return column + " < ?", []interface{}{start.AddDate(0, 0, 1)}
+	case opGreater:
+		return column + " >= ?", []interface{}{start.AddDate(0, 0, 1)}
+	default:
+		return column + " >= ?", []interface{}{start}
+	}
+}
@@ -0,0 +1,188 @@
+package filters
+
+import (
+	"meerkat/database"
+	"meerkat/models"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactFilter_Matches(t *testing.T) {
+	db, err := database.InitDB(database.DriverSQLite, filepath.Join(t.TempDir(), "meerkat.db"))
+	require.NoError(t, err)
+
+	user := models.User{Username: "filter", Password: "x", Email: "filter@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+
+	contacts := []models.Contact{
+		{
+			Firstname: "Alice", Lastname: "Archer", Circles: []string{"Work", "Friends"}, Birthday: "1990-03-10",
+			CustomFields: map[string]string{"Company": "ACME Corp", "Favorite color": "green"},
+			Emails:       []models.ContactEmail{{Type: "work", Value: "alice@acme.example"}},
+			Addresses:    []models.ContactAddress{{Type: "home", City: "Lisbon", Country: "Portugal"}},
+		},
+		{Firstname: "Bob", Lastname: "Baker", Circles: []string{"Work"}, Birthday: "--12-30", Organization: "Globex"},
+		{Firstname: "Carol", Lastname: "100%_real", Birthday: "1985-06-01", Archived: true, Anniversary: "2010-03-05"},
+		{Firstname: "Dave", Phones: []models.ContactPhone{{Type: "cell", Value: "+351 912 345 678"}}},
+	}
+	for i := range contacts {
+		contacts[i].UserID = user.ID
+		require.NoError(t, db.Create(&contacts[i]).Error)
+	}
+	// Not the user's, never matched
+	require.NoError(t, db.Create(&models.Contact{UserID: user.ID + 1, Firstname: "Mallory", Circles: []string{"Work"}}).Error)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	match := func(expression string) []string {
+		t.Helper()
+		filter, err := ParseContactFilter(expression)
+		require.NoError(t, err, expression)
+		names := []string{}
+		require.NoError(t, filter.Apply(db.Model(&models.Contact{}).Where("user_id = ?", user.ID), now).
+			Order("firstname").Pluck("firstname", &names).Error, expression)
+		return names
+	}
+
+	cases := map[string][]string{
+		`circle:Work AND birthday:<30d AND NOT archived AND custom.Company:"ACME"`: {"Alice"},
+		`circle:Work`:                         {"Alice", "Bob"},
+		`circle:work`:                         {},
+		`circle:*`:                            {"Alice", "Bob"},
+		`-circle:*`:                           {"Carol", "Dave"},
+		`circle:Friends OR org:globex`:        {"Alice", "Bob"},
+		`(circle:Friends OR org:globex) bob`:  {"Bob"},
+		`archived`:                            {"Carol"},
+		`archived:false`:                      {"Alice", "Bob", "Dave"},
+		`NOT NOT archived`:                    {"Carol"},
+		`lastname:100%_`:                      {"Carol"},
+		`lastname:0%`:                         {"Carol"},
+		`lastname:%`:                          {"Carol"},
+		`lastname:=ARCHER`:                    {"Alice"},
+		`lastname:arch`:                       {"Alice"},
+		`NOT lastname:*`:                      {"Dave"},
+		`email:acme.example`:                  {"Alice"},
+		`email:*`:                             {"Alice"},
+		`phone:912`:                           {"Dave"},
+		`city:lisbon`:                         {"Alice"},
+		`address:portugal`:                    {"Alice"},
+		`-address:portugal`:                   {"Bob", "Carol", "Dave"},
+		`custom.company:=acme`:                {},
+		`custom.company:="acme corp"`:         {"Alice"},
+		`custom."Favorite color":green`:       {"Alice"},
+		`custom.Company:*`:                    {"Alice"},
+		`NOT custom.Company:acme`:             {"Bob", "Carol", "Dave"},
+		`"alice archer"`:                      {"Alice"},
+		`birthday:<10d`:                       {"Alice"},
+		`birthday:<9d`:                        {},
+		`birthday:<=9d`:                       {"Alice"},
+		`birthday:>9d`:                        {"Bob", "Carol"},
+		`birthday:<1y`:                        {"Alice", "Bob", "Carol"},
+		`birthday:12-30`:                      {"Bob"},
+		`birthday:--12-30`:                    {"Bob"},
+		`birthday:12-01..01-31`:               {"Bob"},
+		`birthday:03-01..06-01`:               {"Alice", "Carol"},
+		`birthday:1980..1989`:                 {"Carol"},
+		`birthday:1985-01-01..1995-12-31`:     {"Alice", "Carol"},
+		`birthday:<1988-01-01`:                {"Carol"},
+		`birthday:1990`:                       {"Alice"},
+		`birthday:*`:                          {"Alice", "Bob", "Carol"},
+		`anniversary:<1w`:                     {"Carol"},
+		`created:<1d`:                         {"Alice", "Bob", "Carol", "Dave"},
+		`created:>1d`:                         {},
+		`created:2026-03-01`:                  {"Alice", "Bob", "Carol", "Dave"},
+		`created:2026-02-01..2026-02-28`:      {},
+		`updated:>=2026-03-01 AND -archived`:  {"Alice", "Bob", "Dave"},
+		`name:"alice archer" OR nickname:bob`: {"Alice"},
+		`activity:<90d`:                       {"Alice"},
+		`NOT activity:<90d`:                   {"Bob", "Carol", "Dave"},
+		`activity:*`:                          {"Alice"},
+		`activities:2026-02-19`:               {"Alice"},
+		`note:>90d`:                           {"Bob"},
+		`note:<90d`:                           {},
+		`-notes:* AND -activity:*`:            {"Carol", "Dave"},
+	}
+	// Deleted activities and notes do not count
+	activity := models.Activity{UserID: user.ID, Title: "Lunch", Date: now.AddDate(0, 0, -10), Contacts: []models.Contact{contacts[0]}}
+	require.NoError(t, db.Omit("Contacts.*").Create(&activity).Error)
+	deleted := models.Activity{UserID: user.ID, Title: "Dinner", Date: now.AddDate(0, 0, -1), Contacts: []models.Contact{contacts[1]}}
+	require.NoError(t, db.Omit("Contacts.*").Create(&deleted).Error)
+	require.NoError(t, db.Delete(&deleted).Error)
+	require.NoError(t, db.Create(&models.Note{UserID: user.ID, ContactID: &contacts[1].ID, Content: "Moved", Date: now.AddDate(0, 0, -100)}).Error)
+
+	// Everything was created at the test's real time, so pin created/updated to now
+	require.NoError(t, db.Model(&models.Contact{}).Where("user_id = ?", user.ID).
+		UpdateColumns(map[string]interface{}{"created_at": now, "updated_at": now}).Error)
+
+	for expression, want := range cases {
+		assert.Equal(t, want, match(expression), expression)
+	}
+}
+
+func TestContactFilter_Members(t *testing.T) {
+	db, err := database.InitDB(database.DriverSQLite, filepath.Join(t.TempDir(), "meerkat.db"))
+	require.NoError(t, err)
+
+	user := models.User{Username: "members", Password: "x", Email: "members@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+	require.NoError(t, db.Create(&models.Contact{UserID: user.ID, Firstname: "Alice", Organization: "ACME"}).Error)
+	require.NoError(t, db.Create(&models.Contact{UserID: user.ID, Firstname: "Bob", Organization: "ACME", Archived: true}).Error)
+
+	members := func(expression string) []string {
+		t.Helper()
+		filter, err := ParseContactFilter(expression)
+		require.NoError(t, err, expression)
+		names := []string{}
+		require.NoError(t, filter.Members(db.Model(&models.Contact{}).Where("user_id = ?", user.ID), time.Now()).
+			Order("firstname").Pluck("firstname", &names).Error, expression)
+		return names
+	}
+
+	// Archived contacts only match a filter that asks for them
+	assert.Equal(t, []string{"Alice"}, members("org:acme"))
+	assert.Equal(t, []string{"Bob"}, members("org:acme AND archived"))
+	assert.Equal(t, []string{"Alice", "Bob"}, members("org:acme AND (archived OR -archived)"))
+}
+
+func TestParseContactFilter_Errors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"   ",
+		"circle:Work AND",
+		"OR circle:Work",
+		"(circle:Work",
+		"circle:Work)",
+		"unknown:value",
+		"circle:",
+		`custom.Company:"ACME`,
+		`name:"a"b`,
+		"name:>5",
+		"archived:maybe",
+		"archived:>1",
+		"birthday:soon",
+		"birthday:<30x",
+		"birthday:2026-02-30",
+		"birthday:13-01..14-01",
+		"created:03-01..04-01",
+		"created:<=yesterday",
+	} {
+		_, err := ParseContactFilter(expression)
+		assert.ErrorIs(t, err, ErrInvalidFilter, expression)
+	}
+
+	deep := ""
+	for i := 0; i < 30; i++ {
+		deep += "("
+	}
+	_, err := ParseContactFilter(deep + "a")
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+
+	filter, err := ParseContactFilter("circle:Work NOT archived")
+	require.NoError(t, err)
+	assert.True(t, filter.References("archived"))
+	assert.True(t, filter.References("circle"))
+	assert.False(t, filter.References("birthday"))
+}
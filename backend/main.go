@@ -52,7 +52,7 @@ func main() {
 	cfg.ValidateOrPanic()
 
 	logger.Info().Msg("Loading database and running migrations...")
-	db, err := database.InitDB(cfg.DBPath)
+	db, err := database.InitDB(cfg.DBDriver, cfg.DatabaseDSN())
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to initialize database")
 	}
@@ -63,7 +63,7 @@ func main() {
 	}
 
 	logger.Info().Msg("Running scheduler...")
-	// Schedule the reminder task daily
+	// Check for users whose daily reminder time has come every few minutes
 	if !cfg.UseResend {
 		logger.Warn().Msg("No Mails to be sent since Resend configuration is not set")
 	}
@@ -74,11 +74,32 @@ func main() {
 			logger.Error().Err(err).Msg("Error sending reminders")
 		}
 	}
-	s.Every(1).Day().At(cfg.ReminderTime).Do(task)
+	s.Every(services.ReminderCheckInterval).Do(task)
 	go task() // Run initially once on startup (rate-limited to prevent duplicates)
+	timedTask := func() {
+		if err := services.SendTimedRemindersWithRateLimit(db, *cfg); err != nil {
+			logger.Error().Err(err).Msg("Error sending timed reminders")
+		}
+	}
+	s.Every(services.TimedReminderCheckInterval).Do(timedTask)
 	s.Every(5).Minutes().Do(func() {
 		services.ProcessWebhookRetries(db, *cfg)
 	})
+	s.Every(5).Minutes().Do(func() {
+		services.SyncDueCardDAVRemotes(db, *cfg)
+	})
+	if cfg.TrashRetentionDays > 0 {
+		s.Every(1).Day().At("03:00").Do(func() {
+			services.PurgeExpiredTrash(db, *cfg)
+		})
+	}
+	if cfg.BackupDir != "" {
+		// Wait for the first interval so that restarts do not pile up snapshots and prune older ones
+		s.Every(cfg.BackupIntervalHours).Hours().WaitForSchedule().Do(func() {
+			services.CreateScheduledSnapshot(db, *cfg)
+		})
+		logger.Info().Str("dir", cfg.BackupDir).Int("interval_hours", cfg.BackupIntervalHours).Msg("Scheduled snapshots enabled")
+	}
 	go s.StartBlocking()
 
 	r := gin.Default()
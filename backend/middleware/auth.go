@@ -54,6 +54,7 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			}
 			c.Set("userID", apiToken.UserID)
 			c.Set("isAPIToken", true)
+			c.Set("apiTokenName", apiToken.Name)
 			go func(id uint) {
 				if err := db.Model(&models.ApiToken{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error; err != nil {
 					logger.Logger.Warn().Err(err).Uint("api_token_id", id).Msg("Failed to update api token last_used_at")
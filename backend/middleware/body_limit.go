@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -12,11 +13,22 @@ const (
 	MaxJSONBodySize    = 1 << 20  // 1 MB
 )
 
+// unlimitedBodyKey holds the request body before any size limit was applied
+const unlimitedBodyKey = "unlimitedBody"
+
 // BodySizeLimitMiddleware limits the size of request bodies to prevent DoS attacks.
+// A limit set on a route replaces the global one, so uploads such as backups can be larger.
 func BodySizeLimitMiddleware(maxBytes int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		body := c.Request.Body
+		if original, ok := c.Get(unlimitedBodyKey); ok {
+			body = original.(io.ReadCloser)
+		} else {
+			c.Set(unlimitedBodyKey, body)
+		}
+
 		// Wrap the request body with a size limiter
-		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Request.Body = http.MaxBytesReader(c.Writer, body, maxBytes)
 		c.Next()
 	}
 }
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -135,3 +136,26 @@ func TestDefaultBodySizeLimitMiddleware(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestBodySizeLimitMiddleware_RouteOverridesGlobalLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(BodySizeLimitMiddleware(1024))
+	readAll := func(c *gin.Context) {
+		if _, err := io.ReadAll(c.Request.Body); err != nil {
+			c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	router.POST("/small", readAll)
+	router.POST("/large", BodySizeLimitMiddleware(4096), readAll)
+
+	for path, expected := range map[string]int{"/small": http.StatusRequestEntityTooLarge, "/large": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(bytes.Repeat([]byte("x"), 2048)))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, expected, w.Code, path)
+	}
+}
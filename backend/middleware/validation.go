@@ -3,6 +3,7 @@ package middleware
 import (
 	apperrors "meerkat/errors"
 	"meerkat/logger"
+	"meerkat/models"
 	"reflect"
 	"regexp"
 	"strings"
@@ -25,6 +26,7 @@ func init() {
 	validate.RegisterValidation("unique_circles", validateUniqueCircles)
 	validate.RegisterValidation("no_at_sign", validateNoAtSign)
 	validate.RegisterValidation("safeurl", validateSafeURL)
+	validate.RegisterValidation("rrule", validateRRule)
 }
 
 // ValidationError represents a validation error response
@@ -77,6 +79,19 @@ func formatValidationError(err validator.FieldError) string {
 		return field + " must be a valid URL"
 	case "safeurl":
 		return field + " uses an unsafe URL scheme"
+	case "rrule":
+		return field + " must be a valid recurrence rule (e.g. FREQ=WEEKLY;INTERVAL=2;BYDAY=TU)"
+	case "timezone":
+		return field + " must be an IANA timezone (e.g. Europe/Berlin)"
+	case "datetime":
+		if err.Param() == "15:04" {
+			return field + " must be a time in HH:MM format"
+		}
+		return field + " must match the format " + err.Param()
+	case "required_if":
+		return field + " is required"
+	case "required_without":
+		return field + " or " + err.Param() + " is required"
 	default:
 		return field + " is invalid"
 	}
@@ -152,6 +167,16 @@ func validateSafeURL(fl validator.FieldLevel) bool {
 	return true
 }
 
+// validateRRule checks the recurrence rule of a reminder
+func validateRRule(fl validator.FieldLevel) bool {
+	rule := fl.Field().String()
+	if rule == "" {
+		return true
+	}
+	_, err := models.ParseRecurrenceRule(rule)
+	return err == nil
+}
+
 // validateBirthday validates date format (YYYY-MM-DD or --MM-DD)
 func validateBirthday(fl validator.FieldLevel) bool {
 	birthday := fl.Field().String()
@@ -187,6 +187,43 @@ func TestValidateStruct_SafeURL(t *testing.T) {
 	}
 }
 
+// TestValidateStruct_RRule tests the recurrence rule validator through ValidateStruct
+func TestValidateStruct_RRule(t *testing.T) {
+	type TestStruct struct {
+		Rule string `validate:"rrule"`
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		isValid bool
+	}{
+		{name: "empty allowed", rule: "", isValid: true},
+		{name: "every 3 days", rule: "FREQ=DAILY;INTERVAL=3", isValid: true},
+		{name: "every 2 weeks on Tuesday", rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU", isValid: true},
+		{name: "last Friday of the month", rule: "FREQ=MONTHLY;BYDAY=-1FR", isValid: true},
+		{name: "with prefix and count", rule: "RRULE:FREQ=YEARLY;COUNT=5", isValid: true},
+		{name: "until date", rule: "FREQ=WEEKLY;UNTIL=20271231T000000Z", isValid: true},
+		{name: "missing frequency", rule: "INTERVAL=2", isValid: false},
+		{name: "hourly rejected", rule: "FREQ=HOURLY", isValid: false},
+		{name: "out of range", rule: "FREQ=MONTHLY;BYMONTHDAY=32", isValid: false},
+		{name: "never occurs", rule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30;COUNT=2", isValid: false},
+		{name: "leap day", rule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", isValid: true},
+		{name: "dtstart rejected", rule: "DTSTART:20260101T000000Z\nRRULE:FREQ=DAILY", isValid: false},
+		{name: "garbage", rule: "every tuesday", isValid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := ValidateStruct(TestStruct{Rule: tt.rule})
+			hasErrors := len(errors) > 0
+			if hasErrors == tt.isValid {
+				t.Errorf("ValidateStruct with rule %q: hasErrors=%v, want isValid=%v", tt.rule, hasErrors, tt.isValid)
+			}
+		})
+	}
+}
+
 // TestValidateStruct_Birthday tests birthday validation through ValidateStruct
 func TestValidateStruct_Birthday(t *testing.T) {
 	type TestStruct struct {
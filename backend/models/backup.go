@@ -0,0 +1,178 @@
+package models
+
+import "time"
+
+// BackupFormat identifies Meerkat backup archives, and BackupVersion is the version of the layout
+// below. Bump the version when a change would make older Meerkat versions misread a backup.
+const (
+	BackupFormat  = "meerkat-backup"
+	BackupVersion = 1
+)
+
+// BackupManifest is stored as manifest.json at the root of a backup archive
+type BackupManifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BackupData is stored as data.json next to the manifest. IDs are those of the source instance and
+// only link records within the backup; a restore assigns new ones. Photos are stored in the archive
+// under the path given in BackupContact.Photo.
+type BackupData struct {
+	Settings            BackupSettings             `json:"settings"`
+	Contacts            []BackupContact            `json:"contacts"`
+	Relationships       []BackupRelationship       `json:"relationships"`
+	Activities          []BackupActivity           `json:"activities"`
+	Notes               []BackupNote               `json:"notes"`
+	Reminders           []BackupReminder           `json:"reminders"`
+	ReminderCompletions []BackupReminderCompletion `json:"reminder_completions"`
+	ReminderSnoozes     []BackupReminderSnooze     `json:"reminder_snoozes,omitempty"`
+	Webhooks            []BackupWebhook            `json:"webhooks"`
+	SmartCircles        []BackupSmartCircle        `json:"smart_circles"`
+}
+
+// BackupSettings holds the user preferences a backup carries
+type BackupSettings struct {
+	Language             string   `json:"language"`
+	DateFormat           string   `json:"date_format"`
+	CustomFieldNames     []string `json:"custom_field_names"`
+	EnabledContactFields []string `json:"enabled_contact_fields"`
+	Timezone             string   `json:"timezone,omitempty"`
+	ReminderTime         string   `json:"reminder_time,omitempty"`
+}
+
+type BackupContact struct {
+	ID                 uint              `json:"id"`
+	VCardUID           string            `json:"vcard_uid"`
+	Firstname          string            `json:"firstname"`
+	Lastname           string            `json:"lastname"`
+	Nickname           string            `json:"nickname"`
+	Prefix             string            `json:"prefix"`
+	MiddleName         string            `json:"middle_name"`
+	Suffix             string            `json:"suffix"`
+	Gender             string            `json:"gender"`
+	Birthday           string            `json:"birthday"`
+	Anniversary        string            `json:"anniversary"`
+	Email              string            `json:"email"`
+	Phone              string            `json:"phone"`
+	Address            string            `json:"address"`
+	Emails             []ContactEmail    `json:"emails"`
+	Phones             []ContactPhone    `json:"phones"`
+	Addresses          []ContactAddress  `json:"addresses"`
+	URLs               []ContactURL      `json:"urls"`
+	IMPPs              []ContactIMPP     `json:"impps"`
+	Organization       string            `json:"organization"`
+	Department         string            `json:"department"`
+	JobTitle           string            `json:"job_title"`
+	Role               string            `json:"role"`
+	HowWeMet           string            `json:"how_we_met"`
+	FoodPreference     string            `json:"food_preference"`
+	WorkInformation    string            `json:"work_information"`
+	ContactInformation string            `json:"contact_information"`
+	Circles            []string          `json:"circles"`
+	CustomFields       map[string]string `json:"custom_fields"`
+	Archived           bool              `json:"archived"`
+	ContactFrequency   int               `json:"contact_frequency_days,omitempty"`
+	Photo              string            `json:"photo,omitempty"` // Path of the photo file inside the archive
+	VCardExtra         string            `json:"vcard_extra,omitempty"`
+	CreatedAt          time.Time         `json:"created_at"`
+	UpdatedAt          time.Time         `json:"updated_at"`
+}
+
+type BackupRelationship struct {
+	ID               uint      `json:"id"`
+	ContactID        uint      `json:"contact_id"`
+	RelatedContactID *uint     `json:"related_contact_id"`
+	Name             string    `json:"name"`
+	Type             string    `json:"type"`
+	Gender           string    `json:"gender"`
+	Birthday         string    `json:"birthday"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type BackupActivity struct {
+	ID          uint      `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Location    string    `json:"location"`
+	Date        time.Time `json:"date"`
+	ContactIDs  []uint    `json:"contact_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type BackupNote struct {
+	ID        uint      `json:"id"`
+	ContactID *uint     `json:"contact_id"`
+	Content   string    `json:"content"`
+	Date      time.Time `json:"date"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type BackupReminder struct {
+	ID                    uint       `json:"id"`
+	ContactID             *uint      `json:"contact_id"`
+	Message               string     `json:"message"`
+	ByMail                *bool      `json:"by_mail"`
+	RemindAt              time.Time  `json:"remind_at"`
+	RemindTime            string     `json:"remind_time,omitempty"`
+	Recurrence            string     `json:"recurrence"`
+	RecurrenceRule        string     `json:"recurrence_rule,omitempty"`
+	RecurrenceStart       *time.Time `json:"recurrence_start,omitempty"`
+	ReoccurFromCompletion *bool      `json:"reoccur_from_completion"`
+	Completed             bool       `json:"completed"`
+	EmailSent             bool       `json:"email_sent"`
+	LastSent              *time.Time `json:"last_sent"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+type BackupReminderCompletion struct {
+	ID          uint      `json:"id"`
+	ReminderID  *uint     `json:"reminder_id"`
+	ContactID   uint      `json:"contact_id"`
+	Message     string    `json:"message"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+type BackupReminderSnooze struct {
+	ID               uint      `json:"id"`
+	ReminderID       *uint     `json:"reminder_id"`
+	ContactID        uint      `json:"contact_id"`
+	Message          string    `json:"message"`
+	SnoozedAt        time.Time `json:"snoozed_at"`
+	PreviousRemindAt time.Time `json:"previous_remind_at"`
+	RemindAt         time.Time `json:"remind_at"`
+}
+
+type BackupWebhook struct {
+	ID       uint     `json:"id"`
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	Secret   string   `json:"secret"`
+	IsActive bool     `json:"is_active"`
+}
+
+type BackupSmartCircle struct {
+	ID     uint   `json:"id"`
+	Name   string `json:"name"`
+	Filter string `json:"filter"`
+}
+
+// BackupRestoreResult reports how many records a restore created
+type BackupRestoreResult struct {
+	Contacts            int `json:"contacts"`
+	Relationships       int `json:"relationships"`
+	Activities          int `json:"activities"`
+	Notes               int `json:"notes"`
+	Reminders           int `json:"reminders"`
+	ReminderCompletions int `json:"reminder_completions"`
+	ReminderSnoozes     int `json:"reminder_snoozes"`
+	Webhooks            int `json:"webhooks"`
+	SmartCircles        int `json:"smart_circles"`
+	Photos              int `json:"photos"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CalendarFeedToken is the secret part of a user's ICS subscription URL. The URL itself is the
+// credential, since calendar apps subscribing to a feed cannot send other authentication.
+type CalendarFeedToken struct {
+	gorm.Model
+	UserID     uint   `gorm:"not null"`
+	Name       string `gorm:"not null"`
+	TokenHash  string `gorm:"not null;unique" json:"-"`
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (CalendarFeedToken) TableName() string {
+	return "calendar_feed_tokens"
+}
+
+// HashCalendarFeedToken returns the stored hash of a feed token
+func HashCalendarFeedToken(plaintext string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(plaintext)))
+}
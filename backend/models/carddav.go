@@ -1,15 +1,82 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // CardDAVSync tracks sync tokens for CardDAV clients
 type CardDAVSync struct {
-	ID           uint      `gorm:"primaryKey"`
-	UserID       uint      `gorm:"not null;uniqueIndex"`
-	SyncToken    string    `gorm:"not null"`
-	LastModified time.Time `gorm:"not null"`
+	ID             uint      `gorm:"primaryKey"`
+	UserID         uint      `gorm:"not null;uniqueIndex"`
+	SyncToken      string    `gorm:"not null"`
+	LastModified   time.Time `gorm:"not null"`
+	Revision       int64     `gorm:"not null;default:0"` // Monotonic per-user change counter, bumped on every contact change
+	PurgedRevision int64     `gorm:"not null;default:0"` // Highest revision of a tombstone removed by the trash purge
 }
 
 func (CardDAVSync) TableName() string {
 	return "carddav_sync"
 }
+
+// cardDAVSyncTokenPrefix turns a revision into an RFC 6578 sync token (which must be a URI)
+const cardDAVSyncTokenPrefix = "urn:meerkat:sync:"
+
+// CardDAVSyncToken formats a revision as a sync token
+func CardDAVSyncToken(revision int64) string {
+	return cardDAVSyncTokenPrefix + strconv.FormatInt(revision, 10)
+}
+
+// ParseCardDAVSyncToken extracts the revision from a sync token created by CardDAVSyncToken
+func ParseCardDAVSyncToken(token string) (int64, error) {
+	if !strings.HasPrefix(token, cardDAVSyncTokenPrefix) {
+		return 0, fmt.Errorf("unknown sync token %q", token)
+	}
+	revision, err := strconv.ParseInt(strings.TrimPrefix(token, cardDAVSyncTokenPrefix), 10, 64)
+	if err != nil || revision < 0 {
+		return 0, fmt.Errorf("malformed sync token %q", token)
+	}
+	return revision, nil
+}
+
+// NextCardDAVRevision increments the user's CardDAV revision counter and returns the new value.
+// Runs inside the caller's transaction so the bump commits or rolls back with the change it records.
+func NextCardDAVRevision(tx *gorm.DB, userID uint) (int64, error) {
+	var revision int64
+	err := tx.Raw(`INSERT INTO carddav_sync (user_id, sync_token, last_modified, revision)
+		VALUES (?, ?, ?, 1)
+		ON CONFLICT(user_id) DO UPDATE SET
+			revision = carddav_sync.revision + 1,
+			sync_token = ? || CAST(carddav_sync.revision + 1 AS TEXT),
+			last_modified = excluded.last_modified
+		RETURNING revision`,
+		userID, CardDAVSyncToken(1), time.Now(), cardDAVSyncTokenPrefix).Scan(&revision).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump CardDAV revision: %w", err)
+	}
+	return revision, nil
+}
+
+// ValidCardDAVSyncRevision reports whether changes since the given revision can still be listed:
+// it must not be ahead of the user's current revision, nor older than a purged tombstone
+func ValidCardDAVSyncRevision(db *gorm.DB, userID uint, since, current int64) (bool, error) {
+	if since > current {
+		return false, nil
+	}
+	var sync CardDAVSync
+	if err := db.Where("user_id = ?", userID).Limit(1).Find(&sync).Error; err != nil {
+		return false, err
+	}
+	return since >= sync.PurgedRevision, nil
+}
+
+// CurrentCardDAVRevision returns the user's latest CardDAV revision (0 if nothing has changed yet)
+func CurrentCardDAVRevision(db *gorm.DB, userID uint) (int64, error) {
+	var sync CardDAVSync
+	err := db.Where("user_id = ?", userID).Limit(1).Find(&sync).Error
+	return sync.Revision, err
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Protocols an app password can be used for
+const (
+	AppPasswordProtocolCardDAV = "carddav" // contact sync under /carddav
+	AppPasswordProtocolCalDAV  = "caldav"  // calendar sync under /caldav
+)
+
+// CardDAVAppPassword is a per-device password accepted only by the DAV server of its protocol
+type CardDAVAppPassword struct {
+	gorm.Model
+	UserID       uint   `gorm:"not null"`
+	Name         string `gorm:"not null"`
+	Protocol     string `gorm:"not null;default:'carddav'"`
+	PasswordHash string `gorm:"not null;unique" json:"-"`
+	LastUsedAt   *time.Time
+	RevokedAt    *time.Time
+}
+
+func (CardDAVAppPassword) TableName() string {
+	return "carddav_app_passwords"
+}
+
+// HashCardDAVAppPassword returns the stored hash of an app password. Dashes, spaces and case are
+// ignored so a password typed in by hand on a phone still matches.
+func HashCardDAVAppPassword(plaintext string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(plaintext))
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(normalized)))
+}
@@ -0,0 +1,19 @@
+package models
+
+import "gorm.io/gorm"
+
+// CardDAVGroup is the group vCard (KIND:group) that represents a circle over CardDAV.
+// Membership lives in Contact.Circles; the row only keeps the group's UID stable and
+// records when the group last changed (or was removed) for sync-collection.
+type CardDAVGroup struct {
+	gorm.Model
+	UserID       uint   `gorm:"not null;uniqueIndex:idx_carddav_groups_user_uid"`
+	Name         string `gorm:"not null"`
+	VCardUID     string `gorm:"column:vcard_uid;not null;uniqueIndex:idx_carddav_groups_user_uid"`
+	ETag         string `gorm:"column:etag;not null;default:''"`
+	SyncRevision int64  `gorm:"not null;default:0"`
+}
+
+func (CardDAVGroup) TableName() string {
+	return "carddav_groups"
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sync directions for a CardDAV remote
+const (
+	CardDAVRemoteModePull   = "pull"    // remote changes are copied into Meerkat
+	CardDAVRemoteModePush   = "push"    // Meerkat changes are copied to the remote
+	CardDAVRemoteModeTwoWay = "two_way" // both; the remote wins conflicts
+)
+
+// CardDAVRemote is an external CardDAV address book (e.g. Nextcloud or Radicale) that a
+// user's contacts are synced with on a schedule
+type CardDAVRemote struct {
+	gorm.Model
+	UserID          uint   `gorm:"not null;index"`
+	Name            string `gorm:"not null"`
+	URL             string `gorm:"not null"` // Address book collection URL
+	Username        string
+	Password        string `json:"-"` // Needed in plaintext to authenticate against the remote
+	Mode            string `gorm:"not null"`
+	IntervalMinutes int    `gorm:"not null;default:60"`
+	IsActive        bool   `gorm:"default:true"`
+	LastSyncAt      *time.Time
+	LastError       *string
+}
+
+func (CardDAVRemote) TableName() string {
+	return "carddav_remotes"
+}
+
+// CardDAVRemoteObject links a contact (by VCardUID) to its card on a remote and records
+// the state both sides were in after the last sync, so changes can be told apart from conflicts
+type CardDAVRemoteObject struct {
+	ID            uint   `gorm:"primaryKey"`
+	RemoteID      uint   `gorm:"not null;uniqueIndex:idx_carddav_remote_objects_uid"`
+	VCardUID      string `gorm:"column:vcard_uid;not null;uniqueIndex:idx_carddav_remote_objects_uid"`
+	Href          string `gorm:"not null"`
+	RemoteETag    string `gorm:"column:remote_etag;not null;default:''"`
+	LocalRevision int64  `gorm:"not null;default:0"` // Contact.SyncRevision when last synced
+}
+
+func (CardDAVRemoteObject) TableName() string {
+	return "carddav_remote_objects"
+}
@@ -94,10 +94,16 @@ type Contact struct {
 	VCardExtra string `gorm:"column:vcard_extra" json:"-"`     // JSON for unmapped vCard properties
 	ETag       string `gorm:"column:etag" json:"-"`            // Sync conflict detection
 
+	// Per-user CardDAV revision of the last change, including soft deletes (RFC 6578 sync-collection)
+	SyncRevision int64 `gorm:"column:sync_revision;not null;default:0" json:"-"`
+
 	// Custom fields (user-defined string fields)
 	CustomFields map[string]string `gorm:"type:text;serializer:json" json:"custom_fields"`
 
 	Archived bool `gorm:"default:false" json:"archived"`
+
+	// Desired number of days between interactions, 0 when the contact is not tracked
+	ContactFrequencyDays int `gorm:"not null;default:0" json:"contact_frequency_days"`
 }
 
 // renders a structured address as a single human-readable line, used to keep the legacy Address scalar in sync for search/list views.
@@ -142,10 +148,35 @@ func (c *Contact) AfterCreate(tx *gorm.DB) error {
 }
 
 func (c *Contact) AfterSave(tx *gorm.DB) error {
-	newETag := fmt.Sprintf("e-%d-%d", c.ID, c.UpdatedAt.Unix())
-	if newETag != c.ETag {
-		c.ETag = newETag
-		return tx.Model(c).UpdateColumn("etag", c.ETag).Error
+	// Batch updates through an empty model have no row to record against
+	if c.ID == 0 || c.UserID == 0 {
+		return nil
 	}
-	return nil
+
+	revision, err := NextCardDAVRevision(tx, c.UserID)
+	if err != nil {
+		return err
+	}
+	c.SyncRevision = revision
+	// The revision changes on every save, unlike UpdatedAt's seconds, so two edits in
+	// the same second still get distinct ETags for If-Match conflict detection
+	c.ETag = fmt.Sprintf("e-%d-%d", c.ID, c.SyncRevision)
+	return tx.Model(c).UpdateColumns(map[string]interface{}{
+		"etag":          c.ETag,
+		"sync_revision": c.SyncRevision,
+	}).Error
+}
+
+// AfterDelete records soft deletes as a new revision so the row serves as a tombstone for CardDAV sync
+func (c *Contact) AfterDelete(tx *gorm.DB) error {
+	if c.ID == 0 || c.UserID == 0 {
+		return nil
+	}
+
+	revision, err := NextCardDAVRevision(tx, c.UserID)
+	if err != nil {
+		return err
+	}
+	c.SyncRevision = revision
+	return tx.Unscoped().Model(c).UpdateColumn("sync_revision", c.SyncRevision).Error
 }
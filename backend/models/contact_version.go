@@ -0,0 +1,221 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sources of contact changes
+const (
+	ContactSourceWeb      = "web"
+	ContactSourceAPIToken = "api_token"
+	ContactSourceCardDAV  = "carddav"
+	ContactSourceImport   = "import"
+	// ContactSourceInitial marks the state of a contact from before its history was recorded
+	ContactSourceInitial = "initial"
+)
+
+// ContactEditor describes where a contact change came from and who made it
+type ContactEditor struct {
+	Source string
+	Actor  string // Username, API token or CardDAV remote name
+}
+
+// ContactFieldChange holds the JSON values of a field before and after a change
+type ContactFieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// ContactVersion is a recorded state of a contact's fields together with the changes that led to it.
+// Versions are numbered per contact, starting at 1.
+type ContactVersion struct {
+	ID        uint                          `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time                     `json:"created_at"`
+	UserID    uint                          `gorm:"not null;index" json:"-"`
+	ContactID uint                          `gorm:"not null;uniqueIndex:idx_contact_versions_contact_version" json:"contact_id"`
+	Version   int                           `gorm:"not null;uniqueIndex:idx_contact_versions_contact_version" json:"version"`
+	Source    string                        `gorm:"not null" json:"source"`
+	Actor     string                        `gorm:"not null" json:"actor"`
+	Changes   map[string]ContactFieldChange `gorm:"type:text;serializer:json" json:"changes"`
+	Snapshot  ContactInput                  `gorm:"type:text;serializer:json" json:"snapshot"`
+	RevertOf  *int                          `json:"revert_of,omitempty"` // Version this change reverted the contact to
+}
+
+func (ContactVersion) TableName() string {
+	return "contact_versions"
+}
+
+// Input returns the contact's editable fields, the part of a contact its history records
+func (c *Contact) Input() ContactInput {
+	return ContactInput{
+		Firstname:          c.Firstname,
+		Lastname:           c.Lastname,
+		Nickname:           c.Nickname,
+		Gender:             c.Gender,
+		Email:              c.Email,
+		Phone:              c.Phone,
+		Birthday:           c.Birthday,
+		Address:            c.Address,
+		HowWeMet:           c.HowWeMet,
+		FoodPreference:     c.FoodPreference,
+		WorkInformation:    c.WorkInformation,
+		ContactInformation: c.ContactInformation,
+		Circles:            c.Circles,
+		CustomFields:       c.CustomFields,
+		Emails:             c.Emails,
+		Phones:             c.Phones,
+		Addresses:          c.Addresses,
+		URLs:               c.URLs,
+		IMPPs:              c.IMPPs,
+		Prefix:             c.Prefix,
+		MiddleName:         c.MiddleName,
+		Suffix:             c.Suffix,
+		Organization:       c.Organization,
+		Department:         c.Department,
+		JobTitle:           c.JobTitle,
+		Role:               c.Role,
+		Anniversary:        c.Anniversary,
+	}
+}
+
+// ApplyInput sets the contact's editable fields
+func (c *Contact) ApplyInput(input ContactInput) {
+	c.Firstname = input.Firstname
+	c.Lastname = input.Lastname
+	c.Nickname = input.Nickname
+	c.Gender = input.Gender
+	c.Email = input.Email
+	c.Phone = input.Phone
+	c.Birthday = input.Birthday
+	c.Address = input.Address
+	c.HowWeMet = input.HowWeMet
+	c.FoodPreference = input.FoodPreference
+	c.WorkInformation = input.WorkInformation
+	c.ContactInformation = input.ContactInformation
+	c.Circles = input.Circles
+	c.CustomFields = input.CustomFields
+	c.Emails = input.Emails
+	c.Phones = input.Phones
+	c.Addresses = input.Addresses
+	c.URLs = input.URLs
+	c.IMPPs = input.IMPPs
+	c.Prefix = input.Prefix
+	c.MiddleName = input.MiddleName
+	c.Suffix = input.Suffix
+	c.Organization = input.Organization
+	c.Department = input.Department
+	c.JobTitle = input.JobTitle
+	c.Role = input.Role
+	c.Anniversary = input.Anniversary
+}
+
+// RecordContactVersion records a saved change of a contact. before is the contact as it was
+// loaded, or nil for a new contact; after is the contact as saved. Nothing is recorded if no
+// field changed. The first change of a contact from before history was recorded first stores
+// its previous state as version 1, so that it can be reverted to.
+func RecordContactVersion(tx *gorm.DB, before, after *Contact, editor ContactEditor) error {
+	_, err := recordContactVersion(tx, before, after, editor, nil)
+	return err
+}
+
+// RevertContact sets the contact's fields to those of one of its versions, saves it and records
+// the change. The contact is left as it was if it already matches the version.
+func RevertContact(tx *gorm.DB, contact *Contact, version *ContactVersion, editor ContactEditor) error {
+	before := *contact
+	contact.ApplyInput(version.Snapshot)
+	if err := tx.Save(contact).Error; err != nil {
+		return err
+	}
+	_, err := recordContactVersion(tx, &before, contact, editor, &version.Version)
+	return err
+}
+
+func recordContactVersion(tx *gorm.DB, before, after *Contact, editor ContactEditor, revertOf *int) (*ContactVersion, error) {
+	var oldFields map[string]json.RawMessage
+	if before != nil {
+		var err error
+		if oldFields, err = contactFields(before.Input()); err != nil {
+			return nil, err
+		}
+	}
+	newFields, err := contactFields(after.Input())
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]ContactFieldChange{}
+	for field, value := range newFields {
+		old, existed := oldFields[field]
+		if !existed {
+			old = json.RawMessage("null")
+			if isEmptyJSON(value) {
+				continue
+			}
+		}
+		if !bytes.Equal(old, value) {
+			changes[field] = ContactFieldChange{Old: old, New: value}
+		}
+	}
+	if before != nil && len(changes) == 0 {
+		return nil, nil
+	}
+
+	var latest int
+	if err := tx.Model(&ContactVersion{}).Where("contact_id = ?", after.ID).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return nil, fmt.Errorf("failed to read contact history: %w", err)
+	}
+	if latest == 0 && before != nil {
+		initial := ContactVersion{
+			UserID:    after.UserID,
+			ContactID: after.ID,
+			Version:   1,
+			Source:    ContactSourceInitial,
+			Snapshot:  before.Input(),
+		}
+		if err := tx.Create(&initial).Error; err != nil {
+			return nil, fmt.Errorf("failed to record contact history: %w", err)
+		}
+		latest = 1
+	}
+
+	version := ContactVersion{
+		UserID:    after.UserID,
+		ContactID: after.ID,
+		Version:   latest + 1,
+		Source:    editor.Source,
+		Actor:     editor.Actor,
+		Changes:   changes,
+		Snapshot:  after.Input(),
+		RevertOf:  revertOf,
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return nil, fmt.Errorf("failed to record contact history: %w", err)
+	}
+	return &version, nil
+}
+
+// contactFields returns the JSON value of every editable field, keyed by its JSON name
+func contactFields(input ContactInput) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// isEmptyJSON reports whether a JSON value is an empty string, list, object or null
+func isEmptyJSON(value json.RawMessage) bool {
+	switch string(value) {
+	case `""`, `[]`, `{}`, `null`:
+		return true
+	}
+	return false
+}
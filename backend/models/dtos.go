@@ -61,6 +61,13 @@ type CustomFieldNamesInput struct {
 	Names []string `json:"names" validate:"dive,max=100"`
 }
 
+// ReminderScheduleInput represents the DTO for updating when the user's daily reminder email is
+// sent. Empty values fall back to the instance's REMINDER_TIMEZONE and REMINDER_TIME.
+type ReminderScheduleInput struct {
+	Timezone     string `json:"timezone" validate:"omitempty,timezone"`
+	ReminderTime string `json:"reminder_time" validate:"omitempty,datetime=15:04"`
+}
+
 // represents the DTO for updating which extended contact fields are visible in the UI. A nil/absent list means "use the default set"
 type EnabledContactFieldsInput struct {
 	Fields []string `json:"fields" validate:"dive,max=50"`
@@ -108,15 +115,26 @@ type ContactResponse struct {
 	PhotoThumbnail string `json:"photo_thumbnail"`
 }
 
-// Birthday represents a unified birthday entry for contacts and relationships
+// Kinds of dates in the birthday feed
+const (
+	DateKindBirthday    = "birthday"
+	DateKindAnniversary = "anniversary"
+)
+
+// Birthday represents a unified birthday entry for contacts and relationships, or a contact's anniversary
 type Birthday struct {
 	Type                  string `json:"type"`                              // "contact" or "relationship"
+	Kind                  string `json:"kind"`                              // "birthday" or "anniversary"
 	Name                  string `json:"name"`                              // Unified display name
-	Birthday              string `json:"birthday"`                          // Birthday in DD.MM.YYYY or DD.MM. format
+	Birthday              string `json:"birthday"`                          // The date in YYYY-MM-DD or --MM-DD format
 	PhotoThumbnail        string `json:"photo_thumbnail,omitempty"`         // Profile picture thumbnail (base64)
 	ContactID             uint   `json:"contact_id"`                        // Contact ID (the person or parent contact for relationships)
+	RelationshipID        uint   `json:"relationship_id,omitempty"`         // Relationship ID (empty for contacts)
 	RelationshipType      string `json:"relationship_type,omitempty"`       // Relationship type (empty for contacts)
 	AssociatedContactName string `json:"associated_contact_name,omitempty"` // Parent contact name (for relationships)
+	NextDate              string `json:"next_date,omitempty"`               // Next occurrence in YYYY-MM-DD format (upcoming lists only)
+	DaysUntil             int    `json:"days_until"`                        // Days until the next occurrence (upcoming lists only)
+	Years                 *int   `json:"years,omitempty"`                   // Age turned or years marked on the next occurrence, if the year is known
 }
 
 // GraphNode represents a node in the network visualization (contact or activity)
@@ -143,6 +161,18 @@ type GraphResponse struct {
 	Edges []GraphEdge `json:"edges"`
 }
 
+// SearchResult is one hit of the full-text search across contacts, notes and activities.
+// Title and Snippet are HTML-escaped with the matching words wrapped in <mark>.
+type SearchResult struct {
+	Type      string     `json:"type"`                 // "contact", "note" or "activity"
+	ID        uint       `json:"id"`                   // ID of the contact, note or activity
+	Title     string     `json:"title"`                // Contact name, the note's contact or activity title
+	Snippet   string     `json:"snippet"`              // Excerpt around the matches
+	ContactID *uint      `json:"contact_id,omitempty"` // Contact of a note (empty for unassigned notes)
+	Date      *time.Time `json:"date,omitempty"`       // Date of a note or activity
+	Score     float64    `json:"score"`                // Relevance, higher is better; only comparable within one response
+}
+
 // AdminUserResponse - user data returned to admin (no password)
 type AdminUserResponse struct {
 	ID         uint      `json:"id"`
@@ -160,6 +190,8 @@ type CurrentUserResponse struct {
 	AdminUserResponse
 	CustomFieldNames     []string `json:"custom_field_names"`
 	EnabledContactFields []string `json:"enabled_contact_fields"`
+	Timezone             string   `json:"timezone"`
+	ReminderTime         string   `json:"reminder_time"`
 }
 
 // AdminUserUpdateInput - DTO for admin updating a user
@@ -199,11 +231,107 @@ type ApiTokenCreateResponse struct {
 	Token string `json:"token"`
 }
 
+// CardDAVAppPasswordInput represents the DTO for creating a CardDAV app password
+type CardDAVAppPasswordInput struct {
+	Name     string `json:"name" validate:"required,min=1,max=100"`
+	Protocol string `json:"protocol" validate:"omitempty,oneof=carddav caldav"` // defaults to carddav
+}
+
+// CardDAVAppPasswordResponse represents the DTO returned for a CardDAV app password
+type CardDAVAppPasswordResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Protocol   string     `json:"protocol"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// CardDAVAppPasswordCreateResponse is returned on creation and includes the plaintext password
+type CardDAVAppPasswordCreateResponse struct {
+	CardDAVAppPasswordResponse
+	Password string `json:"password"`
+}
+
+// CalendarFeedTokenInput represents the DTO for creating an ICS calendar feed
+type CalendarFeedTokenInput struct {
+	Name string `json:"name" validate:"required,min=1,max=100"`
+}
+
+// CalendarFeedTokenResponse represents the DTO returned for an ICS calendar feed
+type CalendarFeedTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// CalendarFeedTokenCreateResponse is returned on creation and includes the feed's secret path
+type CalendarFeedTokenCreateResponse struct {
+	CalendarFeedTokenResponse
+	Token string `json:"token"`
+	Path  string `json:"path"`
+}
+
+// CardDAVRemoteInput is the DTO for creating/updating a CardDAV remote.
+// An empty password on update keeps the stored one.
+type CardDAVRemoteInput struct {
+	Name            string `json:"name" validate:"required,min=1,max=200"`
+	URL             string `json:"url" validate:"required,http_url"`
+	Username        string `json:"username" validate:"max=200"`
+	Password        string `json:"password" validate:"max=500"`
+	Mode            string `json:"mode" validate:"required,oneof=pull push two_way"`
+	IntervalMinutes int    `json:"interval_minutes" validate:"omitempty,min=15,max=10080"`
+	IsActive        bool   `json:"is_active"`
+}
+
+// CardDAVRemoteResponse is the DTO returned for a CardDAV remote (no password)
+type CardDAVRemoteResponse struct {
+	ID              uint       `json:"id"`
+	Name            string     `json:"name"`
+	URL             string     `json:"url"`
+	Username        string     `json:"username"`
+	Mode            string     `json:"mode"`
+	IntervalMinutes int        `json:"interval_minutes"`
+	IsActive        bool       `json:"is_active"`
+	LastSyncAt      *time.Time `json:"last_sync_at"`
+	LastError       *string    `json:"last_error"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// NotificationChannelInput is the DTO for creating/updating a notification channel.
+// An empty token on update keeps the stored one.
+type NotificationChannelInput struct {
+	Name     string   `json:"name" validate:"required,min=1,max=200"`
+	Type     string   `json:"type" validate:"required,oneof=ntfy gotify apprise matrix webhook"`
+	URL      string   `json:"url" validate:"required,http_url"`
+	Target   string   `json:"target" validate:"required_if=Type ntfy,required_if=Type matrix,max=255"`
+	Token    string   `json:"token" validate:"max=500"`
+	Kinds    []string `json:"kinds" validate:"required,min=1,dive,oneof=reminder birthday overdue"`
+	IsActive bool     `json:"is_active"`
+}
+
+// NotificationChannelResponse is the DTO returned for a notification channel (no token)
+type NotificationChannelResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	URL        string     `json:"url"`
+	Target     string     `json:"target"`
+	HasToken   bool       `json:"has_token"`
+	Kinds      []string   `json:"kinds"`
+	IsActive   bool       `json:"is_active"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	LastError  *string    `json:"last_error"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
 // WebhookInput is the DTO for creating/updating a webhook
 type WebhookInput struct {
 	Name     string   `json:"name" validate:"required,min=1,max=200"`
 	URL      string   `json:"url" validate:"required,http_url"`
-	Events   []string `json:"events" validate:"required,min=1,dive,oneof=contact.created contact.updated contact.deleted note.created note.updated note.deleted activity.created activity.updated activity.deleted reminder.triggered birthday.occurred"`
+	Events   []string `json:"events" validate:"required,min=1,dive,oneof=contact.created contact.updated contact.deleted note.created note.updated note.deleted activity.created activity.updated activity.deleted reminder.triggered reminder.snoozed birthday.occurred"`
 	IsActive bool     `json:"is_active"`
 }
 
@@ -239,3 +367,96 @@ type WebhookDeliveryResponse struct {
 	NextRetryAt *time.Time `json:"next_retry_at"`
 	CreatedAt   time.Time  `json:"created_at"`
 }
+
+// SmartCircleInput is the DTO for creating/updating a smart circle
+type SmartCircleInput struct {
+	Name   string `json:"name" validate:"required,min=1,max=100"`
+	Filter string `json:"filter" validate:"required,min=1,max=2000"`
+}
+
+// SmartCircleResponse is the DTO returned for a smart circle
+type SmartCircleResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Filter    string    `json:"filter"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DuplicateContact summarizes a contact in a duplicate cluster
+type DuplicateContact struct {
+	ID             uint     `json:"id"`
+	Firstname      string   `json:"firstname"`
+	Lastname       string   `json:"lastname"`
+	Nickname       string   `json:"nickname"`
+	Organization   string   `json:"organization"`
+	Emails         []string `json:"emails"`
+	Phones         []string `json:"phones"`
+	Birthday       string   `json:"birthday"`
+	Archived       bool     `json:"archived"`
+	PhotoThumbnail string   `json:"photo_thumbnail,omitempty"`
+}
+
+// DuplicatePair is a scored match between two contacts of a cluster
+type DuplicatePair struct {
+	ContactID      uint     `json:"contact_id"`
+	OtherContactID uint     `json:"other_contact_id"`
+	Score          float64  `json:"score"`
+	Reasons        []string `json:"reasons"` // "email", "phone" and/or "name"
+}
+
+// DuplicateCluster is a group of contacts that probably describe the same person. Score is the
+// best score among its pairs.
+type DuplicateCluster struct {
+	Score    float64            `json:"score"`
+	Contacts []DuplicateContact `json:"contacts"`
+	Pairs    []DuplicatePair    `json:"pairs"`
+}
+
+// MergeContactsInput is the DTO for merging duplicates into a surviving contact
+type MergeContactsInput struct {
+	DuplicateIDs []uint `json:"duplicate_ids" validate:"required,min=1,max=50,dive,gt=0"`
+}
+
+// TrashItem is a soft-deleted record that can be restored from the trash
+type TrashItem struct {
+	Type        string     `json:"type"` // "contact", "note", "activity" or "reminder"
+	ID          uint       `json:"id"`
+	Title       string     `json:"title"`
+	ContactID   *uint      `json:"contact_id,omitempty"`
+	ContactName string     `json:"contact_name,omitempty"`
+	DeletedAt   time.Time  `json:"deleted_at"`
+	PurgeAt     *time.Time `json:"purge_at,omitempty"` // When the item will be deleted for good, unless the trash is kept forever
+}
+
+// TrashPurgeResult counts the items a trash purge deleted for good
+type TrashPurgeResult struct {
+	Contacts   int64 `json:"contacts"`
+	Notes      int64 `json:"notes"`
+	Activities int64 `json:"activities"`
+	Reminders  int64 `json:"reminders"`
+}
+
+// ContactFrequencyInput sets how often the user wants to be in touch with a contact
+type ContactFrequencyInput struct {
+	Days int `json:"days" validate:"min=0,max=3650"` // 0 stops tracking the contact
+}
+
+// OverdueContact is a contact the user has not been in touch with for longer than they wanted to
+type OverdueContact struct {
+	ID                   uint       `json:"id"`
+	Firstname            string     `json:"firstname"`
+	Lastname             string     `json:"lastname"`
+	Nickname             string     `json:"nickname"`
+	PhotoThumbnail       string     `json:"photo_thumbnail,omitempty"`
+	ContactFrequencyDays int        `json:"contact_frequency_days"`
+	LastInteraction      *time.Time `json:"last_interaction"` // Latest past activity, note or reminder completion, if any
+	DueAt                time.Time  `json:"due_at"`
+	DaysOverdue          int        `json:"days_overdue"`
+}
+
+// ReminderSnoozeInput moves a reminder to a later date, either by a number of days or to a date
+type ReminderSnoozeInput struct {
+	Days  int        `json:"days" validate:"required_without=Until,omitempty,min=1,max=365"`
+	Until *time.Time `json:"until" validate:"required_without=Days"`
+}
@@ -22,4 +22,10 @@ type JobExecution struct {
 const (
 	// JobNameDailyReminders is the job name for the daily reminder email job
 	JobNameDailyReminders = "daily_reminders"
+	// JobNameTimedReminders is the job name for sending reminders with a time of day
+	JobNameTimedReminders = "timed_reminders"
+	// JobNameTrashPurge is the job name for deleting expired items from the trash
+	JobNameTrashPurge = "trash_purge"
+	// JobNameCardDAVRemotePrefix is followed by a remote's ID for the lock held while it syncs
+	JobNameCardDAVRemotePrefix = "carddav_remote:"
 )
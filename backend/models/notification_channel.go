@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Backends a notification channel can deliver through
+const (
+	NotificationChannelNtfy    = "ntfy"    // ntfy server; Target is the topic
+	NotificationChannelGotify  = "gotify"  // Gotify server; Token is the application token
+	NotificationChannelApprise = "apprise" // Apprise API notify endpoint, e.g. http://apprise:8000/notify/meerkat
+	NotificationChannelMatrix  = "matrix"  // Matrix homeserver; Target is the room ID, Token the access token
+	NotificationChannelWebhook = "webhook" // Any URL that accepts a JSON POST
+)
+
+// Kinds of notification a channel can be subscribed to
+const (
+	NotificationKindReminder = "reminder" // A reminder is due
+	NotificationKindBirthday = "birthday" // A birthday or anniversary is today
+	NotificationKindOverdue  = "overdue"  // A contact became due for a catch-up
+)
+
+// NotificationChannel is a push service, chat room or endpoint that a user's reminder, birthday
+// and keep-in-touch notifications are sent to, in addition to the daily email
+type NotificationChannel struct {
+	gorm.Model
+	UserID     uint     `gorm:"not null;index"`
+	Name       string   `gorm:"not null"`
+	Type       string   `gorm:"not null"`
+	URL        string   `gorm:"not null"`
+	Target     string   `gorm:"not null;default:''"`
+	Token      string   `gorm:"not null;default:''" json:"-"` // Needed in plaintext to authenticate against the service
+	Kinds      []string `gorm:"type:text;serializer:json"`
+	IsActive   bool     `gorm:"default:true"`
+	LastSentAt *time.Time
+	LastError  *string
+}
+
+// Receives reports whether the channel is subscribed to the given kind of notification
+func (c NotificationChannel) Receives(kind string) bool {
+	for _, k := range c.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,11 @@
 package models
 
 import (
+	"errors"
+	"strings"
 	"time"
 
+	"github.com/teambition/rrule-go"
 	"gorm.io/gorm"
 )
 
@@ -12,11 +15,15 @@ type Reminder struct {
 	Message               string     `gorm:"not null type:text" json:"message" validate:"required,min=1,max=500"`
 	ByMail                *bool      `gorm:"default:false" json:"by_mail"`
 	RemindAt              time.Time  `gorm:"not null" json:"remind_at" validate:"required"`
-	Recurrence            string     `gorm:"not null" json:"recurrence" validate:"required,oneof=once weekly monthly quarterly six-months yearly"`
+	RemindTime            string     `gorm:"not null;default:''" json:"remind_time" validate:"omitempty,datetime=15:04"` // HH:MM in the user's timezone; empty for the daily email
+	Recurrence            string     `gorm:"not null" json:"recurrence" validate:"required,oneof=once weekly monthly quarterly six-months yearly custom"`
+	RecurrenceRule        string     `gorm:"type:text;not null;default:''" json:"recurrence_rule" validate:"required_if=Recurrence custom,max=255,rrule"`
+	RecurrenceStart       *time.Time `json:"recurrence_start,omitempty" validate:"-"` // First occurrence of the rule, set by the server
 	ReoccurFromCompletion *bool      `gorm:"default:true" json:"reoccur_from_completion"`
 	Completed             bool       `gorm:"default:false" json:"completed"`
 	EmailSent             bool       `gorm:"default:false" json:"email_sent"`
 	LastSent              *time.Time `gorm:"default:null" json:"last_sent"`
+	LastTriggered         *time.Time `gorm:"default:null" json:"last_triggered"`
 	ContactID             *uint      `gorm:"not null" json:"contact_id" validate:"required"`
 	Contact               Contact    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"contact,omitempty" validate:"-"`
 }
@@ -29,3 +36,65 @@ type ReminderCompletion struct {
 	Message     string    `gorm:"not null;type:text" json:"message"`
 	CompletedAt time.Time `gorm:"not null" json:"completed_at"`
 }
+
+// ReminderSnooze records on the contact's timeline that a reminder was snoozed to a later date
+type ReminderSnooze struct {
+	gorm.Model
+	UserID           uint      `gorm:"not null;index" json:"-"`
+	ReminderID       *uint     `gorm:"index" json:"reminder_id,omitempty"`
+	ContactID        uint      `gorm:"not null;index" json:"contact_id"`
+	Message          string    `gorm:"not null;type:text" json:"message"`
+	SnoozedAt        time.Time `gorm:"not null" json:"snoozed_at"`
+	PreviousRemindAt time.Time `gorm:"not null" json:"previous_remind_at"`
+	RemindAt         time.Time `gorm:"not null" json:"remind_at"`
+}
+
+// StartRecurrence starts a custom rule on the reminder's date. Reminders with another recurrence
+// have their rule cleared.
+func (r *Reminder) StartRecurrence() {
+	if r.Recurrence != "custom" {
+		r.RecurrenceRule = ""
+		r.RecurrenceStart = nil
+		return
+	}
+	start := r.RemindAt
+	r.RecurrenceStart = &start
+}
+
+// ParseRecurrenceRule parses the RRULE value of a reminder with the "custom" recurrence, e.g.
+// "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU" or "FREQ=MONTHLY;BYDAY=-1FR;COUNT=6". Reminders are due on a
+// day, so rules repeating more often than daily are rejected, as is a DTSTART: the rule starts on
+// the reminder's date.
+func ParseRecurrenceRule(rule string) (*rrule.ROption, error) {
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if strings.ContainsAny(rule, "\r\n") {
+		return nil, errors.New("only a single RRULE is supported")
+	}
+	option, err := rrule.StrToROption(rule)
+	if err != nil {
+		return nil, err
+	}
+	if !option.Dtstart.IsZero() {
+		return nil, errors.New("DTSTART is not supported")
+	}
+	if option.Freq > rrule.DAILY {
+		return nil, errors.New("the rule must repeat daily or less often")
+	}
+	if _, err := rrule.NewRRule(*option); err != nil {
+		return nil, err
+	}
+	// rrule-go accepts rules that match no date at all, such as BYMONTH=2;BYMONTHDAY=30. The
+	// Gregorian calendar repeats every 400 years, so a rule that occurs at all does within that.
+	probe := *option
+	probe.Dtstart = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	probe.Count = 0
+	probe.Until = probe.Dtstart.AddDate(400, 0, 0)
+	probeRule, err := rrule.NewRRule(probe)
+	if err != nil {
+		return nil, err
+	}
+	if probeRule.After(probe.Dtstart, true).IsZero() {
+		return nil, errors.New("the rule never occurs")
+	}
+	return option, nil
+}
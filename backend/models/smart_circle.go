@@ -0,0 +1,36 @@
+package models
+
+import "gorm.io/gorm"
+
+// SmartCircle is a saved contact filter expression, e.g. "NOT activity:<90d". Its members are
+// worked out whenever it is used, so unlike a circle on Contact.Circles it is never stored on the
+// contacts themselves.
+type SmartCircle struct {
+	gorm.Model
+	UserID uint   `gorm:"not null;index"`
+	Name   string `gorm:"not null"`
+	Filter string `gorm:"not null"`
+}
+
+func (SmartCircle) TableName() string {
+	return "smart_circles"
+}
+
+// ListSmartCircles returns the user's smart circles ordered by name
+func ListSmartCircles(db *gorm.DB, userID uint) ([]SmartCircle, error) {
+	var circles []SmartCircle
+	err := db.Where("user_id = ?", userID).Order("name, id").Find(&circles).Error
+	return circles, err
+}
+
+// FindSmartCircle returns the user's smart circle with the given name, or nil if there is none
+func FindSmartCircle(db *gorm.DB, userID uint, name string) (*SmartCircle, error) {
+	var circles []SmartCircle
+	if err := db.Where("user_id = ? AND name = ?", userID, name).Limit(1).Find(&circles).Error; err != nil {
+		return nil, err
+	}
+	if len(circles) == 0 {
+		return nil, nil
+	}
+	return &circles[0], nil
+}
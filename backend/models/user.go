@@ -21,4 +21,7 @@ type User struct {
 	EnabledContactFields     []string   `gorm:"type:text;serializer:json" json:"enabled_contact_fields"`
 	OIDCSubject              *string    `gorm:"column:oidc_subject"`
 	OIDCProvider             *string    `gorm:"column:oidc_provider"`
+	Timezone                 string     `gorm:"not null;default:''" json:"timezone" validate:"omitempty,timezone"`            // IANA name, empty for the instance default
+	ReminderTime             string     `gorm:"not null;default:''" json:"reminder_time" validate:"omitempty,datetime=15:04"` // HH:MM, empty for the instance default
+	ReminderDigestDate       string     `gorm:"not null;default:''" json:"-"`                                                 // User's local date (YYYY-MM-DD) of the last daily reminder email
 }
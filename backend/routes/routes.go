@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"meerkat/caldav"
 	"meerkat/carddav"
 	"meerkat/config"
 	"meerkat/controllers"
@@ -41,6 +42,9 @@ func RegisterRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, oidcPro
 		})
 		v1.POST("/password-reset/confirm", middleware.AuthRateLimitMiddleware(), middleware.ValidateJSONMiddleware(&models.PasswordResetConfirmInput{}), controllers.ConfirmPasswordReset)
 
+		// ICS subscription feed (the secret token in the URL authenticates the request)
+		v1.GET("/calendar-feed/:token", middleware.APIRateLimitMiddleware(), controllers.ServeCalendarFeed)
+
 		// Protected routes (authentication required, general rate limiting)
 		protected := v1.Group("/")
 		protected.Use(middleware.APIRateLimitMiddleware())
@@ -53,19 +57,29 @@ func RegisterRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, oidcPro
 			protected.PATCH("/users/custom-fields", middleware.ValidateJSONMiddleware(&models.CustomFieldNamesInput{}), controllers.UpdateCustomFieldNames)
 			protected.GET("/users/enabled-contact-fields", controllers.GetEnabledContactFields)
 			protected.PATCH("/users/enabled-contact-fields", middleware.ValidateJSONMiddleware(&models.EnabledContactFieldsInput{}), controllers.UpdateEnabledContactFields)
+			protected.PATCH("/users/reminder-schedule", middleware.ValidateJSONMiddleware(&models.ReminderScheduleInput{}), controllers.UpdateReminderSchedule)
 			protected.GET("/users/me", controllers.GetCurrentUser)
 
+			// Full-text search across contacts, notes and activities
+			protected.GET("/search", controllers.Search)
+
 			// Contact routes
 			protected.GET("/contacts", controllers.GetContacts)
 			protected.GET("/contacts/circles", controllers.GetCircles)
 			protected.GET("/contacts/random", controllers.GetContactsRandom)
 			protected.GET("/contacts/birthdays", controllers.GetUpcomingBirthdays)
+			protected.GET("/contacts/duplicates", controllers.GetDuplicateContacts)
+			protected.GET("/contacts/overdue", controllers.GetOverdueContacts)
 			protected.POST("/contacts", middleware.ValidateJSONMiddleware(&models.ContactInput{}), controllers.CreateContact)
 			protected.GET("/contacts/:id", controllers.GetContact)
 			protected.PUT("/contacts/:id", middleware.ValidateJSONMiddleware(&models.ContactInput{}), controllers.UpdateContact)
 			protected.DELETE("/contacts/:id", controllers.DeleteContact)
 			protected.POST("/contacts/:id/archive", controllers.ArchiveContact)
 			protected.POST("/contacts/:id/unarchive", controllers.UnarchiveContact)
+			protected.PUT("/contacts/:id/frequency", middleware.ValidateJSONMiddleware(&models.ContactFrequencyInput{}), controllers.SetContactFrequency)
+			protected.POST("/contacts/:id/merge", middleware.ValidateJSONMiddleware(&models.MergeContactsInput{}), controllers.MergeContacts)
+			protected.GET("/contacts/:id/history", controllers.GetContactHistory)
+			protected.POST("/contacts/:id/history/:version/revert", controllers.RevertContactVersion)
 
 			// Contact import routes (CSV)
 			protected.POST("/contacts/import/upload", controllers.UploadCSVForImport)
@@ -123,6 +137,7 @@ func RegisterRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, oidcPro
 			protected.GET("/reminders/:id", controllers.GetReminder)
 			protected.PUT("/reminders/:id", middleware.ValidateJSONMiddleware(&models.Reminder{}), controllers.UpdateReminder)
 			protected.POST("/reminders/:id/complete", controllers.CompleteReminder)
+			protected.POST("/reminders/:id/snooze", middleware.ValidateJSONMiddleware(&models.ReminderSnoozeInput{}), controllers.SnoozeReminder)
 			protected.DELETE("/reminders/:id", controllers.DeleteReminder)
 
 			// Reminder completion routes (for timeline)
@@ -135,14 +150,52 @@ func RegisterRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, oidcPro
 				controllers.ExportContactsAsVCF(c, cfg.ProfilePhotoDir)
 			})
 
+			// Backup routes (ZIP archive with JSON and photos)
+			protected.GET("/backup", controllers.ExportBackup)
+			protected.POST("/backup/restore", middleware.BodySizeLimitMiddleware(services.MaxBackupSize), controllers.RestoreBackup)
+
 			// Graph/Network visualization route
 			protected.GET("/graph", controllers.GetGraph)
 
+			// Smart circle (saved filter) routes
+			protected.GET("/smart-circles", controllers.ListSmartCircles)
+			protected.POST("/smart-circles", middleware.ValidateJSONMiddleware(&models.SmartCircleInput{}), controllers.CreateSmartCircle)
+			protected.PUT("/smart-circles/:id", middleware.ValidateJSONMiddleware(&models.SmartCircleInput{}), controllers.UpdateSmartCircle)
+			protected.DELETE("/smart-circles/:id", controllers.DeleteSmartCircle)
+
+			// Trash routes
+			protected.GET("/trash", controllers.GetTrash)
+			protected.POST("/trash/:type/:id/restore", controllers.RestoreTrashItem)
+
 			// API token routes
 			protected.GET("/api-tokens", controllers.ListApiTokens)
 			protected.POST("/api-tokens", middleware.ValidateJSONMiddleware(&models.ApiTokenInput{}), controllers.CreateApiToken)
 			protected.DELETE("/api-tokens/:id", controllers.RevokeApiToken)
 
+			// CardDAV app password routes
+			protected.GET("/carddav/app-passwords", controllers.ListCardDAVAppPasswords)
+			protected.POST("/carddav/app-passwords", middleware.ValidateJSONMiddleware(&models.CardDAVAppPasswordInput{}), controllers.CreateCardDAVAppPassword)
+			protected.DELETE("/carddav/app-passwords/:id", controllers.RevokeCardDAVAppPassword)
+
+			// ICS calendar feed routes
+			protected.GET("/calendar-feeds", controllers.ListCalendarFeedTokens)
+			protected.POST("/calendar-feeds", middleware.ValidateJSONMiddleware(&models.CalendarFeedTokenInput{}), controllers.CreateCalendarFeedToken)
+			protected.DELETE("/calendar-feeds/:id", controllers.RevokeCalendarFeedToken)
+
+			// CardDAV remote (outbound sync) routes
+			protected.GET("/carddav/remotes", controllers.ListCardDAVRemotes)
+			protected.POST("/carddav/remotes", middleware.ValidateJSONMiddleware(&models.CardDAVRemoteInput{}), controllers.CreateCardDAVRemote)
+			protected.PUT("/carddav/remotes/:id", middleware.ValidateJSONMiddleware(&models.CardDAVRemoteInput{}), controllers.UpdateCardDAVRemote)
+			protected.DELETE("/carddav/remotes/:id", controllers.DeleteCardDAVRemote)
+			protected.POST("/carddav/remotes/:id/sync", controllers.SyncCardDAVRemoteNow)
+
+			// Notification channel routes
+			protected.GET("/notification-channels", controllers.ListNotificationChannels)
+			protected.POST("/notification-channels", middleware.ValidateJSONMiddleware(&models.NotificationChannelInput{}), controllers.CreateNotificationChannel)
+			protected.PUT("/notification-channels/:id", middleware.ValidateJSONMiddleware(&models.NotificationChannelInput{}), controllers.UpdateNotificationChannel)
+			protected.DELETE("/notification-channels/:id", controllers.DeleteNotificationChannel)
+			protected.POST("/notification-channels/:id/test", controllers.TestNotificationChannel)
+
 			// Webhook routes
 			protected.GET("/webhooks", controllers.ListWebhooks)
 			protected.POST("/webhooks", middleware.ValidateJSONMiddleware(&models.WebhookInput{}), controllers.CreateWebhook)
@@ -173,6 +226,11 @@ func RegisterRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, oidcPro
 	if cfg.CardDAVEnabled {
 		registerCardDAVRoutes(router, cfg, db)
 	}
+
+	// CalDAV routes (optional, enabled via CALDAV_ENABLED)
+	if cfg.CalDAVEnabled {
+		registerCalDAVRoutes(router, cfg, db)
+	}
 }
 
 // registerCardDAVRoutes sets up CardDAV endpoints for contact synchronization
@@ -188,7 +246,7 @@ func registerCardDAVRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB)
 		c.Next()
 	})
 	cardDAVGroup.Use(middleware.CardDAVRateLimitMiddleware())
-	cardDAVGroup.Use(carddav.BasicAuthMiddleware())
+	cardDAVGroup.Use(carddav.BasicAuthMiddleware(models.AppPasswordProtocolCardDAV, cfg.CardDAVAccountPassword))
 	{
 		ginHandler := handler.GinHandler()
 		cardDAVGroup.Any("/*path", ginHandler)
@@ -200,3 +258,28 @@ func registerCardDAVRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB)
 		cardDAVGroup.Handle("MOVE", "/*path", ginHandler)
 	}
 }
+
+// registerCalDAVRoutes sets up CalDAV endpoints for birthdays and reminders.
+// CalDAV shares authentication and rate limits with CardDAV, but only accepts CalDAV app passwords.
+func registerCalDAVRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB) {
+	// Well-known discovery endpoint (no auth required for discovery)
+	router.GET("/.well-known/caldav", caldav.WellKnownRedirect)
+
+	handler := caldav.NewHandler(db)
+
+	calDAVGroup := router.Group("/caldav")
+	calDAVGroup.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Next()
+	})
+	calDAVGroup.Use(middleware.CardDAVRateLimitMiddleware())
+	calDAVGroup.Use(carddav.BasicAuthMiddleware(models.AppPasswordProtocolCalDAV, cfg.CardDAVAccountPassword))
+	{
+		ginHandler := handler.GinHandler()
+		calDAVGroup.Any("/*path", ginHandler)
+		// WebDAV methods required for CalDAV
+		calDAVGroup.Handle("PROPFIND", "/*path", ginHandler)
+		calDAVGroup.Handle("REPORT", "/*path", ginHandler)
+		calDAVGroup.Handle("MKCOL", "/*path", ginHandler)
+	}
+}
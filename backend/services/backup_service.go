@@ -0,0 +1,623 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"meerkat/carddav"
+	"meerkat/i18n"
+	"meerkat/logger"
+	"meerkat/models"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	MaxBackupSize      = 200 * 1024 * 1024 // 200MB, backups include photos
+	maxBackupDataSize  = 100 * 1024 * 1024 // uncompressed data.json
+	maxBackupPhotoSize = 20 * 1024 * 1024  // uncompressed photo file
+
+	backupManifestFile = "manifest.json"
+	backupDataFile     = "data.json"
+	backupPhotoDir     = "photos/"
+)
+
+// ErrInvalidBackup is returned when an uploaded file is not a backup this version can restore
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// WriteBackup writes a ZIP archive with all of a user's data and contact photos to w
+func WriteBackup(db *gorm.DB, userID uint, photoDir string, w io.Writer, now time.Time) error {
+	data, photos, err := collectBackupData(db, userID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	if err := writeBackupJSON(zw, backupManifestFile, models.BackupManifest{
+		Format:    models.BackupFormat,
+		Version:   models.BackupVersion,
+		CreatedAt: now.UTC(),
+	}); err != nil {
+		return err
+	}
+
+	// Photos that went missing on disk are left out rather than failing the whole backup
+	for i := range data.Contacts {
+		filename, ok := photos[data.Contacts[i].ID]
+		if !ok {
+			continue
+		}
+		archivePath := backupPhotoDir + filename
+		if err := copyPhotoToBackup(zw, filepath.Join(photoDir, filename), archivePath); err != nil {
+			logger.Warn().Err(err).Uint("contact_id", data.Contacts[i].ID).Msg("Backup: skipping unreadable contact photo")
+			continue
+		}
+		data.Contacts[i].Photo = archivePath
+	}
+
+	if err := writeBackupJSON(zw, backupDataFile, data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// collectBackupData loads everything a backup contains, along with the photo filename of each
+// contact that has one
+func collectBackupData(db *gorm.DB, userID uint) (models.BackupData, map[uint]string, error) {
+	var data models.BackupData
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return data, nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	data.Settings = models.BackupSettings{
+		Language:             user.Language,
+		DateFormat:           user.DateFormat,
+		CustomFieldNames:     user.CustomFieldNames,
+		EnabledContactFields: user.EnabledContactFields,
+		Timezone:             user.Timezone,
+		ReminderTime:         user.ReminderTime,
+	}
+
+	var contacts []models.Contact
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&contacts).Error; err != nil {
+		return data, nil, fmt.Errorf("failed to load contacts: %w", err)
+	}
+	photos := make(map[uint]string)
+	data.Contacts = make([]models.BackupContact, len(contacts))
+	for i, c := range contacts {
+		data.Contacts[i] = models.BackupContact{
+			ID: c.ID, VCardUID: c.VCardUID,
+			Firstname: c.Firstname, Lastname: c.Lastname, Nickname: c.Nickname,
+			Prefix: c.Prefix, MiddleName: c.MiddleName, Suffix: c.Suffix,
+			Gender: c.Gender, Birthday: c.Birthday, Anniversary: c.Anniversary,
+			Email: c.Email, Phone: c.Phone, Address: c.Address,
+			Emails: c.Emails, Phones: c.Phones, Addresses: c.Addresses, URLs: c.URLs, IMPPs: c.IMPPs,
+			Organization: c.Organization, Department: c.Department, JobTitle: c.JobTitle, Role: c.Role,
+			HowWeMet: c.HowWeMet, FoodPreference: c.FoodPreference,
+			WorkInformation: c.WorkInformation, ContactInformation: c.ContactInformation,
+			Circles: c.Circles, CustomFields: c.CustomFields, Archived: c.Archived, ContactFrequency: c.ContactFrequencyDays,
+			VCardExtra: c.VCardExtra, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt,
+		}
+		if c.Photo != "" {
+			photos[c.ID] = filepath.Base(c.Photo)
+		}
+	}
+
+	var relationships []models.Relationship
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&relationships).Error; err != nil {
+		return data, nil, fmt.Errorf("failed to load relationships: %w", err)
+	}
+	data.Relationships = make([]models.BackupRelationship, len(relationships))
+	for i, r := range relationships {
+		data.Relationships[i] = models.BackupRelationship{
+			ID: r.ID, ContactID: r.ContactID, RelatedContactID: r.RelatedContactID,
+			Name: r.Name, Type: r.Type, Gender: r.Gender, Birthday: r.Birthday,
+			CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt,
+		}
+	}
+
+	var activities []models.Activity
+	if err := db.Preload("Contacts").Where("user_id = ?", userID).Order("id").Find(&activities).Error; err != nil {
+		return data, nil, fmt.Errorf("failed to load activities: %w", err)
+	}
+	data.Activities = make([]models.BackupActivity, len(activities))
+	for i, a := range activities {
+		contactIDs := make([]uint, len(a.Contacts))
+		for j, c := range a.Contacts {
+			contactIDs[j] = c.ID
+		}
+		data.Activities[i] = models.BackupActivity{
+			ID: a.ID, Title: a.Title, Description: a.Description, Location: a.Location,
+			Date: a.Date, ContactIDs: contactIDs, CreatedAt: a.CreatedAt, UpdatedAt: a.UpdatedAt,
+		}
+	}
+
+	var notes []models.Note
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&notes).Error; err != nil {
+		return data, nil, fmt.Errorf("failed to load notes: %w", err)
+	}
+	data.Notes = make([]models.BackupNote, len(notes))
+	for i, n := range notes {
+		data.Notes[i] = models.BackupNote{
+			ID: n.ID, ContactID: n.ContactID, Content: n.Content, Date: n.Date,
+			CreatedAt: n.CreatedAt, UpdatedAt: n.UpdatedAt,
+		}
+	}
+
+	var reminders []models.Reminder
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&reminders).Error; err != nil {
+		return data, nil, fmt.Errorf("failed to load reminders: %w", err)
+	}
+	data.Reminders = make([]models.BackupReminder, len(reminders))
+	for i, r := range reminders {
+		data.Reminders[i] = models.BackupReminder{
+			ID: r.ID, ContactID: r.ContactID, Message: r.Message, ByMail: r.ByMail,
+			RemindAt: r.RemindAt, RemindTime: r.RemindTime, Recurrence: r.Recurrence, ReoccurFromCompletion: r.ReoccurFromCompletion,
+			RecurrenceRule: r.RecurrenceRule, RecurrenceStart: r.RecurrenceStart,
+			Completed: r.Completed, EmailSent: r.EmailSent, LastSent: r.LastSent,
+			CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt,
+		}
+	}
+
+	// Completions and snoozes stay when their contact is moved to the trash, but the contact is not
+	// part of the backup
+	liveContacts := db.Model(&models.Contact{}).Select("id").Where("user_id = ?", userID)
+
+	var completions []models.ReminderCompletion
+	if err := db.Where("user_id = ? AND contact_id IN (?)", userID, liveContacts).Order("id").Find(&completions).Error; err != nil {
+		return data, nil, fmt.Errorf("failed to load reminder completions: %w", err)
+	}
+	data.ReminderCompletions = make([]models.BackupReminderCompletion, len(completions))
+	for i, rc := range completions {
+		data.ReminderCompletions[i] = models.BackupReminderCompletion{
+			ID: rc.ID, ReminderID: rc.ReminderID, ContactID: rc.ContactID,
+			Message: rc.Message, CompletedAt: rc.CompletedAt,
+		}
+	}
+
+	var snoozes []models.ReminderSnooze
+	if err := db.Where("user_id = ? AND contact_id IN (?)", userID, liveContacts).Order("id").Find(&snoozes).Error; err != nil {
+		return data, nil, fmt.Errorf("failed to load reminder snoozes: %w", err)
+	}
+	data.ReminderSnoozes = make([]models.BackupReminderSnooze, len(snoozes))
+	for i, rs := range snoozes {
+		data.ReminderSnoozes[i] = models.BackupReminderSnooze{
+			ID: rs.ID, ReminderID: rs.ReminderID, ContactID: rs.ContactID, Message: rs.Message,
+			SnoozedAt: rs.SnoozedAt, PreviousRemindAt: rs.PreviousRemindAt, RemindAt: rs.RemindAt,
+		}
+	}
+
+	var webhooks []models.Webhook
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&webhooks).Error; err != nil {
+		return data, nil, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	data.Webhooks = make([]models.BackupWebhook, len(webhooks))
+	for i, wh := range webhooks {
+		data.Webhooks[i] = models.BackupWebhook{
+			ID: wh.ID, Name: wh.Name, URL: wh.URL, Events: wh.Events, Secret: wh.Secret, IsActive: wh.IsActive,
+		}
+	}
+
+	smartCircles, err := models.ListSmartCircles(db, userID)
+	if err != nil {
+		return data, nil, fmt.Errorf("failed to load smart circles: %w", err)
+	}
+	data.SmartCircles = make([]models.BackupSmartCircle, len(smartCircles))
+	for i, sc := range smartCircles {
+		data.SmartCircles[i] = models.BackupSmartCircle{ID: sc.ID, Name: sc.Name, Filter: sc.Filter}
+	}
+
+	return data, photos, nil
+}
+
+func writeBackupJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func copyPhotoToBackup(zw *zip.Writer, filePath, archivePath string) error {
+	photo, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	// Photos are JPEGs already, compressing them again gains nothing
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: archivePath, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(photo)
+	return err
+}
+
+// RestoreBackup adds the contents of a backup archive to a user's account. Every record gets a new
+// ID and links between records are remapped, so a backup can be restored into an empty account or
+// next to existing data. The restore is all or nothing.
+func RestoreBackup(db *gorm.DB, userID uint, photoDir string, r io.ReaderAt, size int64) (models.BackupRestoreResult, error) {
+	var result models.BackupRestoreResult
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return result, fmt.Errorf("%w: not a ZIP archive", ErrInvalidBackup)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var manifest models.BackupManifest
+	if err := readBackupJSON(files[backupManifestFile], &manifest, 1024*1024); err != nil {
+		return result, err
+	}
+	if manifest.Format != models.BackupFormat {
+		return result, fmt.Errorf("%w: not a Meerkat backup", ErrInvalidBackup)
+	}
+	if manifest.Version < 1 || manifest.Version > models.BackupVersion {
+		return result, fmt.Errorf("%w: backup version %d is not supported, update Meerkat to restore it", ErrInvalidBackup, manifest.Version)
+	}
+
+	var data models.BackupData
+	if err := readBackupJSON(files[backupDataFile], &data, maxBackupDataSize); err != nil {
+		return result, err
+	}
+	if err := validateBackupData(&data); err != nil {
+		return result, err
+	}
+
+	// Photos are decoded and re-encoded like any upload before the database is touched, and
+	// removed again if the restore fails
+	var savedPhotos []string
+	removePhotos := func() {
+		for _, p := range savedPhotos {
+			os.Remove(filepath.Join(photoDir, p))
+		}
+	}
+	type restoredPhoto struct{ path, thumbnail string }
+	photos := make(map[uint]restoredPhoto)
+	for _, c := range data.Contacts {
+		if c.Photo == "" {
+			continue
+		}
+		photoData, err := readBackupFile(files[c.Photo], maxBackupPhotoSize)
+		if err != nil {
+			removePhotos()
+			return result, err
+		}
+		photoPath, thumbnail, err := carddav.SaveContactPhoto(photoData, "", photoDir)
+		if err != nil {
+			removePhotos()
+			return result, fmt.Errorf("%w: photo %s: %v", ErrInvalidBackup, c.Photo, err)
+		}
+		savedPhotos = append(savedPhotos, photoPath)
+		photos[c.ID] = restoredPhoto{photoPath, thumbnail}
+	}
+	result.Photos = len(savedPhotos)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := restoreSettings(tx, userID, data.Settings); err != nil {
+			return err
+		}
+
+		contactIDs := make(map[uint]uint, len(data.Contacts))
+		for _, bc := range data.Contacts {
+			contact := models.Contact{
+				UserID: userID, VCardUID: bc.VCardUID,
+				Firstname: bc.Firstname, Lastname: bc.Lastname, Nickname: bc.Nickname,
+				Prefix: bc.Prefix, MiddleName: bc.MiddleName, Suffix: bc.Suffix,
+				Gender: bc.Gender, Birthday: bc.Birthday, Anniversary: bc.Anniversary,
+				Email: bc.Email, Phone: bc.Phone, Address: bc.Address,
+				Emails: bc.Emails, Phones: bc.Phones, Addresses: bc.Addresses, URLs: bc.URLs, IMPPs: bc.IMPPs,
+				Organization: bc.Organization, Department: bc.Department, JobTitle: bc.JobTitle, Role: bc.Role,
+				HowWeMet: bc.HowWeMet, FoodPreference: bc.FoodPreference,
+				WorkInformation: bc.WorkInformation, ContactInformation: bc.ContactInformation,
+				Circles: bc.Circles, CustomFields: bc.CustomFields, Archived: bc.Archived, ContactFrequencyDays: bc.ContactFrequency,
+				VCardExtra: bc.VCardExtra,
+			}
+			contact.CreatedAt = bc.CreatedAt
+			contact.UpdatedAt = bc.UpdatedAt
+			if photo, ok := photos[bc.ID]; ok {
+				contact.Photo = photo.path
+				contact.PhotoThumbnail = photo.thumbnail
+			}
+
+			// Restoring next to the original contact (e.g. after a partial mistake) must not
+			// give CardDAV clients two cards with the same UID, so the copy gets a new one
+			if contact.VCardUID != "" {
+				var existing int64
+				if err := tx.Unscoped().Model(&models.Contact{}).
+					Where("user_id = ? AND vcard_uid = ?", userID, contact.VCardUID).
+					Count(&existing).Error; err != nil {
+					return err
+				}
+				if existing > 0 {
+					contact.VCardUID = ""
+				}
+			}
+
+			if err := tx.Create(&contact).Error; err != nil {
+				return err
+			}
+			contactIDs[bc.ID] = contact.ID
+		}
+		result.Contacts = len(contactIDs)
+
+		for _, br := range data.Relationships {
+			rel := models.Relationship{
+				UserID: userID, ContactID: contactIDs[br.ContactID],
+				Name: br.Name, Type: br.Type, Gender: br.Gender, Birthday: br.Birthday,
+			}
+			rel.CreatedAt = br.CreatedAt
+			rel.UpdatedAt = br.UpdatedAt
+			if br.RelatedContactID != nil {
+				if id, ok := contactIDs[*br.RelatedContactID]; ok {
+					rel.RelatedContactID = &id
+				}
+			}
+			if err := tx.Create(&rel).Error; err != nil {
+				return err
+			}
+			result.Relationships++
+		}
+
+		for _, ba := range data.Activities {
+			activity := models.Activity{
+				UserID: userID, Title: ba.Title, Description: ba.Description, Location: ba.Location, Date: ba.Date,
+			}
+			activity.CreatedAt = ba.CreatedAt
+			activity.UpdatedAt = ba.UpdatedAt
+			if err := tx.Create(&activity).Error; err != nil {
+				return err
+			}
+			for _, oldID := range ba.ContactIDs {
+				if err := tx.Exec("INSERT INTO activity_contacts (activity_id, contact_id) VALUES (?, ?)", activity.ID, contactIDs[oldID]).Error; err != nil {
+					return err
+				}
+			}
+			result.Activities++
+		}
+
+		for _, bn := range data.Notes {
+			note := models.Note{UserID: userID, Content: bn.Content, Date: bn.Date}
+			if bn.ContactID != nil {
+				contactID := contactIDs[*bn.ContactID]
+				note.ContactID = &contactID
+			}
+			note.CreatedAt = bn.CreatedAt
+			note.UpdatedAt = bn.UpdatedAt
+			if err := tx.Omit("Contact").Create(&note).Error; err != nil {
+				return err
+			}
+			result.Notes++
+		}
+
+		reminderIDs := make(map[uint]uint, len(data.Reminders))
+		for _, br := range data.Reminders {
+			contactID := contactIDs[*br.ContactID]
+			reminder := models.Reminder{
+				UserID: userID, ContactID: &contactID, Message: br.Message, ByMail: br.ByMail,
+				RemindAt: br.RemindAt, RemindTime: br.RemindTime, Recurrence: br.Recurrence, ReoccurFromCompletion: br.ReoccurFromCompletion,
+				RecurrenceRule: br.RecurrenceRule, RecurrenceStart: br.RecurrenceStart,
+				Completed: br.Completed, EmailSent: br.EmailSent, LastSent: br.LastSent,
+			}
+			reminder.CreatedAt = br.CreatedAt
+			reminder.UpdatedAt = br.UpdatedAt
+			if err := tx.Omit("Contact").Create(&reminder).Error; err != nil {
+				return err
+			}
+			reminderIDs[br.ID] = reminder.ID
+		}
+		result.Reminders = len(reminderIDs)
+
+		for _, bc := range data.ReminderCompletions {
+			contactID, ok := contactIDs[bc.ContactID]
+			if !ok {
+				// Older backups include the history of contacts that were in the trash
+				continue
+			}
+			completion := models.ReminderCompletion{
+				UserID: userID, ContactID: contactID, Message: bc.Message, CompletedAt: bc.CompletedAt,
+			}
+			if bc.ReminderID != nil {
+				if id, ok := reminderIDs[*bc.ReminderID]; ok {
+					completion.ReminderID = &id
+				}
+			}
+			if err := tx.Create(&completion).Error; err != nil {
+				return err
+			}
+			result.ReminderCompletions++
+		}
+
+		for _, bs := range data.ReminderSnoozes {
+			contactID, ok := contactIDs[bs.ContactID]
+			if !ok {
+				continue
+			}
+			snooze := models.ReminderSnooze{
+				UserID: userID, ContactID: contactID, Message: bs.Message,
+				SnoozedAt: bs.SnoozedAt, PreviousRemindAt: bs.PreviousRemindAt, RemindAt: bs.RemindAt,
+			}
+			if bs.ReminderID != nil {
+				if id, ok := reminderIDs[*bs.ReminderID]; ok {
+					snooze.ReminderID = &id
+				}
+			}
+			if err := tx.Create(&snooze).Error; err != nil {
+				return err
+			}
+			result.ReminderSnoozes++
+		}
+
+		for _, bw := range data.Webhooks {
+			webhook := models.Webhook{UserID: userID, Name: bw.Name, URL: bw.URL, Events: bw.Events, Secret: bw.Secret, IsActive: true}
+			if err := tx.Create(&webhook).Error; err != nil {
+				return err
+			}
+			// IsActive defaults to true, so an inactive webhook has to be switched off explicitly
+			if !bw.IsActive {
+				if err := tx.Model(&webhook).Update("is_active", false).Error; err != nil {
+					return err
+				}
+			}
+			result.Webhooks++
+		}
+
+		// Smart circles are looked up by name, so one that already exists is kept as it is
+		for _, bs := range data.SmartCircles {
+			existing, err := models.FindSmartCircle(tx, userID, bs.Name)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				continue
+			}
+			if err := tx.Create(&models.SmartCircle{UserID: userID, Name: bs.Name, Filter: bs.Filter}).Error; err != nil {
+				return err
+			}
+			result.SmartCircles++
+		}
+
+		return nil
+	})
+	if err != nil {
+		removePhotos()
+		return models.BackupRestoreResult{}, fmt.Errorf("failed to restore backup: %w", err)
+	}
+
+	return result, nil
+}
+
+func isValidTimezone(name string) bool {
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// restoreSettings applies a backup's preferences. Custom field names are merged with the existing
+// ones so that custom fields of contacts already in the account stay visible.
+func restoreSettings(tx *gorm.DB, userID uint, settings models.BackupSettings) error {
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	var columns []string
+	if slices.Contains(i18n.SupportedLanguages, settings.Language) {
+		user.Language = settings.Language
+		columns = append(columns, "language")
+	}
+	if settings.DateFormat == "eu" || settings.DateFormat == "us" {
+		user.DateFormat = settings.DateFormat
+		columns = append(columns, "date_format")
+	}
+	if settings.Timezone != "" && settings.Timezone != "Local" && isValidTimezone(settings.Timezone) {
+		user.Timezone = settings.Timezone
+		columns = append(columns, "timezone")
+	}
+	if _, err := time.Parse("15:04", settings.ReminderTime); err == nil {
+		user.ReminderTime = settings.ReminderTime
+		columns = append(columns, "reminder_time")
+	}
+	if settings.EnabledContactFields != nil {
+		user.EnabledContactFields = settings.EnabledContactFields
+		columns = append(columns, "enabled_contact_fields")
+	}
+	added := false
+	for _, name := range settings.CustomFieldNames {
+		if !slices.Contains(user.CustomFieldNames, name) {
+			user.CustomFieldNames = append(user.CustomFieldNames, name)
+			added = true
+		}
+	}
+	if added {
+		columns = append(columns, "custom_field_names")
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	return tx.Model(&user).Select(columns).Updates(&user).Error
+}
+
+// validateBackupData checks that every link in a backup points at a record in it, so the restore
+// cannot attach data to contacts of the account it is restored into
+func validateBackupData(data *models.BackupData) error {
+	contacts := make(map[uint]bool, len(data.Contacts))
+	for _, c := range data.Contacts {
+		if c.Firstname == "" {
+			return fmt.Errorf("%w: contact %d has no first name", ErrInvalidBackup, c.ID)
+		}
+		if c.Photo != "" && (path.Dir(c.Photo)+"/" != backupPhotoDir) {
+			return fmt.Errorf("%w: contact %d has an invalid photo path", ErrInvalidBackup, c.ID)
+		}
+		contacts[c.ID] = true
+	}
+	for _, r := range data.Relationships {
+		if !contacts[r.ContactID] {
+			return fmt.Errorf("%w: relationship %d refers to unknown contact %d", ErrInvalidBackup, r.ID, r.ContactID)
+		}
+	}
+	for _, a := range data.Activities {
+		for _, id := range a.ContactIDs {
+			if !contacts[id] {
+				return fmt.Errorf("%w: activity %d refers to unknown contact %d", ErrInvalidBackup, a.ID, id)
+			}
+		}
+	}
+	for _, n := range data.Notes {
+		// Notes without a contact are unassigned notes
+		if n.ContactID != nil && !contacts[*n.ContactID] {
+			return fmt.Errorf("%w: note %d refers to unknown contact %d", ErrInvalidBackup, n.ID, *n.ContactID)
+		}
+	}
+	for _, r := range data.Reminders {
+		if r.ContactID == nil || !contacts[*r.ContactID] {
+			return fmt.Errorf("%w: reminder %d refers to an unknown contact", ErrInvalidBackup, r.ID)
+		}
+	}
+	return nil
+}
+
+func readBackupJSON(f *zip.File, v any, limit int64) error {
+	raw, err := readBackupFile(f, limit)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidBackup, f.Name, err)
+	}
+	return nil
+}
+
+// readBackupFile reads a file from the archive, refusing files that decompress to more than limit
+// bytes
+func readBackupFile(f *zip.File, limit int64) ([]byte, error) {
+	if f == nil {
+		return nil, fmt.Errorf("%w: archive is incomplete", ErrInvalidBackup)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBackup, f.Name, err)
+	}
+	defer rc.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBackup, f.Name, err)
+	}
+	if int64(len(raw)) > limit {
+		return nil, fmt.Errorf("%w: %s is too large", ErrInvalidBackup, f.Name)
+	}
+	return raw, nil
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"meerkat/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func seedBackupUser(t *testing.T, db *gorm.DB, photoDir string) models.User {
+	t.Helper()
+
+	user := models.User{Username: "source", Password: "x", Email: "source@example.com", Language: "de", CustomFieldNames: []string{"Shoe size"}}
+	require.NoError(t, db.Create(&user).Error)
+
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	img.Set(1, 1, color.White)
+	var photo bytes.Buffer
+	require.NoError(t, jpeg.Encode(&photo, img, nil))
+	require.NoError(t, os.WriteFile(filepath.Join(photoDir, "alice_photo.jpg"), photo.Bytes(), 0o644))
+
+	alice := models.Contact{UserID: user.ID, Firstname: "Alice", Photo: "alice_photo.jpg", Circles: []string{"Friends"}, CustomFields: map[string]string{"Shoe size": "38"}}
+	bob := models.Contact{UserID: user.ID, Firstname: "Bob", Archived: true}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+
+	require.NoError(t, db.Create(&models.Relationship{UserID: user.ID, ContactID: alice.ID, RelatedContactID: &bob.ID, Name: "Bob", Type: "Brother"}).Error)
+	activity := models.Activity{UserID: user.ID, Title: "Hiking", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+	require.NoError(t, db.Create(&activity).Error)
+	require.NoError(t, db.Model(&activity).Association("Contacts").Append([]models.Contact{alice, bob}))
+	require.NoError(t, db.Create(&models.Note{UserID: user.ID, ContactID: &alice.ID, Content: "Likes tea", Date: time.Now()}).Error)
+	require.NoError(t, db.Create(&models.Note{UserID: user.ID, Content: "Unassigned", Date: time.Now()}).Error)
+	reminder := models.Reminder{UserID: user.ID, ContactID: &bob.ID, Message: "Call", Recurrence: "monthly", RemindAt: time.Now()}
+	require.NoError(t, db.Create(&reminder).Error)
+	require.NoError(t, db.Create(&models.ReminderCompletion{UserID: user.ID, ReminderID: &reminder.ID, ContactID: bob.ID, Message: "Call", CompletedAt: time.Now()}).Error)
+	// The history of a contact in the trash is not part of the backup
+	carol := models.Contact{UserID: user.ID, Firstname: "Carol"}
+	require.NoError(t, db.Create(&carol).Error)
+	require.NoError(t, db.Create(&models.ReminderCompletion{UserID: user.ID, ContactID: carol.ID, Message: "Visit", CompletedAt: time.Now()}).Error)
+	require.NoError(t, db.Create(&models.ReminderSnooze{UserID: user.ID, ContactID: carol.ID, Message: "Visit", SnoozedAt: time.Now(), PreviousRemindAt: time.Now(), RemindAt: time.Now()}).Error)
+	require.NoError(t, db.Delete(&carol).Error)
+	webhook := models.Webhook{UserID: user.ID, Name: "Hook", URL: "https://example.com/hook", Events: []string{"contact.created"}, Secret: "s3cret"}
+	require.NoError(t, db.Create(&webhook).Error)
+	require.NoError(t, db.Model(&webhook).Update("is_active", false).Error)
+	require.NoError(t, db.Create(&models.SmartCircle{UserID: user.ID, Name: "Quiet", Filter: "NOT activity:<90d"}).Error)
+
+	return user
+}
+
+func TestBackup_RoundTripIntoOtherAccount(t *testing.T) {
+	db, _ := setupRouter()
+	require.NoError(t, db.AutoMigrate(&models.ReminderCompletion{}))
+	photoDir := t.TempDir()
+	source := seedBackupUser(t, db, photoDir)
+
+	var archive bytes.Buffer
+	require.NoError(t, WriteBackup(db, source.ID, photoDir, &archive, time.Now()))
+
+	target := models.User{Username: "target", Password: "x", Email: "target@example.com", CustomFieldNames: []string{"Pets"}}
+	require.NoError(t, db.Create(&target).Error)
+
+	restoreDir := t.TempDir()
+	result, err := RestoreBackup(db, target.ID, restoreDir, bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, models.BackupRestoreResult{
+		Contacts: 2, Relationships: 1, Activities: 1, Notes: 2, Reminders: 1, ReminderCompletions: 1, Webhooks: 1, SmartCircles: 1, Photos: 1,
+	}, result)
+
+	var contacts []models.Contact
+	require.NoError(t, db.Where("user_id = ?", target.ID).Order("id").Find(&contacts).Error)
+	require.Len(t, contacts, 2)
+	alice, bob := contacts[0], contacts[1]
+	assert.Equal(t, []string{"Friends"}, alice.Circles)
+	assert.Equal(t, "38", alice.CustomFields["Shoe size"])
+	assert.True(t, bob.Archived)
+	assert.NotEmpty(t, alice.PhotoThumbnail)
+	assert.FileExists(t, filepath.Join(restoreDir, alice.Photo))
+
+	// Links point at the restored records, not the originals
+	var rel models.Relationship
+	require.NoError(t, db.Where("user_id = ?", target.ID).First(&rel).Error)
+	assert.Equal(t, alice.ID, rel.ContactID)
+	require.NotNil(t, rel.RelatedContactID)
+	assert.Equal(t, bob.ID, *rel.RelatedContactID)
+
+	var activity models.Activity
+	require.NoError(t, db.Preload("Contacts").Where("user_id = ?", target.ID).First(&activity).Error)
+	assert.Len(t, activity.Contacts, 2)
+
+	var unassigned models.Note
+	require.NoError(t, db.Where("user_id = ? AND content = ?", target.ID, "Unassigned").First(&unassigned).Error)
+	assert.Nil(t, unassigned.ContactID)
+
+	var reminder models.Reminder
+	require.NoError(t, db.Where("user_id = ?", target.ID).First(&reminder).Error)
+	assert.Equal(t, bob.ID, *reminder.ContactID)
+	var completion models.ReminderCompletion
+	require.NoError(t, db.Where("user_id = ?", target.ID).First(&completion).Error)
+	assert.Equal(t, reminder.ID, *completion.ReminderID)
+
+	var webhook models.Webhook
+	require.NoError(t, db.Where("user_id = ?", target.ID).First(&webhook).Error)
+	assert.False(t, webhook.IsActive)
+	assert.Equal(t, "s3cret", webhook.Secret)
+
+	smartCircles, err := models.ListSmartCircles(db, target.ID)
+	require.NoError(t, err)
+	require.Len(t, smartCircles, 1)
+	assert.Equal(t, "NOT activity:<90d", smartCircles[0].Filter)
+
+	var reloaded models.User
+	require.NoError(t, db.First(&reloaded, target.ID).Error)
+	assert.Equal(t, "de", reloaded.Language)
+	assert.Equal(t, []string{"Pets", "Shoe size"}, reloaded.CustomFieldNames)
+}
+
+func TestBackup_RestoreNextToOriginalsGetsNewUIDs(t *testing.T) {
+	db, _ := setupRouter()
+	require.NoError(t, db.AutoMigrate(&models.ReminderCompletion{}))
+	photoDir := t.TempDir()
+	user := seedBackupUser(t, db, photoDir)
+
+	var archive bytes.Buffer
+	require.NoError(t, WriteBackup(db, user.ID, photoDir, &archive, time.Now()))
+	result, err := RestoreBackup(db, user.ID, photoDir, bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	require.NoError(t, err)
+	assert.Zero(t, result.SmartCircles) // kept, since one with that name exists
+
+	var uids []string
+	require.NoError(t, db.Model(&models.Contact{}).Where("user_id = ?", user.ID).Distinct().Pluck("vcard_uid", &uids).Error)
+	assert.Len(t, uids, 4)
+}
+
+func TestBackup_RestoreSkipsHistoryOfMissingContacts(t *testing.T) {
+	db, _ := setupRouter()
+	require.NoError(t, db.AutoMigrate(&models.ReminderCompletion{}))
+	user := models.User{Username: "u", Password: "x", Email: "u@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+
+	// Backups made before trashed contacts were left out still list their completions and snoozes
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, v := range map[string]any{
+		"manifest.json": models.BackupManifest{Format: models.BackupFormat, Version: models.BackupVersion},
+		"data.json": models.BackupData{
+			Contacts:            []models.BackupContact{{ID: 1, Firstname: "Alice"}},
+			ReminderCompletions: []models.BackupReminderCompletion{{ID: 1, ContactID: 1, Message: "Call"}, {ID: 2, ContactID: 2, Message: "Visit"}},
+			ReminderSnoozes:     []models.BackupReminderSnooze{{ID: 1, ContactID: 2, Message: "Visit"}},
+		},
+	} {
+		f, _ := zw.Create(name)
+		require.NoError(t, json.NewEncoder(f).Encode(v))
+	}
+	require.NoError(t, zw.Close())
+
+	result, err := RestoreBackup(db, user.ID, t.TempDir(), bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.ReminderCompletions)
+	assert.Zero(t, result.ReminderSnoozes)
+}
+
+func TestBackup_RejectsInvalidArchives(t *testing.T) {
+	db, _ := setupRouter()
+	user := models.User{Username: "u", Password: "x", Email: "u@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+
+	archive := func(manifest models.BackupManifest, data models.BackupData) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, v := range map[string]any{"manifest.json": manifest, "data.json": data} {
+			f, _ := zw.Create(name)
+			require.NoError(t, json.NewEncoder(f).Encode(v))
+		}
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+	valid := models.BackupManifest{Format: models.BackupFormat, Version: models.BackupVersion}
+	contactID := uint(7)
+
+	cases := map[string][]byte{
+		"not a zip":     []byte("hello"),
+		"newer version": archive(models.BackupManifest{Format: models.BackupFormat, Version: models.BackupVersion + 1}, models.BackupData{}),
+		"dangling note": archive(valid, models.BackupData{Notes: []models.BackupNote{{ID: 1, ContactID: &contactID, Content: "x"}}}),
+		"missing photo": archive(valid, models.BackupData{Contacts: []models.BackupContact{{ID: 1, Firstname: "A", Photo: "photos/a.jpg"}}}),
+	}
+	for name, raw := range cases {
+		_, err := RestoreBackup(db, user.ID, t.TempDir(), bytes.NewReader(raw), int64(len(raw)))
+		assert.ErrorIs(t, err, ErrInvalidBackup, name)
+	}
+
+	var count int64
+	db.Model(&models.Contact{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Zero(t, count)
+}
@@ -4,77 +4,159 @@ import (
 	"fmt"
 	"meerkat/models"
 	"slices"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
-// GetUpcomingBirthdays fetches upcoming birthdays for a specific user
-// Returns birthdays sorted by days until birthday, with smart limits
+// DefaultUpcomingDays is how far ahead GetUpcomingBirthdays looks
+const DefaultUpcomingDays = 60
+
+// GetUpcomingBirthdays fetches upcoming birthdays and anniversaries for a specific user
+// Returns them sorted by days until the date, with smart limits: max 5, but all within 2 weeks
 func GetUpcomingBirthdays(db *gorm.DB, userID uint, now time.Time) ([]models.Birthday, error) {
-	currentDay := now.Format("02")
-	currentMonth := now.Format("01")
-	// Use first day of next month to avoid overflow when current day doesn't exist in next month
-	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()).Format("01")
+	birthdays, err := ListUpcomingDates(db, userID, now, DefaultUpcomingDays)
+	if err != nil {
+		return nil, err
+	}
 
-	var birthdays []models.Birthday
+	const maxResults = 5
+	const twoWeeksDays = 14
 
-	// Query upcoming contact birthdays
-	// Birthday format is now YYYY-MM-DD or --MM-DD (ISO 8601)
-	// Month is at position LENGTH-4 (2 chars), Day is at position LENGTH-1 (2 chars)
-	var contacts []models.Contact
-	contactQuery := db.Model(&models.Contact{}).
-		Where("user_id = ?", userID).
-		Where("archived = ?", false).
-		Where("birthday IS NOT NULL AND birthday != ''").
-		Where(
-			db.Where("SUBSTR(birthday, LENGTH(birthday) - 4, 2) = ? AND SUBSTR(birthday, LENGTH(birthday) - 1, 2) >= ?", currentMonth, currentDay).
-				Or("SUBSTR(birthday, LENGTH(birthday) - 4, 2) = ?", nextMonth),
-		)
+	resultCount := 0
+	for i, b := range birthdays {
+		if b.DaysUntil <= twoWeeksDays || resultCount < maxResults {
+			resultCount = i + 1
+		} else {
+			break
+		}
+	}
+	return birthdays[:resultCount], nil
+}
 
-	if err := contactQuery.Find(&contacts).Error; err != nil {
-		return nil, fmt.Errorf("failed to retrieve upcoming birthdays: %w", err)
+// ListUpcomingDates returns the birthdays and anniversaries of a user's contacts, and the birthdays
+// of their relationships, that fall within the given number of days from now (0 is today only).
+// Each comes with the date of its next occurrence and, if the year is known, the age or number
+// of years it marks. They are sorted by date, then by name.
+func ListUpcomingDates(db *gorm.DB, userID uint, now time.Time, days int) ([]models.Birthday, error) {
+	birthdays, err := ListBirthdays(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	anniversaries, err := listAnniversaries(db, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Convert contacts to Birthday DTOs
-	for _, contact := range contacts {
-		name := contact.Firstname
-		if contact.Nickname != "" {
-			name = contact.Nickname
+	upcoming := []models.Birthday{}
+	for _, date := range append(birthdays, anniversaries...) {
+		next, ok := NextOccurrence(date.Birthday, now)
+		if !ok {
+			continue
 		}
-		if contact.Lastname != "" {
-			name += " " + contact.Lastname
+		date.DaysUntil = daysBetween(now, next)
+		if date.DaysUntil > days {
+			continue
 		}
+		date.NextDate = next.Format("2006-01-02")
+		if since, ok := parseAnnualDate(date.Birthday); ok && hasYear(date.Birthday) && next.Year() > since.Year() {
+			years := next.Year() - since.Year()
+			date.Years = &years
+		}
+		upcoming = append(upcoming, date)
+	}
 
-		birthdays = append(birthdays, models.Birthday{
-			Type:           "contact",
-			Name:           name,
-			Birthday:       contact.Birthday,
-			PhotoThumbnail: contact.PhotoThumbnail,
-			ContactID:      contact.ID,
-		})
+	slices.SortStableFunc(upcoming, func(a, b models.Birthday) int {
+		if a.DaysUntil != b.DaysUntil {
+			return a.DaysUntil - b.DaysUntil
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return upcoming, nil
+}
+
+// ListBirthdays returns every birthday of a user's contacts and of their relationships that have no
+// contact of their own, regardless of date and unsorted. Archived contacts are left out.
+func ListBirthdays(db *gorm.DB, userID uint) ([]models.Birthday, error) {
+	var contacts []models.Contact
+	if err := db.Where("user_id = ? AND archived = ?", userID, false).
+		Where("birthday IS NOT NULL AND birthday != ''").
+		Find(&contacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve birthdays: %w", err)
+	}
+
+	birthdays := make([]models.Birthday, 0, len(contacts))
+	for _, contact := range contacts {
+		birthdays = append(birthdays, contactBirthday(contact))
 	}
 
-	// Query upcoming relationship birthdays (only those without their own contact)
-	// Exclude relationships whose parent contact is archived
-	// Birthday format is now YYYY-MM-DD or --MM-DD (ISO 8601)
 	var relationships []models.Relationship
-	relationshipQuery := db.Model(&models.Relationship{}).
+	if err := db.Model(&models.Relationship{}).
 		Joins("JOIN contacts ON contacts.id = relationships.contact_id AND contacts.archived = ?", false).
-		Preload("RelatedContact").
 		Where("relationships.user_id = ?", userID).
 		Where("related_contact_id IS NULL").
 		Where("relationships.birthday IS NOT NULL AND relationships.birthday != ''").
-		Where(
-			db.Where("SUBSTR(relationships.birthday, LENGTH(relationships.birthday) - 4, 2) = ? AND SUBSTR(relationships.birthday, LENGTH(relationships.birthday) - 1, 2) >= ?", currentMonth, currentDay).
-				Or("SUBSTR(relationships.birthday, LENGTH(relationships.birthday) - 4, 2) = ?", nextMonth),
-		)
-
-	if err := relationshipQuery.Find(&relationships).Error; err != nil {
+		Find(&relationships).Error; err != nil {
 		return nil, fmt.Errorf("failed to retrieve relationship birthdays: %w", err)
 	}
 
-	// Get parent contacts for relationships
+	relBirthdays, err := relationshipBirthdays(db, relationships)
+	if err != nil {
+		return nil, err
+	}
+	return append(birthdays, relBirthdays...), nil
+}
+
+// ContactDisplayName is the name birthdays are listed under: the nickname if set, then the last name
+func ContactDisplayName(contact models.Contact) string {
+	name := contact.Firstname
+	if contact.Nickname != "" {
+		name = contact.Nickname
+	}
+	if contact.Lastname != "" {
+		name += " " + contact.Lastname
+	}
+	return name
+}
+
+// listAnniversaries returns the anniversaries of a user's contacts as entries of the birthday feed.
+// Archived contacts are left out.
+func listAnniversaries(db *gorm.DB, userID uint) ([]models.Birthday, error) {
+	var contacts []models.Contact
+	if err := db.Where("user_id = ? AND archived = ?", userID, false).
+		Where("anniversary IS NOT NULL AND anniversary != ''").
+		Find(&contacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve anniversaries: %w", err)
+	}
+
+	anniversaries := make([]models.Birthday, 0, len(contacts))
+	for _, contact := range contacts {
+		anniversaries = append(anniversaries, models.Birthday{
+			Type:           "contact",
+			Kind:           models.DateKindAnniversary,
+			Name:           ContactDisplayName(contact),
+			Birthday:       contact.Anniversary,
+			PhotoThumbnail: contact.PhotoThumbnail,
+			ContactID:      contact.ID,
+		})
+	}
+	return anniversaries, nil
+}
+
+func contactBirthday(contact models.Contact) models.Birthday {
+	return models.Birthday{
+		Type:           "contact",
+		Kind:           models.DateKindBirthday,
+		Name:           ContactDisplayName(contact),
+		Birthday:       contact.Birthday,
+		PhotoThumbnail: contact.PhotoThumbnail,
+		ContactID:      contact.ID,
+	}
+}
+
+// relationshipBirthdays converts relationships to Birthday DTOs, loading their parent contacts
+func relationshipBirthdays(db *gorm.DB, relationships []models.Relationship) ([]models.Birthday, error) {
 	contactIDs := make([]uint, 0, len(relationships))
 	for _, rel := range relationships {
 		contactIDs = append(contactIDs, rel.ContactID)
@@ -91,83 +173,65 @@ func GetUpcomingBirthdays(db *gorm.DB, userID uint, now time.Time) ([]models.Bir
 		}
 	}
 
-	// Convert relationships to Birthday DTOs
+	birthdays := make([]models.Birthday, 0, len(relationships))
 	for _, rel := range relationships {
 		parentContact := parentContacts[rel.ContactID]
-		parentName := parentContact.Firstname
-		if parentContact.Nickname != "" {
-			parentName = parentContact.Nickname
-		}
-		if parentContact.Lastname != "" {
-			parentName += " " + parentContact.Lastname
-		}
-
 		birthdays = append(birthdays, models.Birthday{
 			Type:                  "relationship",
+			Kind:                  models.DateKindBirthday,
 			Name:                  rel.Name,
 			Birthday:              rel.Birthday,
 			PhotoThumbnail:        parentContact.PhotoThumbnail,
 			ContactID:             rel.ContactID,
+			RelationshipID:        rel.ID,
 			RelationshipType:      rel.Type,
-			AssociatedContactName: parentName,
+			AssociatedContactName: ContactDisplayName(parentContact),
 		})
 	}
-
-	// Sort by days until birthday
-	slices.SortFunc(birthdays, func(a, b models.Birthday) int {
-		daysA := DaysUntilBirthday(a.Birthday, now)
-		daysB := DaysUntilBirthday(b.Birthday, now)
-		return daysA - daysB
-	})
-
-	// Apply limit: max 5, but include all birthdays within 2 weeks
-	const maxResults = 5
-	const twoWeeksDays = 14
-
-	resultCount := 0
-	for i, b := range birthdays {
-		days := DaysUntilBirthday(b.Birthday, now)
-		if days <= twoWeeksDays {
-			resultCount = i + 1
-		} else if resultCount < maxResults {
-			resultCount = i + 1
-		} else {
-			break
-		}
-	}
-
-	if resultCount < len(birthdays) {
-		birthdays = birthdays[:resultCount]
-	}
-
 	return birthdays, nil
 }
 
 // DaysUntilBirthday calculates the number of days until a birthday from a given date
 // Birthday format is YYYY-MM-DD or --MM-DD (ISO 8601)
 func DaysUntilBirthday(birthday string, now time.Time) int {
-	if len(birthday) < 7 {
+	next, ok := NextOccurrence(birthday, now)
+	if !ok {
 		return 999
 	}
+	return daysBetween(now, next)
+}
 
-	// Extract month and day from end of string (works for both YYYY-MM-DD and --MM-DD)
-	// Month is at position len-5 to len-3, Day is at position len-2 to len
-	length := len(birthday)
-	month := birthday[length-5 : length-3]
-	day := birthday[length-2 : length]
-
-	d, err1 := time.Parse("02", day)
-	m, err2 := time.Parse("01", month)
-	if err1 != nil || err2 != nil {
-		return 999
+// NextOccurrence returns the next date, today included, on which a yearly date such as a birthday
+// (YYYY-MM-DD or --MM-DD) falls. February 29 falls on February 28 in other years.
+func NextOccurrence(date string, now time.Time) (time.Time, bool) {
+	annual, ok := parseAnnualDate(date)
+	if !ok {
+		return time.Time{}, false
 	}
 
-	birthdayThisYear := time.Date(now.Year(), m.Month(), d.Day(), 0, 0, 0, 0, now.Location())
-	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	next := occurrenceIn(annual, today.Year())
+	if next.Before(today) {
+		next = occurrenceIn(annual, today.Year()+1)
+	}
+	return next, true
+}
 
-	if birthdayThisYear.Before(today) {
-		birthdayThisYear = birthdayThisYear.AddDate(1, 0, 0)
+// occurrenceIn places a yearly date in the given year
+func occurrenceIn(date time.Time, year int) time.Time {
+	day := date.Day()
+	if date.Month() == time.February && day == 29 && !isLeapYear(year) {
+		day = 28
 	}
+	return time.Date(year, date.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
 
-	return int(birthdayThisYear.Sub(today).Hours() / 24)
+// daysBetween counts the calendar days from now's date to the given UTC date
+func daysBetween(now, date time.Time) int {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return int(date.Sub(today).Hours() / 24)
 }
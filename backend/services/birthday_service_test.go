@@ -0,0 +1,85 @@
+package services
+
+import (
+	"meerkat/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	tests := []struct {
+		date string
+		now  time.Time
+		want string
+	}{
+		{"1990-03-10", time.Date(2030, 3, 1, 12, 0, 0, 0, time.UTC), "2030-03-10"},
+		{"1990-03-10", time.Date(2030, 3, 10, 23, 0, 0, 0, time.UTC), "2030-03-10"},
+		{"--01-05", time.Date(2030, 3, 1, 12, 0, 0, 0, time.UTC), "2031-01-05"},
+		// February 29 falls on the 28th outside leap years
+		{"2000-02-29", time.Date(2030, 2, 1, 12, 0, 0, 0, time.UTC), "2030-02-28"},
+		{"--02-29", time.Date(2031, 3, 1, 12, 0, 0, 0, time.UTC), "2032-02-29"},
+	}
+	for _, tt := range tests {
+		next, ok := NextOccurrence(tt.date, tt.now)
+		require.True(t, ok, tt.date)
+		assert.Equal(t, tt.want, next.Format("2006-01-02"), tt.date)
+	}
+
+	_, ok := NextOccurrence("someday", time.Now())
+	assert.False(t, ok)
+
+	// Days are counted by calendar date, also across a daylight saving change
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	assert.Equal(t, 2, DaysUntilBirthday("--03-31", time.Date(2030, 3, 29, 23, 30, 0, 0, berlin)))
+}
+
+func TestListUpcomingDates(t *testing.T) {
+	db, _ := setupRouter()
+	userID := uint(1)
+	now := time.Date(2030, 2, 28, 9, 0, 0, 0, time.UTC)
+
+	alice := models.Contact{UserID: userID, Firstname: "Alice", Birthday: "1990-03-10", Anniversary: "2015-03-05"}
+	leap := models.Contact{UserID: userID, Firstname: "Leap", Birthday: "2000-02-29"}
+	later := models.Contact{UserID: userID, Firstname: "Later", Birthday: "--06-01"}
+	archived := models.Contact{UserID: userID, Firstname: "Archived", Birthday: "--03-01", Archived: true}
+	for _, contact := range []*models.Contact{&alice, &leap, &later, &archived} {
+		require.NoError(t, db.Create(contact).Error)
+	}
+	require.NoError(t, db.Create(&models.Relationship{UserID: userID, ContactID: alice.ID, Name: "Tom", Type: "Son", Birthday: "--03-20"}).Error)
+
+	dates, err := ListUpcomingDates(db, userID, now, 14)
+	require.NoError(t, err)
+	require.Len(t, dates, 3)
+
+	assert.Equal(t, "Leap", dates[0].Name)
+	assert.Equal(t, 0, dates[0].DaysUntil)
+	assert.Equal(t, "2030-02-28", dates[0].NextDate)
+	require.NotNil(t, dates[0].Years)
+	assert.Equal(t, 30, *dates[0].Years)
+
+	assert.Equal(t, models.DateKindAnniversary, dates[1].Kind)
+	assert.Equal(t, "2015-03-05", dates[1].Birthday)
+	assert.Equal(t, 5, dates[1].DaysUntil)
+	require.NotNil(t, dates[1].Years)
+	assert.Equal(t, 15, *dates[1].Years)
+
+	assert.Equal(t, models.DateKindBirthday, dates[2].Kind)
+	assert.Equal(t, 10, dates[2].DaysUntil)
+	assert.Equal(t, 40, *dates[2].Years)
+
+	// A wider window reaches the relationship, whose birth year is unknown
+	dates, err = ListUpcomingDates(db, userID, now, 30)
+	require.NoError(t, err)
+	require.Len(t, dates, 4)
+	assert.Equal(t, "relationship", dates[3].Type)
+	assert.Nil(t, dates[3].Years)
+
+	dates, err = ListUpcomingDates(db, userID, now, 0)
+	require.NoError(t, err)
+	require.Len(t, dates, 1)
+	assert.Equal(t, "Leap", dates[0].Name)
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"meerkat/i18n"
+	"meerkat/models"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"gorm.io/gorm"
+)
+
+const calendarFeedProductID = "-//Meerkat CRM//Calendar Feed//EN"
+
+// feedActivityLookback is how far back past activities are still included in the ICS feed
+const feedActivityLookback = -1 // years
+
+// BirthdayEvent renders a contact's or relationship's birthday as a yearly all-day event, with the
+// summary in the user's language and the birth date in their date format
+func BirthdayEvent(birthday models.Birthday, user models.User) (*ical.Component, bool) {
+	summary := i18n.T(user.Language, "calendar.birthday", map[string]string{"name": birthday.Name})
+	if hasYear(birthday.Birthday) {
+		summary = i18n.T(user.Language, "calendar.birthdayBorn", map[string]string{
+			"name": birthday.Name,
+			"date": formatBirthdayForUser(birthday.Birthday, user.DateFormat),
+		})
+	}
+	description := ""
+	if birthday.Type == "relationship" {
+		description = i18n.T(user.Language, "calendar.relationshipOf", map[string]string{
+			"type": birthday.RelationshipType,
+			"name": birthday.AssociatedContactName,
+		})
+	}
+	return annualEvent(birthdayUID(birthday), summary, description, birthday.Birthday)
+}
+
+// AnniversaryEvent renders a contact's anniversary as a yearly all-day event
+func AnniversaryEvent(contact models.Contact, user models.User) (*ical.Component, bool) {
+	name := ContactDisplayName(contact)
+	summary := i18n.T(user.Language, "calendar.anniversary", map[string]string{"name": name})
+	if hasYear(contact.Anniversary) {
+		summary = i18n.T(user.Language, "calendar.anniversarySince", map[string]string{
+			"name": name,
+			"date": formatBirthdayForUser(contact.Anniversary, user.DateFormat),
+		})
+	}
+	return annualEvent(fmt.Sprintf("meerkat-anniversary-contact-%d", contact.ID), summary, "", contact.Anniversary)
+}
+
+func birthdayUID(birthday models.Birthday) string {
+	if birthday.Type == "relationship" {
+		return fmt.Sprintf("meerkat-birthday-relationship-%d", birthday.RelationshipID)
+	}
+	return fmt.Sprintf("meerkat-birthday-contact-%d", birthday.ContactID)
+}
+
+func hasYear(date string) bool {
+	return date != "" && !strings.HasPrefix(date, "--")
+}
+
+// parseAnnualDate parses a birthday or anniversary (YYYY-MM-DD or --MM-DD). Dates without a year
+// are placed in 2000, a leap year, so that February 29 stays valid.
+func parseAnnualDate(value string) (time.Time, bool) {
+	if strings.HasPrefix(value, "--") {
+		value = "2000" + value[1:]
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// annualEvent renders a yearly all-day event. The event is generated rather than stored, so its
+// start date stands in for DTSTAMP and the rendered data only changes with the underlying date.
+func annualEvent(uid, summary, description, date string) (*ical.Component, bool) {
+	start, ok := parseAnnualDate(date)
+	if !ok {
+		return nil, false
+	}
+
+	event := ical.NewEvent()
+	event.Props.SetText(ical.PropUID, uid)
+	event.Props.SetDateTime(ical.PropDateTimeStamp, start)
+	event.Props.SetText(ical.PropSummary, summary)
+	if description != "" {
+		event.Props.SetText(ical.PropDescription, description)
+	}
+	event.Props.SetDate(ical.PropDateTimeStart, start)
+	rule := ical.NewProp(ical.PropRecurrenceRule)
+	rule.Value = "FREQ=YEARLY"
+	if start.Month() == time.February && start.Day() == 29 {
+		// A plain yearly rule skips the years without February 29; fall back to the 28th in those
+		rule.Value = "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1"
+	}
+	event.Props.Set(rule)
+	event.Props.SetText(ical.PropTransparency, "TRANSPARENT")
+	return event.Component, true
+}
+
+// reminderEvent renders an open reminder as an all-day event on its next date, repeating by its
+// recurrence. Feeds are read by apps that mostly ignore tasks, so unlike the CalDAV server the
+// reminder is not a VTODO.
+func reminderEvent(reminder models.Reminder, user models.User) *ical.Component {
+	event := ical.NewEvent()
+	event.Props.SetText(ical.PropUID, fmt.Sprintf("meerkat-reminder-event-%d", reminder.ID))
+	event.Props.SetDateTime(ical.PropDateTimeStamp, reminder.UpdatedAt.UTC())
+	event.Props.SetText(ical.PropSummary, i18n.T(user.Language, "calendar.reminder", map[string]string{"message": reminder.Message}))
+	if reminder.Contact.ID != 0 {
+		event.Props.SetText(ical.PropDescription, ContactDisplayName(reminder.Contact))
+	}
+	event.Props.SetDate(ical.PropDateTimeStart, reminder.RemindAt.UTC())
+	if value, ok := ReminderRecurrenceRule(reminder); ok {
+		rule := ical.NewProp(ical.PropRecurrenceRule)
+		rule.Value = value
+		event.Props.Set(rule)
+	}
+	return event.Component
+}
+
+// activityEvent renders an activity as an all-day event listing the contacts who took part
+func activityEvent(activity models.Activity, user models.User) *ical.Component {
+	event := ical.NewEvent()
+	event.Props.SetText(ical.PropUID, fmt.Sprintf("meerkat-activity-%d", activity.ID))
+	event.Props.SetDateTime(ical.PropDateTimeStamp, activity.UpdatedAt.UTC())
+	event.Props.SetText(ical.PropSummary, activity.Title)
+
+	var description []string
+	if activity.Description != "" {
+		description = append(description, activity.Description)
+	}
+	if len(activity.Contacts) > 0 {
+		names := make([]string, len(activity.Contacts))
+		for i, contact := range activity.Contacts {
+			names[i] = ContactDisplayName(contact)
+		}
+		description = append(description, i18n.T(user.Language, "calendar.activityWith", map[string]string{"names": strings.Join(names, ", ")}))
+	}
+	if len(description) > 0 {
+		event.Props.SetText(ical.PropDescription, strings.Join(description, "\n\n"))
+	}
+	if activity.Location != "" {
+		event.Props.SetText(ical.PropLocation, activity.Location)
+	}
+	event.Props.SetDate(ical.PropDateTimeStart, activity.Date.UTC())
+	return event.Component
+}
+
+// BuildCalendarFeed renders a user's ICS subscription feed: open reminders, birthdays, anniversaries,
+// and activities from the past year onwards
+func BuildCalendarFeed(db *gorm.DB, user models.User, now time.Time) (*ical.Calendar, error) {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, calendarFeedProductID)
+	cal.Props.SetText("X-WR-CALNAME", "Meerkat CRM")
+	cal.Props.SetText("X-PUBLISHED-TTL", "PT1H")
+
+	birthdays, err := ListBirthdays(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, birthday := range birthdays {
+		if event, ok := BirthdayEvent(birthday, user); ok {
+			cal.Children = append(cal.Children, event)
+		}
+	}
+
+	var contacts []models.Contact
+	if err := db.Where("user_id = ? AND archived = ?", user.ID, false).
+		Where("anniversary IS NOT NULL AND anniversary != ''").
+		Order("id").
+		Find(&contacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve anniversaries: %w", err)
+	}
+	for _, contact := range contacts {
+		if event, ok := AnniversaryEvent(contact, user); ok {
+			cal.Children = append(cal.Children, event)
+		}
+	}
+
+	var reminders []models.Reminder
+	if err := db.Preload("Contact").
+		Where("user_id = ? AND completed = ?", user.ID, false).
+		Order("remind_at").
+		Find(&reminders).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve reminders: %w", err)
+	}
+	for _, reminder := range reminders {
+		cal.Children = append(cal.Children, reminderEvent(reminder, user))
+	}
+
+	var activities []models.Activity
+	if err := db.Preload("Contacts").
+		Where("user_id = ? AND date >= ?", user.ID, now.AddDate(feedActivityLookback, 0, 0)).
+		Order("date").
+		Find(&activities).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve activities: %w", err)
+	}
+	for _, activity := range activities {
+		cal.Children = append(cal.Children, activityEvent(activity, user))
+	}
+
+	return cal, nil
+}
+
+// EncodeCalendarFeed encodes a feed built by BuildCalendarFeed. go-ical refuses to encode a calendar
+// without components, but a user with nothing scheduled still needs a valid, empty feed.
+func EncodeCalendarFeed(cal *ical.Calendar) ([]byte, error) {
+	if len(cal.Children) == 0 {
+		return []byte("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:" + calendarFeedProductID + "\r\nEND:VCALENDAR\r\n"), nil
+	}
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
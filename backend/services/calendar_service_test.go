@@ -0,0 +1,93 @@
+package services
+
+import (
+	"meerkat/i18n"
+	"meerkat/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func feedSummaries(cal *ical.Calendar) []string {
+	summaries := make([]string, 0, len(cal.Children))
+	for _, event := range cal.Events() {
+		summary, _ := event.Props.Text(ical.PropSummary)
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func TestBuildCalendarFeed(t *testing.T) {
+	require.NoError(t, i18n.Init())
+	db, _ := setupRouter()
+
+	user := models.User{Username: "feed", Password: "x", Email: "feed@example.com", Language: "de", DateFormat: "us"}
+	require.NoError(t, db.Create(&user).Error)
+
+	alice := models.Contact{UserID: user.ID, Firstname: "Alice", Lastname: "Smith", Birthday: "1985-04-12", Anniversary: "2010-06-20"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&models.Relationship{UserID: user.ID, ContactID: alice.ID, Name: "Tom", Type: "Sohn", Birthday: "--02-29"}).Error)
+
+	now := time.Date(2030, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, db.Create(&models.Reminder{UserID: user.ID, ContactID: &alice.ID, Message: "Anrufen", Recurrence: "once", RemindAt: now.AddDate(0, 0, 3)}).Error)
+	require.NoError(t, db.Create(&models.Reminder{UserID: user.ID, ContactID: &alice.ID, Message: "Erledigt", Recurrence: "once", RemindAt: now, Completed: true}).Error)
+	require.NoError(t, db.Create(&models.Reminder{UserID: user.ID, ContactID: &alice.ID, Message: "Blumen gießen", Recurrence: "custom", RecurrenceRule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;COUNT=4", RemindAt: time.Date(2030, 3, 5, 0, 0, 0, 0, time.UTC)}).Error)
+
+	dinner := models.Activity{UserID: user.ID, Title: "Abendessen", Location: "Berlin", Date: now.AddDate(0, -2, 0), Contacts: []models.Contact{alice}}
+	require.NoError(t, db.Create(&dinner).Error)
+	require.NoError(t, db.Create(&models.Activity{UserID: user.ID, Title: "Zu alt", Date: now.AddDate(-2, 0, 0)}).Error)
+
+	cal, err := BuildCalendarFeed(db, user, now)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{
+		"Geburtstag von Alice Smith (geb. 04/12/1985)",
+		"Geburtstag von Tom",
+		"Jahrestag von Alice Smith (seit 06/20/2010)",
+		"Erinnerung: Anrufen",
+		"Erinnerung: Blumen gießen",
+		"Abendessen",
+	}, feedSummaries(cal))
+
+	for _, event := range cal.Events() {
+		uid, _ := event.Props.Text(ical.PropUID)
+		switch uid {
+		case "meerkat-birthday-relationship-1":
+			description, _ := event.Props.Text(ical.PropDescription)
+			assert.Equal(t, "Sohn von Alice Smith", description)
+			// February 29 recurs on the last day of February
+			assert.Equal(t, "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1", event.Props.Get(ical.PropRecurrenceRule).Value)
+		case "meerkat-reminder-event-3":
+			// The count is exported as the date of the last occurrence
+			assert.Equal(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU;UNTIL=20300416", event.Props.Get(ical.PropRecurrenceRule).Value)
+		case "meerkat-activity-1":
+			description, _ := event.Props.Text(ical.PropDescription)
+			assert.Equal(t, "Mit Alice Smith", description)
+			location, _ := event.Props.Text(ical.PropLocation)
+			assert.Equal(t, "Berlin", location)
+		}
+	}
+
+	data, err := EncodeCalendarFeed(cal)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "BEGIN:VCALENDAR"))
+}
+
+func TestEncodeCalendarFeed_Empty(t *testing.T) {
+	db, _ := setupRouter()
+	user := models.User{Username: "empty", Password: "x", Email: "empty@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+
+	cal, err := BuildCalendarFeed(db, user, time.Now())
+	require.NoError(t, err)
+	data, err := EncodeCalendarFeed(cal)
+	require.NoError(t, err)
+
+	decoded, err := ical.NewDecoder(strings.NewReader(string(data))).Decode()
+	require.NoError(t, err)
+	assert.Empty(t, decoded.Children)
+}
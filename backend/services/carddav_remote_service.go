@@ -0,0 +1,461 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"meerkat/carddav"
+	"meerkat/config"
+	"meerkat/logger"
+	"meerkat/models"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-vcard"
+	"github.com/emersion/go-webdav"
+	davcarddav "github.com/emersion/go-webdav/carddav"
+	"gorm.io/gorm"
+)
+
+// CardDAVRemoteSyncResult summarizes one sync run with a CardDAV remote
+type CardDAVRemoteSyncResult struct {
+	Pulled        int `json:"pulled"`         // contacts created or updated from the remote
+	Pushed        int `json:"pushed"`         // cards created or updated on the remote
+	DeletedLocal  int `json:"deleted_local"`  // contacts deleted because their card was removed remotely
+	DeletedRemote int `json:"deleted_remote"` // cards deleted because their contact was removed in Meerkat
+	Conflicts     int `json:"conflicts"`      // cards changed on both sides since the last sync
+}
+
+// ErrCardDAVRemoteSyncRunning is returned when a sync of the same remote is already in progress
+var ErrCardDAVRemoteSyncRunning = errors.New("a sync of this remote is already running")
+
+// ErrCardDAVRemoteURLBlocked is returned for remotes on private addresses when
+// WEBHOOK_BLOCK_PRIVATE_URLS is enabled
+var ErrCardDAVRemoteURLBlocked = errors.New("address book URL resolves to a private or loopback address")
+
+// errRemotePreconditionFailed and errRemoteNotFound are returned by the remote HTTP client for
+// 412 and 404 responses, which the sync handles instead of failing the run
+var (
+	errRemotePreconditionFailed = errors.New("remote card changed concurrently")
+	errRemoteNotFound           = errors.New("remote card not found")
+)
+
+const (
+	cardDAVRemoteTimeout = 5 * time.Minute
+	// cardDAVRemoteMultiGetBatch caps the number of cards fetched per addressbook-multiget
+	cardDAVRemoteMultiGetBatch = 100
+)
+
+var (
+	cardDAVRemoteHTTPClient = &http.Client{Timeout: 30 * time.Second}
+	// cardDAVRemoteLocks keeps scheduled and manual syncs of the same remote from overlapping in
+	// this instance; a job lock per remote does the same across instances sharing a database
+	cardDAVRemoteLocks sync.Map
+)
+
+// SyncDueCardDAVRemotes syncs every active remote whose interval has elapsed. Run by the scheduler.
+func SyncDueCardDAVRemotes(db *gorm.DB, cfg config.Config) {
+	var remotes []models.CardDAVRemote
+	if err := db.Where("is_active = ?", true).Find(&remotes).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to load CardDAV remotes")
+		return
+	}
+
+	now := time.Now()
+	for i := range remotes {
+		remote := &remotes[i]
+		if remote.LastSyncAt != nil && now.Sub(*remote.LastSyncAt) < time.Duration(remote.IntervalMinutes)*time.Minute {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cardDAVRemoteTimeout)
+		result, err := SyncCardDAVRemote(ctx, db, cfg, remote)
+		cancel()
+		if err != nil {
+			logger.Warn().Err(err).Uint("remote_id", remote.ID).Msg("CardDAV remote sync failed")
+			continue
+		}
+		logger.Info().Uint("remote_id", remote.ID).Interface("result", result).Msg("CardDAV remote synced")
+	}
+}
+
+// SyncCardDAVRemote runs one sync with a remote address book and records its outcome on the remote.
+// Contacts are matched to remote cards by VCardUID.
+func SyncCardDAVRemote(ctx context.Context, db *gorm.DB, cfg config.Config, remote *models.CardDAVRemote) (*CardDAVRemoteSyncResult, error) {
+	lock, _ := cardDAVRemoteLocks.LoadOrStore(remote.ID, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		return nil, ErrCardDAVRemoteSyncRunning
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	jobName := fmt.Sprintf("%s%d", models.JobNameCardDAVRemotePrefix, remote.ID)
+	if acquired, err := acquireJobLock(db, jobName, 0); err != nil {
+		return nil, err
+	} else if !acquired {
+		return nil, ErrCardDAVRemoteSyncRunning
+	}
+	defer func() {
+		if err := releaseJobLock(db, jobName, true); err != nil {
+			logger.Error().Err(err).Uint("remote_id", remote.ID).Msg("Failed to release CardDAV remote sync lock")
+		}
+	}()
+
+	var syncer *remoteSyncer
+	var err error
+	// Checked on every sync, as the address may resolve differently than when the remote was saved
+	if URLBlocked(cfg, remote.URL) {
+		err = ErrCardDAVRemoteURLBlocked
+	} else {
+		syncer, err = newRemoteSyncer(db, cfg, remote)
+	}
+	var result *CardDAVRemoteSyncResult
+	if err == nil {
+		result, err = syncer.run(ctx)
+	}
+
+	now := time.Now()
+	remote.LastSyncAt = &now
+	remote.LastError = nil
+	if err != nil {
+		msg := err.Error()
+		remote.LastError = &msg
+	}
+	if saveErr := db.Model(remote).Select("last_sync_at", "last_error").Updates(remote).Error; saveErr != nil {
+		logger.Error().Err(saveErr).Uint("remote_id", remote.ID).Msg("Failed to record CardDAV remote sync")
+	}
+	return result, err
+}
+
+// remoteSyncer holds the state of one sync run
+type remoteSyncer struct {
+	db       *gorm.DB
+	photoDir string
+	remote   *models.CardDAVRemote
+	client   *davcarddav.Client
+	bookPath string
+	result   CardDAVRemoteSyncResult
+
+	links    map[string]*models.CardDAVRemoteObject // by VCardUID
+	contacts map[string]*models.Contact             // by VCardUID, soft-deleted ones included
+	// forcePush holds contacts whose remote card was edited in push mode and must be overwritten
+	forcePush map[string]bool
+}
+
+func newRemoteSyncer(db *gorm.DB, cfg config.Config, remote *models.CardDAVRemote) (*remoteSyncer, error) {
+	u, err := url.Parse(remote.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid address book URL")
+	}
+	bookPath := u.Path
+	if !strings.HasSuffix(bookPath, "/") {
+		bookPath += "/"
+	}
+
+	// Redirects are checked like the remote's own URL, so a remote cannot point the sync at a
+	// private address
+	redirectChecked := *cardDAVRemoteHTTPClient
+	redirectChecked.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if URLBlocked(cfg, req.URL.String()) {
+			return ErrCardDAVRemoteURLBlocked
+		}
+		return nil
+	}
+	httpClient := webdav.HTTPClientWithBasicAuth(remoteHTTPClient{&redirectChecked}, remote.Username, remote.Password)
+	client, err := davcarddav.NewClient(httpClient, remote.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address book URL: %w", err)
+	}
+
+	return &remoteSyncer{
+		db:        db,
+		photoDir:  cfg.ProfilePhotoDir,
+		remote:    remote,
+		client:    client,
+		bookPath:  bookPath,
+		links:     map[string]*models.CardDAVRemoteObject{},
+		contacts:  map[string]*models.Contact{},
+		forcePush: map[string]bool{},
+	}, nil
+}
+
+func (s *remoteSyncer) pulls() bool  { return s.remote.Mode != models.CardDAVRemoteModePush }
+func (s *remoteSyncer) pushes() bool { return s.remote.Mode != models.CardDAVRemoteModePull }
+
+func (s *remoteSyncer) run(ctx context.Context) (*CardDAVRemoteSyncResult, error) {
+	// Only UID and KIND are needed to list the book; full cards are fetched for changed ones below.
+	// A PROPFIND listing would be cheaper, but go-webdav's requires getcontentlength, which many servers omit.
+	// The filter is empty, which matches every card; go-webdav servers only agree to that with allof.
+	listing, err := s.client.QueryAddressBook(ctx, s.bookPath, &davcarddav.AddressBookQuery{
+		FilterTest:  davcarddav.FilterAllOf,
+		DataRequest: davcarddav.AddressDataRequest{Props: []string{vcard.FieldUID, vcard.FieldKind, "X-ADDRESSBOOKSERVER-KIND"}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote address book: %w", err)
+	}
+	remoteETags := map[string]string{}
+	for _, ao := range listing {
+		// Without a UID a card cannot be matched; groups are not synced
+		if ao.Card.Value(vcard.FieldUID) != "" && !carddav.IsGroupCard(ao.Card) {
+			remoteETags[ao.Path] = ao.ETag
+		}
+	}
+
+	var links []models.CardDAVRemoteObject
+	if err := s.db.Where("remote_id = ?", s.remote.ID).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	linksByHref := map[string]*models.CardDAVRemoteObject{}
+	for i := range links {
+		s.links[links[i].VCardUID] = &links[i]
+		linksByHref[links[i].Href] = &links[i]
+	}
+
+	var contacts []models.Contact
+	if err := s.db.Unscoped().Where("user_id = ?", s.remote.UserID).Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+	for i := range contacts {
+		s.contacts[contacts[i].VCardUID] = &contacts[i]
+	}
+
+	// Remote side: cards that are new or whose ETag moved since the last sync
+	var changed []string
+	for href, etag := range remoteETags {
+		link := linksByHref[href]
+		switch {
+		case link != nil && link.RemoteETag == etag:
+		case s.pulls():
+			changed = append(changed, href)
+		case link != nil:
+			// Push mode: Meerkat's copy overwrites edits made on the remote
+			s.forcePush[link.VCardUID] = true
+		}
+	}
+	sort.Strings(changed)
+	if err := s.pullCards(ctx, changed, linksByHref); err != nil {
+		return nil, err
+	}
+
+	// Cards removed from the remote
+	for i := range links {
+		link := &links[i]
+		if _, ok := remoteETags[link.Href]; ok {
+			continue
+		}
+		if err := s.remoteDeleted(link); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.pushes() {
+		for i := range contacts {
+			if err := s.pushContact(ctx, &contacts[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &s.result, nil
+}
+
+// pullCards fetches the given remote cards and applies them to the matching contacts
+func (s *remoteSyncer) pullCards(ctx context.Context, hrefs []string, linksByHref map[string]*models.CardDAVRemoteObject) error {
+	for start := 0; start < len(hrefs); start += cardDAVRemoteMultiGetBatch {
+		batch := hrefs[start:min(start+cardDAVRemoteMultiGetBatch, len(hrefs))]
+		objects, err := s.client.MultiGetAddressBook(ctx, s.bookPath, &davcarddav.AddressBookMultiGet{
+			Paths:       batch,
+			DataRequest: davcarddav.AddressDataRequest{AllProp: true},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch remote cards: %w", err)
+		}
+		for i := range objects {
+			ao := &objects[i]
+			uid := ao.Card.Value(vcard.FieldUID)
+			if uid == "" || carddav.IsGroupCard(ao.Card) {
+				// Without a UID a card cannot be matched; groups are not synced
+				continue
+			}
+			link := linksByHref[ao.Path]
+			if link == nil {
+				link = s.links[uid]
+			}
+			if err := s.pullCard(ao, uid, link); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pullCard creates or updates the contact for a remote card. The remote wins conflicts,
+// including against a local deletion, which is undone.
+func (s *remoteSyncer) pullCard(ao *davcarddav.AddressObject, uid string, link *models.CardDAVRemoteObject) error {
+	contact := s.contacts[uid]
+	if contact != nil && link != nil && contact.SyncRevision > link.LocalRevision {
+		s.result.Conflicts++
+	}
+	var before *models.Contact
+	if contact == nil {
+		contact = &models.Contact{}
+	} else {
+		previous := *contact
+		before = &previous
+	}
+
+	updated, photoData, photoMediaType, _ := carddav.VCardToContact(ao.Card, contact)
+	updated.UserID = s.remote.UserID
+	updated.VCardUID = uid
+	updated.DeletedAt = gorm.DeletedAt{}
+	if len(photoData) > 0 {
+		photoPath, thumbnail, err := carddav.SaveContactPhoto(photoData, photoMediaType, s.photoDir)
+		if err != nil {
+			logger.Warn().Err(err).Str("vcard_uid", uid).Msg("CardDAV remote: failed to save contact photo")
+		} else {
+			updated.Photo = photoPath
+			updated.PhotoThumbnail = thumbnail
+		}
+	}
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Save(updated).Error; err != nil {
+			return err
+		}
+		editor := models.ContactEditor{Source: models.ContactSourceCardDAV, Actor: s.remote.Name}
+		return models.RecordContactVersion(tx, before, updated, editor)
+	}); err != nil {
+		return fmt.Errorf("failed to save contact %s: %w", uid, err)
+	}
+	s.contacts[uid] = updated
+	s.result.Pulled++
+
+	return s.saveLink(uid, ao.Path, ao.ETag, updated.SyncRevision)
+}
+
+// remoteDeleted handles a linked card that is gone from the remote
+func (s *remoteSyncer) remoteDeleted(link *models.CardDAVRemoteObject) error {
+	contact := s.contacts[link.VCardUID]
+	live := contact != nil && !contact.DeletedAt.Valid
+	switch {
+	case !s.pulls() || !live:
+		// Push mode recreates the card below; nothing left to delete locally otherwise
+	case s.pushes() && contact.SyncRevision > link.LocalRevision:
+		// Edited here, deleted there: keep the edit and push it as a new card
+		s.result.Conflicts++
+	default:
+		if err := s.db.Delete(contact).Error; err != nil {
+			return fmt.Errorf("failed to delete contact %s: %w", link.VCardUID, err)
+		}
+		contact.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		s.result.DeletedLocal++
+	}
+	delete(s.links, link.VCardUID)
+	return s.db.Delete(link).Error
+}
+
+// pushContact sends a contact's changes (or its deletion) to the remote
+func (s *remoteSyncer) pushContact(ctx context.Context, contact *models.Contact) error {
+	uid := contact.VCardUID
+	link := s.links[uid]
+
+	if contact.DeletedAt.Valid {
+		if link == nil {
+			return nil
+		}
+		err := s.client.RemoveAll(withRemoteConditions(ctx, link), link.Href)
+		switch {
+		case errors.Is(err, errRemotePreconditionFailed):
+			// Changed remotely since: pulled on the next run instead
+			s.result.Conflicts++
+			return nil
+		case err != nil && !errors.Is(err, errRemoteNotFound):
+			return fmt.Errorf("failed to delete remote card %s: %w", uid, err)
+		}
+		s.result.DeletedRemote++
+		delete(s.links, uid)
+		return s.db.Delete(link).Error
+	}
+
+	if link != nil && contact.SyncRevision <= link.LocalRevision && !s.forcePush[uid] {
+		return nil
+	}
+
+	href := s.bookPath + url.PathEscape(uid) + ".vcf"
+	putCtx := withRemoteConditions(ctx, link)
+	if link != nil {
+		href = link.Href
+		if s.forcePush[uid] {
+			putCtx = ctx
+		}
+	}
+	ao, err := s.client.PutAddressObject(putCtx, href, carddav.ContactToVCard(contact, s.photoDir))
+	if errors.Is(err, errRemotePreconditionFailed) {
+		s.result.Conflicts++
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload contact %s: %w", uid, err)
+	}
+	s.result.Pushed++
+	return s.saveLink(uid, ao.Path, ao.ETag, contact.SyncRevision)
+}
+
+// saveLink records the state of a contact/card pair after it was synced
+func (s *remoteSyncer) saveLink(uid, href, etag string, revision int64) error {
+	link := s.links[uid]
+	if link == nil {
+		link = &models.CardDAVRemoteObject{RemoteID: s.remote.ID, VCardUID: uid}
+		s.links[uid] = link
+	}
+	link.Href = href
+	link.RemoteETag = etag
+	link.LocalRevision = revision
+	return s.db.Save(link).Error
+}
+
+type remoteConditionsKey struct{}
+
+// withRemoteConditions makes the next request conditional on the remote card being unchanged
+// since the last sync (If-Match), or on it not existing yet (If-None-Match) when there is no link.
+// go-webdav's client does not support conditional requests itself.
+func withRemoteConditions(ctx context.Context, link *models.CardDAVRemoteObject) context.Context {
+	header := http.Header{}
+	if link == nil {
+		header.Set("If-None-Match", "*")
+	} else if link.RemoteETag != "" {
+		header.Set("If-Match", `"`+link.RemoteETag+`"`)
+	}
+	return context.WithValue(ctx, remoteConditionsKey{}, header)
+}
+
+// remoteHTTPClient adds the conditional headers from the request context and reports
+// 412 and 404 responses as errors the sync can recognize
+type remoteHTTPClient struct {
+	client *http.Client
+}
+
+func (c remoteHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if header, ok := req.Context().Value(remoteConditionsKey{}).(http.Header); ok {
+		for name, values := range header {
+			req.Header[name] = values
+		}
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPreconditionFailed:
+		resp.Body.Close()
+		return nil, errRemotePreconditionFailed
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, errRemoteNotFound
+	}
+	return resp, nil
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"meerkat/carddav"
+	"meerkat/config"
+	"meerkat/models"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openCardDAVRemoteDB(t *testing.T, username string) (*gorm.DB, uint) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Contact{}, &models.CardDAVSync{}, &models.CardDAVGroup{},
+		&models.CardDAVRemote{}, &models.CardDAVRemoteObject{}, &models.ContactVersion{}, &models.JobExecution{}))
+
+	user := models.User{Username: username, Password: "password123", Email: username + "@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+	return db, user.ID
+}
+
+// setupCardDAVRemote starts a second Meerkat CardDAV server to sync with and returns the local
+// database together with a remote pointing at the server's address book
+func setupCardDAVRemote(t *testing.T, mode string) (local *gorm.DB, remoteDB *gorm.DB, remote *models.CardDAVRemote) {
+	gin.SetMode(gin.ReleaseMode)
+
+	remoteDB, remoteUserID := openCardDAVRemoteDB(t, "remote")
+	handler := carddav.NewHandler(remoteDB, t.TempDir())
+	router := gin.New()
+	group := router.Group("/carddav")
+	group.Use(func(c *gin.Context) {
+		c.Set("userID", remoteUserID)
+		c.Set("username", "remote")
+		c.Next()
+	})
+	group.Any("/*path", handler.GinHandler())
+	group.Handle("PROPFIND", "/*path", handler.GinHandler())
+	group.Handle("REPORT", "/*path", handler.GinHandler())
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	local, localUserID := openCardDAVRemoteDB(t, "local")
+	remote = &models.CardDAVRemote{
+		UserID:          localUserID,
+		Name:            "Other server",
+		URL:             server.URL + "/carddav/addressbooks/remote/contacts/",
+		Username:        "remote",
+		Password:        "secret",
+		Mode:            mode,
+		IntervalMinutes: 60,
+		IsActive:        true,
+	}
+	require.NoError(t, local.Create(remote).Error)
+	return local, remoteDB, remote
+}
+
+func syncRemote(t *testing.T, db *gorm.DB, remote *models.CardDAVRemote) CardDAVRemoteSyncResult {
+	t.Helper()
+	result, err := SyncCardDAVRemote(t.Context(), db, config.Config{ProfilePhotoDir: t.TempDir()}, remote)
+	require.NoError(t, err)
+	return *result
+}
+
+func contactByUID(t *testing.T, db *gorm.DB, uid string) models.Contact {
+	t.Helper()
+	var contact models.Contact
+	require.NoError(t, db.Where("vcard_uid = ?", uid).First(&contact).Error)
+	return contact
+}
+
+func TestSyncCardDAVRemote_BlocksPrivateURLs(t *testing.T) {
+	local, _, remote := setupCardDAVRemote(t, models.CardDAVRemoteModeTwoWay)
+
+	// The test server listens on loopback
+	_, err := SyncCardDAVRemote(t.Context(), local, config.Config{WebhookBlockPrivateURLs: true}, remote)
+	assert.ErrorIs(t, err, ErrCardDAVRemoteURLBlocked)
+
+	var stored models.CardDAVRemote
+	require.NoError(t, local.First(&stored, remote.ID).Error)
+	require.NotNil(t, stored.LastError)
+	assert.Contains(t, *stored.LastError, "private or loopback")
+}
+
+func TestSyncCardDAVRemote_BlocksRedirectsToPrivateURLs(t *testing.T) {
+	local, remoteDB, remote := setupCardDAVRemote(t, models.CardDAVRemoteModePull)
+	var remoteUser models.User
+	require.NoError(t, remoteDB.First(&remoteUser).Error)
+	require.NoError(t, remoteDB.Create(&models.Contact{UserID: remoteUser.ID, Firstname: "Bob", VCardUID: "bob"}).Error)
+
+	// The remote's own host does not resolve, so it passes the check, but it redirects to the
+	// loopback server
+	target := remote.URL
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target, http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(redirector.Close)
+	original := cardDAVRemoteHTTPClient
+	t.Cleanup(func() { cardDAVRemoteHTTPClient = original })
+	var dialer net.Dialer
+	cardDAVRemoteHTTPClient = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if strings.HasPrefix(addr, "carddav.invalid:") {
+				addr = redirector.Listener.Addr().String()
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}
+	remote.URL = "http://carddav.invalid/carddav/addressbooks/remote/contacts/"
+
+	_, err := SyncCardDAVRemote(t.Context(), local, config.Config{WebhookBlockPrivateURLs: true}, remote)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "private or loopback")
+	var count int64
+	require.NoError(t, local.Model(&models.Contact{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// Without the block the redirect is followed
+	assert.Equal(t, CardDAVRemoteSyncResult{Pulled: 1}, syncRemote(t, local, remote))
+}
+
+func TestSyncCardDAVRemote_LockedByOtherInstance(t *testing.T) {
+	local, _, remote := setupCardDAVRemote(t, models.CardDAVRemoteModeTwoWay)
+	lockedAt := time.Now()
+	job := models.JobExecution{JobName: fmt.Sprintf("%s%d", models.JobNameCardDAVRemotePrefix, remote.ID), LastRunAt: lockedAt, LockedAt: &lockedAt, LockedBy: "other-instance"}
+	require.NoError(t, local.Create(&job).Error)
+
+	_, err := SyncCardDAVRemote(t.Context(), local, config.Config{ProfilePhotoDir: t.TempDir()}, remote)
+	assert.ErrorIs(t, err, ErrCardDAVRemoteSyncRunning)
+
+	// A lock left behind by a crashed instance expires
+	staleAt := lockedAt.Add(-10 * time.Minute)
+	require.NoError(t, local.Model(&job).Update("locked_at", staleAt).Error)
+	syncRemote(t, local, remote)
+	var released models.JobExecution
+	require.NoError(t, local.First(&released, job.ID).Error)
+	assert.Nil(t, released.LockedAt)
+}
+
+func TestSyncCardDAVRemote_TwoWay(t *testing.T) {
+	local, remoteDB, remote := setupCardDAVRemote(t, models.CardDAVRemoteModeTwoWay)
+	var remoteUser models.User
+	require.NoError(t, remoteDB.First(&remoteUser).Error)
+
+	require.NoError(t, local.Create(&models.Contact{UserID: remote.UserID, Firstname: "Alice", VCardUID: "alice"}).Error)
+	require.NoError(t, remoteDB.Create(&models.Contact{UserID: remoteUser.ID, Firstname: "Bob", VCardUID: "bob"}).Error)
+
+	// First run: each side gets the other's contact
+	assert.Equal(t, CardDAVRemoteSyncResult{Pulled: 1, Pushed: 1}, syncRemote(t, local, remote))
+	assert.Equal(t, "Bob", contactByUID(t, local, "bob").Firstname)
+	assert.Equal(t, "Alice", contactByUID(t, remoteDB, "alice").Firstname)
+	assert.NotNil(t, remote.LastSyncAt)
+	assert.Nil(t, remote.LastError)
+
+	// Nothing changed since
+	assert.Equal(t, CardDAVRemoteSyncResult{}, syncRemote(t, local, remote))
+
+	// Edits travel in both directions
+	alice := contactByUID(t, local, "alice")
+	alice.Lastname = "Liddell"
+	require.NoError(t, local.Save(&alice).Error)
+	bob := contactByUID(t, remoteDB, "bob")
+	bob.Lastname = "Builder"
+	require.NoError(t, remoteDB.Save(&bob).Error)
+
+	assert.Equal(t, CardDAVRemoteSyncResult{Pulled: 1, Pushed: 1}, syncRemote(t, local, remote))
+	assert.Equal(t, "Builder", contactByUID(t, local, "bob").Lastname)
+	assert.Equal(t, "Liddell", contactByUID(t, remoteDB, "alice").Lastname)
+
+	// So do deletions
+	localBob := contactByUID(t, local, "bob")
+	require.NoError(t, local.Delete(&localBob).Error)
+	remoteAlice := contactByUID(t, remoteDB, "alice")
+	require.NoError(t, remoteDB.Delete(&remoteAlice).Error)
+
+	assert.Equal(t, CardDAVRemoteSyncResult{DeletedLocal: 1, DeletedRemote: 1}, syncRemote(t, local, remote))
+	var count int64
+	local.Model(&models.Contact{}).Count(&count)
+	assert.Zero(t, count)
+	remoteDB.Model(&models.Contact{}).Count(&count)
+	assert.Zero(t, count)
+	local.Model(&models.CardDAVRemoteObject{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestSyncCardDAVRemote_ConflictRemoteWins(t *testing.T) {
+	local, remoteDB, remote := setupCardDAVRemote(t, models.CardDAVRemoteModeTwoWay)
+	require.NoError(t, local.Create(&models.Contact{UserID: remote.UserID, Firstname: "Alice", VCardUID: "alice"}).Error)
+	syncRemote(t, local, remote)
+
+	alice := contactByUID(t, local, "alice")
+	alice.Lastname = "Local"
+	require.NoError(t, local.Save(&alice).Error)
+	remoteAlice := contactByUID(t, remoteDB, "alice")
+	remoteAlice.Lastname = "Remote"
+	require.NoError(t, remoteDB.Save(&remoteAlice).Error)
+
+	assert.Equal(t, CardDAVRemoteSyncResult{Pulled: 1, Conflicts: 1}, syncRemote(t, local, remote))
+	assert.Equal(t, "Remote", contactByUID(t, local, "alice").Lastname)
+	assert.Equal(t, "Remote", contactByUID(t, remoteDB, "alice").Lastname)
+}
+
+func TestSyncCardDAVRemote_OneWay(t *testing.T) {
+	t.Run("pull", func(t *testing.T) {
+		local, remoteDB, remote := setupCardDAVRemote(t, models.CardDAVRemoteModePull)
+		var remoteUser models.User
+		require.NoError(t, remoteDB.First(&remoteUser).Error)
+		require.NoError(t, local.Create(&models.Contact{UserID: remote.UserID, Firstname: "Alice", VCardUID: "alice"}).Error)
+		require.NoError(t, remoteDB.Create(&models.Contact{UserID: remoteUser.ID, Firstname: "Bob", VCardUID: "bob"}).Error)
+
+		assert.Equal(t, CardDAVRemoteSyncResult{Pulled: 1}, syncRemote(t, local, remote))
+		var count int64
+		remoteDB.Model(&models.Contact{}).Where("vcard_uid = ?", "alice").Count(&count)
+		assert.Zero(t, count)
+	})
+
+	t.Run("push", func(t *testing.T) {
+		local, remoteDB, remote := setupCardDAVRemote(t, models.CardDAVRemoteModePush)
+		var remoteUser models.User
+		require.NoError(t, remoteDB.First(&remoteUser).Error)
+		require.NoError(t, local.Create(&models.Contact{UserID: remote.UserID, Firstname: "Alice", VCardUID: "alice"}).Error)
+		require.NoError(t, remoteDB.Create(&models.Contact{UserID: remoteUser.ID, Firstname: "Bob", VCardUID: "bob"}).Error)
+
+		assert.Equal(t, CardDAVRemoteSyncResult{Pushed: 1}, syncRemote(t, local, remote))
+		var count int64
+		local.Model(&models.Contact{}).Where("vcard_uid = ?", "bob").Count(&count)
+		assert.Zero(t, count)
+
+		// Edits made on the remote are overwritten with Meerkat's copy
+		remoteAlice := contactByUID(t, remoteDB, "alice")
+		remoteAlice.Firstname = "Changed"
+		require.NoError(t, remoteDB.Save(&remoteAlice).Error)
+		assert.Equal(t, CardDAVRemoteSyncResult{Pushed: 1}, syncRemote(t, local, remote))
+		assert.Equal(t, "Alice", contactByUID(t, remoteDB, "alice").Firstname)
+	})
+}
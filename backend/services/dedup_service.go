@@ -0,0 +1,488 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"meerkat/models"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Scores of the individual signals of a duplicate pair. Signals count as independent evidence, so
+// a pair matching on several of them scores higher than on any one.
+const (
+	duplicateEmailScore      = 0.95
+	duplicatePhoneScore      = 0.85
+	duplicateNameScore       = 0.8 // identical names
+	duplicateFuzzyNameScore  = 0.5 // names at duplicateNameSimilarity, rising towards duplicateNameScore
+	duplicateNameSimilarity  = 0.85
+	minDuplicatePhoneDigits  = 5 // as in DetectDuplicate
+	duplicatePhoneSuffixLen  = 7 // numbers this long also match with and without a country code
+	DefaultDuplicateMinScore = 0.5
+)
+
+// ErrMergeIntoSelf is returned when a contact is listed as a duplicate of itself
+var ErrMergeIntoSelf = errors.New("a contact cannot be merged into itself")
+
+// duplicateCandidate holds the normalized values a contact is compared on
+type duplicateCandidate struct {
+	contact    *models.Contact
+	emails     []string // lowercased
+	phones     []string // digits only
+	name       string   // first and last name tokens, lowercased and sorted
+	nameTokens []string
+}
+
+// FindDuplicateClusters scans all of the user's contacts for probable duplicates. Contacts are
+// compared on shared email addresses, phone numbers and similar names; pairs scoring at least
+// minScore are grouped into clusters, best cluster first.
+func FindDuplicateClusters(db *gorm.DB, userID uint, minScore float64) ([]models.DuplicateCluster, error) {
+	var contacts []models.Contact
+	err := db.Select("id", "user_id", "firstname", "lastname", "nickname", "organization", "email", "phone",
+		"emails", "phones", "birthday", "archived", "photo_thumbnail").
+		Where("user_id = ?", userID).Order("id").Find(&contacts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]duplicateCandidate, len(contacts))
+	for i := range contacts {
+		candidates[i] = newDuplicateCandidate(&contacts[i])
+	}
+
+	// Only contacts sharing an email, the tail of a phone number or the start of a name token are
+	// compared, which keeps the scan well below comparing every pair
+	buckets := map[string][]int{}
+	for i, cand := range candidates {
+		keys := map[string]bool{}
+		for _, email := range cand.emails {
+			keys["e:"+email] = true
+		}
+		for _, phone := range cand.phones {
+			keys["p:"+phone[max(0, len(phone)-duplicatePhoneSuffixLen):]] = true
+		}
+		for _, token := range cand.nameTokens {
+			keys["n:"+string([]rune(token)[:min(2, len([]rune(token)))])] = true
+		}
+		for key := range keys {
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	seen := map[[2]int]bool{}
+	var pairs []models.DuplicatePair
+	parent := make([]int, len(candidates))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for _, members := range buckets {
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				key := [2]int{members[x], members[y]}
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				a, b := &candidates[key[0]], &candidates[key[1]]
+				score, reasons := scoreDuplicatePair(a, b)
+				if len(reasons) == 0 || score < minScore {
+					continue
+				}
+				pairs = append(pairs, models.DuplicatePair{
+					ContactID:      a.contact.ID,
+					OtherContactID: b.contact.ID,
+					Score:          score,
+					Reasons:        reasons,
+				})
+				parent[find(key[0])] = find(key[1])
+			}
+		}
+	}
+
+	indexByID := make(map[uint]int, len(candidates))
+	for i, cand := range candidates {
+		indexByID[cand.contact.ID] = i
+	}
+	byRoot := map[int]*models.DuplicateCluster{}
+	for _, pair := range pairs {
+		root := find(indexByID[pair.ContactID])
+		cluster := byRoot[root]
+		if cluster == nil {
+			cluster = &models.DuplicateCluster{}
+			byRoot[root] = cluster
+		}
+		cluster.Pairs = append(cluster.Pairs, pair)
+		cluster.Score = math.Max(cluster.Score, pair.Score)
+	}
+	for i, cand := range candidates {
+		if cluster := byRoot[find(i)]; cluster != nil {
+			cluster.Contacts = append(cluster.Contacts, toDuplicateContact(cand.contact))
+		}
+	}
+
+	clusters := make([]models.DuplicateCluster, 0, len(byRoot))
+	for _, cluster := range byRoot {
+		sort.Slice(cluster.Pairs, func(i, j int) bool {
+			if cluster.Pairs[i].Score != cluster.Pairs[j].Score {
+				return cluster.Pairs[i].Score > cluster.Pairs[j].Score
+			}
+			return cluster.Pairs[i].ContactID < cluster.Pairs[j].ContactID ||
+				(cluster.Pairs[i].ContactID == cluster.Pairs[j].ContactID && cluster.Pairs[i].OtherContactID < cluster.Pairs[j].OtherContactID)
+		})
+		clusters = append(clusters, *cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Score != clusters[j].Score {
+			return clusters[i].Score > clusters[j].Score
+		}
+		return clusters[i].Contacts[0].ID < clusters[j].Contacts[0].ID
+	})
+	return clusters, nil
+}
+
+func newDuplicateCandidate(contact *models.Contact) duplicateCandidate {
+	cand := duplicateCandidate{contact: contact}
+
+	emails := []string{contact.Email}
+	for _, e := range contact.Emails {
+		emails = append(emails, e.Value)
+	}
+	for _, email := range emails {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" && !slices.Contains(cand.emails, email) {
+			cand.emails = append(cand.emails, email)
+		}
+	}
+
+	phones := []string{contact.Phone}
+	for _, p := range contact.Phones {
+		phones = append(phones, p.Value)
+	}
+	for _, phone := range phones {
+		if phone = normalizePhoneForComparison(phone); len(phone) >= minDuplicatePhoneDigits && !slices.Contains(cand.phones, phone) {
+			cand.phones = append(cand.phones, phone)
+		}
+	}
+
+	cand.nameTokens = strings.FieldsFunc(strings.ToLower(contact.Firstname+" "+contact.Lastname), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(cand.nameTokens)
+	cand.name = strings.Join(cand.nameTokens, " ")
+	return cand
+}
+
+// scoreDuplicatePair scores how likely two contacts are the same person and names the signals
+// that matched. Birthdays that contradict each other halve the score.
+func scoreDuplicatePair(a, b *duplicateCandidate) (float64, []string) {
+	var reasons []string
+	remaining := 1.0
+
+	if sharesAny(a.emails, b.emails, func(x, y string) bool { return x == y }) {
+		reasons = append(reasons, "email")
+		remaining *= 1 - duplicateEmailScore
+	}
+	if sharesAny(a.phones, b.phones, phonesMatch) {
+		reasons = append(reasons, "phone")
+		remaining *= 1 - duplicatePhoneScore
+	}
+	// A lone first name says too little about a person to count
+	if len(a.nameTokens) >= 2 && len(b.nameTokens) >= 2 {
+		if similarity := stringSimilarity(a.name, b.name); similarity >= duplicateNameSimilarity {
+			reasons = append(reasons, "name")
+			nameScore := duplicateFuzzyNameScore + (similarity-duplicateNameSimilarity)/(1-duplicateNameSimilarity)*(duplicateNameScore-duplicateFuzzyNameScore)
+			remaining *= 1 - nameScore
+		}
+	}
+
+	score := 1 - remaining
+	if birthdaysConflict(a.contact.Birthday, b.contact.Birthday) {
+		score /= 2
+	}
+	return math.Round(score*100) / 100, reasons
+}
+
+// phonesMatch compares normalized numbers, allowing one of them to carry a country or trunk prefix
+func phonesMatch(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return a == b || (len(a) >= duplicatePhoneSuffixLen && strings.HasSuffix(b, a))
+}
+
+// birthdaysConflict reports whether two birthdays (YYYY-MM-DD or --MM-DD) cannot be the same day
+func birthdaysConflict(a, b string) bool {
+	if a == "" || b == "" || len(a) < 5 || len(b) < 5 {
+		return false
+	}
+	if a[len(a)-5:] != b[len(b)-5:] {
+		return true
+	}
+	return !strings.HasPrefix(a, "--") && !strings.HasPrefix(b, "--") && a != b
+}
+
+// stringSimilarity returns 1 minus the Levenshtein distance relative to the longer string
+func stringSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+func sharesAny(a, b []string, match func(x, y string) bool) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if match(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toDuplicateContact(contact *models.Contact) models.DuplicateContact {
+	dc := models.DuplicateContact{
+		ID:             contact.ID,
+		Firstname:      contact.Firstname,
+		Lastname:       contact.Lastname,
+		Nickname:       contact.Nickname,
+		Organization:   contact.Organization,
+		Emails:         []string{},
+		Phones:         []string{},
+		Birthday:       contact.Birthday,
+		Archived:       contact.Archived,
+		PhotoThumbnail: contact.PhotoThumbnail,
+	}
+	for _, e := range contact.Emails {
+		dc.Emails = append(dc.Emails, e.Value)
+	}
+	if len(dc.Emails) == 0 && contact.Email != "" {
+		dc.Emails = append(dc.Emails, contact.Email)
+	}
+	for _, p := range contact.Phones {
+		dc.Phones = append(dc.Phones, p.Value)
+	}
+	if len(dc.Phones) == 0 && contact.Phone != "" {
+		dc.Phones = append(dc.Phones, contact.Phone)
+	}
+	return dc
+}
+
+// MergeContacts merges the duplicates into the surviving contact and moves them to the trash. The
+// survivor keeps its own values and takes the duplicates' values where it has none; multi-valued
+// fields and circles are combined. Notes, activities, reminders, reminder completions and
+// relationships move to the survivor, as does a photo if the survivor has none.
+//
+// The change to the survivor is recorded in its history as made by editor. It returns the
+// updated survivor and the deleted duplicates.
+func MergeContacts(db *gorm.DB, userID, survivorID uint, duplicateIDs []uint, editor models.ContactEditor) (*models.Contact, []models.Contact, error) {
+	var ids []uint
+	for _, id := range duplicateIDs {
+		if id == survivorID {
+			return nil, nil, ErrMergeIntoSelf
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	var survivor models.Contact
+	var duplicates []models.Contact
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).First(&survivor, survivorID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND id IN ?", userID, ids).Order("id").Find(&duplicates).Error; err != nil {
+			return err
+		}
+		if len(duplicates) != len(ids) {
+			return gorm.ErrRecordNotFound
+		}
+		before := survivor
+
+		for i := range duplicates {
+			dup := &duplicates[i]
+			adoptsPhoto := survivor.Photo == "" && dup.Photo != ""
+			mergeDuplicateFields(&survivor, dup)
+			if err := moveContactRecords(tx, userID, dup.ID, survivor.ID); err != nil {
+				return err
+			}
+			// The photo now belongs to the survivor and must not be removed when the trash is purged
+			if adoptsPhoto {
+				dup.Photo, dup.PhotoThumbnail = "", ""
+				if err := tx.Model(dup).UpdateColumns(map[string]interface{}{"photo": "", "photo_thumbnail": ""}).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Delete(dup).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := dedupeRelationships(tx, userID, survivor.ID); err != nil {
+			return err
+		}
+		if err := tx.Save(&survivor).Error; err != nil {
+			return err
+		}
+		return models.RecordContactVersion(tx, &before, &survivor, editor)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &survivor, duplicates, nil
+}
+
+// mergeDuplicateFields fills the survivor's empty fields from the duplicate, building on
+// MergeImportedContact with the survivor as the incoming side so its values win
+func mergeDuplicateFields(survivor, duplicate *models.Contact) {
+	merged := *duplicate
+	MergeImportedContact(&merged, survivor)
+
+	merged.Model = survivor.Model
+	merged.UserID = survivor.UserID
+	merged.ETag = survivor.ETag
+	merged.SyncRevision = survivor.SyncRevision
+	merged.Archived = survivor.Archived
+	merged.Relationships, merged.Activities, merged.Notes, merged.Reminders = nil, nil, nil, nil
+	if survivor.Photo != "" {
+		merged.Photo, merged.PhotoThumbnail = survivor.Photo, survivor.PhotoThumbnail
+	}
+	if survivor.ContactFrequencyDays != 0 {
+		merged.ContactFrequencyDays = survivor.ContactFrequencyDays
+	}
+
+	merged.Circles = mergeValues(survivor.Circles, duplicate.Circles, func(c string) string { return c })
+	merged.Emails = mergeValues(survivor.Emails, duplicate.Emails, func(e models.ContactEmail) string {
+		return strings.ToLower(strings.TrimSpace(e.Value))
+	})
+	merged.Phones = mergeValues(survivor.Phones, duplicate.Phones, func(p models.ContactPhone) string {
+		return normalizePhoneForComparison(p.Value)
+	})
+	merged.Addresses = mergeValues(survivor.Addresses, duplicate.Addresses, func(a models.ContactAddress) string {
+		return strings.ToLower(models.FormatAddress(a))
+	})
+	merged.URLs = mergeValues(survivor.URLs, duplicate.URLs, func(u models.ContactURL) string {
+		return strings.ToLower(strings.TrimSpace(u.Value))
+	})
+	merged.IMPPs = mergeValues(survivor.IMPPs, duplicate.IMPPs, func(i models.ContactIMPP) string {
+		return strings.ToLower(i.Type + ":" + strings.TrimSpace(i.Value))
+	})
+
+	if len(duplicate.CustomFields) > 0 {
+		fields := make(map[string]string, len(duplicate.CustomFields)+len(survivor.CustomFields))
+		for k, v := range duplicate.CustomFields {
+			fields[k] = v
+		}
+		for k, v := range survivor.CustomFields {
+			fields[k] = v
+		}
+		merged.CustomFields = fields
+	}
+
+	*survivor = merged
+}
+
+// mergeValues appends the values of b that are not in a, comparing by key
+func mergeValues[T any](a, b []T, key func(T) string) []T {
+	if len(b) == 0 {
+		return a
+	}
+	seen := map[string]bool{}
+	result := make([]T, 0, len(a)+len(b))
+	for _, values := range [][]T{a, b} {
+		for _, v := range values {
+			if k := key(v); !seen[k] {
+				seen[k] = true
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+// moveContactRecords reassigns everything linked to one contact to another
+func moveContactRecords(tx *gorm.DB, userID, fromID, toID uint) error {
+	for _, model := range []any{&models.Note{}, &models.Reminder{}, &models.ReminderCompletion{}, &models.ReminderSnooze{}, &models.Relationship{}} {
+		if err := tx.Model(model).Where("contact_id = ? AND user_id = ?", fromID, userID).
+			Update("contact_id", toID).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Model(&models.Relationship{}).Where("related_contact_id = ? AND user_id = ?", fromID, userID).
+		Update("related_contact_id", toID).Error; err != nil {
+		return err
+	}
+
+	// Activities both contacts took part in are already linked to the survivor
+	if err := tx.Exec(`DELETE FROM activity_contacts WHERE contact_id = ?
+		AND activity_id IN (SELECT activity_id FROM activity_contacts WHERE contact_id = ?)`, fromID, toID).Error; err != nil {
+		return err
+	}
+	return tx.Exec("UPDATE activity_contacts SET contact_id = ? WHERE contact_id = ?", toID, fromID).Error
+}
+
+// dedupeRelationships removes the relationships a merge made redundant: links of the contact to
+// itself, and repeats of the same relationship from or to it
+func dedupeRelationships(tx *gorm.DB, userID, contactID uint) error {
+	if err := tx.Where("user_id = ? AND contact_id = ? AND related_contact_id = ?", userID, contactID, contactID).
+		Delete(&models.Relationship{}).Error; err != nil {
+		return err
+	}
+
+	var relationships []models.Relationship
+	if err := tx.Where("user_id = ? AND (contact_id = ? OR related_contact_id = ?)", userID, contactID, contactID).
+		Order("id").Find(&relationships).Error; err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	var redundant []uint
+	for _, r := range relationships {
+		other := "name:" + strings.ToLower(strings.TrimSpace(r.Name))
+		if r.RelatedContactID != nil {
+			other = "id:" + strconv.FormatUint(uint64(*r.RelatedContactID), 10)
+		}
+		key := strconv.FormatUint(uint64(r.ContactID), 10) + "\x00" + strings.ToLower(r.Type) + "\x00" + other
+		if seen[key] {
+			redundant = append(redundant, r.ID)
+			continue
+		}
+		seen[key] = true
+	}
+	if len(redundant) == 0 {
+		return nil
+	}
+	return tx.Delete(&models.Relationship{}, redundant).Error
+}
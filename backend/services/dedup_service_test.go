@@ -0,0 +1,144 @@
+package services
+
+import (
+	"meerkat/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindDuplicateClusters(t *testing.T) {
+	db, _ := setupRouter()
+	userID := uint(1)
+	otherUser := uint(2)
+
+	contacts := []models.Contact{
+		{UserID: userID, Firstname: "John", Lastname: "Smith", Emails: []models.ContactEmail{{Value: "john@example.com"}}},
+		{UserID: userID, Firstname: "Jon", Lastname: "Smith", Emails: []models.ContactEmail{{Value: "other@example.com"}, {Value: "JOHN@example.com"}}},
+		{UserID: userID, Firstname: "Johnny", Lastname: "Smith", Phones: []models.ContactPhone{{Value: "+351 912 345 678"}}},
+		{UserID: userID, Firstname: "Mary", Lastname: "Jones", Phones: []models.ContactPhone{{Value: "912-345-678"}}},
+		{UserID: userID, Firstname: "Jane", Lastname: "Doe", Birthday: "1990-01-01"},
+		{UserID: userID, Firstname: "Jane", Lastname: "Doe", Birthday: "--03-04"},
+		{UserID: userID, Firstname: "Alice"},
+		{UserID: userID, Firstname: "Alice"},
+		{UserID: otherUser, Firstname: "John", Lastname: "Smith", Email: "john@example.com"},
+	}
+	for i := range contacts {
+		require.NoError(t, db.Create(&contacts[i]).Error)
+	}
+
+	clusters, err := FindDuplicateClusters(db, userID, DefaultDuplicateMinScore)
+	require.NoError(t, err)
+	require.Len(t, clusters, 2)
+
+	// Shared email (case-insensitive, from the Emails arrays) plus a similar name
+	assert.Equal(t, 0.98, clusters[0].Score)
+	require.Len(t, clusters[0].Contacts, 2)
+	assert.Equal(t, contacts[0].ID, clusters[0].Contacts[0].ID)
+	assert.Equal(t, contacts[1].ID, clusters[0].Contacts[1].ID)
+	assert.Equal(t, []string{"email", "name"}, clusters[0].Pairs[0].Reasons)
+
+	// The same number with and without a country code
+	assert.Equal(t, 0.85, clusters[1].Score)
+	assert.Equal(t, []string{"phone"}, clusters[1].Pairs[0].Reasons)
+	assert.Equal(t, contacts[2].ID, clusters[1].Pairs[0].ContactID)
+	assert.Equal(t, contacts[3].ID, clusters[1].Pairs[0].OtherContactID)
+
+	// Conflicting birthdays and lone first names only show up at lower scores
+	clusters, err = FindDuplicateClusters(db, userID, 0.3)
+	require.NoError(t, err)
+	require.Len(t, clusters, 3)
+	assert.Equal(t, 0.4, clusters[2].Score)
+	assert.Equal(t, contacts[4].ID, clusters[2].Contacts[0].ID)
+}
+
+func TestMergeContacts(t *testing.T) {
+	db, _ := setupRouter()
+	require.NoError(t, db.AutoMigrate(&models.ReminderCompletion{}))
+	userID := uint(1)
+
+	survivor := models.Contact{
+		UserID: userID, Firstname: "John", Lastname: "Smith", VCardUID: "survivor",
+		Emails:       []models.ContactEmail{{Type: "home", Value: "john@example.com"}},
+		Circles:      []string{"Friends"},
+		CustomFields: map[string]string{"Team": "Blue"},
+	}
+	duplicate := models.Contact{
+		UserID: userID, Firstname: "Jon", Lastname: "Smith", VCardUID: "duplicate",
+		Birthday: "1980-05-06", Organization: "ACME", Photo: "dup.jpg", PhotoThumbnail: "data:image/jpeg;base64,AA",
+		Emails:       []models.ContactEmail{{Type: "work", Value: "JOHN@example.com"}, {Type: "work", Value: "jsmith@acme.test"}},
+		Circles:      []string{"Work", "Friends"},
+		CustomFields: map[string]string{"Team": "Red", "Desk": "4B"},
+	}
+	friend := models.Contact{UserID: userID, Firstname: "Bob"}
+	for _, contact := range []*models.Contact{&survivor, &duplicate, &friend} {
+		require.NoError(t, db.Create(contact).Error)
+	}
+
+	dupID, friendID, survivorID := duplicate.ID, friend.ID, survivor.ID
+	require.NoError(t, db.Create(&models.Note{UserID: userID, Content: "Met at the fair", Date: time.Now(), ContactID: &dupID}).Error)
+	require.NoError(t, db.Create(&models.Reminder{UserID: userID, Message: "Call", RemindAt: time.Now(), Recurrence: "once", ContactID: &dupID}).Error)
+	require.NoError(t, db.Create(&models.ReminderCompletion{UserID: userID, ContactID: dupID, Message: "Called", CompletedAt: time.Now()}).Error)
+	shared := models.Activity{UserID: userID, Title: "Dinner", Date: time.Now(), Contacts: []models.Contact{survivor, duplicate}}
+	own := models.Activity{UserID: userID, Title: "Lunch", Date: time.Now(), Contacts: []models.Contact{duplicate}}
+	require.NoError(t, db.Omit("Contacts.*").Create(&shared).Error)
+	require.NoError(t, db.Omit("Contacts.*").Create(&own).Error)
+	relationships := []models.Relationship{
+		{UserID: userID, Name: "Bob", Type: "Friend", ContactID: survivorID, RelatedContactID: &friendID},
+		{UserID: userID, Name: "Bob", Type: "Friend", ContactID: dupID, RelatedContactID: &friendID},
+		{UserID: userID, Name: "John", Type: "Colleague", ContactID: friendID, RelatedContactID: &dupID},
+		{UserID: userID, Name: "Jon", Type: "Self", ContactID: survivorID, RelatedContactID: &dupID},
+	}
+	for i := range relationships {
+		require.NoError(t, db.Create(&relationships[i]).Error)
+	}
+
+	editor := models.ContactEditor{Source: models.ContactSourceWeb, Actor: "tester"}
+	_, _, err := MergeContacts(db, userID, survivorID, []uint{survivorID}, editor)
+	assert.ErrorIs(t, err, ErrMergeIntoSelf)
+	_, _, err = MergeContacts(db, userID+1, survivorID, []uint{dupID}, editor)
+	assert.Error(t, err)
+
+	merged, removed, err := MergeContacts(db, userID, survivorID, []uint{dupID}, editor)
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Empty(t, removed[0].Photo, "the survivor took over the photo, so it must not be deleted")
+
+	// The survivor's values win; the duplicate fills the gaps and lists are combined
+	var reloaded models.Contact
+	require.NoError(t, db.First(&reloaded, survivorID).Error)
+	assert.Equal(t, merged.ID, reloaded.ID)
+	assert.Equal(t, "John", reloaded.Firstname)
+	assert.Equal(t, "survivor", reloaded.VCardUID)
+	assert.Equal(t, "1980-05-06", reloaded.Birthday)
+	assert.Equal(t, "ACME", reloaded.Organization)
+	assert.Equal(t, "dup.jpg", reloaded.Photo)
+	assert.Equal(t, []string{"Friends", "Work"}, reloaded.Circles)
+	assert.Equal(t, map[string]string{"Team": "Blue", "Desk": "4B"}, reloaded.CustomFields)
+	assert.Equal(t, []models.ContactEmail{{Type: "home", Value: "john@example.com"}, {Type: "work", Value: "jsmith@acme.test"}}, reloaded.Emails)
+
+	var count int64
+	db.Model(&models.Contact{}).Where("id = ?", dupID).Count(&count)
+	assert.Zero(t, count)
+
+	// Everything linked to the duplicate moved
+	db.Model(&models.Note{}).Where("contact_id = ?", survivorID).Count(&count)
+	assert.Equal(t, int64(1), count)
+	db.Model(&models.Reminder{}).Where("contact_id = ?", survivorID).Count(&count)
+	assert.Equal(t, int64(1), count)
+	db.Model(&models.ReminderCompletion{}).Where("contact_id = ?", survivorID).Count(&count)
+	assert.Equal(t, int64(1), count)
+	db.Table("activity_contacts").Where("contact_id = ?", survivorID).Count(&count)
+	assert.Equal(t, int64(2), count)
+	db.Table("activity_contacts").Where("contact_id = ?", dupID).Count(&count)
+	assert.Zero(t, count)
+
+	var rels []models.Relationship
+	require.NoError(t, db.Order("id").Find(&rels).Error)
+	require.Len(t, rels, 2, "the repeated friendship and the link to itself are dropped")
+	assert.Equal(t, survivorID, rels[0].ContactID)
+	assert.Equal(t, friendID, rels[1].ContactID)
+	assert.Equal(t, survivorID, *rels[1].RelatedContactID)
+}
@@ -35,16 +35,26 @@ type BirthdayItem struct {
 	IsRelationship        bool
 	AssociatedContactName string
 	RelationshipType      string
+	Occasion              string // Age turned or anniversary, if known
+}
+
+// OverdueItem is a single overdue contact row in the email template.
+type OverdueItem struct {
+	Name            string
+	DaysText        string
+	LastInteraction string
 }
 
 // ReminderEmailData holds all data passed to the reminder email template.
 type ReminderEmailData struct {
 	RemindersTitle string
 	BirthdaysTitle string
+	OverdueTitle   string
 	ContactLabel   string
 	Footer         string
 	Reminders      []ReminderItem
 	Birthdays      []BirthdayItem
+	Overdue        []OverdueItem
 }
 
 // PasswordResetEmailData holds all data passed to the password reset email template.
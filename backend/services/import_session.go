@@ -171,7 +171,7 @@ func (m *ImportSessionManager) PreviewCSV(db *gorm.DB, userID uint, req models.I
 
 // Confirm executes a CSV or VCF import using the per-row actions in req, then deletes
 // the session. Photo processing is handled separately by ConfirmVCF.
-func (m *ImportSessionManager) Confirm(db *gorm.DB, userID uint, req models.ImportConfirmRequest, log *zerolog.Logger) (*models.ImportResult, *apperrors.AppError) {
+func (m *ImportSessionManager) Confirm(db *gorm.DB, userID uint, req models.ImportConfirmRequest, editor models.ContactEditor, log *zerolog.Logger) (*models.ImportResult, *apperrors.AppError) {
 	sessionData, sessErr := m.get(req.SessionID, userID)
 	if sessErr != nil {
 		return nil, sessErr
@@ -207,7 +207,7 @@ func (m *ImportSessionManager) Confirm(db *gorm.DB, userID uint, req models.Impo
 				}
 				contact.UserID = userID
 
-				if err := tx.Create(&contact).Error; err != nil {
+				if err := createImportedContact(tx, &contact, editor); err != nil {
 					result.Errors = append(result.Errors, fmt.Sprintf("Row %d: Failed to create contact: %v", preview.RowIndex+1, err))
 					result.Skipped++
 				} else {
@@ -239,6 +239,7 @@ func (m *ImportSessionManager) Confirm(db *gorm.DB, userID uint, req models.Impo
 					log.Warn().Err(err).Uint("contact_id", existing.ID).Msg("Failed to create merge note")
 				}
 
+				before := existing
 				if isVCFImport {
 					MergeImportedContact(&existing, sessionData.vcfContacts[preview.RowIndex].Contact)
 				} else {
@@ -246,7 +247,7 @@ func (m *ImportSessionManager) Confirm(db *gorm.DB, userID uint, req models.Impo
 					MergeImportedContact(&existing, &csvContact)
 				}
 
-				if err := tx.Save(&existing).Error; err != nil {
+				if err := saveImportedContact(tx, &before, &existing, editor); err != nil {
 					result.Errors = append(result.Errors, fmt.Sprintf("Row %d: Failed to update contact: %v", preview.RowIndex+1, err))
 					result.Skipped++
 				} else {
@@ -289,7 +290,7 @@ type photoTask struct {
 }
 
 // ConfirmVCF executes a VCF import with photo processing, then deletes the session.
-func (m *ImportSessionManager) ConfirmVCF(db *gorm.DB, userID uint, req models.ImportConfirmRequest, cfg *config.Config, log *zerolog.Logger) (*models.ImportResult, *apperrors.AppError) {
+func (m *ImportSessionManager) ConfirmVCF(db *gorm.DB, userID uint, req models.ImportConfirmRequest, editor models.ContactEditor, cfg *config.Config, log *zerolog.Logger) (*models.ImportResult, *apperrors.AppError) {
 	sessionData, sessErr := m.get(req.SessionID, userID)
 	if sessErr != nil {
 		return nil, sessErr
@@ -325,7 +326,7 @@ func (m *ImportSessionManager) ConfirmVCF(db *gorm.DB, userID uint, req models.I
 				contact := *vcfData.Contact
 				contact.UserID = userID
 
-				if err := tx.Create(&contact).Error; err != nil {
+				if err := createImportedContact(tx, &contact, editor); err != nil {
 					result.Errors = append(result.Errors, fmt.Sprintf("Row %d: Failed to create contact: %v", preview.RowIndex+1, err))
 					result.Skipped++
 				} else {
@@ -359,9 +360,10 @@ func (m *ImportSessionManager) ConfirmVCF(db *gorm.DB, userID uint, req models.I
 					log.Warn().Err(err).Uint("contact_id", existing.ID).Msg("Failed to create merge note")
 				}
 
+				before := existing
 				MergeImportedContact(&existing, vcfData.Contact)
 
-				if err := tx.Save(&existing).Error; err != nil {
+				if err := saveImportedContact(tx, &before, &existing, editor); err != nil {
 					result.Errors = append(result.Errors, fmt.Sprintf("Row %d: Failed to update contact: %v", preview.RowIndex+1, err))
 					result.Skipped++
 				} else {
@@ -415,7 +417,13 @@ func (m *ImportSessionManager) ConfirmVCF(db *gorm.DB, userID uint, req models.I
 			continue
 		}
 
-		if err := db.Model(&models.Contact{}).Where("id = ?", task.contactID).Updates(map[string]interface{}{
+		// Update through the loaded contact so the save hooks record the change for CardDAV sync
+		var contact models.Contact
+		if err := db.First(&contact, task.contactID).Error; err != nil {
+			log.Warn().Err(err).Uint("contact_id", task.contactID).Msg("Failed to load contact for photo update")
+			continue
+		}
+		if err := db.Model(&contact).Updates(map[string]interface{}{
 			"photo":           photoPath,
 			"photo_thumbnail": thumbnailData,
 		}).Error; err != nil {
@@ -437,6 +445,22 @@ func (m *ImportSessionManager) ConfirmVCF(db *gorm.DB, userID uint, req models.I
 	return &result, nil
 }
 
+// createImportedContact creates a contact from an import row and starts its history
+func createImportedContact(tx *gorm.DB, contact *models.Contact, editor models.ContactEditor) error {
+	if err := tx.Create(contact).Error; err != nil {
+		return err
+	}
+	return models.RecordContactVersion(tx, nil, contact, editor)
+}
+
+// saveImportedContact saves a contact an import row was merged into and records the change
+func saveImportedContact(tx *gorm.DB, before, contact *models.Contact, editor models.ContactEditor) error {
+	if err := tx.Save(contact).Error; err != nil {
+		return err
+	}
+	return models.RecordContactVersion(tx, before, contact, editor)
+}
+
 // buildActionMap indexes per-row import actions by row index.
 func buildActionMap(actions []models.RowImportAction) map[int]string {
 	actionMap := make(map[int]string, len(actions))
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"meerkat/models"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LastInteractions returns when the user last interacted with each of the given contacts: the
+// latest of their activities, notes and reminder completions up to now. Contacts without any
+// are left out.
+func LastInteractions(db *gorm.DB, userID uint, contactIDs []uint, now time.Time) (map[uint]time.Time, error) {
+	last := make(map[uint]time.Time)
+	if len(contactIDs) == 0 {
+		return last, nil
+	}
+
+	// Plain rows rather than MAX(), which SQLite returns as text instead of a timestamp
+	queries := map[string]*gorm.DB{
+		"activities": db.Table("activity_contacts").
+			Select("activity_contacts.contact_id, activities.date").
+			Joins("JOIN activities ON activities.id = activity_contacts.activity_id").
+			Where("activities.user_id = ? AND activities.deleted_at IS NULL", userID).
+			Where("activity_contacts.contact_id IN ? AND activities.date <= ?", contactIDs, now),
+		"notes": db.Model(&models.Note{}).
+			Select("contact_id, date").
+			Where("user_id = ? AND contact_id IN ? AND date <= ?", userID, contactIDs, now),
+		"reminder completions": db.Model(&models.ReminderCompletion{}).
+			Select("contact_id, completed_at AS date").
+			Where("user_id = ? AND contact_id IN ? AND completed_at <= ?", userID, contactIDs, now),
+	}
+	for source, query := range queries {
+		var rows []struct {
+			ContactID uint
+			Date      time.Time
+		}
+		if err := query.Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to retrieve %s: %w", source, err)
+		}
+		for _, row := range rows {
+			if row.Date.After(last[row.ContactID]) {
+				last[row.ContactID] = row.Date
+			}
+		}
+	}
+	return last, nil
+}
+
+// GetOverdueContacts returns the user's contacts with a contact frequency that are due for an
+// interaction: the frequency has passed since their last interaction, or since they were added
+// if there has been none. Archived contacts are left out. The most overdue contacts come first.
+func GetOverdueContacts(db *gorm.DB, userID uint, now time.Time) ([]models.OverdueContact, error) {
+	var contacts []models.Contact
+	if err := db.Select("id", "created_at", "firstname", "lastname", "nickname", "photo_thumbnail", "contact_frequency_days").
+		Where("user_id = ? AND archived = ? AND contact_frequency_days > 0", userID, false).
+		Find(&contacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve tracked contacts: %w", err)
+	}
+
+	ids := make([]uint, len(contacts))
+	for i, contact := range contacts {
+		ids[i] = contact.ID
+	}
+	lastInteractions, err := LastInteractions(db, userID, ids, now)
+	if err != nil {
+		return nil, err
+	}
+
+	overdue := []models.OverdueContact{}
+	for _, contact := range contacts {
+		since := contact.CreatedAt
+		var lastInteraction *time.Time
+		if last, ok := lastInteractions[contact.ID]; ok {
+			since = last
+			lastInteraction = &last
+		}
+		dueAt := since.AddDate(0, 0, contact.ContactFrequencyDays)
+		if dueAt.After(now) {
+			continue
+		}
+		overdue = append(overdue, models.OverdueContact{
+			ID:                   contact.ID,
+			Firstname:            contact.Firstname,
+			Lastname:             contact.Lastname,
+			Nickname:             contact.Nickname,
+			PhotoThumbnail:       contact.PhotoThumbnail,
+			ContactFrequencyDays: contact.ContactFrequencyDays,
+			LastInteraction:      lastInteraction,
+			DueAt:                dueAt,
+			DaysOverdue:          int(now.Sub(dueAt) / (24 * time.Hour)),
+		})
+	}
+
+	sort.SliceStable(overdue, func(i, j int) bool { return overdue[i].DueAt.Before(overdue[j].DueAt) })
+	return overdue, nil
+}
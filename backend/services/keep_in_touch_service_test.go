@@ -0,0 +1,107 @@
+package services
+
+import (
+	"meerkat/config"
+	"meerkat/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestGetOverdueContacts(t *testing.T) {
+	db, _ := setupRouter()
+	require.NoError(t, db.AutoMigrate(&models.ReminderCompletion{}))
+	userID := uint(1)
+	now := time.Now()
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	newContact := func(name string, frequency int, created time.Time) models.Contact {
+		contact := models.Contact{UserID: userID, Firstname: name, ContactFrequencyDays: frequency}
+		contact.CreatedAt = created
+		require.NoError(t, db.Create(&contact).Error)
+		return contact
+	}
+	met := newContact("Met", 30, daysAgo(400))         // Activity 45 days ago
+	wrote := newContact("Wrote", 30, daysAgo(400))     // Note 10 days ago
+	called := newContact("Called", 7, daysAgo(400))    // Completion 8 days ago
+	planned := newContact("Planned", 30, daysAgo(400)) // Only a future activity
+	newContact("Newcomer", 30, daysAgo(3))             // No interactions yet, but only just added
+	newContact("Untracked", 0, daysAgo(400))
+	archived := newContact("Archived", 30, daysAgo(400))
+	require.NoError(t, db.Model(&archived).Update("archived", true).Error)
+
+	for _, activity := range []models.Activity{
+		{UserID: userID, Title: "Dinner", Date: daysAgo(45), Contacts: []models.Contact{met}},
+		{UserID: userID, Title: "Trip", Date: now.AddDate(0, 0, 5), Contacts: []models.Contact{planned}},
+	} {
+		require.NoError(t, db.Omit("Contacts.*").Create(&activity).Error)
+	}
+	wroteID := wrote.ID
+	require.NoError(t, db.Create(&models.Note{UserID: userID, Content: "Letter", Date: daysAgo(10), ContactID: &wroteID}).Error)
+	require.NoError(t, db.Create(&models.ReminderCompletion{UserID: userID, ContactID: called.ID, Message: "Call", CompletedAt: daysAgo(8)}).Error)
+
+	overdue, err := GetOverdueContacts(db, userID, now)
+	require.NoError(t, err)
+	names := make([]string, len(overdue))
+	for i, contact := range overdue {
+		names[i] = contact.Firstname
+	}
+	assert.Equal(t, []string{"Planned", "Met", "Called"}, names, "most overdue first")
+
+	assert.Nil(t, overdue[0].LastInteraction, "future activities do not count")
+	assert.Equal(t, 370, overdue[0].DaysOverdue)
+	require.NotNil(t, overdue[1].LastInteraction)
+	assert.WithinDuration(t, daysAgo(45), *overdue[1].LastInteraction, time.Second)
+	assert.Equal(t, 15, overdue[1].DaysOverdue)
+	assert.WithinDuration(t, daysAgo(1), overdue[2].DueAt, time.Second)
+	assert.Equal(t, 7, overdue[2].ContactFrequencyDays)
+}
+
+func TestSendRemindersIncludesNewlyOverdueContacts(t *testing.T) {
+	db, _ := setupRouter()
+	require.NoError(t, db.AutoMigrate(&models.ReminderCompletion{}))
+	now := time.Now()
+
+	newUser := func(name string, lastContact time.Time) models.User {
+		user := models.User{Username: name, Password: "password123", Email: name + "@example.com"}
+		require.NoError(t, db.Create(&user).Error)
+		contact := models.Contact{UserID: user.ID, Firstname: "Friend of " + name, ContactFrequencyDays: 30}
+		contact.CreatedAt = lastContact
+		require.NoError(t, db.Create(&contact).Error)
+		return user
+	}
+	// Overdue since a few hours ago, and overdue for a week already
+	fresh := newUser("fresh", now.AddDate(0, 0, -30).Add(-time.Hour))
+	newUser("stale", now.AddDate(0, 0, -37))
+
+	var emailed []uint
+	originalSender := sendReminderEmailFn
+	sendReminderEmailFn = func(u models.User, reminders []models.Reminder, cfg config.Config, db *gorm.DB) error {
+		emailed = append(emailed, u.ID)
+		return nil
+	}
+	defer func() { sendReminderEmailFn = originalSender }()
+
+	cfg := config.Config{
+		UseResend:       true,
+		ResendAPIKey:    "test_api_key",
+		ResendFromEmail: "noreply@example.com",
+		ReminderTime:    "00:00",
+	}
+	require.NoError(t, SendReminders(db, cfg))
+	assert.Equal(t, []uint{fresh.ID}, emailed, "contacts that stay overdue do not trigger an email every day")
+}
+
+func TestRenderReminderEmailWithOverdueContacts(t *testing.T) {
+	html, err := renderReminderEmail(ReminderEmailData{
+		OverdueTitle: "Time to Get in Touch",
+		Overdue:      []OverdueItem{{Name: "Alice Smith", DaysText: "3 days overdue", LastInteraction: "Last contact: 01.02.2026"}},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, html, "Time to Get in Touch")
+	assert.Contains(t, html, "Alice Smith")
+	assert.Contains(t, html, "Last contact: 01.02.2026")
+}
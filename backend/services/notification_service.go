@@ -0,0 +1,281 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"meerkat/config"
+	"meerkat/i18n"
+	"meerkat/logger"
+	"meerkat/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NotificationKindTest is the kind of the notification sent by TestNotificationChannel. Channels
+// receive it regardless of their kinds.
+const NotificationKindTest = "test"
+
+// Notification is a short message for a push service or chat room, already in the user's language
+type Notification struct {
+	Kind    string `json:"kind"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// Notifier delivers notifications through one type of channel
+type Notifier interface {
+	Send(ctx context.Context, channel models.NotificationChannel, n Notification) error
+}
+
+var notifiers = map[string]Notifier{
+	models.NotificationChannelNtfy:    ntfyNotifier{},
+	models.NotificationChannelGotify:  gotifyNotifier{},
+	models.NotificationChannelApprise: appriseNotifier{},
+	models.NotificationChannelMatrix:  matrixNotifier{},
+	models.NotificationChannelWebhook: webhookNotifier{},
+}
+
+// ntfyNotifier publishes to a topic on an ntfy server. JSON publishing keeps non-ASCII titles
+// intact, which headers would not.
+type ntfyNotifier struct{}
+
+func (ntfyNotifier) Send(ctx context.Context, channel models.NotificationChannel, n Notification) error {
+	body := map[string]interface{}{
+		"topic":   channel.Target,
+		"title":   n.Title,
+		"message": n.Message,
+		"tags":    []string{notificationTag(n.Kind)},
+	}
+	return sendNotificationRequest(ctx, http.MethodPost, channel.URL, body, bearerHeader(channel.Token))
+}
+
+// gotifyNotifier creates a message on a Gotify server with an application token
+type gotifyNotifier struct{}
+
+func (gotifyNotifier) Send(ctx context.Context, channel models.NotificationChannel, n Notification) error {
+	target, err := url.JoinPath(channel.URL, "message")
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"title":    n.Title,
+		"message":  n.Message,
+		"priority": 5,
+	}
+	return sendNotificationRequest(ctx, http.MethodPost, target, body, map[string]string{"X-Gotify-Key": channel.Token})
+}
+
+// appriseNotifier posts to an Apprise API notify endpoint, which fans the message out to the
+// services configured there. Target optionally restricts it to a tag.
+type appriseNotifier struct{}
+
+func (appriseNotifier) Send(ctx context.Context, channel models.NotificationChannel, n Notification) error {
+	body := map[string]interface{}{
+		"title": n.Title,
+		"body":  n.Message,
+		"type":  "info",
+	}
+	if channel.Target != "" {
+		body["tag"] = channel.Target
+	}
+	return sendNotificationRequest(ctx, http.MethodPost, channel.URL, body, bearerHeader(channel.Token))
+}
+
+// matrixNotifier sends a text message to a room through the client-server API
+type matrixNotifier struct{}
+
+func (matrixNotifier) Send(ctx context.Context, channel models.NotificationChannel, n Notification) error {
+	// The transaction ID makes retries of the same request idempotent
+	target, err := url.JoinPath(channel.URL, "_matrix/client/v3/rooms", url.PathEscape(channel.Target), "send/m.room.message", uuid.New().String())
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"msgtype": "m.text",
+		"body":    n.Title + "\n" + n.Message,
+	}
+	return sendNotificationRequest(ctx, http.MethodPut, target, body, bearerHeader(channel.Token))
+}
+
+// webhookNotifier posts the notification in the envelope of Meerkat's webhooks, signed with the
+// token if one is set
+type webhookNotifier struct{}
+
+func (webhookNotifier) Send(ctx context.Context, channel models.NotificationChannel, n Notification) error {
+	body, err := buildPayloadBody("notification."+n.Kind, n)
+	if err != nil {
+		return err
+	}
+	header := map[string]string{"X-Meerkat-Event": "notification." + n.Kind}
+	if channel.Token != "" {
+		header["X-Webhook-Signature"] = "sha256=" + computeSignature(channel.Token, body)
+	}
+	return sendNotificationRequest(ctx, http.MethodPost, channel.URL, json.RawMessage(body), header)
+}
+
+func bearerHeader(token string) map[string]string {
+	if token == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+// notificationTag is the ntfy tag, shown as an emoji, for a kind of notification
+func notificationTag(kind string) string {
+	switch kind {
+	case models.NotificationKindBirthday:
+		return "birthday"
+	case models.NotificationKindOverdue:
+		return "wave"
+	default:
+		return "bell"
+	}
+}
+
+func sendNotificationRequest(ctx context.Context, method, target string, body interface{}, header map[string]string) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := deliveryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
+		resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SendNotification delivers a notification through the channel and records the outcome on it
+func SendNotification(ctx context.Context, db *gorm.DB, cfg config.Config, channel *models.NotificationChannel, n Notification) error {
+	notifier, ok := notifiers[channel.Type]
+	var err error
+	switch {
+	case !ok:
+		err = fmt.Errorf("unknown channel type %q", channel.Type)
+	case cfg.WebhookBlockPrivateURLs && isPrivateURL(channel.URL):
+		err = errors.New("channel URL resolves to a private or loopback address")
+	default:
+		err = notifier.Send(ctx, *channel, n)
+	}
+
+	if err != nil {
+		errStr := err.Error()
+		channel.LastError = &errStr
+	} else {
+		now := time.Now()
+		channel.LastSentAt = &now
+		channel.LastError = nil
+	}
+	if dbErr := db.Model(channel).Select("LastSentAt", "LastError").Updates(channel).Error; dbErr != nil {
+		logger.Error().Err(dbErr).Uint("channel_id", channel.ID).Msg("Failed to record notification delivery")
+	}
+	return err
+}
+
+// TestNotificationChannel sends a test notification through the channel, regardless of its kinds
+func TestNotificationChannel(ctx context.Context, db *gorm.DB, cfg config.Config, channel *models.NotificationChannel, lang string) error {
+	return SendNotification(ctx, db, cfg, channel, Notification{
+		Kind:    NotificationKindTest,
+		Title:   "Meerkat CRM",
+		Message: i18n.T(lang, "notification.test"),
+	})
+}
+
+// ActiveNotificationChannels returns the user's active notification channels
+func ActiveNotificationChannels(db *gorm.DB, userID uint) ([]models.NotificationChannel, error) {
+	var channels []models.NotificationChannel
+	if err := db.Where("user_id = ? AND is_active = ?", userID, true).Order("id").Find(&channels).Error; err != nil {
+		return nil, fmt.Errorf("failed to load notification channels: %w", err)
+	}
+	return channels, nil
+}
+
+// NotifyChannels sends each notification to the channels subscribed to its kind. Failures are
+// logged and recorded on the channel. It returns the kinds that reached at least one channel.
+func NotifyChannels(ctx context.Context, db *gorm.DB, cfg config.Config, channels []models.NotificationChannel, notifications []Notification) map[string]bool {
+	delivered := make(map[string]bool)
+	for i := range channels {
+		channel := &channels[i]
+		for _, n := range notifications {
+			if !channel.Receives(n.Kind) {
+				continue
+			}
+			if err := SendNotification(ctx, db, cfg, channel, n); err != nil {
+				logger.Warn().Err(err).Uint("channel_id", channel.ID).Str("type", channel.Type).Msg("Failed to send notification")
+				continue
+			}
+			delivered[n.Kind] = true
+		}
+	}
+	return delivered
+}
+
+// buildNotifications builds the notifications for a reminder run: one per due reminder, per
+// birthday or anniversary today and per contact that became overdue
+func buildNotifications(db *gorm.DB, user models.User, reminders []models.Reminder, birthdays []models.Birthday, overdue []models.OverdueContact) []Notification {
+	lang := user.Language
+	notifications := make([]Notification, 0, len(reminders)+len(birthdays)+len(overdue))
+
+	for _, reminder := range reminders {
+		name := i18n.T(lang, "email.reminder.unknownContact")
+		if reminder.ContactID != nil {
+			var contact models.Contact
+			if err := db.Where("user_id = ?", reminder.UserID).First(&contact, *reminder.ContactID).Error; err == nil {
+				name = ContactDisplayName(contact)
+			}
+		}
+		notifications = append(notifications, Notification{
+			Kind:    models.NotificationKindReminder,
+			Title:   i18n.T(lang, "notification.reminder", map[string]string{"name": name}),
+			Message: reminder.Message,
+		})
+	}
+
+	for _, birthday := range birthdays {
+		title := i18n.T(lang, "calendar.birthday", map[string]string{"name": birthday.Name})
+		message := i18n.T(lang, "email.reminder.today")
+		if birthday.Kind == models.DateKindAnniversary {
+			title = i18n.T(lang, "calendar.anniversary", map[string]string{"name": birthday.Name})
+			if birthday.Years != nil {
+				message = i18n.T(lang, "email.reminder.anniversaryYears", map[string]string{"years": strconv.Itoa(*birthday.Years)})
+			}
+		} else if birthday.Years != nil {
+			message = i18n.T(lang, "email.reminder.turns", map[string]string{"years": strconv.Itoa(*birthday.Years)})
+		}
+		notifications = append(notifications, Notification{Kind: models.NotificationKindBirthday, Title: title, Message: message})
+	}
+
+	for _, contact := range overdue {
+		name := ContactDisplayName(models.Contact{Firstname: contact.Firstname, Lastname: contact.Lastname, Nickname: contact.Nickname})
+		notifications = append(notifications, Notification{
+			Kind:    models.NotificationKindOverdue,
+			Title:   i18n.T(lang, "email.reminder.overdueTitle"),
+			Message: i18n.T(lang, "notification.overdue", map[string]string{"name": name}),
+		})
+	}
+	return notifications
+}
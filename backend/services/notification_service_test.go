@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"meerkat/config"
+	"meerkat/i18n"
+	"meerkat/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type capturedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+// notificationStandIn records the requests a notifier makes in place of the real service
+func notificationStandIn(t *testing.T) (*httptest.Server, *[]capturedRequest) {
+	var requests []capturedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &body))
+		requests = append(requests, capturedRequest{Method: r.Method, Path: r.URL.EscapedPath(), Header: r.Header, Body: body})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestNotifiers(t *testing.T) {
+	n := Notification{Kind: models.NotificationKindBirthday, Title: "Jürgen's birthday", Message: "Turns 40"}
+
+	t.Run("ntfy", func(t *testing.T) {
+		server, requests := notificationStandIn(t)
+		channel := models.NotificationChannel{Type: models.NotificationChannelNtfy, URL: server.URL, Target: "meerkat", Token: "tk_secret"}
+		require.NoError(t, notifiers[channel.Type].Send(context.Background(), channel, n))
+		require.Len(t, *requests, 1)
+		req := (*requests)[0]
+		assert.Equal(t, "POST", req.Method)
+		assert.Equal(t, "Bearer tk_secret", req.Header.Get("Authorization"))
+		assert.Equal(t, "meerkat", req.Body["topic"])
+		assert.Equal(t, "Jürgen's birthday", req.Body["title"])
+		assert.Equal(t, []interface{}{"birthday"}, req.Body["tags"])
+	})
+
+	t.Run("gotify", func(t *testing.T) {
+		server, requests := notificationStandIn(t)
+		channel := models.NotificationChannel{Type: models.NotificationChannelGotify, URL: server.URL + "/gotify/", Token: "app-token"}
+		require.NoError(t, notifiers[channel.Type].Send(context.Background(), channel, n))
+		req := (*requests)[0]
+		assert.Equal(t, "/gotify/message", req.Path)
+		assert.Equal(t, "app-token", req.Header.Get("X-Gotify-Key"))
+		assert.Equal(t, "Turns 40", req.Body["message"])
+	})
+
+	t.Run("apprise", func(t *testing.T) {
+		server, requests := notificationStandIn(t)
+		channel := models.NotificationChannel{Type: models.NotificationChannelApprise, URL: server.URL + "/notify/meerkat", Target: "family"}
+		require.NoError(t, notifiers[channel.Type].Send(context.Background(), channel, n))
+		req := (*requests)[0]
+		assert.Equal(t, "/notify/meerkat", req.Path)
+		assert.Empty(t, req.Header.Get("Authorization"))
+		assert.Equal(t, "Turns 40", req.Body["body"])
+		assert.Equal(t, "family", req.Body["tag"])
+	})
+
+	t.Run("matrix", func(t *testing.T) {
+		server, requests := notificationStandIn(t)
+		channel := models.NotificationChannel{Type: models.NotificationChannelMatrix, URL: server.URL, Target: "!room:example.org", Token: "syt_secret"}
+		require.NoError(t, notifiers[channel.Type].Send(context.Background(), channel, n))
+		req := (*requests)[0]
+		assert.Equal(t, "PUT", req.Method)
+		assert.True(t, strings.HasPrefix(req.Path, "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/"), req.Path)
+		assert.Equal(t, "Bearer syt_secret", req.Header.Get("Authorization"))
+		assert.Equal(t, "m.text", req.Body["msgtype"])
+		assert.Equal(t, "Jürgen's birthday\nTurns 40", req.Body["body"])
+	})
+
+	t.Run("webhook", func(t *testing.T) {
+		server, requests := notificationStandIn(t)
+		channel := models.NotificationChannel{Type: models.NotificationChannelWebhook, URL: server.URL, Token: "signing-secret"}
+		require.NoError(t, notifiers[channel.Type].Send(context.Background(), channel, n))
+		req := (*requests)[0]
+		assert.Equal(t, "notification.birthday", req.Body["event"])
+		assert.Equal(t, "notification.birthday", req.Header.Get("X-Meerkat-Event"))
+		assert.True(t, strings.HasPrefix(req.Header.Get("X-Webhook-Signature"), "sha256="))
+		assert.Equal(t, map[string]interface{}{"kind": "birthday", "title": "Jürgen's birthday", "message": "Turns 40"}, req.Body["data"])
+	})
+}
+
+func TestSendRemindersNotifiesChannels(t *testing.T) {
+	require.NoError(t, i18n.Init())
+	db, _ := setupRouter()
+	require.NoError(t, db.AutoMigrate(&models.ReminderCompletion{}))
+	server, requests := notificationStandIn(t)
+
+	user := models.User{Username: "pushy", Password: "password123", Email: "pushy@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+	contact := models.Contact{UserID: user.ID, Firstname: "Jane", Lastname: "Doe", Birthday: time.Now().UTC().Format("2006-01-02")}
+	require.NoError(t, db.Create(&contact).Error)
+	byMail := true
+	reminder := models.Reminder{UserID: user.ID, ContactID: &contact.ID, Message: "Send the book back", ByMail: &byMail, RemindAt: time.Now().Add(-time.Hour), Recurrence: "once"}
+	require.NoError(t, db.Create(&reminder).Error)
+
+	reminders := models.NotificationChannel{UserID: user.ID, Name: "ntfy", Type: models.NotificationChannelNtfy, URL: server.URL, Target: "reminders", Kinds: []string{models.NotificationKindReminder}, IsActive: true}
+	birthdays := models.NotificationChannel{UserID: user.ID, Name: "Gotify", Type: models.NotificationChannelGotify, URL: server.URL, Token: "app-token", Kinds: []string{models.NotificationKindBirthday}, IsActive: true}
+	paused := models.NotificationChannel{UserID: user.ID, Name: "Paused", Type: models.NotificationChannelWebhook, URL: server.URL, Kinds: []string{models.NotificationKindReminder}}
+	for _, channel := range []*models.NotificationChannel{&reminders, &birthdays, &paused} {
+		require.NoError(t, db.Create(channel).Error)
+	}
+	require.NoError(t, db.Model(&paused).Update("is_active", false).Error)
+
+	// Without an email channel, the notification channels alone deliver the reminder
+	require.NoError(t, SendReminders(db, config.Config{ReminderTime: "00:00"}))
+	require.Len(t, *requests, 2)
+	assert.Equal(t, "reminders", (*requests)[0].Body["topic"])
+	assert.Equal(t, "Reminder for Jane Doe", (*requests)[0].Body["title"])
+	assert.Equal(t, "Send the book back", (*requests)[0].Body["message"])
+	assert.Equal(t, "/message", (*requests)[1].Path)
+	assert.Equal(t, "Jane Doe's birthday", (*requests)[1].Body["title"])
+
+	var updated models.Reminder
+	require.NoError(t, db.First(&updated, reminder.ID).Error)
+	assert.True(t, updated.EmailSent)
+
+	var stored models.NotificationChannel
+	require.NoError(t, db.First(&stored, reminders.ID).Error)
+	assert.NotNil(t, stored.LastSentAt)
+}
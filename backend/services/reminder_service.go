@@ -1,27 +1,43 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"meerkat/config"
 	"meerkat/i18n"
 	"meerkat/logger"
 	"meerkat/models"
 	"os"
-	"sort"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/teambition/rrule-go"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var sendReminderEmailFn = sendReminderEmail
 
+var sendTimedReminderEmailFn = sendTimedReminderEmail
+
+// ReminderCheckInterval is how often the scheduler looks for users whose reminder time has come
+const ReminderCheckInterval = 15 * time.Minute
+
 // Default minimum interval between reminder job runs (prevents duplicates during restarts)
-const DefaultReminderMinInterval = 1 * time.Hour
+const DefaultReminderMinInterval = 10 * time.Minute
 
 // ReminderMinInterval can be overridden for testing
 var ReminderMinInterval = DefaultReminderMinInterval
 
+// TimedReminderCheckInterval is how often the scheduler looks for reminders whose time of day has come
+const TimedReminderCheckInterval = 1 * time.Minute
+
+// TimedReminderMinInterval is the minimum interval between runs of the timed reminder job. It is
+// shorter than the check interval so that the scheduler's jitter never skips a run.
+var TimedReminderMinInterval = 30 * time.Second
+
 // getInstanceID returns a unique identifier for this server instance
 func getInstanceID() string {
 	hostname, err := os.Hostname()
@@ -42,8 +58,9 @@ func acquireJobLock(db *gorm.DB, jobName string, minInterval time.Duration) (boo
 	return db.Transaction(func(tx *gorm.DB) error {
 		var job models.JobExecution
 
-		// Try to find existing job execution record
-		err := tx.Where("job_name = ?", jobName).First(&job).Error
+		// Try to find existing job execution record. The row lock keeps instances sharing a
+		// PostgreSQL database from taking the job lock at the same time (SQLite ignores it).
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("job_name = ?", jobName).First(&job).Error
 		if err != nil && err != gorm.ErrRecordNotFound {
 			return err
 		}
@@ -114,7 +131,7 @@ func releaseJobLock(db *gorm.DB, jobName string, success bool) error {
 
 	return db.Transaction(func(tx *gorm.DB) error {
 		var job models.JobExecution
-		if err := tx.Where("job_name = ?", jobName).First(&job).Error; err != nil {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("job_name = ?", jobName).First(&job).Error; err != nil {
 			return err
 		}
 
@@ -141,122 +158,228 @@ func releaseJobLock(db *gorm.DB, jobName string, success bool) error {
 // SendRemindersWithRateLimit wraps SendReminders with distributed locking
 // to prevent duplicate sends during rapid restarts
 func SendRemindersWithRateLimit(db *gorm.DB, cfg config.Config) error {
-	acquired, err := acquireJobLock(db, models.JobNameDailyReminders, ReminderMinInterval)
+	return runWithJobLock(db, models.JobNameDailyReminders, ReminderMinInterval, func() error {
+		return SendReminders(db, cfg)
+	})
+}
+
+// SendTimedRemindersWithRateLimit wraps SendTimedReminders with the same distributed locking
+func SendTimedRemindersWithRateLimit(db *gorm.DB, cfg config.Config) error {
+	return runWithJobLock(db, models.JobNameTimedReminders, TimedReminderMinInterval, func() error {
+		return SendTimedReminders(db, cfg)
+	})
+}
+
+// runWithJobLock runs a job unless it ran less than minInterval ago or another instance holds
+// its lock
+func runWithJobLock(db *gorm.DB, jobName string, minInterval time.Duration, run func() error) error {
+	acquired, err := acquireJobLock(db, jobName, minInterval)
 	if err != nil {
-		logger.Error().Err(err).Msg("Error checking job lock")
+		logger.Error().Err(err).Str("job", jobName).Msg("Error checking job lock")
 		return err
 	}
 
 	if !acquired {
-		logger.Info().Msg("Skipping reminder job - rate limited")
+		logger.Info().Str("job", jobName).Msg("Skipping job - rate limited")
 		return nil
 	}
 
-	// Run the actual reminder logic
-	err = SendReminders(db, cfg)
+	// Run the actual job logic
+	err = run()
 
 	// Release the lock, marking success if no error
-	if releaseErr := releaseJobLock(db, models.JobNameDailyReminders, err == nil); releaseErr != nil {
-		logger.Error().Err(releaseErr).Msg("Error releasing job lock")
+	if releaseErr := releaseJobLock(db, jobName, err == nil); releaseErr != nil {
+		logger.Error().Err(releaseErr).Str("job", jobName).Msg("Error releasing job lock")
 	}
 
 	return err
 }
 
-func SendReminders(db *gorm.DB, config config.Config) error {
-	logger.Info().Msg("Sending reminders...")
-	var reminders []models.Reminder
-	// Get the current time in the configured reminder timezone
-	loc := config.GetReminderLocation()
-	now := time.Now().In(loc)
-	endOfDay := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, loc)
-
-	// Fetch reminders that are:
-	// - Set to be sent by email
-	// - Due today or before
-	// - Not completed
-	// - Email not yet sent for this occurrence
-	err := db.Where("by_mail = ? AND remind_at <= ? AND completed = ? AND email_sent = ?",
-		true, endOfDay, false, false).Find(&reminders).Error
-	if err != nil {
-		return fmt.Errorf("failed to fetch reminders: %w", err)
+// UserLocation returns the user's timezone, or the instance's REMINDER_TIMEZONE if they have not
+// chosen one
+func UserLocation(user models.User, cfg config.Config) *time.Location {
+	if user.Timezone != "" {
+		if loc, err := time.LoadLocation(user.Timezone); err == nil {
+			return loc
+		}
 	}
+	return cfg.GetReminderLocation()
+}
 
-	// Group reminders by user
-	remindersByUser := make(map[uint][]models.Reminder)
-	for _, reminder := range reminders {
-		remindersByUser[reminder.UserID] = append(remindersByUser[reminder.UserID], reminder)
+// UserReminderTime returns the HH:MM at which the user's daily reminder email is sent, or the
+// instance's REMINDER_TIME if they have not chosen one
+func UserReminderTime(user models.User, cfg config.Config) string {
+	if user.ReminderTime != "" {
+		return user.ReminderTime
 	}
+	return cfg.ReminderTime
+}
 
-	// Collect user IDs from reminders
-	userIDSet := make(map[uint]bool)
-	for userID := range remindersByUser {
-		userIDSet[userID] = true
+// UserNow returns the current time in the timezone of the user with the given ID, so that "today"
+// is the user's date. It falls back to the instance timezone if the user cannot be loaded.
+func UserNow(db *gorm.DB, userID uint, cfg config.Config) time.Time {
+	var user models.User
+	if err := db.Select("id", "timezone").First(&user, userID).Error; err != nil {
+		logger.Warn().Err(err).Uint("user_id", userID).Msg("Failed to load user timezone, using the instance timezone")
 	}
+	return time.Now().In(UserLocation(user, cfg))
+}
 
-	// Also include users who have birthdays today (even without reminders)
-	// Check all users and use GetUpcomingBirthdays - if first result is today, include them
-	var allUsers []models.User
-	if err := db.Find(&allUsers).Error; err != nil {
-		logger.Warn().Err(err).Msg("Failed to fetch all users for birthday check, continuing with reminders only")
-	} else {
-		for _, user := range allUsers {
-			if userIDSet[user.ID] {
-				continue // Already included via reminders
-			}
-			birthdays, err := GetUpcomingBirthdays(db, user.ID, now)
-			if err != nil {
-				logger.Warn().Err(err).Uint("user_id", user.ID).Msg("Failed to fetch birthdays for user")
-				continue
-			}
-			if len(birthdays) > 0 && DaysUntilBirthday(birthdays[0].Birthday, now) == 0 {
-				userIDSet[user.ID] = true
-			}
-		}
+// lastReminderSlot returns the most recent time the daily reminder email was due at the given
+// HH:MM: today's if it has passed, otherwise yesterday's. Comparing its date with the date of the
+// last email catches up on a slot that the periodic check skipped past, e.g. at 23:55.
+func lastReminderSlot(now time.Time, reminderTime string) time.Time {
+	at, err := time.Parse("15:04", reminderTime)
+	if err != nil {
+		at = time.Time{}
 	}
+	slot := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if slot.After(now) {
+		slot = slot.AddDate(0, 0, -1)
+	}
+	return slot
+}
 
-	// Convert set to slice
-	userIDs := make([]uint, 0, len(userIDSet))
-	for userID := range userIDSet {
-		userIDs = append(userIDs, userID)
+// reminderTriggered reports whether the reminder.triggered webhook already fired for the
+// reminder's current date, which starts at midnight in the user's timezone
+func reminderTriggered(reminder models.Reminder, loc *time.Location) bool {
+	if reminder.LastTriggered == nil {
+		return false
 	}
+	date := reminder.RemindAt.UTC()
+	return !reminder.LastTriggered.Before(time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc))
+}
 
-	if len(userIDs) == 0 {
-		logger.Info().Msg("No reminders or birthdays to send for today")
-		return nil
+// triggerReminderWebhooks fires the reminder.triggered webhooks of the reminders that have not
+// fired yet for their current date. Failed or disabled emails leave reminders pending, so without
+// this every retry would fire them again.
+func triggerReminderWebhooks(db *gorm.DB, cfg config.Config, reminders []models.Reminder, loc *time.Location) {
+	for _, reminder := range reminders {
+		if reminderTriggered(reminder, loc) {
+			continue
+		}
+		// UpdateColumn leaves updated_at alone, which calendar clients use to detect changes
+		if err := db.Model(&reminder).UpdateColumn("last_triggered", time.Now()).Error; err != nil {
+			logger.Error().Err(err).Uint("reminder_id", reminder.ID).Msg("Failed to record reminder webhook")
+			continue
+		}
+		go TriggerWebhooks(db, cfg, reminder.UserID, "reminder.triggered", reminder)
 	}
+}
+
+// SendReminders sends each user's daily reminder email once their reminder time has passed in
+// their timezone: the reminders due that day, upcoming birthdays and overdue contacts. The due
+// reminders, today's birthdays and newly overdue contacts also go to the user's notification
+// channels. It runs every ReminderCheckInterval. The first run after the reminder time sends the
+// digest, and later runs retry it until it reaches the user by email or a channel; then the
+// birthday webhooks fire. Until the next reminder time, later runs only send reminders that
+// became due since, e.g. after a snooze.
+func SendReminders(db *gorm.DB, config config.Config) error {
+	logger.Info().Msg("Sending reminders...")
 
-	// Fetch all users we need to email
 	var users []models.User
-	if err := db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+	if err := db.Order("id").Find(&users).Error; err != nil {
 		return fmt.Errorf("failed to fetch users: %w", err)
 	}
 
-	userByID := make(map[uint]models.User, len(users))
+	var sent, sendErrors int
 	for _, user := range users {
-		userByID[user.ID] = user
-	}
+		loc := UserLocation(user, config)
+		now := time.Now().In(loc)
+		// The digest is for the date of the last reminder time, which is yesterday's until today's
+		// reminder time
+		slot := lastReminderSlot(now, UserReminderTime(user, config))
+		today := slot.Format("2006-01-02")
+		firstToday := user.ReminderDigestDate != today
+		// New users get their first email at their reminder time, not yesterday's right away
+		if firstToday && user.ReminderDigestDate == "" && today != now.Format("2006-01-02") {
+			continue
+		}
 
-	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+		// Fetch reminders that are:
+		// - Set to be sent by email
+		// - Due on the user's today or before (reminder dates are stored as midnight UTC)
+		// - Not completed
+		// - Email not yet sent for this occurrence
+		endOfDay := time.Date(slot.Year(), slot.Month(), slot.Day()+1, 0, 0, 0, 0, time.UTC)
+		var userReminders []models.Reminder
+		// Reminders with a time of day are left to SendTimedReminders
+		if err := db.Where("user_id = ? AND by_mail = ? AND remind_at < ? AND completed = ? AND email_sent = ? AND remind_time = ?",
+			user.ID, true, endOfDay, false, false, "").Find(&userReminders).Error; err != nil {
+			logger.Error().Err(err).Uint("user_id", user.ID).Msg("Failed to fetch reminders for user")
+			sendErrors++
+			continue
+		}
 
-	var sendErrors int
-	for _, userID := range userIDs {
-		user, exists := userByID[userID]
-		if !exists {
-			logger.Warn().Uint("user_id", userID).Msg("Skipping user - not found")
+		channels, err := ActiveNotificationChannels(db, user.ID)
+		if err != nil {
+			logger.Warn().Err(err).Uint("user_id", user.ID).Msg("Failed to fetch notification channels for user")
+		}
+		reminderChannel := slices.ContainsFunc(channels, func(c models.NotificationChannel) bool {
+			return c.Receives(models.NotificationKindReminder)
+		})
+
+		// Without email or a channel for reminders, reminders stay pending until the next day's digest
+		if !firstToday && (len(userReminders) == 0 || !(config.EmailEnabled() || reminderChannel)) {
 			continue
 		}
 
-		userReminders := remindersByUser[userID] // May be nil/empty for birthday-only users
+		// Birthdays today and contacts that became overdue since yesterday also trigger the first
+		// email of the day; contacts that stay overdue are listed in every email but do not
+		// trigger one each day
+		var todayBirthdays []models.Birthday
+		var newlyOverdue []models.OverdueContact
+		if firstToday {
+			birthdays, err := GetUpcomingBirthdays(db, user.ID, slot)
+			if err != nil {
+				logger.Warn().Err(err).Uint("user_id", user.ID).Msg("Failed to fetch birthdays for user")
+			}
+			for _, birthday := range birthdays {
+				if birthday.DaysUntil == 0 {
+					todayBirthdays = append(todayBirthdays, birthday)
+				}
+			}
+			overdue, err := GetOverdueContacts(db, user.ID, now)
+			if err != nil {
+				logger.Warn().Err(err).Uint("user_id", user.ID).Msg("Failed to fetch overdue contacts for user")
+			}
+			for _, contact := range overdue {
+				if contact.DaysOverdue == 0 {
+					newlyOverdue = append(newlyOverdue, contact)
+				}
+			}
+		}
 
-		// Send email only when enabled; preserve reminders (email_sent=false) when disabled
-		// so they are picked up again once email is configured.
-		if config.EmailEnabled() {
-			if err := sendReminderEmailFn(user, userReminders, config, db); err != nil {
-				logger.Error().Err(err).Uint("user_id", user.ID).Msg("Error sending daily email, skipping reminder mutations for this user")
-				sendErrors++
+		digestDone := true
+		if len(userReminders) > 0 || len(todayBirthdays) > 0 || len(newlyOverdue) > 0 {
+			// Send email only when enabled; preserve reminders (email_sent=false) when disabled
+			// so they are picked up again once email is configured.
+			delivered := false
+			if config.EmailEnabled() {
+				if err := sendReminderEmailFn(user, userReminders, config, db); err != nil {
+					logger.Error().Err(err).Uint("user_id", user.ID).Msg("Error sending daily email")
+					sendErrors++
+				} else {
+					sent++
+					delivered = true
+				}
 			} else {
-				// Mark reminders as email_sent so they won't be re-emailed
+				logger.Info().Int("reminder_count", len(userReminders)).Uint("user_id", user.ID).Msg("Email sending disabled (no email channel configured)")
+			}
+
+			notifications := buildNotifications(db, user, userReminders, todayBirthdays, newlyOverdue)
+			notified := NotifyChannels(context.Background(), db, config, channels, notifications)
+			if notified[models.NotificationKindReminder] {
+				delivered = true
+			}
+			// Today's birthdays and newly overdue contacts are only sent with the first email of the
+			// day, so it is retried on the next run until it reached the user. Without email or a
+			// channel there is nothing to retry.
+			digestDone = delivered || len(notified) > 0 || !(config.EmailEnabled() || len(channels) > 0)
+
+			// Mark reminders as email_sent once they reached the user by email or another channel,
+			// so they won't be sent again
+			if delivered {
 				for _, reminder := range userReminders {
 					reminder.EmailSent = true
 					reminder.LastSent = new(time.Time)
@@ -268,31 +391,140 @@ func SendReminders(db *gorm.DB, config config.Config) error {
 					}
 				}
 			}
-		} else {
-			logger.Info().Int("reminder_count", len(userReminders)).Uint("user_id", userID).Msg("Email sending disabled (no channel configured), skipping reminder mutations to preserve them")
-		}
 
-		// Fire reminder.triggered webhooks regardless of email config
-		for _, reminder := range userReminders {
-			go TriggerWebhooks(db, config, reminder.UserID, "reminder.triggered", reminder)
+			// Fire reminder.triggered webhooks regardless of email config
+			triggerReminderWebhooks(db, config, userReminders, loc)
 		}
 
-		// Fire birthday.occurred for each birthday that falls today regardless of email config
-		todayBirthdays, err := GetUpcomingBirthdays(db, userID, now)
-		if err != nil {
-			logger.Warn().Err(err).Uint("user_id", userID).Msg("Failed to fetch birthdays for webhook")
-		} else {
+		if firstToday && digestDone {
+			// Fire birthday.occurred for each birthday that falls today regardless of email config,
+			// once the day's digest is done so that retries do not fire them again
 			for _, bday := range todayBirthdays {
-				if DaysUntilBirthday(bday.Birthday, now) == 0 {
+				if bday.Kind == models.DateKindBirthday {
 					bday := bday
-					go TriggerWebhooks(db, config, userID, "birthday.occurred", bday)
+					go TriggerWebhooks(db, config, user.ID, "birthday.occurred", bday)
 				}
 			}
+			if err := db.Model(&user).Update("reminder_digest_date", today).Error; err != nil {
+				logger.Error().Err(err).Uint("user_id", user.ID).Msg("Failed to record daily reminder email")
+			}
 		}
 	}
 
 	if sendErrors > 0 {
-		logger.Warn().Int("failed_users", sendErrors).Int("total_users", len(userIDs)).Msg("Some emails failed to send")
+		logger.Warn().Int("failed_users", sendErrors).Int("sent", sent).Msg("Some emails failed to send")
+	}
+
+	return nil
+}
+
+// ReminderDueAt returns when a reminder with a time of day is due: its date at that time in the
+// given location. ok is false for reminders without a time, which are sent with the daily email.
+func ReminderDueAt(reminder models.Reminder, loc *time.Location) (dueAt time.Time, ok bool) {
+	if reminder.RemindTime == "" {
+		return time.Time{}, false
+	}
+	clock, err := time.Parse("15:04", reminder.RemindTime)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// Reminder dates are stored as midnight UTC
+	date := reminder.RemindAt.UTC()
+	return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, loc), true
+}
+
+// SendTimedReminders sends the reminders with a time of day once that time has come in the user's
+// timezone, by email and to the user's reminder channels. It runs every TimedReminderCheckInterval;
+// reminders whose time passed while the server was down are sent on the next run. Users without
+// email or a reminder channel are skipped, apart from the reminder.triggered webhooks.
+func SendTimedReminders(db *gorm.DB, config config.Config) error {
+	now := time.Now()
+	// No timezone is more than 14 hours ahead of UTC, so later dates cannot be due yet
+	var reminders []models.Reminder
+	if err := db.Where("by_mail = ? AND remind_time != ? AND remind_at <= ? AND completed = ? AND email_sent = ?",
+		true, "", now.Add(14*time.Hour), false, false).
+		Order("user_id, remind_at, remind_time").
+		Find(&reminders).Error; err != nil {
+		return fmt.Errorf("failed to fetch timed reminders: %w", err)
+	}
+
+	var userIDs []uint
+	remindersByUser := make(map[uint][]models.Reminder)
+	for _, reminder := range reminders {
+		if _, ok := remindersByUser[reminder.UserID]; !ok {
+			userIDs = append(userIDs, reminder.UserID)
+		}
+		remindersByUser[reminder.UserID] = append(remindersByUser[reminder.UserID], reminder)
+	}
+
+	var sendErrors int
+	for _, userID := range userIDs {
+		var user models.User
+		if err := db.First(&user, userID).Error; err != nil {
+			logger.Warn().Err(err).Uint("user_id", userID).Msg("Skipping timed reminders - user not found")
+			continue
+		}
+
+		loc := UserLocation(user, config)
+		var due []models.Reminder
+		for _, reminder := range remindersByUser[userID] {
+			dueAt, ok := ReminderDueAt(reminder, loc)
+			if !ok || dueAt.After(now) {
+				continue
+			}
+			// Reminders that could not be delivered are retried every ReminderCheckInterval rather
+			// than on every run
+			if reminderTriggered(reminder, loc) && now.Sub(dueAt)%ReminderCheckInterval >= TimedReminderCheckInterval {
+				continue
+			}
+			due = append(due, reminder)
+		}
+		if len(due) == 0 {
+			continue
+		}
+
+		// Fire reminder.triggered webhooks regardless of email config
+		triggerReminderWebhooks(db, config, due, loc)
+
+		channels, err := ActiveNotificationChannels(db, user.ID)
+		if err != nil {
+			logger.Warn().Err(err).Uint("user_id", user.ID).Msg("Failed to fetch notification channels for user")
+		}
+		reminderChannel := slices.ContainsFunc(channels, func(c models.NotificationChannel) bool {
+			return c.Receives(models.NotificationKindReminder)
+		})
+		// Without email or a channel for reminders, reminders stay pending until one is set up
+		if !config.EmailEnabled() && !reminderChannel {
+			continue
+		}
+
+		delivered := false
+		if config.EmailEnabled() {
+			if err := sendTimedReminderEmailFn(user, due, config, db); err != nil {
+				logger.Error().Err(err).Uint("user_id", user.ID).Msg("Error sending timed reminder email")
+				sendErrors++
+			} else {
+				delivered = true
+			}
+		}
+
+		if NotifyChannels(context.Background(), db, config, channels, buildNotifications(db, user, due, nil, nil))[models.NotificationKindReminder] {
+			delivered = true
+		}
+
+		// Undelivered reminders are tried again on the next run
+		if delivered {
+			sentAt := time.Now()
+			for _, reminder := range due {
+				if err := db.Model(&reminder).Updates(map[string]interface{}{"email_sent": true, "last_sent": sentAt}).Error; err != nil {
+					logger.Error().Err(err).Uint("reminder_id", reminder.ID).Msg("Failed to update reminder after sending it")
+				}
+			}
+		}
+	}
+
+	if sendErrors > 0 {
+		logger.Warn().Int("failed_users", sendErrors).Msg("Some timed reminder emails failed to send")
 	}
 
 	return nil
@@ -341,26 +573,21 @@ func formatBirthdayForUser(birthday string, dateFormat string) string {
 	return birthday
 }
 
-// Send email using Resend with daily reminders and upcoming birthdays
-func sendReminderEmail(user models.User, reminders []models.Reminder, config config.Config, db *gorm.DB) error {
-	if user.Email == "" {
-		logger.Warn().Uint("user_id", user.ID).Msg("Skipping reminder email because user email is missing")
-		return nil
-	}
-
-	// Get user's language preference (default to "en" if not set)
-	lang := user.Language
+// emailPreferences returns the user's language and date format, with the defaults for unset ones
+func emailPreferences(user models.User) (lang, dateFormat string) {
+	lang = user.Language
 	if lang == "" {
 		lang = i18n.DefaultLanguage
 	}
-
-	// Get user's date format preference (default to "eu" if not set)
-	dateFormat := user.DateFormat
+	dateFormat = user.DateFormat
 	if dateFormat == "" {
 		dateFormat = "eu"
 	}
+	return lang, dateFormat
+}
 
-	// Build reminder items
+// buildReminderItems lists reminders for the reminder email, with their time of day if they have one
+func buildReminderItems(db *gorm.DB, reminders []models.Reminder, lang, dateFormat string) []ReminderItem {
 	reminderItems := make([]ReminderItem, 0, len(reminders))
 	for _, reminder := range reminders {
 		contactName := i18n.T(lang, "email.reminder.unknownContact")
@@ -370,22 +597,38 @@ func sendReminderEmail(user models.User, reminders []models.Reminder, config con
 				contactName = contact.Firstname + " " + contact.Lastname
 			}
 		}
+		date := formatDateForUser(reminder.RemindAt.UTC(), dateFormat)
+		if reminder.RemindTime != "" {
+			date += " " + reminder.RemindTime
+		}
 		reminderItems = append(reminderItems, ReminderItem{
-			Date:        formatDateForUser(reminder.RemindAt, dateFormat),
+			Date:        date,
 			Message:     reminder.Message,
 			ContactName: contactName,
 		})
 	}
+	return reminderItems
+}
+
+// Send email using Resend with daily reminders and upcoming birthdays
+func sendReminderEmail(user models.User, reminders []models.Reminder, config config.Config, db *gorm.DB) error {
+	if user.Email == "" {
+		logger.Warn().Uint("user_id", user.ID).Msg("Skipping reminder email because user email is missing")
+		return nil
+	}
+
+	lang, dateFormat := emailPreferences(user)
+	reminderItems := buildReminderItems(db, reminders, lang, dateFormat)
 
 	// Build birthday items
-	now := time.Now().In(config.GetReminderLocation())
+	now := time.Now().In(UserLocation(user, config))
 	birthdays, birthdayErr := GetUpcomingBirthdays(db, user.ID, now)
 	if birthdayErr != nil {
 		logger.Warn().Err(birthdayErr).Uint("user_id", user.ID).Msg("Failed to fetch birthdays for email, continuing without them")
 	}
 	birthdayItems := make([]BirthdayItem, 0, len(birthdays))
 	for _, birthday := range birthdays {
-		days := DaysUntilBirthday(birthday.Birthday, now)
+		days := birthday.DaysUntil
 		var daysText, badgeType string
 		switch days {
 		case 0:
@@ -406,23 +649,55 @@ func sendReminderEmail(user models.User, reminders []models.Reminder, config con
 			IsRelationship:        birthday.Type == "relationship",
 			AssociatedContactName: birthday.AssociatedContactName,
 			RelationshipType:      birthday.RelationshipType,
+			Occasion:              birthdayOccasion(birthday, lang),
+		})
+	}
+
+	// Build overdue contact items
+	overdue, overdueErr := GetOverdueContacts(db, user.ID, now)
+	if overdueErr != nil {
+		logger.Warn().Err(overdueErr).Uint("user_id", user.ID).Msg("Failed to fetch overdue contacts for email, continuing without them")
+	}
+	overdueItems := make([]OverdueItem, 0, len(overdue))
+	for _, contact := range overdue {
+		var daysText string
+		switch contact.DaysOverdue {
+		case 0:
+			daysText = i18n.T(lang, "email.reminder.overdueToday")
+		case 1:
+			daysText = i18n.T(lang, "email.reminder.overdueOneDay")
+		default:
+			daysText = i18n.T(lang, "email.reminder.overdueDays", map[string]string{"days": strconv.Itoa(contact.DaysOverdue)})
+		}
+		lastInteraction := i18n.T(lang, "email.reminder.noInteraction")
+		if contact.LastInteraction != nil {
+			lastInteraction = i18n.T(lang, "email.reminder.lastInteraction", map[string]string{
+				"date": formatDateForUser(contact.LastInteraction.In(now.Location()), dateFormat),
+			})
+		}
+		overdueItems = append(overdueItems, OverdueItem{
+			Name:            strings.TrimSpace(contact.Firstname + " " + contact.Lastname),
+			DaysText:        daysText,
+			LastInteraction: lastInteraction,
 		})
 	}
 
 	htmlContent, err := renderReminderEmail(ReminderEmailData{
 		RemindersTitle: i18n.T(lang, "email.reminder.remindersTitle"),
 		BirthdaysTitle: i18n.T(lang, "email.reminder.birthdaysTitle"),
+		OverdueTitle:   i18n.T(lang, "email.reminder.overdueTitle"),
 		ContactLabel:   i18n.T(lang, "email.reminder.contactLabel"),
 		Footer:         i18n.T(lang, "email.footer"),
 		Reminders:      reminderItems,
 		Birthdays:      birthdayItems,
+		Overdue:        overdueItems,
 	})
 	if err != nil {
 		logger.Error().Err(err).Uint("user_id", user.ID).Msg("Failed to render reminder email template")
 		return err
 	}
 
-	logger.Debug().Int("reminder_count", len(reminderItems)).Int("birthday_count", len(birthdayItems)).Uint("user_id", user.ID).Str("language", lang).Msg("Sending reminder email")
+	logger.Debug().Int("reminder_count", len(reminderItems)).Int("birthday_count", len(birthdayItems)).Int("overdue_count", len(overdueItems)).Uint("user_id", user.ID).Str("language", lang).Msg("Sending reminder email")
 
 	if err := SendEmail(config, EmailMessage{
 		To:      user.Email,
@@ -438,6 +713,51 @@ func sendReminderEmail(user models.User, reminders []models.Reminder, config con
 	return nil
 }
 
+// sendTimedReminderEmail sends reminders whose time of day has come, without the birthdays and
+// overdue contacts of the daily email
+func sendTimedReminderEmail(user models.User, reminders []models.Reminder, config config.Config, db *gorm.DB) error {
+	if user.Email == "" {
+		logger.Warn().Uint("user_id", user.ID).Msg("Skipping reminder email because user email is missing")
+		return nil
+	}
+
+	lang, dateFormat := emailPreferences(user)
+	htmlContent, err := renderReminderEmail(ReminderEmailData{
+		RemindersTitle: i18n.T(lang, "email.reminder.remindersTitle"),
+		ContactLabel:   i18n.T(lang, "email.reminder.contactLabel"),
+		Footer:         i18n.T(lang, "email.footer"),
+		Reminders:      buildReminderItems(db, reminders, lang, dateFormat),
+	})
+	if err != nil {
+		logger.Error().Err(err).Uint("user_id", user.ID).Msg("Failed to render reminder email template")
+		return err
+	}
+
+	messages := make([]string, len(reminders))
+	for i, reminder := range reminders {
+		messages[i] = reminder.Message
+	}
+	return SendEmail(config, EmailMessage{
+		To:      user.Email,
+		Subject: i18n.T(lang, "calendar.reminder", map[string]string{"message": strings.Join(messages, ", ")}),
+		HTML:    htmlContent,
+	})
+}
+
+// birthdayOccasion describes what an entry of the birthday feed marks, e.g. "Turns 30"
+func birthdayOccasion(birthday models.Birthday, lang string) string {
+	if birthday.Kind == models.DateKindAnniversary {
+		if birthday.Years != nil {
+			return i18n.T(lang, "email.reminder.anniversaryYears", map[string]string{"years": strconv.Itoa(*birthday.Years)})
+		}
+		return i18n.T(lang, "email.reminder.anniversary")
+	}
+	if birthday.Years != nil {
+		return i18n.T(lang, "email.reminder.turns", map[string]string{"years": strconv.Itoa(*birthday.Years)})
+	}
+	return ""
+}
+
 // addMonths adds the specified number of months to a date, clamping to the last
 // valid day of the target month to handle edge cases like Jan 31 + 1 month -> Feb 28/29
 func addMonths(t time.Time, months int) time.Time {
@@ -473,6 +793,16 @@ func addYears(t time.Time, years int) time.Time {
 // CalculateNextReminderTime determines the next reminder date based on recurrence settings.
 // All calculations are done in UTC to ensure consistency.
 func CalculateNextReminderTime(reminder models.Reminder) time.Time {
+	next, ok := NextReminderTime(reminder)
+	if !ok {
+		return reminder.RemindAt
+	}
+	return next
+}
+
+// NextReminderTime is CalculateNextReminderTime, but reports whether the reminder recurs at all:
+// ok is false for "once" reminders and for custom rules that have no further occurrence.
+func NextReminderTime(reminder models.Reminder) (next time.Time, ok bool) {
 	// Normalize to UTC for consistent calculations
 	now := time.Now().UTC()
 	remindAtUTC := reminder.RemindAt.UTC()
@@ -495,20 +825,167 @@ func CalculateNextReminderTime(reminder models.Reminder) time.Time {
 	switch reminder.Recurrence {
 	case "once":
 		// Will be deleted anyway
-		return reminder.RemindAt
+		return reminder.RemindAt, false
 	case "weekly":
-		return baseTime.AddDate(0, 0, 7)
+		return baseTime.AddDate(0, 0, 7), true
 	case "monthly":
-		return addMonths(baseTime, 1)
+		return addMonths(baseTime, 1), true
 	case "quarterly":
-		return addMonths(baseTime, 3)
+		return addMonths(baseTime, 3), true
 	case "six-months":
-		return addMonths(baseTime, 6)
+		return addMonths(baseTime, 6), true
 	case "yearly":
-		return addYears(baseTime, 1)
+		return addYears(baseTime, 1), true
+	case "custom":
+		rule, err := reminderRule(reminder)
+		if err != nil {
+			logger.Warn().Err(err).Str("rule", reminder.RecurrenceRule).Uint("reminder_id", reminder.ID).Msg("Invalid recurrence rule")
+			return reminder.RemindAt, true
+		}
+		next := rule.After(baseTime, false)
+		return next, !next.IsZero()
 	default:
 		// If the recurrence type is unrecognized, return the original RemindAt
 		logger.Warn().Str("recurrence", reminder.Recurrence).Uint("reminder_id", reminder.ID).Msg("Unrecognized recurrence type")
-		return reminder.RemindAt
+		return reminder.RemindAt, true
+	}
+}
+
+// reminderRule builds the rule of a custom reminder. It counts from the reminder's first date, so
+// that INTERVAL and COUNT keep their meaning however often the reminder has been rescheduled.
+func reminderRule(reminder models.Reminder) (*rrule.RRule, error) {
+	option, err := models.ParseRecurrenceRule(reminder.RecurrenceRule)
+	if err != nil {
+		return nil, err
 	}
+	option.Dtstart = reminder.RemindAt.UTC()
+	if reminder.RecurrenceStart != nil {
+		option.Dtstart = reminder.RecurrenceStart.UTC()
+	}
+	return rrule.NewRRule(*option)
+}
+
+// ReminderRecurrenceRule returns the recurrence of a reminder as an RRULE value for calendar
+// exports, whose events start on the reminder's current date. A COUNT is turned into the date of
+// the last occurrence, as the count starts at the reminder's first date. ok is false for reminders
+// that do not recur.
+func ReminderRecurrenceRule(reminder models.Reminder) (value string, ok bool) {
+	switch reminder.Recurrence {
+	case "weekly":
+		return "FREQ=WEEKLY", true
+	case "monthly":
+		return "FREQ=MONTHLY", true
+	case "quarterly":
+		return "FREQ=MONTHLY;INTERVAL=3", true
+	case "six-months":
+		return "FREQ=MONTHLY;INTERVAL=6", true
+	case "yearly":
+		return "FREQ=YEARLY", true
+	case "custom":
+		rule, err := reminderRule(reminder)
+		if err != nil {
+			return "", false
+		}
+		option := rule.OrigOptions
+		until := option.Until
+		if option.Count > 0 {
+			occurrences := rule.All()
+			if len(occurrences) == 0 {
+				return "", false
+			}
+			until = occurrences[len(occurrences)-1]
+		}
+		option.Dtstart, option.Count, option.Until = time.Time{}, 0, time.Time{}
+		value = option.RRuleString()
+		if !until.IsZero() {
+			// Exported reminders are all-day events, whose UNTIL is a date as well
+			value += ";UNTIL=" + until.UTC().Format("20060102")
+		}
+		return value, true
+	default:
+		return "", false
+	}
+}
+
+// CompleteReminder marks a reminder as completed and records the completion on the contact's
+// timeline (unless skip is set). Recurring reminders that reoccur from completion are rescheduled
+// with NextReminderTime; "once" reminders, and custom rules without a further occurrence, are
+// deleted, which is reported by deleted.
+func CompleteReminder(db *gorm.DB, reminder *models.Reminder, skip bool) (deleted bool, err error) {
+	now := time.Now()
+	reminder.Completed = true
+	reminder.LastSent = &now
+
+	// Create a completion record for the timeline (unless skipping)
+	if !skip {
+		completion := models.ReminderCompletion{
+			UserID:      reminder.UserID,
+			ReminderID:  &reminder.ID,
+			ContactID:   *reminder.ContactID,
+			Message:     reminder.Message,
+			CompletedAt: now,
+		}
+		if err := db.Create(&completion).Error; err != nil {
+			// Don't fail the entire operation if completion record fails
+			logger.Error().Err(err).Uint("reminder_id", reminder.ID).Msg("Failed to create reminder completion record")
+		}
+	}
+
+	// If reoccur from completion, calculate next reminder time
+	// Default to true if not specified (nil)
+	reoccurFromCompletion := reminder.ReoccurFromCompletion == nil || *reminder.ReoccurFromCompletion
+	finished := reminder.Recurrence == "once"
+	if reoccurFromCompletion && !finished {
+		if next, ok := NextReminderTime(*reminder); ok {
+			reminder.RemindAt = next
+			// Reset completed and email_sent flags for recurring reminders
+			reminder.Completed = false
+			reminder.EmailSent = false
+		} else {
+			finished = true
+		}
+	}
+
+	// Delete reminders that do not recur anymore after completion
+	if finished {
+		if err := db.Delete(reminder).Error; err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	return false, db.Save(reminder).Error
+}
+
+// SnoozeDate returns the date a reminder is snoozed to by a number of days: counted from its date,
+// or from today if it is already due
+func SnoozeDate(remindAt time.Time, days int, now time.Time) time.Time {
+	base := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if remindAt.UTC().After(base) {
+		base = remindAt.UTC()
+	}
+	return base.AddDate(0, 0, days)
+}
+
+// SnoozeReminder moves a reminder to a later date without completing it, and records the snooze
+// on the contact's timeline. The email flag is reset, so the reminder is sent again once it is due.
+func SnoozeReminder(db *gorm.DB, reminder *models.Reminder, until time.Time) (models.ReminderSnooze, error) {
+	snooze := models.ReminderSnooze{
+		UserID:           reminder.UserID,
+		ReminderID:       &reminder.ID,
+		ContactID:        *reminder.ContactID,
+		Message:          reminder.Message,
+		SnoozedAt:        time.Now(),
+		PreviousRemindAt: reminder.RemindAt,
+		RemindAt:         until,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		reminder.RemindAt = until
+		reminder.EmailSent = false
+		if err := tx.Model(reminder).Select("remind_at", "email_sent").Updates(reminder).Error; err != nil {
+			return err
+		}
+		return tx.Create(&snooze).Error
+	})
+	return snooze, err
 }
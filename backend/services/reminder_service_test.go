@@ -1,6 +1,8 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"meerkat/config"
 	"meerkat/models"
 	"testing"
@@ -9,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 )
 
@@ -23,7 +26,7 @@ func setupRouter() (*gorm.DB, *gin.Engine) {
 	sqlDB, _ := db.DB()
 	sqlDB.SetMaxOpenConns(1)
 
-	db.AutoMigrate(&models.Contact{}, &models.Activity{}, &models.Note{}, models.Relationship{}, models.Reminder{}, models.User{}, models.JobExecution{}, models.Webhook{}, models.WebhookDelivery{})
+	db.AutoMigrate(&models.Contact{}, &models.Activity{}, &models.Note{}, models.Relationship{}, models.Reminder{}, models.User{}, models.JobExecution{}, models.Webhook{}, models.WebhookDelivery{}, models.CardDAVSync{}, models.SmartCircle{}, models.ContactVersion{}, models.ReminderSnooze{}, models.NotificationChannel{})
 
 	router := gin.Default()
 	router.Use(func(c *gin.Context) {
@@ -233,6 +236,116 @@ func TestCalculateNextReminderTimeUTCConsistency(t *testing.T) {
 	assert.Equal(t, expectedUTC, result, "Should be 7 days after the original UTC time")
 }
 
+// TestNextReminderTimeCustomRules tests reminders with an RRULE recurrence
+func TestNextReminderTimeCustomRules(t *testing.T) {
+	reoccurFalse := false
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		rule     string
+		start    time.Time
+		remindAt time.Time
+		expected time.Time
+		ok       bool
+	}{
+		{"Every 3 days", "FREQ=DAILY;INTERVAL=3", date(2023, 1, 10), date(2023, 1, 10), date(2023, 1, 13), true},
+		{"Every 2 weeks on Tuesday", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU", date(2023, 1, 3), date(2023, 1, 3), date(2023, 1, 17), true},
+		{"Last Friday of the month", "FREQ=MONTHLY;BYDAY=-1FR", date(2023, 1, 27), date(2023, 1, 27), date(2023, 2, 24), true},
+		{"Count starts at the first date", "FREQ=WEEKLY;COUNT=3", date(2023, 1, 2), date(2023, 1, 9), date(2023, 1, 16), true},
+		{"Count used up", "FREQ=WEEKLY;COUNT=3", date(2023, 1, 2), date(2023, 1, 16), time.Time{}, false},
+		{"Until date included", "FREQ=MONTHLY;UNTIL=20230301T000000Z", date(2023, 1, 1), date(2023, 2, 1), date(2023, 3, 1), true},
+		{"Until date passed", "FREQ=MONTHLY;UNTIL=20230301T000000Z", date(2023, 1, 1), date(2023, 3, 1), time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.start
+			reminder := models.Reminder{
+				RemindAt:              tt.remindAt,
+				Recurrence:            "custom",
+				RecurrenceRule:        tt.rule,
+				RecurrenceStart:       &start,
+				ReoccurFromCompletion: &reoccurFalse,
+			}
+			next, ok := NextReminderTime(reminder)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.expected, next)
+			}
+		})
+	}
+}
+
+// TestNextReminderTimeCustomRuleFromCompletion tests that a late completion keeps the rule's rhythm
+func TestNextReminderTimeCustomRuleFromCompletion(t *testing.T) {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := today.AddDate(0, 0, -10)
+
+	next, ok := NextReminderTime(models.Reminder{
+		RemindAt:        start,
+		Recurrence:      "custom",
+		RecurrenceRule:  "FREQ=DAILY;INTERVAL=3",
+		RecurrenceStart: &start,
+	})
+	assert.True(t, ok)
+	// Ten days after the start, the next occurrence is on day 12
+	assert.Equal(t, start.AddDate(0, 0, 12), next)
+}
+
+// TestCompleteReminderEndsCustomRule tests that a reminder is deleted after its rule's last occurrence
+func TestCompleteReminderEndsCustomRule(t *testing.T) {
+	db, _ := setupRouter()
+	db.AutoMigrate(&models.ReminderCompletion{})
+
+	contact := models.Contact{UserID: 1, Firstname: "Anna"}
+	db.Create(&contact)
+
+	remindAt := time.Now().UTC().AddDate(0, 0, 1).Truncate(24 * time.Hour)
+	reminder := models.Reminder{UserID: 1, ContactID: &contact.ID, Message: "Physio", RemindAt: remindAt, Recurrence: "custom", RecurrenceRule: "FREQ=WEEKLY;COUNT=2"}
+	reminder.StartRecurrence()
+	db.Create(&reminder)
+
+	deleted, err := CompleteReminder(db, &reminder, false)
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+	assert.Equal(t, remindAt.AddDate(0, 0, 7), reminder.RemindAt.UTC())
+	assert.False(t, reminder.Completed)
+
+	deleted, err = CompleteReminder(db, &reminder, false)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	assert.ErrorIs(t, db.First(&models.Reminder{}, reminder.ID).Error, gorm.ErrRecordNotFound)
+}
+
+// TestReminderRecurrenceRule tests the recurrence exported to calendars
+func TestReminderRecurrenceRule(t *testing.T) {
+	start := time.Date(2023, 1, 27, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		reminder models.Reminder
+		expected string
+	}{
+		{models.Reminder{Recurrence: "quarterly"}, "FREQ=MONTHLY;INTERVAL=3"},
+		{models.Reminder{Recurrence: "custom", RecurrenceRule: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", RemindAt: start.AddDate(0, 1, -3), RecurrenceStart: &start}, "FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20230331"},
+		{models.Reminder{Recurrence: "custom", RecurrenceRule: "RRULE:FREQ=DAILY;INTERVAL=3;UNTIL=20231231T000000Z", RemindAt: start}, "FREQ=DAILY;INTERVAL=3;UNTIL=20231231"},
+	}
+	for _, tt := range tests {
+		value, ok := ReminderRecurrenceRule(tt.reminder)
+		assert.True(t, ok)
+		assert.Equal(t, tt.expected, value)
+	}
+
+	_, ok := ReminderRecurrenceRule(models.Reminder{Recurrence: "once"})
+	assert.False(t, ok)
+
+	// A rule whose occurrences all fall before its start has no last date to export
+	_, ok = ReminderRecurrenceRule(models.Reminder{Recurrence: "custom", RecurrenceRule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29;INTERVAL=4;COUNT=2", RemindAt: time.Date(2001, 3, 1, 0, 0, 0, 0, time.UTC)})
+	assert.False(t, ok)
+}
+
 func TestSendReminders(t *testing.T) {
 	db, _ := setupRouter()
 
@@ -284,7 +397,7 @@ func TestSendReminders(t *testing.T) {
 		UseResend:       true,
 		ResendAPIKey:    "test_api_key",
 		ResendFromEmail: "noreply@example.com",
-		ReminderTime:    "12:00",
+		ReminderTime:    "00:00",
 	}
 
 	err := SendReminders(db, config)
@@ -304,6 +417,292 @@ func TestSendReminders(t *testing.T) {
 	assert.NotNil(t, updatedReminder.LastSent, "LastSent should be set after email is sent")
 }
 
+// noonZone returns a fixed-offset zone in which it is currently between 12:00 and 13:00
+func noonZone(t *testing.T) (string, *time.Location) {
+	name := "Etc/GMT"
+	// Etc/GMT+N is N hours behind UTC
+	if offset := time.Now().UTC().Hour() - 12; offset > 0 {
+		name = fmt.Sprintf("Etc/GMT+%d", offset)
+	} else if offset < 0 {
+		name = fmt.Sprintf("Etc/GMT%d", offset)
+	}
+	loc, err := time.LoadLocation(name)
+	require.NoError(t, err)
+	return name, loc
+}
+
+func TestSendRemindersPerUserSchedule(t *testing.T) {
+	db, _ := setupRouter()
+	zone, loc := noonZone(t)
+	now := time.Now().In(loc)
+	// Reminder dates are stored as midnight UTC of the user's date
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	byMail := true
+
+	newUser := func(name, reminderTime string, remindAt time.Time) (models.User, models.Reminder) {
+		user := models.User{Username: name, Password: "password123", Email: name + "@example.com", Timezone: zone, ReminderTime: reminderTime}
+		require.NoError(t, db.Create(&user).Error)
+		contact := models.Contact{UserID: user.ID, Firstname: "Friend of " + name}
+		require.NoError(t, db.Create(&contact).Error)
+		reminder := models.Reminder{UserID: user.ID, ContactID: &contact.ID, Message: "Call", ByMail: &byMail, RemindAt: remindAt, Recurrence: "once"}
+		require.NoError(t, db.Create(&reminder).Error)
+		return user, reminder
+	}
+	early, due := newUser("early", "09:00", today)
+	newUser("late", "18:00", today)
+	_, tomorrow := newUser("tomorrow", "09:00", today.AddDate(0, 0, 1))
+
+	emailed := map[uint][]uint{}
+	originalSender := sendReminderEmailFn
+	sendReminderEmailFn = func(u models.User, reminders []models.Reminder, cfg config.Config, db *gorm.DB) error {
+		for _, reminder := range reminders {
+			emailed[u.ID] = append(emailed[u.ID], reminder.ID)
+		}
+		if len(reminders) == 0 {
+			emailed[u.ID] = append(emailed[u.ID], 0)
+		}
+		return nil
+	}
+	defer func() { sendReminderEmailFn = originalSender }()
+
+	cfg := config.Config{
+		UseResend:       true,
+		ResendAPIKey:    "test_api_key",
+		ResendFromEmail: "noreply@example.com",
+		ReminderTime:    "00:00",
+	}
+	require.NoError(t, SendReminders(db, cfg))
+	assert.Equal(t, map[uint][]uint{early.ID: {due.ID}}, emailed, "only users past their reminder time get the reminders due on their date")
+
+	var reloaded models.User
+	require.NoError(t, db.First(&reloaded, early.ID).Error)
+	assert.Equal(t, now.Format("2006-01-02"), reloaded.ReminderDigestDate)
+
+	// Later runs that day only pick up reminders that became due since, e.g. after a snooze
+	clear(emailed)
+	require.NoError(t, SendReminders(db, cfg))
+	assert.Empty(t, emailed)
+
+	require.NoError(t, db.Model(&models.Reminder{}).Where("id = ?", tomorrow.ID).Update("remind_at", today).Error)
+	require.NoError(t, SendReminders(db, cfg))
+	assert.Len(t, emailed, 1)
+	assert.Equal(t, []uint{tomorrow.ID}, emailed[tomorrow.UserID])
+}
+
+func TestSendRemindersRetriesFailedDigest(t *testing.T) {
+	db, _ := setupRouter()
+	zone, loc := noonZone(t)
+	now := time.Now().In(loc)
+	user := models.User{Username: "birthday", Password: "password123", Email: "birthday@example.com", Timezone: zone, ReminderTime: "09:00"}
+	require.NoError(t, db.Create(&user).Error)
+	// Nothing is due but a birthday, which is only part of the first email of the day
+	require.NoError(t, db.Create(&models.Contact{UserID: user.ID, Firstname: "Alice", Birthday: now.AddDate(-30, 0, 0).Format("2006-01-02")}).Error)
+
+	var attempts int
+	var sendErr error
+	originalSender := sendReminderEmailFn
+	sendReminderEmailFn = func(u models.User, reminders []models.Reminder, cfg config.Config, db *gorm.DB) error {
+		attempts++
+		return sendErr
+	}
+	defer func() { sendReminderEmailFn = originalSender }()
+	cfg := config.Config{UseResend: true, ResendAPIKey: "test_api_key", ResendFromEmail: "noreply@example.com"}
+	digestDate := func() string {
+		var reloaded models.User
+		require.NoError(t, db.First(&reloaded, user.ID).Error)
+		return reloaded.ReminderDigestDate
+	}
+
+	sendErr = errors.New("mail server down")
+	require.NoError(t, SendReminders(db, cfg))
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, digestDate(), "a failed digest is retried")
+
+	sendErr = nil
+	require.NoError(t, SendReminders(db, cfg))
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, now.Format("2006-01-02"), digestDate())
+
+	require.NoError(t, SendReminders(db, cfg))
+	assert.Equal(t, 2, attempts)
+}
+
+func TestLastReminderSlot(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	tests := []struct {
+		now          time.Time
+		reminderTime string
+		want         time.Time
+	}{
+		{time.Date(2030, 5, 2, 9, 30, 0, 0, berlin), "09:00", time.Date(2030, 5, 2, 9, 0, 0, 0, berlin)},
+		{time.Date(2030, 5, 2, 8, 30, 0, 0, berlin), "09:00", time.Date(2030, 5, 1, 9, 0, 0, 0, berlin)},
+		// A check at 00:07 still catches the 23:55 email that the check at 23:52 was too early for
+		{time.Date(2030, 5, 2, 0, 7, 0, 0, berlin), "23:55", time.Date(2030, 5, 1, 23, 55, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, lastReminderSlot(tt.now, tt.reminderTime), tt.now.String())
+	}
+}
+
+func TestSendRemindersFiresWebhookOncePerDate(t *testing.T) {
+	db, _ := setupRouter()
+	byMail := true
+	user := models.User{Username: "failing", Password: "password123", Email: "failing@example.com", Timezone: "UTC"}
+	require.NoError(t, db.Create(&user).Error)
+	contact := models.Contact{UserID: user.ID, Firstname: "Anna"}
+	require.NoError(t, db.Create(&contact).Error)
+	reminder := models.Reminder{UserID: user.ID, ContactID: &contact.ID, Message: "Call", ByMail: &byMail, RemindAt: time.Now().AddDate(0, 0, -1), Recurrence: "once"}
+	require.NoError(t, db.Create(&reminder).Error)
+
+	attempts := 0
+	originalSender := sendReminderEmailFn
+	sendReminderEmailFn = func(u models.User, reminders []models.Reminder, cfg config.Config, db *gorm.DB) error {
+		attempts++
+		return fmt.Errorf("smtp unavailable")
+	}
+	defer func() { sendReminderEmailFn = originalSender }()
+
+	cfg := config.Config{
+		UseResend:       true,
+		ResendAPIKey:    "test_api_key",
+		ResendFromEmail: "noreply@example.com",
+		ReminderTime:    "00:00",
+	}
+	require.NoError(t, SendReminders(db, cfg))
+	var first models.Reminder
+	require.NoError(t, db.First(&first, reminder.ID).Error)
+	require.NotNil(t, first.LastTriggered)
+	assert.False(t, first.EmailSent)
+
+	// The failed email is retried, but the webhook does not fire again for the same date
+	require.NoError(t, SendReminders(db, cfg))
+	assert.Equal(t, 2, attempts)
+	var second models.Reminder
+	require.NoError(t, db.First(&second, reminder.ID).Error)
+	assert.True(t, first.LastTriggered.Equal(*second.LastTriggered))
+
+	// A later date, e.g. after a snooze, is a new occurrence
+	second.RemindAt = time.Now().AddDate(0, 0, 1)
+	assert.False(t, reminderTriggered(second, time.UTC))
+}
+
+func TestReminderDueAt(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	reminder := models.Reminder{RemindAt: time.Date(2030, 3, 31, 0, 0, 0, 0, time.UTC), RemindTime: "15:00"}
+
+	dueAt, ok := ReminderDueAt(reminder, berlin)
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2030, 3, 31, 13, 0, 0, 0, time.UTC), dueAt.UTC(), "summer time has started in Berlin")
+
+	_, ok = ReminderDueAt(models.Reminder{RemindAt: reminder.RemindAt}, berlin)
+	assert.False(t, ok, "reminders without a time are sent with the daily email")
+}
+
+func TestSendTimedReminders(t *testing.T) {
+	db, _ := setupRouter()
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	byMail := true
+
+	user := models.User{Username: "timed", Password: "password123", Email: "timed@example.com", Timezone: "UTC"}
+	require.NoError(t, db.Create(&user).Error)
+	contact := models.Contact{UserID: user.ID, Firstname: "Anna"}
+	require.NoError(t, db.Create(&contact).Error)
+	newReminder := func(message string, remindAt time.Time, remindTime string) models.Reminder {
+		reminder := models.Reminder{UserID: user.ID, ContactID: &contact.ID, Message: message, ByMail: &byMail, RemindAt: remindAt, RemindTime: remindTime, Recurrence: "once"}
+		require.NoError(t, db.Create(&reminder).Error)
+		return reminder
+	}
+	past := newReminder("Call Anna", today.AddDate(0, 0, -1), "23:59")
+	future := newReminder("Call Anna again", today.AddDate(0, 0, 1), "00:00")
+	daily := newReminder("Write to Anna", today.AddDate(0, 0, -1), "")
+
+	var digest, timed []uint
+	originalSender, originalTimedSender := sendReminderEmailFn, sendTimedReminderEmailFn
+	sendReminderEmailFn = func(u models.User, reminders []models.Reminder, cfg config.Config, db *gorm.DB) error {
+		for _, reminder := range reminders {
+			digest = append(digest, reminder.ID)
+		}
+		return nil
+	}
+	sendTimedReminderEmailFn = func(u models.User, reminders []models.Reminder, cfg config.Config, db *gorm.DB) error {
+		for _, reminder := range reminders {
+			timed = append(timed, reminder.ID)
+		}
+		return nil
+	}
+	defer func() { sendReminderEmailFn, sendTimedReminderEmailFn = originalSender, originalTimedSender }()
+
+	cfg := config.Config{
+		UseResend:       true,
+		ResendAPIKey:    "test_api_key",
+		ResendFromEmail: "noreply@example.com",
+		ReminderTime:    "00:00",
+	}
+	require.NoError(t, SendReminders(db, cfg))
+	assert.Equal(t, []uint{daily.ID}, digest, "reminders with a time of day are not part of the daily email")
+
+	require.NoError(t, SendTimedRemindersWithRateLimit(db, cfg))
+	assert.Equal(t, []uint{past.ID}, timed)
+
+	var sent, pending models.Reminder
+	require.NoError(t, db.First(&sent, past.ID).Error)
+	assert.True(t, sent.EmailSent)
+	require.NoError(t, db.First(&pending, future.ID).Error)
+	assert.False(t, pending.EmailSent)
+
+	var job models.JobExecution
+	require.NoError(t, db.Where("job_name = ?", models.JobNameTimedReminders).First(&job).Error)
+	assert.NotZero(t, job.LastRunAt)
+
+	// A restart right after the run does not send anything twice
+	require.NoError(t, db.Model(&sent).Update("email_sent", false).Error)
+	require.NoError(t, SendTimedRemindersWithRateLimit(db, cfg))
+	assert.Equal(t, []uint{past.ID}, timed)
+}
+
+func TestSendTimedRemindersRetriesFailedSends(t *testing.T) {
+	db, _ := setupRouter()
+	byMail := true
+	user := models.User{Username: "retry", Password: "password123", Email: "retry@example.com", Timezone: "UTC"}
+	require.NoError(t, db.Create(&user).Error)
+	contact := models.Contact{UserID: user.ID, Firstname: "Anna"}
+	require.NoError(t, db.Create(&contact).Error)
+	dueAt := time.Now().UTC().Truncate(time.Minute).Add(-5 * time.Minute)
+	reminder := models.Reminder{
+		UserID: user.ID, ContactID: &contact.ID, Message: "Call Anna", ByMail: &byMail, Recurrence: "once",
+		RemindAt:   time.Date(dueAt.Year(), dueAt.Month(), dueAt.Day(), 0, 0, 0, 0, time.UTC),
+		RemindTime: dueAt.Format("15:04"),
+	}
+	require.NoError(t, db.Create(&reminder).Error)
+
+	attempts := 0
+	originalSender := sendTimedReminderEmailFn
+	sendTimedReminderEmailFn = func(u models.User, reminders []models.Reminder, cfg config.Config, db *gorm.DB) error {
+		attempts++
+		return fmt.Errorf("smtp unavailable")
+	}
+	defer func() { sendTimedReminderEmailFn = originalSender }()
+
+	// Without email or a reminder channel only the webhooks fire
+	require.NoError(t, SendTimedReminders(db, config.Config{}))
+	assert.Zero(t, attempts)
+	var stored models.Reminder
+	require.NoError(t, db.First(&stored, reminder.ID).Error)
+	require.NotNil(t, stored.LastTriggered)
+
+	// A failed email is not retried on every run, and the webhooks do not fire again
+	cfg := config.Config{UseResend: true, ResendAPIKey: "test_api_key", ResendFromEmail: "noreply@example.com"}
+	require.NoError(t, db.Model(&stored).UpdateColumn("last_triggered", nil).Error)
+	require.NoError(t, SendTimedReminders(db, cfg))
+	require.NoError(t, SendTimedReminders(db, cfg))
+	assert.Equal(t, 1, attempts)
+	require.NoError(t, db.First(&stored, reminder.ID).Error)
+	assert.False(t, stored.EmailSent)
+}
+
 func TestSendRemindersWithRateLimit_FirstRun(t *testing.T) {
 	db, _ := setupRouter()
 
@@ -345,7 +744,7 @@ func TestSendRemindersWithRateLimit_FirstRun(t *testing.T) {
 		UseResend:       true,
 		ResendAPIKey:    "test_api_key",
 		ResendFromEmail: "noreply@example.com",
-		ReminderTime:    "12:00",
+		ReminderTime:    "00:00",
 	}
 
 	// First run should execute
@@ -401,7 +800,7 @@ func TestSendRemindersWithRateLimit_RateLimited(t *testing.T) {
 		UseResend:       true,
 		ResendAPIKey:    "test_api_key",
 		ResendFromEmail: "noreply@example.com",
-		ReminderTime:    "12:00",
+		ReminderTime:    "00:00",
 	}
 
 	// First run should execute
@@ -456,7 +855,7 @@ func TestSendRemindersWithRateLimit_AllowsAfterInterval(t *testing.T) {
 		UseResend:       true,
 		ResendAPIKey:    "test_api_key",
 		ResendFromEmail: "noreply@example.com",
-		ReminderTime:    "12:00",
+		ReminderTime:    "00:00",
 	}
 
 	// First run
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"meerkat/database"
+	"meerkat/models"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Types of search results
+const (
+	SearchTypeContact  = "contact"
+	SearchTypeNote     = "note"
+	SearchTypeActivity = "activity"
+)
+
+// SearchTypes lists all result types in the order they are searched
+var SearchTypes = []string{SearchTypeContact, SearchTypeNote, SearchTypeActivity}
+
+// ErrEmptySearchQuery is returned when a query has no words to search for
+var ErrEmptySearchQuery = errors.New("search query contains no words")
+
+// maxSearchTerms caps the number of words taken from a query
+const maxSearchTerms = 10
+
+// The index marks matches with these control characters. They are replaced with <mark> tags
+// after the text is HTML-escaped, so stored content can never inject markup.
+const (
+	searchMatchStart = "\x02"
+	searchMatchEnd   = "\x03"
+)
+
+var searchMarkReplacer = strings.NewReplacer(searchMatchStart, "<mark>", searchMatchEnd, "</mark>")
+
+// searchRow is the row shape shared by the per-type queries
+type searchRow struct {
+	ID        uint
+	Score     float64
+	Title     string
+	Snippet   string
+	ContactID *uint
+	Date      *time.Time
+	Firstname *string
+	Lastname  *string
+	Nickname  *string
+}
+
+// Search runs a full-text query over the user's contacts, notes and activities and returns up
+// to limit results of the given types (all types if empty), best match first. Every word of the
+// query must match, and each word also matches longer words it is a prefix of.
+func Search(db *gorm.DB, userID uint, query string, types []string, limit int) ([]models.SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearchQuery
+	}
+	if len(types) == 0 {
+		types = SearchTypes
+	}
+
+	results := []models.SearchResult{}
+	for _, searchType := range types {
+		var rows []searchRow
+		var err error
+		if database.IsPostgres(db) {
+			rows, err = searchPostgres(db, searchType, userID, terms, limit)
+		} else {
+			rows, err = searchSQLite(db, searchType, userID, terms, limit)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %ss: %w", searchType, err)
+		}
+		for _, row := range rows {
+			results = append(results, searchResult(searchType, row))
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// searchTerms splits a query into words the way the index tokenizes text, so punctuation and
+// query syntax in user input are never passed on to the database
+func searchTerms(query string) []string {
+	terms := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+func searchResult(searchType string, row searchRow) models.SearchResult {
+	result := models.SearchResult{
+		Type:    searchType,
+		ID:      row.ID,
+		Title:   renderSearchMatches(row.Title),
+		Snippet: renderSearchMatches(row.Snippet),
+		Date:    row.Date,
+		Score:   row.Score,
+	}
+	if searchType == SearchTypeNote {
+		result.ContactID = row.ContactID
+		if row.Firstname != nil {
+			result.Title = html.EscapeString(ContactDisplayName(models.Contact{
+				Firstname: *row.Firstname,
+				Lastname:  stringValue(row.Lastname),
+				Nickname:  stringValue(row.Nickname),
+			}))
+		}
+	}
+	return result
+}
+
+func renderSearchMatches(text string) string {
+	return searchMarkReplacer.Replace(html.EscapeString(text))
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// searchSQLite queries the FTS5 tables. bm25 is lower for better matches, so it is negated to
+// make the score comparable with PostgreSQL's ts_rank.
+func searchSQLite(db *gorm.DB, searchType string, userID uint, terms []string, limit int) ([]searchRow, error) {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"*`
+	}
+	match := strings.Join(quoted, " ")
+
+	var sql string
+	switch searchType {
+	case SearchTypeContact:
+		sql = `SELECT contacts_fts.rowid AS id,
+				-bm25(contacts_fts, 0, 10.0, 4.0, 1.0) AS score,
+				highlight(contacts_fts, 1, ?, ?) AS title,
+				snippet(contacts_fts, -1, ?, ?, '…', 16) AS snippet
+			FROM contacts_fts
+			WHERE contacts_fts MATCH ? AND contacts_fts.user_id = ?
+			ORDER BY score DESC LIMIT ?`
+	case SearchTypeNote:
+		sql = `SELECT notes_fts.rowid AS id,
+				-bm25(notes_fts) AS score,
+				'' AS title,
+				snippet(notes_fts, 1, ?, ?, '…', 24) AS snippet,
+				notes.contact_id, notes.date,
+				contacts.firstname, contacts.lastname, contacts.nickname
+			FROM notes_fts
+			JOIN notes ON notes.id = notes_fts.rowid
+			LEFT JOIN contacts ON contacts.id = notes.contact_id AND contacts.deleted_at IS NULL
+			WHERE notes_fts MATCH ? AND notes_fts.user_id = ?
+			ORDER BY score DESC LIMIT ?`
+		return scanSearchRows(db, sql, searchMatchStart, searchMatchEnd, match, userID, limit)
+	case SearchTypeActivity:
+		sql = `SELECT activities_fts.rowid AS id,
+				-bm25(activities_fts, 0, 5.0, 1.0, 2.0) AS score,
+				highlight(activities_fts, 1, ?, ?) AS title,
+				snippet(activities_fts, -1, ?, ?, '…', 16) AS snippet,
+				activities.date
+			FROM activities_fts
+			JOIN activities ON activities.id = activities_fts.rowid
+			WHERE activities_fts MATCH ? AND activities_fts.user_id = ?
+			ORDER BY score DESC LIMIT ?`
+	default:
+		return nil, fmt.Errorf("unknown search type %q", searchType)
+	}
+	return scanSearchRows(db, sql, searchMatchStart, searchMatchEnd, searchMatchStart, searchMatchEnd, match, userID, limit)
+}
+
+// searchPostgres queries the tsvector tables. Every term becomes a prefix match, and the
+// 'simple' configuration indexes words as they are, without language-specific stemming.
+func searchPostgres(db *gorm.DB, searchType string, userID uint, terms []string, limit int) ([]searchRow, error) {
+	prefixed := make([]string, len(terms))
+	for i, term := range terms {
+		prefixed[i] = term + ":*"
+	}
+	tsquery := strings.Join(prefixed, " & ")
+	titleOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", searchMatchStart, searchMatchEnd)
+	snippetOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=1, MaxWords=16, MinWords=6, FragmentDelimiter=…",
+		searchMatchStart, searchMatchEnd)
+
+	var sql string
+	switch searchType {
+	case SearchTypeContact:
+		sql = `SELECT f.id,
+				ts_rank(f.document, q) AS score,
+				ts_headline('simple', f.name, q, ?) AS title,
+				ts_headline('simple', concat_ws(' ', f.name, f.organization, f.details), q, ?) AS snippet
+			FROM contacts_fts f, to_tsquery('simple', ?) q
+			WHERE f.document @@ q AND f.user_id = ?
+			ORDER BY score DESC LIMIT ?`
+	case SearchTypeNote:
+		sql = `SELECT f.id,
+				ts_rank(f.document, q) AS score,
+				'' AS title,
+				ts_headline('simple', f.content, q, ?) AS snippet,
+				notes.contact_id, notes.date,
+				contacts.firstname, contacts.lastname, contacts.nickname
+			FROM notes_fts f
+			CROSS JOIN to_tsquery('simple', ?) q
+			JOIN notes ON notes.id = f.id
+			LEFT JOIN contacts ON contacts.id = notes.contact_id AND contacts.deleted_at IS NULL
+			WHERE f.document @@ q AND f.user_id = ?
+			ORDER BY score DESC LIMIT ?`
+		return scanSearchRows(db, sql, snippetOptions, tsquery, userID, limit)
+	case SearchTypeActivity:
+		sql = `SELECT f.id,
+				ts_rank(f.document, q) AS score,
+				ts_headline('simple', f.title, q, ?) AS title,
+				ts_headline('simple', concat_ws(' ', f.title, f.location, f.description), q, ?) AS snippet,
+				activities.date
+			FROM activities_fts f
+			CROSS JOIN to_tsquery('simple', ?) q
+			JOIN activities ON activities.id = f.id
+			WHERE f.document @@ q AND f.user_id = ?
+			ORDER BY score DESC LIMIT ?`
+	default:
+		return nil, fmt.Errorf("unknown search type %q", searchType)
+	}
+	return scanSearchRows(db, sql, titleOptions, snippetOptions, tsquery, userID, limit)
+}
+
+func scanSearchRows(db *gorm.DB, sql string, args ...interface{}) ([]searchRow, error) {
+	var rows []searchRow
+	if err := db.Raw(sql, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
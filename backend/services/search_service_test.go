@@ -0,0 +1,120 @@
+package services
+
+import (
+	"database/sql"
+	"meerkat/database"
+	"meerkat/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSearch_SQLite(t *testing.T) {
+	db, err := database.InitDB(database.DriverSQLite, filepath.Join(t.TempDir(), "meerkat.db"))
+	require.NoError(t, err)
+	userID := checkSearch(t, db)
+
+	// The SQLite tokenizer folds diacritics
+	results, err := Search(db, userID, "jose", nil, 10)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "<mark>José</mark> Sailor", results[0].Title)
+}
+
+// TestSearch_Postgres runs against a throwaway PostgreSQL database like the test in the database
+// package and drops everything in its public schema first
+func TestSearch_Postgres(t *testing.T) {
+	dsn := os.Getenv("MEERKAT_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("MEERKAT_TEST_POSTGRES_URL not set")
+	}
+
+	sqlDB, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public")
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	db, err := database.InitDB(database.DriverPostgres, dsn)
+	require.NoError(t, err)
+	checkSearch(t, db)
+}
+
+// checkSearch creates data for two users, runs the searches shared by both databases and returns
+// the first user's ID
+func checkSearch(t *testing.T, db *gorm.DB) uint {
+	t.Helper()
+
+	user := models.User{Username: "search", Password: "x", Email: "search@example.com"}
+	other := models.User{Username: "other", Password: "x", Email: "other@example.com"}
+	require.NoError(t, db.Create(&user).Error)
+	require.NoError(t, db.Create(&other).Error)
+
+	contact := models.Contact{
+		UserID:       user.ID,
+		Firstname:    "José",
+		Lastname:     "Sailor",
+		Organization: "Acme Corp",
+		Addresses:    []models.ContactAddress{{Type: "home", City: "Lisbon"}},
+		CustomFields: map[string]string{"Hobby": "Woodworking"},
+	}
+	require.NoError(t, db.Create(&contact).Error)
+	require.NoError(t, db.Create(&models.Contact{UserID: other.ID, Firstname: "Acme", Lastname: "Other"}).Error)
+
+	note := models.Note{UserID: user.ID, ContactID: &contact.ID, Content: "Wants a <b>woodworking</b> class", Date: time.Now()}
+	require.NoError(t, db.Create(&note).Error)
+	activity := models.Activity{UserID: user.ID, Title: "Regatta", Location: "Kiel harbour", Date: time.Now()}
+	require.NoError(t, db.Create(&activity).Error)
+
+	search := func(query string, types ...string) []models.SearchResult {
+		t.Helper()
+		results, err := Search(db, user.ID, query, types, 10)
+		require.NoError(t, err)
+		return results
+	}
+	hits := func(results []models.SearchResult) []string {
+		names := []string{}
+		for _, result := range results {
+			names = append(names, result.Type)
+		}
+		return names
+	}
+
+	// Organization, addresses and custom fields are indexed, and words match by prefix
+	assert.Equal(t, []string{"contact"}, hits(search("acme")))
+	assert.Equal(t, []string{"contact"}, hits(search("lisb")))
+	assert.Equal(t, []string{"activity"}, hits(search("kiel regatta")))
+	assert.Empty(t, search("acme regatta"))
+
+	results := search("woodworking")
+	assert.ElementsMatch(t, []string{"contact", "note"}, hits(results))
+	for _, result := range results {
+		if result.Type == SearchTypeNote {
+			assert.Equal(t, note.ID, result.ID)
+			assert.Equal(t, &contact.ID, result.ContactID)
+			assert.Equal(t, "José Sailor", result.Title)
+			assert.Contains(t, result.Snippet, "&lt;b&gt;<mark>woodworking</mark>&lt;/b&gt;")
+			assert.NotNil(t, result.Date)
+		}
+	}
+	assert.Equal(t, []string{"note"}, hits(search("woodworking", SearchTypeNote)))
+
+	// The index follows updates and soft deletes
+	require.NoError(t, db.Model(&contact).Update("organization", "Globex").Error)
+	assert.Empty(t, search("acme"))
+	assert.Equal(t, []string{"contact"}, hits(search("globex")))
+	require.NoError(t, db.Delete(&note).Error)
+	assert.Equal(t, []string{"contact"}, hits(search("woodworking")))
+	require.NoError(t, db.Delete(&activity).Error)
+	assert.Empty(t, search("regatta"))
+
+	_, err := Search(db, user.ID, " -- * ", nil, 10)
+	assert.ErrorIs(t, err, ErrEmptySearchQuery)
+
+	return user.ID
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"meerkat/config"
+	"meerkat/database"
+	"meerkat/logger"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Snapshots are gzipped tar archives named after the UTC time they were taken, so that sorting the
+// names sorts them by age. They contain the database as meerkat.db and the photo directory under
+// photos/.
+const (
+	snapshotPrefix     = "meerkat-snapshot-"
+	snapshotSuffix     = ".tar.gz"
+	snapshotTimeLayout = "20060102T150405Z"
+	snapshotDBName     = "meerkat.db"
+	snapshotPhotoDir   = "photos/"
+)
+
+// ErrInvalidSnapshot is returned when a file is not a snapshot this version can restore
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// CreateScheduledSnapshot takes a snapshot into cfg.BackupDir and prunes snapshots beyond the
+// retention limit. Errors are logged, as there is nobody to return them to.
+func CreateScheduledSnapshot(db *gorm.DB, cfg config.Config) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get database handle for snapshot")
+		return
+	}
+
+	archivePath, err := CreateSnapshot(sqlDB, cfg.ProfilePhotoDir, cfg.BackupDir, time.Now())
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create snapshot")
+		return
+	}
+	logger.Info().Str("path", archivePath).Msg("Snapshot created")
+
+	removed, err := PruneSnapshots(cfg.BackupDir, cfg.BackupRetention)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to prune snapshots")
+	}
+	if len(removed) > 0 {
+		logger.Info().Strs("removed", removed).Msg("Pruned old snapshots")
+	}
+}
+
+// CreateSnapshot writes a consistent copy of the database together with the photo directory to a
+// timestamped archive in backupDir and returns the archive's path. VACUUM INTO copies the database
+// within a single read transaction, so the server can keep running while a snapshot is taken.
+func CreateSnapshot(db *sql.DB, photoDir, backupDir string, now time.Time) (string, error) {
+	if err := os.MkdirAll(backupDir, 0o750); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Work in a hidden directory so that neither a half-written archive nor the database copy is
+	// ever mistaken for a snapshot
+	workDir, err := os.MkdirTemp(backupDir, ".snapshot-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	dbCopy := filepath.Join(workDir, snapshotDBName)
+	if _, err := db.Exec("VACUUM INTO ?", dbCopy); err != nil {
+		return "", fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	partial := filepath.Join(workDir, "snapshot"+snapshotSuffix)
+	if err := writeSnapshotArchive(partial, dbCopy, photoDir); err != nil {
+		return "", err
+	}
+
+	archivePath := filepath.Join(backupDir, snapshotPrefix+now.UTC().Format(snapshotTimeLayout)+snapshotSuffix)
+	if err := os.Rename(partial, archivePath); err != nil {
+		return "", fmt.Errorf("failed to move snapshot into place: %w", err)
+	}
+	return archivePath, nil
+}
+
+func writeSnapshotArchive(archivePath, dbPath, photoDir string) error {
+	f, err := os.OpenFile(archivePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	if err := addFileToSnapshot(tw, snapshotDBName, dbPath); err != nil {
+		return err
+	}
+
+	if photoDir != "" {
+		err := filepath.WalkDir(photoDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(photoDir, p)
+			if err != nil {
+				return err
+			}
+			return addFileToSnapshot(tw, snapshotPhotoDir+filepath.ToSlash(rel), p)
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to add photos to snapshot: %w", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish snapshot: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish snapshot: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return f.Close()
+}
+
+func addFileToSnapshot(tw *tar.Writer, name, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to add %s to snapshot: %w", name, err)
+	}
+	if _, err := io.CopyN(tw, f, info.Size()); err != nil {
+		return fmt.Errorf("failed to add %s to snapshot: %w", name, err)
+	}
+	return nil
+}
+
+// ListSnapshots returns the names of the snapshots in backupDir, oldest first
+func ListSnapshots(backupDir string) ([]string, error) {
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// PruneSnapshots deletes all but the newest keep snapshots in backupDir and returns the names of
+// the deleted ones. A keep of 0 keeps every snapshot.
+func PruneSnapshots(backupDir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	names, err := ListSnapshots(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) <= keep {
+		return nil, nil
+	}
+
+	var removed []string
+	for _, name := range names[:len(names)-keep] {
+		if err := os.Remove(filepath.Join(backupDir, name)); err != nil {
+			return removed, fmt.Errorf("failed to remove snapshot %s: %w", name, err)
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// RestoreSnapshot replaces the database at dbPath with the one in a snapshot archive and copies
+// the archived photos into photoDir. The server must be stopped while it runs. The snapshot's
+// schema version is checked against the migrations in this binary: snapshots from a newer version
+// are refused and older ones are migrated before they are put in place. The replaced database is
+// kept next to the new one with a .before-restore-<time> suffix. It returns the schema version the
+// snapshot was taken with.
+func RestoreSnapshot(archivePath, dbPath, photoDir string, now time.Time) (uint, error) {
+	// Stage next to the database so that moving it into place is a rename on the same file system
+	stagingDir, err := os.MkdirTemp(filepath.Dir(dbPath), ".restore-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if err := extractSnapshot(archivePath, stagingDir); err != nil {
+		return 0, err
+	}
+
+	stagedDB := filepath.Join(stagingDir, snapshotDBName)
+	version, err := prepareSnapshotDatabase(stagedDB)
+	if err != nil {
+		return 0, err
+	}
+
+	// Move the current database aside together with its WAL files, which may hold committed
+	// changes that are not yet in the main file
+	keepSuffix := ".before-restore-" + now.UTC().Format(snapshotTimeLayout)
+	for _, ext := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(dbPath+ext, dbPath+keepSuffix+ext); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return 0, fmt.Errorf("failed to move current database aside: %w", err)
+		}
+	}
+	if err := os.Rename(stagedDB, dbPath); err != nil {
+		return 0, fmt.Errorf("failed to move restored database into place: %w", err)
+	}
+
+	// Photos are copied rather than renamed since the photo directory is often a separate volume
+	stagedPhotos := filepath.Join(stagingDir, filepath.FromSlash(snapshotPhotoDir))
+	err = filepath.WalkDir(stagedPhotos, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(stagedPhotos, p)
+		if err != nil {
+			return err
+		}
+		return copySnapshotFile(p, filepath.Join(photoDir, rel))
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return version, fmt.Errorf("database restored, but copying photos failed: %w", err)
+	}
+
+	return version, nil
+}
+
+// extractSnapshot unpacks a snapshot into dir, accepting only the database and files below photos/
+func extractSnapshot(archivePath, dir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%w: not a gzip archive", ErrInvalidSnapshot)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	hasDB := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		var target string
+		switch {
+		case header.Typeflag != tar.TypeReg:
+			return fmt.Errorf("%w: unexpected entry %s", ErrInvalidSnapshot, header.Name)
+		case header.Name == snapshotDBName:
+			target = filepath.Join(dir, snapshotDBName)
+			hasDB = true
+		case strings.HasPrefix(header.Name, snapshotPhotoDir):
+			rel := strings.TrimPrefix(header.Name, snapshotPhotoDir)
+			if !filepath.IsLocal(rel) || path.Clean(rel) != rel {
+				return fmt.Errorf("%w: invalid photo path %s", ErrInvalidSnapshot, header.Name)
+			}
+			target = filepath.Join(dir, filepath.FromSlash(snapshotPhotoDir), filepath.FromSlash(rel))
+		default:
+			return fmt.Errorf("%w: unexpected entry %s", ErrInvalidSnapshot, header.Name)
+		}
+
+		if err := writeSnapshotFile(target, tr); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidSnapshot, header.Name, err)
+		}
+	}
+
+	if !hasDB {
+		return fmt.Errorf("%w: no %s in archive", ErrInvalidSnapshot, snapshotDBName)
+	}
+	return nil
+}
+
+// prepareSnapshotDatabase checks a staged snapshot database and migrates it to the schema of this
+// binary, returning the schema version it had before
+func prepareSnapshotDatabase(dbPath string) (uint, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open snapshot database: %w", err)
+	}
+	defer db.Close()
+
+	var check string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&check); err != nil || check != "ok" {
+		return 0, fmt.Errorf("%w: database failed the integrity check", ErrInvalidSnapshot)
+	}
+
+	version, dirty, err := database.SchemaVersion(db)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w: database was taken during a failed migration to version %d", ErrInvalidSnapshot, version)
+	}
+	latest, err := database.LatestMigrationVersion()
+	if err != nil {
+		return 0, err
+	}
+	if version > latest {
+		return 0, fmt.Errorf("%w: schema version %d is newer than this Meerkat version supports (%d), update Meerkat to restore it", ErrInvalidSnapshot, version, latest)
+	}
+
+	if err := database.RunMigrations(db); err != nil {
+		return 0, fmt.Errorf("failed to migrate snapshot database: %w", err)
+	}
+	return version, nil
+}
+
+func writeSnapshotFile(target string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func copySnapshotFile(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeSnapshotFile(dst, f)
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"database/sql"
+	"meerkat/database"
+	"meerkat/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSnapshotDB creates a migrated database file with one user and returns its path
+func setupSnapshotDB(t *testing.T) string {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "meerkat.db")
+	db, err := database.InitDB(database.DriverSQLite, dbPath)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.User{Username: "snap", Password: "x", Email: "snap@example.com"}).Error)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+	return dbPath
+}
+
+func takeSnapshot(t *testing.T, dbPath, photoDir, backupDir string, now time.Time) string {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+	archivePath, err := CreateSnapshot(db, photoDir, backupDir, now)
+	require.NoError(t, err)
+	return archivePath
+}
+
+func TestSnapshot_CreateAndRestore(t *testing.T) {
+	dbPath := setupSnapshotDB(t)
+	photoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(photoDir, "alice.jpg"), []byte("jpeg"), 0o644))
+	backupDir := filepath.Join(t.TempDir(), "backups")
+
+	now := time.Date(2026, 3, 1, 4, 5, 6, 0, time.UTC)
+	archivePath := takeSnapshot(t, dbPath, photoDir, backupDir, now)
+	assert.Equal(t, filepath.Join(backupDir, "meerkat-snapshot-20260301T040506Z.tar.gz"), archivePath)
+
+	// Change the live data after the snapshot
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	_, err = db.Exec("DELETE FROM users")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	restoredPhotos := t.TempDir()
+	version, err := RestoreSnapshot(archivePath, dbPath, restoredPhotos, now.Add(time.Hour))
+	require.NoError(t, err)
+	latest, err := database.LatestMigrationVersion()
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	db, err = sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+	var username string
+	require.NoError(t, db.QueryRow("SELECT username FROM users").Scan(&username))
+	assert.Equal(t, "snap", username)
+
+	assert.FileExists(t, filepath.Join(restoredPhotos, "alice.jpg"))
+	assert.FileExists(t, dbPath+".before-restore-20260301T050506Z")
+}
+
+func TestSnapshot_RestoreMigratesOlderSchema(t *testing.T) {
+	dbPath := setupSnapshotDB(t)
+	require.NoError(t, database.MigrateDown(dbPath))
+	archivePath := takeSnapshot(t, dbPath, "", t.TempDir(), time.Now())
+
+	latest, err := database.LatestMigrationVersion()
+	require.NoError(t, err)
+	version, err := RestoreSnapshot(archivePath, dbPath, t.TempDir(), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, latest-1, version)
+
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+	current, dirty, err := database.SchemaVersion(db)
+	require.NoError(t, err)
+	assert.False(t, dirty)
+	assert.Equal(t, latest, current)
+}
+
+func TestSnapshot_RestoreRefusesUnusableSnapshots(t *testing.T) {
+	latest, err := database.LatestMigrationVersion()
+	require.NoError(t, err)
+
+	snapshotWith := func(query string, args ...any) string {
+		dbPath := setupSnapshotDB(t)
+		db, err := sql.Open("sqlite", dbPath)
+		require.NoError(t, err)
+		_, err = db.Exec(query, args...)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+		return takeSnapshot(t, dbPath, "", t.TempDir(), time.Now())
+	}
+
+	notAnArchive := filepath.Join(t.TempDir(), "meerkat-snapshot-x.tar.gz")
+	require.NoError(t, os.WriteFile(notAnArchive, []byte("hello"), 0o644))
+
+	cases := map[string]string{
+		"not an archive": notAnArchive,
+		"newer schema":   snapshotWith("UPDATE schema_migrations SET version = ?", latest+1),
+		"dirty schema":   snapshotWith("UPDATE schema_migrations SET dirty = 1"),
+		"no schema":      snapshotWith("DROP TABLE schema_migrations"),
+	}
+	for name, archivePath := range cases {
+		dbPath := setupSnapshotDB(t)
+		_, err := RestoreSnapshot(archivePath, dbPath, t.TempDir(), time.Now())
+		assert.ErrorIs(t, err, ErrInvalidSnapshot, name)
+
+		// The current database stays in place
+		matches, _ := filepath.Glob(dbPath + ".before-restore-*")
+		assert.Empty(t, matches, name)
+		assert.FileExists(t, dbPath, name)
+	}
+}
+
+func TestSnapshot_PruneKeepsNewest(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"meerkat-snapshot-20260101T000000Z.tar.gz",
+		"meerkat-snapshot-20260103T000000Z.tar.gz",
+		"meerkat-snapshot-20260102T000000Z.tar.gz",
+		"unrelated.tar.gz",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	removed, err := PruneSnapshots(dir, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"meerkat-snapshot-20260101T000000Z.tar.gz"}, removed)
+
+	names, err := ListSnapshots(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"meerkat-snapshot-20260102T000000Z.tar.gz", "meerkat-snapshot-20260103T000000Z.tar.gz"}, names)
+	assert.FileExists(t, filepath.Join(dir, "unrelated.tar.gz"))
+
+	removed, err = PruneSnapshots(dir, 0)
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+}
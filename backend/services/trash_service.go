@@ -0,0 +1,349 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"meerkat/config"
+	"meerkat/logger"
+	"meerkat/models"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Types of items in the trash
+const (
+	TrashTypeContact  = "contact"
+	TrashTypeNote     = "note"
+	TrashTypeActivity = "activity"
+	TrashTypeReminder = "reminder"
+)
+
+// TrashTypes lists all item types that can be restored from the trash
+var TrashTypes = []string{TrashTypeContact, TrashTypeNote, TrashTypeActivity, TrashTypeReminder}
+
+// ErrTrashContactDeleted is returned when restoring a note or reminder whose contact is itself in the trash
+var ErrTrashContactDeleted = errors.New("the contact this belongs to is in the trash, restore it first")
+
+// maxTrashTitleLength caps the note text shown as the title of a trashed note
+const maxTrashTitleLength = 100
+
+// trashPurgeBatchSize is the number of contacts purged per transaction
+const trashPurgeBatchSize = 500
+
+// trashRow is the row shape shared by the per-type trash queries
+type trashRow struct {
+	ID        uint
+	Title     string
+	ContactID *uint
+	Firstname *string
+	Lastname  *string
+	DeletedAt time.Time
+}
+
+// ListTrash returns the user's soft-deleted contacts, notes, activities and reminders, most
+// recently deleted first. Notes and reminders deleted together with their contact are part of
+// that contact's entry rather than listed on their own. With a retention, items carry the time
+// they will be purged.
+func ListTrash(db *gorm.DB, userID uint, retention time.Duration) ([]models.TrashItem, error) {
+	queries := map[string]*gorm.DB{
+		TrashTypeContact: db.Table("contacts").
+			Select("contacts.id, contacts.firstname AS title, contacts.lastname, contacts.deleted_at").
+			Where("contacts.user_id = ? AND contacts.deleted_at IS NOT NULL", userID),
+		TrashTypeActivity: db.Table("activities").
+			Select("activities.id, activities.title, activities.deleted_at").
+			Where("activities.user_id = ? AND activities.deleted_at IS NOT NULL", userID),
+	}
+	for itemType, table := range map[string]string{TrashTypeNote: "notes", TrashTypeReminder: "reminders"} {
+		column := "content"
+		if table == "reminders" {
+			column = "message"
+		}
+		queries[itemType] = db.Table(table).
+			Select(fmt.Sprintf("%[1]s.id, %[1]s.%[2]s AS title, %[1]s.contact_id, contacts.firstname, contacts.lastname, %[1]s.deleted_at", table, column)).
+			Joins(fmt.Sprintf("LEFT JOIN contacts ON contacts.id = %s.contact_id", table)).
+			Where(fmt.Sprintf("%[1]s.user_id = ? AND %[1]s.deleted_at IS NOT NULL AND contacts.deleted_at IS NULL", table), userID)
+	}
+
+	items := []models.TrashItem{}
+	for _, itemType := range TrashTypes {
+		var rows []trashRow
+		if err := queries[itemType].Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to list deleted %ss: %w", itemType, err)
+		}
+		for _, row := range rows {
+			item := models.TrashItem{
+				Type:      itemType,
+				ID:        row.ID,
+				Title:     trashTitle(row.Title),
+				ContactID: row.ContactID,
+				DeletedAt: row.DeletedAt,
+			}
+			if itemType == TrashTypeContact {
+				item.Title = strings.TrimSpace(row.Title + " " + derefString(row.Lastname))
+			} else if row.Firstname != nil {
+				item.ContactName = strings.TrimSpace(*row.Firstname + " " + derefString(row.Lastname))
+			}
+			if retention > 0 {
+				purgeAt := row.DeletedAt.Add(retention)
+				item.PurgeAt = &purgeAt
+			}
+			items = append(items, item)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// trashTitle shortens long note texts to a single line
+func trashTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if runes := []rune(title); len(runes) > maxTrashTitleLength {
+		return string(runes[:maxTrashTitleLength]) + "…"
+	}
+	return title
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// RestoreTrashItem brings a soft-deleted item back and returns it. A contact comes back with the
+// notes, reminders and relationships that were deleted along with it; its activity links and
+// photo are kept while it is in the trash. Items that are not in the user's trash are reported
+// as gorm.ErrRecordNotFound.
+func RestoreTrashItem(db *gorm.DB, userID uint, itemType string, id uint) (any, error) {
+	var restored any
+	err := db.Transaction(func(tx *gorm.DB) error {
+		deleted := tx.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID)
+		switch itemType {
+		case TrashTypeContact:
+			var contact models.Contact
+			if err := deleted.First(&contact, id).Error; err != nil {
+				return err
+			}
+			// DeleteContact stamps the contact and everything deleted with it with the same time
+			for _, model := range []any{&models.Note{}, &models.Reminder{}, &models.Relationship{}} {
+				if err := tx.Unscoped().Model(model).
+					Where("user_id = ? AND contact_id = ? AND deleted_at = ?", userID, contact.ID, contact.DeletedAt.Time).
+					Update("deleted_at", nil).Error; err != nil {
+					return err
+				}
+			}
+			contact.DeletedAt = gorm.DeletedAt{}
+			if err := tx.Unscoped().Model(&contact).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			restored = contact
+		case TrashTypeNote:
+			var note models.Note
+			if err := deleted.First(&note, id).Error; err != nil {
+				return err
+			}
+			if err := requireLiveContact(tx, userID, note.ContactID); err != nil {
+				return err
+			}
+			note.DeletedAt = gorm.DeletedAt{}
+			if err := tx.Unscoped().Model(&note).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			restored = note
+		case TrashTypeReminder:
+			var reminder models.Reminder
+			if err := deleted.First(&reminder, id).Error; err != nil {
+				return err
+			}
+			if err := requireLiveContact(tx, userID, reminder.ContactID); err != nil {
+				return err
+			}
+			reminder.DeletedAt = gorm.DeletedAt{}
+			if err := tx.Unscoped().Model(&reminder).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			restored = reminder
+		case TrashTypeActivity:
+			var activity models.Activity
+			if err := deleted.First(&activity, id).Error; err != nil {
+				return err
+			}
+			activity.DeletedAt = gorm.DeletedAt{}
+			if err := tx.Unscoped().Model(&activity).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			restored = activity
+		default:
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// requireLiveContact checks that the contact a note or reminder belongs to is not in the trash
+func requireLiveContact(tx *gorm.DB, userID uint, contactID *uint) error {
+	if contactID == nil {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.Contact{}).Where("id = ? AND user_id = ?", *contactID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrTrashContactDeleted
+	}
+	return nil
+}
+
+// TrashPurgeMinInterval keeps instances sharing a database from purging the trash more than once
+// a day; it is a little under a day so that the daily schedule does not skip a run
+const TrashPurgeMinInterval = 23 * time.Hour
+
+// PurgeExpiredTrash permanently deletes what has been in the trash for longer than the configured
+// retention. Run by the scheduler under a job lock; errors are logged, as there is nobody to
+// return them to.
+func PurgeExpiredTrash(db *gorm.DB, cfg config.Config) {
+	err := runWithJobLock(db, models.JobNameTrashPurge, TrashPurgeMinInterval, func() error {
+		cutoff := time.Now().Add(-cfg.TrashRetention())
+		result, err := PurgeTrash(db, cfg.ProfilePhotoDir, cutoff)
+		if err != nil {
+			return err
+		}
+		if result.Contacts+result.Notes+result.Activities+result.Reminders > 0 {
+			logger.Info().
+				Int64("contacts", result.Contacts).
+				Int64("notes", result.Notes).
+				Int64("activities", result.Activities).
+				Int64("reminders", result.Reminders).
+				Msg("Purged trash")
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to purge trash")
+	}
+}
+
+// PurgeTrash permanently deletes the contacts, notes, activities and reminders of all users that
+// were deleted before cutoff. Contacts take everything linked to them along, and their photo
+// files are removed once the deletion is committed.
+func PurgeTrash(db *gorm.DB, photoDir string, cutoff time.Time) (models.TrashPurgeResult, error) {
+	var result models.TrashPurgeResult
+
+	for {
+		var contacts []models.Contact
+		if err := db.Unscoped().Select("id", "user_id", "photo", "photo_thumbnail", "sync_revision").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Order("id").Limit(trashPurgeBatchSize).Find(&contacts).Error; err != nil {
+			return result, err
+		}
+		if len(contacts) == 0 {
+			break
+		}
+		if err := purgeContacts(db, contacts); err != nil {
+			return result, err
+		}
+		for _, contact := range contacts {
+			removeContactPhotoFiles(photoDir, contact)
+		}
+		result.Contacts += int64(len(contacts))
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM activity_contacts WHERE activity_id IN
+			(SELECT id FROM activities WHERE deleted_at IS NOT NULL AND deleted_at < ?)`, cutoff).Error; err != nil {
+			return err
+		}
+		for _, target := range []struct {
+			model any
+			count *int64
+		}{
+			{&models.Activity{}, &result.Activities},
+			{&models.Note{}, &result.Notes},
+			{&models.Reminder{}, &result.Reminders},
+		} {
+			res := tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Delete(target.model)
+			if res.Error != nil {
+				return res.Error
+			}
+			*target.count = res.RowsAffected
+		}
+		return nil
+	})
+	return result, err
+}
+
+// purgeContacts hard-deletes contacts with their notes, reminders, completions, relationships and
+// activity links. Relationships of other contacts that pointed at them keep the name only.
+func purgeContacts(db *gorm.DB, contacts []models.Contact) error {
+	ids := make([]uint, len(contacts))
+	purgedRevisions := map[uint]int64{}
+	for i, contact := range contacts {
+		ids[i] = contact.ID
+		purgedRevisions[contact.UserID] = max(purgedRevisions[contact.UserID], contact.SyncRevision)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Relationship{}).Where("related_contact_id IN ?", ids).
+			Update("related_contact_id", nil).Error; err != nil {
+			return err
+		}
+		for _, model := range []any{&models.Relationship{}, &models.Note{}, &models.Reminder{}, &models.ReminderCompletion{}, &models.ReminderSnooze{}, &models.ContactVersion{}} {
+			if err := tx.Unscoped().Where("contact_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec("DELETE FROM activity_contacts WHERE contact_id IN ?", ids).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&models.Contact{}, ids).Error; err != nil {
+			return err
+		}
+
+		// The purged rows were CardDAV tombstones; older sync tokens would now miss these deletions
+		for userID, revision := range purgedRevisions {
+			if err := tx.Model(&models.CardDAVSync{}).
+				Where("user_id = ? AND purged_revision < ?", userID, revision).
+				Update("purged_revision", revision).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// removeContactPhotoFiles removes the profile photo file of a purged contact, and its thumbnail
+// from before thumbnails were stored inline as data URLs
+func removeContactPhotoFiles(photoDir string, contact models.Contact) {
+	if photoDir == "" {
+		return
+	}
+
+	files := []string{contact.Photo}
+	if !strings.HasPrefix(contact.PhotoThumbnail, "data:") {
+		files = append(files, contact.PhotoThumbnail)
+	}
+	for _, name := range files {
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(photoDir, name)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Warn().Err(err).Str("path", path).Msg("Failed to delete contact photo")
+		} else if err == nil {
+			logger.Debug().Str("path", path).Msg("Deleted contact photo")
+		}
+	}
+}
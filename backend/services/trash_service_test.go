@@ -0,0 +1,195 @@
+package services
+
+import (
+	"meerkat/config"
+	"meerkat/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// trashContact deletes a contact the way DeleteContact does: its notes, reminders and
+// relationships go with it at the same time
+func trashContact(t *testing.T, db *gorm.DB, contact *models.Contact, at time.Time) {
+	tx := db.Session(&gorm.Session{NowFunc: func() time.Time { return at }})
+	for _, model := range []any{&models.Note{}, &models.Reminder{}, &models.Relationship{}} {
+		require.NoError(t, tx.Where("contact_id = ?", contact.ID).Delete(model).Error)
+	}
+	require.NoError(t, tx.Delete(contact).Error)
+}
+
+func TestTrashListAndRestore(t *testing.T) {
+	db, _ := setupRouter()
+	userID := uint(1)
+
+	alice := models.Contact{UserID: userID, Firstname: "Alice", Lastname: "Liddell"}
+	bob := models.Contact{UserID: userID, Firstname: "Bob"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+	aliceID, bobID := alice.ID, bob.ID
+
+	earlier := models.Note{UserID: userID, Content: "Deleted on its own", Date: time.Now(), ContactID: &aliceID}
+	cascaded := models.Note{UserID: userID, Content: "Deleted with Alice", Date: time.Now(), ContactID: &aliceID}
+	bobsNote := models.Note{UserID: userID, Content: "Likes   tea\nand cake", Date: time.Now(), ContactID: &bobID}
+	reminder := models.Reminder{UserID: userID, Message: "Call Alice", RemindAt: time.Now(), Recurrence: "once", ContactID: &aliceID}
+	activity := models.Activity{UserID: userID, Title: "Picnic", Date: time.Now(), Contacts: []models.Contact{alice, bob}}
+	for _, record := range []any{&earlier, &cascaded, &bobsNote, &reminder} {
+		require.NoError(t, db.Create(record).Error)
+	}
+	require.NoError(t, db.Omit("Contacts.*").Create(&activity).Error)
+
+	require.NoError(t, db.Delete(&earlier).Error)
+	require.NoError(t, db.Delete(&bobsNote).Error)
+	require.NoError(t, db.Delete(&activity).Error)
+	trashContact(t, db, &alice, time.Now().Add(time.Second))
+
+	items, err := ListTrash(db, userID, 30*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, items, 3, "notes and reminders of a deleted contact are part of its entry")
+	assert.Equal(t, TrashTypeContact, items[0].Type)
+	assert.Equal(t, "Alice Liddell", items[0].Title)
+	require.NotNil(t, items[0].PurgeAt)
+	assert.WithinDuration(t, items[0].DeletedAt.Add(30*24*time.Hour), *items[0].PurgeAt, time.Second)
+	byType := map[string]models.TrashItem{}
+	for _, item := range items {
+		byType[item.Type] = item
+	}
+	assert.Equal(t, "Likes tea and cake", byType[TrashTypeNote].Title)
+	assert.Equal(t, "Bob", byType[TrashTypeNote].ContactName)
+	assert.Equal(t, "Picnic", byType[TrashTypeActivity].Title)
+
+	// A note cannot come back without its contact
+	_, err = RestoreTrashItem(db, userID, TrashTypeNote, earlier.ID)
+	assert.ErrorIs(t, err, ErrTrashContactDeleted)
+	_, err = RestoreTrashItem(db, userID+1, TrashTypeContact, aliceID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = RestoreTrashItem(db, userID, TrashTypeContact, bobID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "live contacts are not in the trash")
+
+	// The contact comes back with what was deleted along with it, but not what was deleted before
+	restored, err := RestoreTrashItem(db, userID, TrashTypeContact, aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", restored.(models.Contact).Firstname)
+	var notes []models.Note
+	require.NoError(t, db.Where("contact_id = ?", aliceID).Find(&notes).Error)
+	require.Len(t, notes, 1)
+	assert.Equal(t, cascaded.ID, notes[0].ID)
+	var count int64
+	db.Model(&models.Reminder{}).Where("contact_id = ?", aliceID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	_, err = RestoreTrashItem(db, userID, TrashTypeNote, earlier.ID)
+	require.NoError(t, err)
+	_, err = RestoreTrashItem(db, userID, TrashTypeActivity, activity.ID)
+	require.NoError(t, err)
+	var picnic models.Activity
+	require.NoError(t, db.Preload("Contacts").First(&picnic, activity.ID).Error)
+	assert.Len(t, picnic.Contacts, 2, "activity links survive the trash")
+
+	items, err = ListTrash(db, userID, 0)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Nil(t, items[0].PurgeAt)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db, _ := setupRouter()
+	require.NoError(t, db.AutoMigrate(&models.ReminderCompletion{}))
+	userID := uint(1)
+	photoDir := t.TempDir()
+	now := time.Now()
+	cutoff := now.Add(-30 * 24 * time.Hour)
+
+	old := models.Contact{UserID: userID, Firstname: "Old", Photo: "old.jpg", PhotoThumbnail: "data:image/jpeg;base64,AA"}
+	recent := models.Contact{UserID: userID, Firstname: "Recent", Photo: "recent.jpg"}
+	friend := models.Contact{UserID: userID, Firstname: "Friend"}
+	for _, contact := range []*models.Contact{&old, &recent, &friend} {
+		require.NoError(t, db.Create(contact).Error)
+		if contact.Photo != "" {
+			require.NoError(t, os.WriteFile(filepath.Join(photoDir, contact.Photo), []byte("jpeg"), 0644))
+		}
+	}
+	oldID, friendID := old.ID, friend.ID
+	require.NoError(t, db.Create(&models.Note{UserID: userID, Content: "About Old", Date: now, ContactID: &oldID}).Error)
+	require.NoError(t, db.Create(&models.ReminderCompletion{UserID: userID, ContactID: oldID, Message: "Called", CompletedAt: now}).Error)
+	require.NoError(t, db.Create(&models.Relationship{UserID: userID, Name: "Old", Type: "Friend", ContactID: friendID, RelatedContactID: &oldID}).Error)
+	activity := models.Activity{UserID: userID, Title: "Walk", Date: now, Contacts: []models.Contact{old, friend}}
+	require.NoError(t, db.Omit("Contacts.*").Create(&activity).Error)
+	expiredNote := models.Note{UserID: userID, Content: "Expired", Date: now, ContactID: &friendID}
+	require.NoError(t, db.Create(&expiredNote).Error)
+
+	trashContact(t, db, &old, cutoff.Add(-time.Hour))
+	trashContact(t, db, &recent, now)
+	require.NoError(t, db.Session(&gorm.Session{NowFunc: func() time.Time { return cutoff.Add(-time.Minute) }}).Delete(&expiredNote).Error)
+
+	result, err := PurgeTrash(db, photoDir, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, models.TrashPurgeResult{Contacts: 1, Notes: 1}, result, "notes of purged contacts are counted with them")
+
+	var count int64
+	db.Unscoped().Model(&models.Contact{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+	db.Unscoped().Model(&models.Note{}).Count(&count)
+	assert.Zero(t, count)
+	db.Model(&models.ReminderCompletion{}).Count(&count)
+	assert.Zero(t, count)
+	db.Table("activity_contacts").Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	var rel models.Relationship
+	require.NoError(t, db.First(&rel).Error)
+	assert.Nil(t, rel.RelatedContactID, "relationships to a purged contact keep the name only")
+	assert.Equal(t, "Old", rel.Name)
+
+	_, err = os.Stat(filepath.Join(photoDir, "old.jpg"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(photoDir, "recent.jpg"))
+	assert.NoError(t, err)
+
+	// Sync tokens from before the purged tombstone are no longer honoured
+	var sync models.CardDAVSync
+	require.NoError(t, db.Where("user_id = ?", userID).First(&sync).Error)
+	assert.Greater(t, sync.PurgedRevision, int64(0))
+	valid, err := models.ValidCardDAVSyncRevision(db, userID, sync.PurgedRevision-1, sync.Revision)
+	require.NoError(t, err)
+	assert.False(t, valid)
+	valid, err = models.ValidCardDAVSyncRevision(db, userID, sync.PurgedRevision, sync.Revision)
+	require.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestPurgeExpiredTrashRunsOncePerDay(t *testing.T) {
+	db, _ := setupRouter()
+	require.NoError(t, db.AutoMigrate(&models.ReminderCompletion{}))
+	cfg := config.Config{TrashRetentionDays: 30, ProfilePhotoDir: t.TempDir()}
+	expired := func(name string) models.Contact {
+		contact := models.Contact{UserID: 1, Firstname: name}
+		require.NoError(t, db.Create(&contact).Error)
+		trashContact(t, db, &contact, time.Now().AddDate(0, 0, -31))
+		return contact
+	}
+	exists := func(contact models.Contact) bool {
+		var count int64
+		require.NoError(t, db.Unscoped().Model(&models.Contact{}).Where("id = ?", contact.ID).Count(&count).Error)
+		return count > 0
+	}
+
+	first := expired("First")
+	PurgeExpiredTrash(db, cfg)
+	assert.False(t, exists(first))
+
+	// Another instance's run on the same day leaves the trash alone
+	second := expired("Second")
+	PurgeExpiredTrash(db, cfg)
+	assert.True(t, exists(second))
+
+	require.NoError(t, db.Model(&models.JobExecution{}).Where("job_name = ?", models.JobNameTrashPurge).
+		Update("last_run_at", time.Now().Add(-TrashPurgeMinInterval)).Error)
+	PurgeExpiredTrash(db, cfg)
+	assert.False(t, exists(second))
+}
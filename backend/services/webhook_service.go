@@ -65,6 +65,13 @@ func isPrivateURL(rawURL string) bool {
 	return false
 }
 
+// URLBlocked reports whether WEBHOOK_BLOCK_PRIVATE_URLS refuses outgoing requests to the URL. It
+// applies to every URL a user can make the server call: webhooks, notification channels and
+// CardDAV remotes.
+func URLBlocked(cfg config.Config, rawURL string) bool {
+	return cfg.WebhookBlockPrivateURLs && isPrivateURL(rawURL)
+}
+
 // TriggerWebhooks fires webhooks for all active subscriptions matching eventType for the user.
 // Runs each delivery in its own goroutine (non-blocking).
 func TriggerWebhooks(db *gorm.DB, cfg config.Config, userID uint, eventType string, data interface{}) {